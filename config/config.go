@@ -13,6 +13,9 @@ type (
 		App  `yaml:"app"`
 		HTTP `yaml:"http"`
 		PG
+		SMTP
+		Payment
+		Invoice
 	}
 
 	App struct {
@@ -35,6 +38,35 @@ type (
 		SSLMODE  string `env:"POSTGRES_SSLMODE"`
 		TIMEZONE string `env:"POSTGRES_TIMEZONE"`
 	}
+
+	// SMTP -.
+	SMTP struct {
+		HOST     string `env:"SMTP_HOST"`
+		PORT     string `env:"SMTP_PORT"`
+		USER     string `env:"SMTP_USER"`
+		PASSWORD string `env:"SMTP_PASSWORD"`
+		FROM     string `env:"SMTP_FROM"`
+	}
+
+	// Invoice -.
+	Invoice struct {
+		SELLER_NAME          string `env:"INVOICE_SELLER_NAME" env-default:"SMS Panel"`
+		SELLER_ECONOMIC_CODE string `env:"INVOICE_SELLER_ECONOMIC_CODE"`
+		SELLER_NATIONAL_ID   string `env:"INVOICE_SELLER_NATIONAL_ID"`
+		SELLER_ADDRESS       string `env:"INVOICE_SELLER_ADDRESS"`
+		SELLER_POSTAL_CODE   string `env:"INVOICE_SELLER_POSTAL_CODE"`
+		SELLER_PHONE         string `env:"INVOICE_SELLER_PHONE"`
+	}
+
+	// Payment -.
+	Payment struct {
+		GATEWAY      string `env:"PAYMENT_GATEWAY" env-default:"zarinpal"`
+		MERCHANT_ID  string `env:"PAYMENT_MERCHANT_ID"`
+		CALLBACK_URL string `env:"PAYMENT_CALLBACK_URL" env-default:"http://localhost:8080/accounts/payment/verify"`
+		API_URL      string `env:"PAYMENT_API_URL"`
+		GATE_URL     string `env:"PAYMENT_GATE_URL"`
+		SANDBOX      bool   `env:"PAYMENT_SANDBOX" env-default:"true"`
+	}
 )
 
 // NewConfig returns app config.
@@ -69,11 +69,11 @@ INSERT INTO public.schema_migrations (version, dirty) VALUES (10, false);
 -- Data for Name: sender_numbers; Type: TABLE DATA; Schema: public; Owner: postgres
 --
 
-INSERT INTO public.sender_numbers (id, number, is_exclusive, is_default) VALUES (2, '09141234567', false, true);
-INSERT INTO public.sender_numbers (id, number, is_exclusive, is_default) VALUES (1, '09121234567', false, true);
-INSERT INTO public.sender_numbers (id, number, is_exclusive, is_default) VALUES (4, '09161234567', false, false);
-INSERT INTO public.sender_numbers (id, number, is_exclusive, is_default) VALUES (3, '09151234567', false, false);
-INSERT INTO public.sender_numbers (id, number, is_exclusive, is_default) VALUES (5, '09191234567', false, false);
+INSERT INTO public.sender_numbers (id, number, is_exclusive, is_default, type) VALUES (2, '09141234567', false, true, 'default');
+INSERT INTO public.sender_numbers (id, number, is_exclusive, is_default, type) VALUES (1, '09121234567', false, true, 'default');
+INSERT INTO public.sender_numbers (id, number, is_exclusive, is_default, type) VALUES (4, '09161234567', false, false, 'exclusive');
+INSERT INTO public.sender_numbers (id, number, is_exclusive, is_default, type) VALUES (3, '09151234567', false, false, 'exclusive');
+INSERT INTO public.sender_numbers (id, number, is_exclusive, is_default, type) VALUES (5, '09191234567', false, false, 'exclusive');
 
 
 --
@@ -98,8 +98,9 @@ INSERT INTO public.sms_messages (id, sender, recipient, message, schedule, deliv
 -- Data for Name: subscription_number_package; Type: TABLE DATA; Schema: public; Owner: postgres
 --
 
-INSERT INTO public.subscription_number_package (id, title, price) VALUES (1, '1 Month', 20);
-INSERT INTO public.subscription_number_package (id, title, price) VALUES (2, '2 Month', 30);
+INSERT INTO public.subscription_number_package (id, title, price, type, duration, duration_unit) VALUES (1, '1 Month', 20, 'rent', 1, 'month');
+INSERT INTO public.subscription_number_package (id, title, price, type, duration, duration_unit) VALUES (2, '2 Month', 30, 'rent', 2, 'month');
+INSERT INTO public.subscription_number_package (id, title, price, type, duration, duration_unit) VALUES (3, 'Buy', 300, 'buy', 0, 'month');
 
 
 --
@@ -170,7 +171,7 @@ SELECT pg_catalog.setval('public.sms_messages_id_seq', 18, true);
 -- Name: subscription_number_package_id_seq; Type: SEQUENCE SET; Schema: public; Owner: postgres
 --
 
-SELECT pg_catalog.setval('public.subscription_number_package_id_seq', 2, true);
+SELECT pg_catalog.setval('public.subscription_number_package_id_seq', 3, true);
 
 
 --
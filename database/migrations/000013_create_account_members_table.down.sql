@@ -0,0 +1,2 @@
+ALTER TABLE sms_messages DROP COLUMN member_id;
+DROP TABLE account_members;
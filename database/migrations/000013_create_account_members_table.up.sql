@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS account_members (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL,
+    member_id INT NOT NULL UNIQUE,
+    role VARCHAR(55) NOT NULL,
+    spending_limit BIGINT NOT NULL DEFAULT 0,
+    spent BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT current_timestamp,
+    FOREIGN KEY (account_id) REFERENCES accounts(id),
+    FOREIGN KEY (member_id) REFERENCES accounts(id)
+);
+
+ALTER TABLE sms_messages
+ADD COLUMN member_id INT REFERENCES accounts (id);
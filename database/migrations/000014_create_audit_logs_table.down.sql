@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS audit_logs_immutable ON audit_logs;
+DROP FUNCTION IF EXISTS reject_audit_log_change();
+DROP TABLE audit_logs;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id SERIAL PRIMARY KEY,
+    actor_id INT NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    target VARCHAR(255),
+    before TEXT,
+    after TEXT,
+    ip VARCHAR(100),
+    created_at TIMESTAMP DEFAULT current_timestamp,
+    FOREIGN KEY (actor_id) REFERENCES accounts(id)
+);
+CREATE INDEX idx_audit_logs_actor_id ON audit_logs (actor_id);
+CREATE INDEX idx_audit_logs_action ON audit_logs (action);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs (created_at);
+
+-- audit logs are append only
+CREATE OR REPLACE FUNCTION reject_audit_log_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit logs can''t be changed';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_logs_immutable
+BEFORE UPDATE OR DELETE ON audit_logs
+FOR EACH ROW EXECUTE FUNCTION reject_audit_log_change();
@@ -0,0 +1,5 @@
+DROP TABLE login_challenges;
+DROP TABLE recovery_codes;
+ALTER TABLE accounts
+DROP COLUMN two_factor_method,
+DROP COLUMN totp_secret;
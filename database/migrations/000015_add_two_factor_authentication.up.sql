@@ -0,0 +1,26 @@
+ALTER TABLE accounts
+ADD COLUMN two_factor_method VARCHAR(10) NOT NULL DEFAULT '',
+ADD COLUMN totp_secret VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    used_at TIMESTAMP,
+    FOREIGN KEY (account_id) REFERENCES accounts(id)
+);
+CREATE INDEX idx_recovery_codes_account_id ON recovery_codes (account_id);
+
+CREATE TABLE IF NOT EXISTS login_challenges (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL,
+    token VARCHAR(255) NOT NULL UNIQUE,
+    method VARCHAR(10) NOT NULL,
+    code_hash VARCHAR(255),
+    for_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT current_timestamp,
+    FOREIGN KEY (account_id) REFERENCES accounts(id)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS otp_codes (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL,
+    token VARCHAR(255) NOT NULL UNIQUE,
+    sender_number VARCHAR(255) NOT NULL,
+    recipient VARCHAR(255) NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    verified_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT current_timestamp,
+    FOREIGN KEY (account_id) REFERENCES accounts(id)
+);
+CREATE INDEX idx_otp_codes_account_id ON otp_codes (account_id);
@@ -0,0 +1,6 @@
+DROP TABLE verification_tokens;
+ALTER TABLE accounts
+DROP COLUMN pending_verification;
+ALTER TABLE users
+DROP COLUMN phone_verified_at,
+DROP COLUMN email_verified_at;
@@ -0,0 +1,21 @@
+ALTER TABLE accounts
+ADD COLUMN pending_verification BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE users
+ADD COLUMN phone_verified_at TIMESTAMP,
+ADD COLUMN email_verified_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS verification_tokens (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL,
+    purpose VARCHAR(50) NOT NULL,
+    channel VARCHAR(10) NOT NULL,
+    token_hash VARCHAR(255) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT current_timestamp,
+    FOREIGN KEY (account_id) REFERENCES accounts(id)
+);
+CREATE INDEX idx_verification_tokens_account_id ON verification_tokens (account_id);
+CREATE INDEX idx_verification_tokens_token_hash ON verification_tokens (token_hash);
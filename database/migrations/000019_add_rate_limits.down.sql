@@ -0,0 +1,4 @@
+DROP TABLE api_keys;
+ALTER TABLE accounts
+DROP COLUMN pricing_plan_id;
+DROP TABLE pricing_plans;
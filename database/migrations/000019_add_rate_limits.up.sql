@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS pricing_plans (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    requests_per_second DOUBLE PRECISION NOT NULL,
+    messages_per_minute INT NOT NULL,
+    created_at TIMESTAMP DEFAULT current_timestamp
+);
+
+INSERT INTO pricing_plans (name, is_default, requests_per_second, messages_per_minute)
+VALUES ('default', TRUE, 10, 600);
+
+ALTER TABLE accounts
+ADD COLUMN pricing_plan_id INT REFERENCES pricing_plans(id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(20) NOT NULL,
+    key_hash VARCHAR(255) NOT NULL UNIQUE,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT current_timestamp,
+    FOREIGN KEY (account_id) REFERENCES accounts(id)
+);
+CREATE INDEX idx_api_keys_account_id ON api_keys (account_id);
@@ -0,0 +1,6 @@
+DROP INDEX idx_transactions_authority;
+
+ALTER TABLE transactions
+DROP COLUMN ref_id,
+DROP COLUMN card_hash,
+DROP COLUMN verified_at;
@@ -0,0 +1,13 @@
+ALTER TABLE transactions
+ADD COLUMN ref_id VARCHAR(255),
+ADD COLUMN card_hash VARCHAR(255),
+ADD COLUMN verified_at TIMESTAMP;
+
+CREATE INDEX idx_transactions_authority ON transactions (authority);
+
+-- transactions were created with the user ID of the account
+UPDATE transactions
+SET account_id = accounts.id
+FROM accounts
+WHERE accounts.user_id = transactions.account_id
+AND (SELECT COUNT(*) FROM accounts a WHERE a.user_id = transactions.account_id) = 1;
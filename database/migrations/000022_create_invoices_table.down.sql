@@ -0,0 +1,7 @@
+DROP TABLE invoices;
+
+ALTER TABLE users
+DROP COLUMN company_name,
+DROP COLUMN economic_code,
+DROP COLUMN address,
+DROP COLUMN postal_code;
@@ -0,0 +1,46 @@
+ALTER TABLE users
+ADD COLUMN company_name VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN economic_code VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN address VARCHAR(1000) NOT NULL DEFAULT '',
+ADD COLUMN postal_code VARCHAR(20) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id SERIAL PRIMARY KEY,
+    number VARCHAR(50) NOT NULL UNIQUE,
+    account_id INT NOT NULL REFERENCES accounts(id),
+    transaction_id INT NOT NULL UNIQUE REFERENCES transactions(id),
+    subtotal BIGINT NOT NULL,
+    vat_percent INT NOT NULL,
+    vat BIGINT NOT NULL,
+    total BIGINT NOT NULL,
+    buyer_name VARCHAR(255),
+    buyer_company VARCHAR(255),
+    buyer_national_id VARCHAR(255),
+    buyer_economic_code VARCHAR(255),
+    buyer_address VARCHAR(1000),
+    buyer_postal_code VARCHAR(20),
+    buyer_phone VARCHAR(255),
+    buyer_email VARCHAR(255),
+    issued_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_invoices_account_id ON invoices (account_id);
+CREATE INDEX idx_invoices_issued_at ON invoices (issued_at);
+
+-- invoices of the top-ups which are done before, with the default VAT
+INSERT INTO invoices (
+    number, account_id, transaction_id, subtotal, vat_percent, vat, total,
+    buyer_name, buyer_company, buyer_national_id, buyer_economic_code,
+    buyer_address, buyer_postal_code, buyer_phone, buyer_email, issued_at, created_at
+)
+SELECT
+    'TMP-' || t.id, t.account_id, t.id, t.amount - t.amount * 10 / 110, 10, t.amount * 10 / 110, t.amount,
+    u.first_name || ' ' || u.last_name, '', u.national_id, '',
+    '', '', u.phone, u.email, COALESCE(t.verified_at, t.created_at), NOW()
+FROM transactions t
+JOIN accounts a ON a.id = t.account_id
+JOIN users u ON u.id = a.user_id
+WHERE t.status = 'Okay'
+ORDER BY t.id;
+
+UPDATE invoices SET number = 'INV-' || LPAD(id::text, 6, '0');
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS promo_credits (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL REFERENCES accounts(id),
+    amount BIGINT NOT NULL,
+    remaining BIGINT NOT NULL,
+    reason VARCHAR(1000),
+    actor_id INT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_promo_credits_account_id ON promo_credits (account_id);
+CREATE INDEX idx_promo_credits_expires_at ON promo_credits (expires_at);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL REFERENCES accounts(id),
+    kind VARCHAR(20) NOT NULL,
+    amount BIGINT NOT NULL,
+    reason VARCHAR(1000),
+    actor_id INT NOT NULL DEFAULT 0,
+    transaction_id INT REFERENCES transactions(id),
+    promo_credit_id INT REFERENCES promo_credits(id),
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_ledger_entries_account_id ON ledger_entries (account_id);
+CREATE INDEX idx_ledger_entries_created_at ON ledger_entries (created_at);
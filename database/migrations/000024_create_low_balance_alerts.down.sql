@@ -0,0 +1 @@
+DROP TABLE low_balance_alerts;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS low_balance_alerts (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL UNIQUE REFERENCES accounts(id),
+    threshold BIGINT NOT NULL,
+    notify_sms BOOLEAN NOT NULL DEFAULT FALSE,
+    notify_email BOOLEAN NOT NULL DEFAULT FALSE,
+    webhook_url VARCHAR(1000),
+    auto_top_up_amount BIGINT NOT NULL DEFAULT 0,
+    triggered BOOLEAN NOT NULL DEFAULT FALSE,
+    last_triggered_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP TABLE bills;
+
+ALTER TABLE accounts
+DROP COLUMN credit_limit,
+DROP COLUMN suspended_at;
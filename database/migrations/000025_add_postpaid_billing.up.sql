@@ -0,0 +1,18 @@
+ALTER TABLE accounts
+ADD COLUMN credit_limit BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN suspended_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS bills (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL REFERENCES accounts(id),
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    usage BIGINT NOT NULL,
+    amount BIGINT NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    due_at TIMESTAMP NOT NULL,
+    paid_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE UNIQUE INDEX idx_bills_account_period ON bills (account_id, period_start);
+CREATE INDEX idx_bills_status ON bills (status);
@@ -0,0 +1,7 @@
+DROP TABLE price_surcharges;
+DROP TABLE price_rates;
+DROP TABLE price_tiers;
+
+ALTER TABLE pricing_plans
+DROP COLUMN single_price,
+DROP COLUMN group_price;
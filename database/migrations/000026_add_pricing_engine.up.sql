@@ -0,0 +1,28 @@
+ALTER TABLE pricing_plans
+ADD COLUMN single_price BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN group_price BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS price_tiers (
+    id SERIAL PRIMARY KEY,
+    pricing_plan_id INT NOT NULL REFERENCES pricing_plans(id) ON DELETE CASCADE,
+    min_messages INT NOT NULL,
+    discount_percent INT NOT NULL
+);
+CREATE UNIQUE INDEX idx_price_tiers_plan_min ON price_tiers (pricing_plan_id, min_messages);
+
+CREATE TABLE IF NOT EXISTS price_rates (
+    id SERIAL PRIMARY KEY,
+    pricing_plan_id INT NOT NULL REFERENCES pricing_plans(id) ON DELETE CASCADE,
+    prefix VARCHAR(20) NOT NULL,
+    name VARCHAR(255),
+    price BIGINT NOT NULL
+);
+CREATE UNIQUE INDEX idx_price_rates_plan_prefix ON price_rates (pricing_plan_id, prefix);
+
+CREATE TABLE IF NOT EXISTS price_surcharges (
+    id SERIAL PRIMARY KEY,
+    pricing_plan_id INT NOT NULL REFERENCES pricing_plans(id) ON DELETE CASCADE,
+    sender_type VARCHAR(20) NOT NULL,
+    amount BIGINT NOT NULL
+);
+CREATE UNIQUE INDEX idx_price_surcharges_plan_type ON price_surcharges (pricing_plan_id, sender_type);
@@ -0,0 +1,8 @@
+ALTER TABLE sms_messages
+DROP COLUMN operator_id;
+
+ALTER TABLE phone_book_numbers
+DROP COLUMN operator_id;
+
+DROP TABLE operator_prefixes;
+DROP TABLE operators;
@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS operators (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    provider VARCHAR(100) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS operator_prefixes (
+    id SERIAL PRIMARY KEY,
+    operator_id INT NOT NULL REFERENCES operators(id) ON DELETE CASCADE,
+    prefix VARCHAR(20) UNIQUE NOT NULL
+);
+CREATE INDEX idx_operator_prefixes_operator_id ON operator_prefixes (operator_id);
+
+ALTER TABLE phone_book_numbers
+ADD COLUMN operator_id INT REFERENCES operators(id) ON DELETE SET NULL;
+
+ALTER TABLE sms_messages
+ADD COLUMN operator_id INT REFERENCES operators(id) ON DELETE SET NULL;
+CREATE INDEX idx_sms_messages_operator_id ON sms_messages (operator_id);
+
+INSERT INTO operators (name, provider) VALUES
+    ('MCI', 'default'),
+    ('Irancell', 'default'),
+    ('Rightel', 'default');
+
+INSERT INTO operator_prefixes (operator_id, prefix)
+SELECT operators.id, prefixes.prefix
+FROM operators
+JOIN (VALUES
+    ('MCI', '98910'), ('MCI', '98911'), ('MCI', '98912'), ('MCI', '98913'), ('MCI', '98914'),
+    ('MCI', '98915'), ('MCI', '98916'), ('MCI', '98917'), ('MCI', '98918'), ('MCI', '98919'),
+    ('MCI', '98990'), ('MCI', '98991'), ('MCI', '98992'), ('MCI', '98993'), ('MCI', '98994'),
+    ('Irancell', '98900'), ('Irancell', '98901'), ('Irancell', '98902'), ('Irancell', '98903'),
+    ('Irancell', '98904'), ('Irancell', '98905'), ('Irancell', '98930'), ('Irancell', '98933'),
+    ('Irancell', '98935'), ('Irancell', '98936'), ('Irancell', '98937'), ('Irancell', '98938'),
+    ('Irancell', '98939'), ('Irancell', '98941'),
+    ('Rightel', '98920'), ('Rightel', '98921'), ('Rightel', '98922')
+) AS prefixes (operator, prefix) ON prefixes.operator = operators.name;
+
+UPDATE phone_book_numbers
+SET operator_id = operator_prefixes.operator_id
+FROM operator_prefixes
+WHERE '98' || SUBSTRING(phone_book_numbers.phone FROM 2) LIKE operator_prefixes.prefix || '%'
+    AND phone_book_numbers.phone LIKE '09%';
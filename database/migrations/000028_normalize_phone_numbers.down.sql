@@ -0,0 +1,15 @@
+UPDATE users
+SET phone = '0' || SUBSTRING(phone FROM 4)
+WHERE phone ~ '^\+989[0-9]{9}$';
+
+UPDATE phone_book_numbers
+SET phone = '0' || SUBSTRING(phone FROM 4)
+WHERE phone ~ '^\+989[0-9]{9}$';
+
+UPDATE sms_messages
+SET recipient = '0' || SUBSTRING(recipient FROM 4)
+WHERE recipient ~ '^\+989[0-9]{9}$';
+
+UPDATE otp_codes
+SET recipient = '0' || SUBSTRING(recipient FROM 4)
+WHERE recipient ~ '^\+989[0-9]{9}$';
@@ -0,0 +1,25 @@
+-- phone numbers are stored in the E.164 format, e.g. +989121234567
+CREATE FUNCTION pg_temp.normalize_phone(phone TEXT) RETURNS TEXT AS $$
+    SELECT CASE
+        WHEN p ~ '^\+[0-9]+$' THEN p
+        WHEN p ~ '^00[0-9]+$' THEN '+' || SUBSTRING(p FROM 3)
+        WHEN p ~ '^09[0-9]{9}$' THEN '+98' || SUBSTRING(p FROM 2)
+        WHEN p ~ '^9[0-9]{9}$' THEN '+98' || p
+        WHEN p ~ '^989[0-9]{9}$' THEN '+' || p
+        ELSE phone
+    END
+    FROM (SELECT REGEXP_REPLACE(phone, '[ ()./-]', '', 'g') AS p) AS stripped
+$$ LANGUAGE SQL IMMUTABLE;
+
+UPDATE users
+SET phone = pg_temp.normalize_phone(phone);
+
+UPDATE phone_book_numbers
+SET phone = pg_temp.normalize_phone(phone),
+    prefix = CASE WHEN pg_temp.normalize_phone(phone) LIKE '+98%' THEN '+98' ELSE prefix END;
+
+UPDATE sms_messages
+SET recipient = pg_temp.normalize_phone(recipient);
+
+UPDATE otp_codes
+SET recipient = pg_temp.normalize_phone(recipient);
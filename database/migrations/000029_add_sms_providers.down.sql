@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS provider_routes;
+DROP TABLE IF EXISTS sms_providers;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS sms_providers (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    price BIGINT NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS provider_routes (
+    id SERIAL PRIMARY KEY,
+    operator_id INT REFERENCES operators(id) ON DELETE CASCADE,
+    provider_id INT NOT NULL REFERENCES sms_providers(id) ON DELETE CASCADE,
+    position INT NOT NULL
+);
+CREATE INDEX idx_provider_routes_operator_id ON provider_routes (operator_id);
+CREATE INDEX idx_provider_routes_provider_id ON provider_routes (provider_id);
+CREATE UNIQUE INDEX idx_provider_routes_operator_provider ON provider_routes (COALESCE(operator_id, 0), provider_id);
+
+INSERT INTO sms_providers (name) VALUES ('default');
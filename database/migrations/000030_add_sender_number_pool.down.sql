@@ -0,0 +1,6 @@
+ALTER TABLE sender_numbers
+DROP COLUMN IF EXISTS type,
+DROP COLUMN IF EXISTS rent_price,
+DROP COLUMN IF EXISTS buy_price,
+DROP COLUMN IF EXISTS provider_id,
+DROP COLUMN IF EXISTS retired_at;
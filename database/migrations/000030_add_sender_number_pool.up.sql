@@ -0,0 +1,10 @@
+ALTER TABLE sender_numbers
+ADD COLUMN type VARCHAR(20) NOT NULL DEFAULT 'exclusive',
+ADD COLUMN rent_price BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN buy_price BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN provider_id INT REFERENCES sms_providers(id) ON DELETE SET NULL,
+ADD COLUMN retired_at TIMESTAMP;
+
+UPDATE sender_numbers
+SET type = 'default'
+WHERE is_default;
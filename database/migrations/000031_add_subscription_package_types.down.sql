@@ -0,0 +1,8 @@
+ALTER TABLE user_numbers
+DROP COLUMN IF EXISTS type;
+
+ALTER TABLE subscription_number_package
+DROP COLUMN IF EXISTS type,
+DROP COLUMN IF EXISTS duration,
+DROP COLUMN IF EXISTS duration_unit,
+DROP COLUMN IF EXISTS is_active;
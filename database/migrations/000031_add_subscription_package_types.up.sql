@@ -0,0 +1,26 @@
+ALTER TABLE subscription_number_package
+ADD COLUMN type VARCHAR(10) NOT NULL DEFAULT 'rent',
+ADD COLUMN duration INT NOT NULL DEFAULT 0,
+ADD COLUMN duration_unit VARCHAR(10) NOT NULL DEFAULT 'month',
+ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- the buy package had the id 666, the rent packages had their months in their title
+UPDATE subscription_number_package
+SET type = 'buy'
+WHERE id = 666;
+
+UPDATE subscription_number_package
+SET duration = CAST(SUBSTRING(title FROM '^([0-9]+) Month') AS INT)
+WHERE type = 'rent' AND title ~ '^[0-9]+ Month';
+
+ALTER TABLE user_numbers
+ADD COLUMN type VARCHAR(10) NOT NULL DEFAULT 'rent';
+
+UPDATE user_numbers
+SET type = 'buy'
+WHERE subscription_package_id IN (SELECT id FROM subscription_number_package WHERE type = 'buy');
+
+-- rent packages without their months in their title have no duration, they can't be rented until an admin sets it
+UPDATE subscription_number_package
+SET is_active = FALSE
+WHERE type = 'rent' AND duration <= 0;
@@ -0,0 +1,4 @@
+ALTER TABLE user_numbers
+DROP COLUMN auto_renew,
+DROP COLUMN reminded_at,
+DROP COLUMN renewal_failed_at;
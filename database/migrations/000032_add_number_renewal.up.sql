@@ -0,0 +1,4 @@
+ALTER TABLE user_numbers
+ADD COLUMN auto_renew BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN reminded_at TIMESTAMP,
+ADD COLUMN renewal_failed_at TIMESTAMP;
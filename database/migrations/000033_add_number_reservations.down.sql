@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS number_waitlists;
+DROP TABLE IF EXISTS number_reservations;
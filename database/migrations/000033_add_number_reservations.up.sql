@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS number_reservations (
+    id SERIAL PRIMARY KEY,
+    number_id INT NOT NULL UNIQUE REFERENCES sender_numbers(id) ON DELETE CASCADE,
+    account_id INT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_number_reservations_account_id ON number_reservations (account_id);
+
+CREATE TABLE IF NOT EXISTS number_waitlists (
+    id SERIAL PRIMARY KEY,
+    number_id INT NOT NULL REFERENCES sender_numbers(id) ON DELETE CASCADE,
+    account_id INT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT idx_number_waitlist UNIQUE (number_id, account_id)
+);
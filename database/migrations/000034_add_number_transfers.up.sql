@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS number_transfers (
+    id SERIAL PRIMARY KEY,
+    user_number_id INT NOT NULL,
+    number_id INT NOT NULL REFERENCES sender_numbers(id) ON DELETE CASCADE,
+    from_account_id INT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    to_account_id INT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    responded_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_number_transfers_user_number_id ON number_transfers (user_number_id);
+CREATE INDEX IF NOT EXISTS idx_number_transfers_from_account_id ON number_transfers (from_account_id);
+CREATE INDEX IF NOT EXISTS idx_number_transfers_to_account_id ON number_transfers (to_account_id);
@@ -0,0 +1,3 @@
+ALTER TABLE user_numbers
+DROP COLUMN IF EXISTS period_start,
+DROP COLUMN IF EXISTS paid_price;
@@ -0,0 +1,23 @@
+ALTER TABLE user_numbers
+ADD COLUMN period_start TIMESTAMP,
+ADD COLUMN paid_price BIGINT NOT NULL DEFAULT 0;
+
+-- the current period of the held numbers is the last one of their package, at the price of it now
+UPDATE user_numbers
+SET period_start = CASE
+        WHEN user_numbers.type = 'buy' THEN user_numbers.start_date
+        WHEN p.duration_unit = 'day' THEN user_numbers.end_date - p.duration * INTERVAL '1 day'
+        ELSE user_numbers.end_date - p.duration * INTERVAL '1 month'
+    END,
+    paid_price = CASE
+        WHEN user_numbers.type = 'buy' AND n.buy_price > 0 THEN n.buy_price
+        WHEN user_numbers.type = 'buy' OR n.rent_price = 0 THEN p.price
+        WHEN p.duration_unit = 'day' THEN (n.rent_price * p.duration + 29) / 30
+        ELSE n.rent_price * p.duration
+    END
+FROM subscription_number_package p, sender_numbers n
+WHERE p.id = user_numbers.subscription_package_id AND n.id = user_numbers.number_id;
+
+UPDATE user_numbers
+SET period_start = start_date
+WHERE period_start IS NULL;
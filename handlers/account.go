@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // define this structs for swagger docs
@@ -44,10 +46,14 @@ type LoginRequest struct {
 type RentNumberRequest struct {
 	SenderNumber              string `json:"senderNumber"`
 	SubscriptionNumberPackage string `json:"SubscriptionNumberPackage"`
+	// AutoRenew renews the rent from the budget before it ends
+	AutoRenew bool `json:"autoRenew"`
 }
 
 type BuyNumberRequest struct {
 	SenderNumber string `json:"senderNumber"`
+	// SubscriptionNumberPackage is the title of a buy package, empty uses the cheapest one
+	SubscriptionNumberPackage string `json:"SubscriptionNumberPackage"`
 }
 
 type BudgetAmountResponse struct {
@@ -115,6 +121,14 @@ func RegisterHandler(c echo.Context, dbConn *gorm.DB) error {
 		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: accountCreationMsg})
 	}
 
+	// account can log in when its phone number or email is verified
+	account.PendingVerification = true
+	account.Token = ""
+	if err := dbConn.Model(&account).Updates(map[string]interface{}{"pending_verification": true, "token": ""}).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed to Create Account"})
+	}
+	sendRegistrationVerification(dbConn, account, user)
+
 	return c.JSON(http.StatusCreated, account)
 }
 
@@ -126,6 +140,7 @@ func RegisterHandler(c echo.Context, dbConn *gorm.DB) error {
 // @Produce json
 // @Param body body LoginRequest true "Login request body"
 // @Success 200 {object} AccountResponse
+// @Success 202 {object} TwoFactorChallengeResponse
 // @Failure 400 {object} ErrorResponseRegisterLogin
 // @Failure 422 {object} ErrorResponseRegisterLogin
 // @Router  /accounts/login [post]
@@ -144,7 +159,13 @@ func LoginHandler(c echo.Context, db *gorm.DB) error {
 	}
 
 	// find account based on username and check password correction
-	findAccountMsg, account, findAccountErr := utils.Login(jsonBody["username"].(string), jsonBody["password"].(string), false, db)
+	findAccountMsg, account, findAccountErr := loginWithLockout(c, db, jsonBody["username"].(string), jsonBody["password"].(string), false)
+	if findAccountErr == utils.ErrTwoFactorRequired {
+		return startTwoFactorChallenge(c, db, account, false)
+	}
+	if findAccountErr == utils.ErrLoginLocked {
+		return c.JSON(http.StatusTooManyRequests, models.Response{ResponseCode: 429, Message: findAccountMsg})
+	}
 	if findAccountErr != nil {
 		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: findAccountMsg})
 	}
@@ -193,7 +214,7 @@ func GetAllSenderNumbersHandler(c echo.Context, db *gorm.DB) error {
 	err := db.Model(&models.SenderNumber{}).
 		Select("sender_numbers.number").
 		Joins("LEFT JOIN user_numbers ON sender_numbers.id = user_numbers.number_id").
-		Where("sender_numbers.is_default=true or (user_numbers.user_id = ? and user_numbers.is_available=true)",
+		Where("(sender_numbers.is_default=true and sender_numbers.retired_at is null) or (user_numbers.user_id = ? and user_numbers.is_available=true)",
 			account.UserID).
 		Scan(&senderNumbersObjects).Error
 	if err != nil {
@@ -209,20 +230,37 @@ func GetAllSenderNumbersHandler(c echo.Context, db *gorm.DB) error {
 
 // GetAllSenderNumbersForSaleHandler retrieves All sender numbers available for sale
 // @Summary Get All sender numbers for sale
-// @Description retrieves All sender numbers available for sale
+// @Description retrieves All sender numbers available for sale, numbers reserved by other accounts aren't available
 // @Tags users
 // @Security ApiKeyAuth
 // @Produce json
+// @Param pattern query string false "Pattern of the numbers, * matches any digits and ? one digit, e.g. *1000"
+// @Param type query string false "Type of the numbers, shared, exclusive or vanity"
+// @Param held query bool false "true lists the numbers which are held by other accounts, to join their waitlist"
 // @Success 200 {object} SenderNumbersResponse
 // @Failure 401 {string} string
+// @Failure 422 {object} ErrorResponse
 // @Router /accounts/sender-numbers/sale	 [get]
 func GetAllSenderNumbersForSaleHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
 	var senderNumbersObjects []models.SenderNumber
 
-	err := db.Model(&models.SenderNumber{}).
+	query := db.Model(&models.SenderNumber{}).
 		Select("number").
-		Where("is_default = false AND is_exclusive=false").
-		Scan(&senderNumbersObjects).Error
+		Where("is_default = false AND is_exclusive = ? AND retired_at IS NULL", c.QueryParam("held") == "true").
+		Where("id NOT IN (SELECT number_id FROM number_reservations WHERE account_id <> ? AND expires_at > ?)", account.ID, time.Now())
+	if pattern := c.QueryParam("pattern"); pattern != "" {
+		like, err := utils.NumberPatternToLike(pattern)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Pattern must only have digits, * and ?"})
+		}
+		query = query.Where("number LIKE ?", like)
+	}
+	if numberType := c.QueryParam("type"); numberType != "" {
+		query = query.Where("type = ?", numberType)
+	}
+
+	err := query.Order("number").Scan(&senderNumbersObjects).Error
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
 	}
@@ -234,6 +272,35 @@ func GetAllSenderNumbersForSaleHandler(c echo.Context, db *gorm.DB) error {
 	return c.JSON(http.StatusOK, SenderNumbersResponse{Numbers: senderNumbers})
 }
 
+var errNumberTaken = errors.New("number is already taken")
+
+// takeSenderNumber makes the number exclusive to the account and removes its reservation.
+// Only one of the requests which rent or buy the number at once takes it, the others
+// get errNumberTaken. A number reserved by another account isn't taken, it gets
+// utils.ErrNumberReserved.
+func takeSenderNumber(tx *gorm.DB, numberID uint, accountID uint) error {
+	var reservation models.NumberReservation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("number_id = ? AND account_id <> ? AND expires_at > ?", numberID, accountID, time.Now()).
+		Limit(1).Find(&reservation).Error
+	if err != nil {
+		return err
+	}
+	if reservation.ID != 0 {
+		return utils.ErrNumberReserved
+	}
+
+	result := tx.Model(&models.SenderNumber{}).Where("id = ? AND is_exclusive = ?", numberID, false).
+		Update("is_exclusive", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errNumberTaken
+	}
+	return tx.Where("number_id = ?", numberID).Delete(&models.NumberReservation{}).Error
+}
+
 // @Summary Rent number
 // @Description Rent available number for this account
 // @Tags users
@@ -243,6 +310,7 @@ func GetAllSenderNumbersForSaleHandler(c echo.Context, db *gorm.DB) error {
 // @Success 200 {object} models.Response
 // @Failure 204 {object} ErrorResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /accounts/rent-number [post]
 func RentNumberHandler(c echo.Context, db *gorm.DB) error {
@@ -261,10 +329,8 @@ func RentNumberHandler(c echo.Context, db *gorm.DB) error {
 	var senderNumbersObject models.SenderNumber
 
 	err := db.WithContext(ctx).WithContext(ctx).Model(&models.SenderNumber{}).
-		Select("sender_numbers.id", "sender_numbers.number").
-		Joins("LEFT JOIN user_numbers ON sender_numbers.id = user_numbers.number_id").
 		Where(
-			"sender_numbers.is_default=false and sender_numbers.is_exclusive=false and sender_numbers.number = ?",
+			"sender_numbers.is_default=false and sender_numbers.is_exclusive=false and sender_numbers.retired_at is null and sender_numbers.number = ?",
 			body.SenderNumber).
 		First(&senderNumbersObject).Error
 	if err != nil {
@@ -275,28 +341,41 @@ func RentNumberHandler(c echo.Context, db *gorm.DB) error {
 	// get the subscription number package
 	var subPackage models.SubscriptionNumberPackage
 	err = db.WithContext(ctx).
-		Where("title = ?", body.SubscriptionNumberPackage).
+		Where("title = ? AND type = ? AND is_active = ?", body.SubscriptionNumberPackage, models.PackageTypeRent, true).
 		First(&subPackage).Error
 	if err != nil {
 		errorResponse := ErrorResponse{Message: "Subscription package does not exist."}
 		return c.JSON(http.StatusNotFound, errorResponse)
 	}
+	// a rent package without a duration would charge for a rent which ends right away
+	if subPackage.Duration <= 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Subscription package has no duration!"})
+	}
+
+	// shared numbers are rented by several accounts, but only once by each of them,
+	// a rent in its grace period is renewed instead
+	if senderNumbersObject.Type == models.SenderTypeShared {
+		var held int64
+		db.WithContext(ctx).Model(&models.UserNumbers{}).
+			Where("number_id = ? AND user_id = ?", senderNumbersObject.ID, account.UserID).
+			Count(&held)
+		if held > 0 {
+			return c.JSON(http.StatusConflict, ErrorResponse{Message: "You have already rented this number!"})
+		}
+	}
+
+	startDate := time.Now()
+	endDate := subPackage.EndDate(startDate)
+	price := utils.NumberRentPrice(senderNumbersObject, subPackage)
+
 	haveAccountBudget := utils.DoesAcountHaveBudget(
-		account.Budget, subPackage.Price,
+		utils.AvailableBudget(account), price,
 	)
 	if !haveAccountBudget {
 		errorResponse := ErrorResponse{Message: "You don't have enough budget!"}
 		return c.JSON(http.StatusNotFound, errorResponse)
 	}
 
-	var subscriptionNumberPackage SubscriptionNumberPackageInterface
-	startDate := time.Now()
-	if subPackage.Title == "1 Month" {
-		subscriptionNumberPackage = &OneMonthSubscriptionNumberPackage{StartDate: startDate}
-	} else if subPackage.Title == "2 Month" {
-		subscriptionNumberPackage = &TwoMonthSubscriptionNumberPackage{StartDate: startDate}
-	}
-
 	// Save to database
 	tx := db.WithContext(ctx).Begin()
 	defer func() {
@@ -309,13 +388,16 @@ func RentNumberHandler(c echo.Context, db *gorm.DB) error {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
 	}
 
-	startDate, endDate := subscriptionNumberPackage.GetTimePeriod()
 	userNumberObject := models.UserNumbers{
 		UserID:                account.UserID,
 		NumberID:              senderNumbersObject.ID,
 		StartDate:             startDate,
 		EndDate:               endDate,
+		PeriodStart:           startDate,
+		PaidPrice:             price,
 		IsAvailable:           true,
+		Type:                  models.PackageTypeRent,
+		AutoRenew:             body.AutoRenew,
 		SubscriptionPackageID: subPackage.ID,
 	}
 	if err = tx.Create(&userNumberObject).Error; err != nil {
@@ -323,21 +405,37 @@ func RentNumberHandler(c echo.Context, db *gorm.DB) error {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
 	}
 
-	// Update senderNumber
-	err = tx.Model(&models.SenderNumber{}).Where("id = ?", senderNumbersObject.ID).
-		Update("is_exclusive", true).
-		Error
-	if err != nil {
-		tx.Rollback()
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	// Update senderNumber, shared numbers stay available to other accounts
+	if senderNumbersObject.Type != models.SenderTypeShared {
+		if err = takeSenderNumber(tx, senderNumbersObject.ID, account.ID); err != nil {
+			tx.Rollback()
+			if errors.Is(err, errNumberTaken) {
+				return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number is already taken!"})
+			}
+			if errors.Is(err, utils.ErrNumberReserved) {
+				return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number is reserved by another account!"})
+			}
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+		}
 	}
 
 	// Update account budget
-	account.Budget -= subPackage.Price
+	account.Budget -= price
 	if err = tx.Save(&account).Error; err != nil {
 		tx.Rollback()
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
 	}
+	if err = utils.RecordSpending(tx, account.ID, price, "sender number "+senderNumbersObject.Number); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	err = writeAuditLog(c, tx, models.AuditActionNumberRent, auditTarget("sender_number", senderNumbersObject.ID), nil,
+		map[string]interface{}{"number": senderNumbersObject.Number, "package": subPackage.Title, "price": price, "end_date": endDate})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
 
 	tx.Commit()
 
@@ -373,28 +471,35 @@ func BuyNumberHandler(c echo.Context, db *gorm.DB) error {
 	var senderNumbersObject models.SenderNumber
 
 	err := db.WithContext(ctx).WithContext(ctx).Model(&models.SenderNumber{}).
-		Select("sender_numbers.id", "sender_numbers.number").
-		Joins("LEFT JOIN user_numbers ON sender_numbers.id = user_numbers.number_id").
 		Where(
-			"sender_numbers.is_default=false and sender_numbers.is_exclusive=false and sender_numbers.number = ?",
+			"sender_numbers.is_default=false and sender_numbers.is_exclusive=false and sender_numbers.retired_at is null and sender_numbers.number = ?",
 			body.SenderNumber).
 		First(&senderNumbersObject).Error
 	if err != nil {
 		log.Println(err)
 		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Sender number not found!"})
 	}
+	if senderNumbersObject.Type == models.SenderTypeShared {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Shared numbers can only be rented!"})
+	}
 
 	// get the subscription number package
 	var subPackage models.SubscriptionNumberPackage
-	err = db.WithContext(ctx).First(
-		&subPackage, utils.SUBSCRIOPTION_PACKAGE_BUY_ID,
-	).Error
+	query := db.WithContext(ctx).Where("type = ? AND is_active = ?", models.PackageTypeBuy, true)
+	if body.SubscriptionNumberPackage != "" {
+		query = query.Where("title = ?", body.SubscriptionNumberPackage)
+	}
+	err = query.Order("price").First(&subPackage).Error
 	if err != nil {
 		errorResponse := ErrorResponse{Message: "Subscription package does not exist."}
 		return c.JSON(http.StatusNotFound, errorResponse)
 	}
+	price := subPackage.Price
+	if senderNumbersObject.BuyPrice > 0 {
+		price = senderNumbersObject.BuyPrice
+	}
 	haveAccountBudget := utils.DoesAcountHaveBudget(
-		account.Budget, subPackage.Price,
+		utils.AvailableBudget(account), price,
 	)
 	if !haveAccountBudget {
 		errorResponse := ErrorResponse{Message: "You don't have enough budget!"}
@@ -413,11 +518,15 @@ func BuyNumberHandler(c echo.Context, db *gorm.DB) error {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
 	}
 
+	startDate := time.Now()
 	userNumberObject := models.UserNumbers{
 		UserID:                account.UserID,
 		NumberID:              senderNumbersObject.ID,
-		StartDate:             time.Now(),
+		StartDate:             startDate,
+		PeriodStart:           startDate,
+		PaidPrice:             price,
 		IsAvailable:           true,
+		Type:                  models.PackageTypeBuy,
 		SubscriptionPackageID: subPackage.ID,
 	}
 	if err = tx.Create(&userNumberObject).Error; err != nil {
@@ -426,20 +535,34 @@ func BuyNumberHandler(c echo.Context, db *gorm.DB) error {
 	}
 
 	// Update senderNumber
-	err = tx.Model(&models.SenderNumber{}).Where("id = ?", senderNumbersObject.ID).
-		Update("is_exclusive", true).
-		Error
-	if err != nil {
+	if err = takeSenderNumber(tx, senderNumbersObject.ID, account.ID); err != nil {
 		tx.Rollback()
+		if errors.Is(err, errNumberTaken) {
+			return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number is already taken!"})
+		}
+		if errors.Is(err, utils.ErrNumberReserved) {
+			return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number is reserved by another account!"})
+		}
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
 	}
 
 	// Update account budget
-	account.Budget -= subPackage.Price
+	account.Budget -= price
 	if err = tx.Save(&account).Error; err != nil {
 		tx.Rollback()
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
 	}
+	if err = utils.RecordSpending(tx, account.ID, price, "sender number "+senderNumbersObject.Number); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	err = writeAuditLog(c, tx, models.AuditActionNumberBuy, auditTarget("sender_number", senderNumbersObject.ID), nil,
+		map[string]interface{}{"number": senderNumbersObject.Number, "price": price})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
 
 	tx.Commit()
 
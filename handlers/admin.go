@@ -93,15 +93,16 @@ func AdminRegisterHandler(c echo.Context, db *gorm.DB) error {
 	return c.JSON(http.StatusOK, account)
 }
 
-// AdminLoginHandler logs in an admin user.
+// AdminLoginHandler logs in an admin user, admins always need a second factor.
 // @Summary Admin login
-// @Description Logs in an admin user.
+// @Description Logs in an admin user, the login is completed in /admin/login/verify.
 // @Tags admin
 // @Accept json
 // @Produce json
 // @Param body body LoginRequest true "Login Request Body"
-// @Success 200 {object} AccountResponse
+// @Success 202 {object} TwoFactorChallengeResponse
 // @Failure 422 {object} ErrorResponseRegisterLogin
+// @Failure 502 {object} ErrorResponseRegisterLogin
 // @Router /admin/login [post]
 func AdminLoginHandler(c echo.Context, db *gorm.DB) error {
 	// Read Request Body
@@ -117,7 +118,13 @@ func AdminLoginHandler(c echo.Context, db *gorm.DB) error {
 		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: jsonFormatValidationMsg})
 	}
 
-	findAccountMsg, account, findAccountErr := utils.Login(jsonBody["username"].(string), jsonBody["password"].(string), true, db)
+	findAccountMsg, account, findAccountErr := loginWithLockout(c, db, jsonBody["username"].(string), jsonBody["password"].(string), true)
+	if findAccountErr == utils.ErrTwoFactorRequired {
+		return startTwoFactorChallenge(c, db, account, true)
+	}
+	if findAccountErr == utils.ErrLoginLocked {
+		return c.JSON(http.StatusTooManyRequests, models.Response{ResponseCode: 429, Message: findAccountMsg})
+	}
 	if findAccountErr != nil {
 		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: findAccountMsg})
 	}
@@ -152,15 +159,27 @@ func DeactivateHandler(c echo.Context, db *gorm.DB) error {
 		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "You can't deactive super admin!"})
 	}
 
-	// if account is deactivated before
-	if !account.IsActive {
+	// if account is deactivated before, accounts which are suspended for an overdue bill are deactivated by admin
+	if !account.IsActive && account.SuspendedAt == nil {
 		return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "This Account Isn't active !"})
 	}
 
 	// deactivate account and update database
 	account.IsActive = false
 	account.Token = ""
-	db.Save(&account)
+	account.SuspendedAt = nil
+	tx := db.Begin()
+	if err := tx.Save(&account).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Deactivate Account"})
+	}
+	err := writeAuditLog(c, tx, models.AuditActionAccountDeactivate, auditTarget("account", account.ID),
+		map[string]bool{"is_active": true}, map[string]bool{"is_active": false})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
 	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "This Account Isn't active From Now"})
 }
 
@@ -191,9 +210,21 @@ func ActivateHandler(c echo.Context, db *gorm.DB) error {
 		return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "This Account is active!"})
 	}
 
-	// activate account and update database
+	// activate account and update database, it lifts the suspension for an overdue bill too
 	account.IsActive = true
-	db.Save(&account)
+	account.SuspendedAt = nil
+	tx := db.Begin()
+	if err := tx.Save(&account).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Activate Account"})
+	}
+	err := writeAuditLog(c, tx, models.AuditActionAccountActivate, auditTarget("account", account.ID),
+		map[string]bool{"is_active": false}, map[string]bool{"is_active": true})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
 	log.Println("Account Activated:", account)
 
 	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "This Account is active From Now"})
@@ -201,7 +232,7 @@ func ActivateHandler(c echo.Context, db *gorm.DB) error {
 
 // AddConfigHandler creates a new configuration entry.
 // @Summary Create Configuration
-// @Description Create a new configuration entry
+// @Description Create a new configuration entry. Values of declared settings are validated by their type, use PUT /admin/settings/{key} to change them.
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -236,12 +267,23 @@ func AddConfigHandler(c echo.Context, db *gorm.DB) error {
 
 	var conf models.Configuration
 	conf.Name = jsonBody["name"].(string)
-	conf.Value = jsonBody["value"].(float64)
+	conf.Value, err = settingDefinition(conf.Name).Parse(jsonBody["value"])
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: err.Error()})
+	}
 
-	createdConf := db.Create(&conf)
+	tx := db.Begin()
+	createdConf := tx.Create(&conf)
 	if createdConf.Error != nil {
+		tx.Rollback()
 		return c.JSON(http.StatusInternalServerError, conf)
 	}
+	if err := writeAuditLog(c, tx, models.AuditActionConfigCreate, auditTarget("config", conf.ID), nil, conf); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+	utils.Settings.Invalidate()
 
 	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Configuration Added Successfully"})
 }
@@ -380,9 +422,16 @@ func AddBadWordHandler(c echo.Context, db *gorm.DB) error {
 	var bw models.Bad_Word
 	bw.Word = word
 	bw.Regex = reg
-	createdBW := db.Create(&bw)
+	tx := db.Begin()
+	createdBW := tx.Create(&bw)
 	if createdBW.Error != nil {
+		tx.Rollback()
 		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Bad Word Cration Failed"})
 	}
+	if err := writeAuditLog(c, tx, models.AuditActionBadWordCreate, auditTarget("bad_word", bw.ID), nil, bw); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
 	return c.JSON(http.StatusOK, bw)
 }
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const apiKeyPrefix = "sk_"
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" example:"backend"`
+}
+
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	// Key is only shown once
+	Key string `json:"key"`
+}
+
+func newAPIKeyResponse(key models.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// CreateAPIKeyHandler creates an API key for the account
+// @Summary Create an API key
+// @Description Create an API key which is sent with the X-API-Key header instead of a login token. The key is only shown in this response.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param body body CreateAPIKeyRequest true "API key name"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/api-keys [post]
+func CreateAPIKeyHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var body CreateAPIKeyRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+	if len(strings.TrimSpace(body.Name)) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Name is required"})
+	}
+
+	secret, err := utils.GenerateRandomToken(24)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to generate API key"})
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := models.APIKey{
+		AccountID: account.ID,
+		Name:      body.Name,
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		KeyHash:   utils.HashCode(key),
+		CreatedAt: time.Now(),
+	}
+
+	tx := db.Begin()
+	if err := tx.Create(&apiKey).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create API key"})
+	}
+	res := newAPIKeyResponse(apiKey)
+	if err := writeAuditLog(c, tx, models.AuditActionAPIKeyCreate, auditTarget("api_key", apiKey.ID), nil, res); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusCreated, CreateAPIKeyResponse{APIKeyResponse: res, Key: key})
+}
+
+// ListAPIKeysHandler lists API keys of the account
+// @Summary List API keys
+// @Description List API keys of the account, without the keys themselves
+// @Tags api-keys
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {array} APIKeyResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/api-keys [get]
+func ListAPIKeysHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var keys []models.APIKey
+	if err := db.Where("account_id = ?", account.ID).Order("id").Find(&keys).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	res := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, newAPIKeyResponse(key))
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// RevokeAPIKeyHandler revokes an API key of the account
+// @Summary Revoke an API key
+// @Description Revoke an API key, it can't be used anymore
+// @Tags api-keys
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "API key ID"
+// @Success 200 {object} APIKeyResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/api-keys/{id} [delete]
+func RevokeAPIKeyHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var apiKey models.APIKey
+	err := db.Where("id = ? AND account_id = ? AND revoked_at IS NULL", c.Param("id"), account.ID).First(&apiKey).Error
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "API key not found"})
+	}
+	before := newAPIKeyResponse(apiKey)
+
+	now := time.Now()
+	apiKey.RevokedAt = &now
+
+	tx := db.Begin()
+	if err := tx.Model(&apiKey).Update("revoked_at", &now).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	res := newAPIKeyResponse(apiKey)
+	if err := writeAuditLog(c, tx, models.AuditActionAPIKeyRevoke, auditTarget("api_key", apiKey.ID), before, res); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, res)
+}
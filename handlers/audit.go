@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"SMS-panel/models"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type AuditLogResponse struct {
+	ID        uint      `json:"id"`
+	ActorID   uint      `json:"actorID"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Before    string    `json:"before"`
+	After     string    `json:"after"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// auditActor returns the id of the account which is doing the request,
+// the member's own account when a member acts on behalf of an organization.
+func auditActor(c echo.Context) uint {
+	if member, ok := c.Get("member").(models.AccountMember); ok {
+		return member.MemberID
+	}
+	if account, ok := c.Get("account").(models.Account); ok {
+		return account.ID
+	}
+	return 0
+}
+
+func auditTarget(kind string, id uint) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+func auditValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// writeAuditLog records a change of state made by the request's account.
+// Every handler which changes state must call it, inside its transaction if it has one.
+func writeAuditLog(
+	c echo.Context,
+	db *gorm.DB,
+	action string,
+	target string,
+	before interface{},
+	after interface{},
+) error {
+	return writeAuditLogAs(c, db, auditActor(c), action, target, before, after)
+}
+
+// writeAuditLogAs records a change of state made by the actor, for the requests which
+// aren't logged in, like verifications and password resets, where the actor is the
+// account of the token.
+func writeAuditLogAs(
+	c echo.Context,
+	db *gorm.DB,
+	actorID uint,
+	action string,
+	target string,
+	before interface{},
+	after interface{},
+) error {
+	auditLog := models.AuditLog{
+		ActorID:   actorID,
+		Action:    action,
+		Target:    target,
+		Before:    auditValue(before),
+		After:     auditValue(after),
+		IP:        c.RealIP(),
+		CreatedAt: time.Now(),
+	}
+	return db.Create(&auditLog).Error
+}
+
+// AuditLogsHandler lists audit logs.
+// @Summary List audit logs
+// @Description List audit logs filtered by actor, action and date
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param actor query int false "Actor account ID"
+// @Param action query string false "Action, e.g. account.deactivate"
+// @Param from query string false "From date (2006-01-02)"
+// @Param to query string false "To date (2006-01-02), inclusive"
+// @Param limit query int false "Maximum number of logs, default 100"
+// @Success 200 {array} AuditLogResponse
+// @Failure 400 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/audit-logs [get]
+func AuditLogsHandler(c echo.Context, db *gorm.DB) error {
+	query := db.Model(&models.AuditLog{})
+
+	if actor := c.QueryParam("actor"); actor != "" {
+		actorID, err := strconv.Atoi(actor)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid actor"})
+		}
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if action := c.QueryParam("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if from := c.QueryParam("from"); from != "" {
+		fromDate, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid from date"})
+		}
+		query = query.Where("created_at >= ?", fromDate)
+	}
+	if to := c.QueryParam("to"); to != "" {
+		toDate, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid to date"})
+		}
+		query = query.Where("created_at < ?", toDate.AddDate(0, 0, 1))
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(c.QueryParam("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+
+	var logs []models.AuditLog
+	if err := query.Order("created_at desc, id desc").Limit(limit).Find(&logs).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed to retrieve audit logs"})
+	}
+
+	res := make([]AuditLogResponse, 0, len(logs))
+	for _, l := range logs {
+		res = append(res, AuditLogResponse{
+			ID:        l.ID,
+			ActorID:   l.ActorID,
+			Action:    l.Action,
+			Target:    l.Target,
+			Before:    l.Before,
+			After:     l.After,
+			IP:        l.IP,
+			CreatedAt: l.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, res)
+}
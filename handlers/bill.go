@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type CreditLimitRequest struct {
+	// CreditLimit is how far the budget may go under zero, 0 makes the account prepaid
+	CreditLimit int64 `json:"creditLimit" example:"5000000"`
+}
+
+type BillResponse struct {
+	ID          uint       `json:"id"`
+	PeriodStart time.Time  `json:"periodStart"`
+	PeriodEnd   time.Time  `json:"periodEnd"`
+	Usage       int64      `json:"usage"`
+	Amount      int64      `json:"amount"`
+	Status      string     `json:"status" example:"unpaid"`
+	DueAt       time.Time  `json:"dueAt"`
+	PaidAt      *time.Time `json:"paidAt"`
+}
+
+func newBillResponse(bill models.Bill) BillResponse {
+	return BillResponse{
+		ID:          bill.ID,
+		PeriodStart: bill.PeriodStart,
+		PeriodEnd:   bill.PeriodEnd,
+		Usage:       bill.Usage,
+		Amount:      bill.Amount,
+		Status:      bill.Status,
+		DueAt:       bill.DueAt,
+		PaidAt:      bill.PaidAt,
+	}
+}
+
+// listBills lists the bills of the account, filtered by the request's status
+func listBills(c echo.Context, db *gorm.DB, accountID uint) error {
+	query := db.Where("account_id = ?", accountID)
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var bills []models.Bill
+	if err := query.Order("period_start desc").Find(&bills).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to retrieve bills"})
+	}
+
+	response := make([]BillResponse, 0, len(bills))
+	for _, bill := range bills {
+		response = append(response, newBillResponse(bill))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// ListBillsHandler lists the monthly bills of the postpaid account
+// @Summary List bills
+// @Description List the monthly bills of the account, which are issued when it has a credit limit
+// @Tags bills
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param status query string false "unpaid or paid"
+// @Success 200 {array} BillResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/bills [get]
+func ListBillsHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+	return listBills(c, db, account.ID)
+}
+
+// PayBillHandler creates the payment of an unpaid bill
+// @Summary Pay bill
+// @Description Create a payment gateway link for the amount of the bill. The bill is marked as paid when the budget covers it, and the account is reactivated when it doesn't have overdue bills anymore.
+// @Tags bills
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Bill ID"
+// @Success 200 {object} RequestResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /accounts/bills/{id}/pay [post]
+func PayBillHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var bill models.Bill
+	err := db.Where("id = ? AND account_id = ?", c.Param("id"), account.ID).First(&bill).Error
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Bill not found"})
+	}
+	if bill.Status != models.BillStatusUnpaid {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Bill is already paid"})
+	}
+
+	var user models.User
+	if err := db.First(&user, account.UserID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "User not found"})
+	}
+
+	_, session, err := utils.CreatePaymentTransaction(db, account.ID, user, bill.Amount, "Bill of "+bill.PeriodStart.Format("2006-01"))
+	if err == utils.ErrPaymentGateway {
+		return c.JSON(http.StatusBadGateway, ErrorResponse{Message: "Failed to create payment"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create transaction"})
+	}
+	return c.JSON(http.StatusOK, RequestResponse{PaymentUrl: session.PaymentURL})
+}
+
+// AccountBillsHandler lists the bills of an account.
+// @Summary List Account Bills
+// @Description List the monthly bills of a postpaid account
+// @Tags admin
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param status query string false "unpaid or paid"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} BillResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/accounts/{id}/bills [get]
+func AccountBillsHandler(c echo.Context, db *gorm.DB) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	return listBills(c, db, uint(id))
+}
+
+// SetCreditLimitHandler makes an account postpaid.
+// @Summary Set Account Credit Limit
+// @Description Set how far the budget of the account may go under zero. Accounts with a credit limit get a monthly bill of their usage, and they are suspended when a bill is overdue.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param body body CreditLimitRequest true "Credit limit"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/accounts/{id}/credit-limit [patch]
+func SetCreditLimitHandler(c echo.Context, db *gorm.DB) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var account models.Account
+	if err := db.First(&account, id).Error; err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Invalid Account ID"})
+	}
+
+	var body CreditLimitRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if body.CreditLimit < 0 {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Credit Limit Must Not Be Negative"})
+	}
+
+	before := account.CreditLimit
+	tx := db.Begin()
+	if err := tx.Model(&account).Update("credit_limit", body.CreditLimit).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Set Credit Limit"})
+	}
+	err := writeAuditLog(c, tx, models.AuditActionCreditLimit, auditTarget("account", account.ID),
+		map[string]int64{"credit_limit": before}, map[string]int64{"credit_limit": body.CreditLimit})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Credit Limit Is Set"})
+}
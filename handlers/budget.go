@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type BudgetAdjustmentRequest struct {
+	Amount int64  `json:"amount" example:"50000"`
+	Reason string `json:"reason" example:"Compensation for failed delivery"`
+	// ExpiresAt makes a credit promotional, it is spent before the paid budget and removed when it expires
+	ExpiresAt *time.Time `json:"expiresAt" example:"2024-01-01T00:00:00Z"`
+}
+
+type LedgerEntryResponse struct {
+	ID            uint      `json:"id"`
+	Kind          string    `json:"kind" example:"admin_credit"`
+	Amount        int64     `json:"amount"`
+	Reason        string    `json:"reason"`
+	ActorID       uint      `json:"actorID"`
+	TransactionID *uint     `json:"transactionID"`
+	PromoCreditID *uint     `json:"promoCreditID"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// bindBudgetAdjustment reads the account and the request of a budget adjustment,
+// it returns the status and the message of the response when they are invalid
+func bindBudgetAdjustment(c echo.Context, db *gorm.DB) (models.Account, BudgetAdjustmentRequest, int, string) {
+	var account models.Account
+	var body BudgetAdjustmentRequest
+
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := db.First(&account, id).Error; err != nil {
+		return account, body, http.StatusUnprocessableEntity, "Invalid Account ID"
+	}
+	if err := c.Bind(&body); err != nil {
+		return account, body, http.StatusBadRequest, "Invalid JSON"
+	}
+	if body.Amount <= 0 {
+		return account, body, http.StatusUnprocessableEntity, "Amount Must Be Positive"
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if body.Reason == "" {
+		return account, body, http.StatusUnprocessableEntity, "Reason Is Required"
+	}
+	return account, body, 0, ""
+}
+
+// CreditAccountHandler adds budget to an account.
+// @Summary Credit Account
+// @Description Add budget to the account with a reason. With expiresAt the budget is a promotional credit, which is spent before the paid budget and is removed when it expires.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param body body BudgetAdjustmentRequest true "Credit"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/accounts/{id}/credit [post]
+func CreditAccountHandler(c echo.Context, db *gorm.DB) error {
+	account, body, status, message := bindBudgetAdjustment(c, db)
+	if status != 0 {
+		return c.JSON(status, models.Response{ResponseCode: uint16(status), Message: message})
+	}
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Expiry Must Be In The Future"})
+	}
+
+	tx := db.Begin()
+	if err := utils.CreditBudget(tx, account.ID, auditActor(c), body.Amount, body.Reason, body.ExpiresAt); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Credit Account"})
+	}
+	err := writeAuditLog(c, tx, models.AuditActionBudgetCredit, auditTarget("account", account.ID),
+		map[string]int64{"budget": account.Budget}, body)
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Account Is Credited"})
+}
+
+// DebitAccountHandler removes budget from an account.
+// @Summary Debit Account
+// @Description Remove budget from the account with a reason. The paid budget is removed before promotional credits.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param body body BudgetAdjustmentRequest true "Debit, expiresAt isn't used"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/accounts/{id}/debit [post]
+func DebitAccountHandler(c echo.Context, db *gorm.DB) error {
+	account, body, status, message := bindBudgetAdjustment(c, db)
+	if status != 0 {
+		return c.JSON(status, models.Response{ResponseCode: uint16(status), Message: message})
+	}
+
+	tx := db.Begin()
+	err := utils.DebitBudget(tx, account.ID, auditActor(c), body.Amount, body.Reason)
+	if err == utils.ErrInsufficientBudget {
+		tx.Rollback()
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Account's Budget Is Less Than Amount"})
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Debit Account"})
+	}
+	err = writeAuditLog(c, tx, models.AuditActionBudgetDebit, auditTarget("account", account.ID),
+		map[string]int64{"budget": account.Budget}, map[string]interface{}{"amount": body.Amount, "reason": body.Reason})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Account Is Debited"})
+}
+
+// ledger lists the ledger entries of the account, filtered by the request's dates
+func ledger(c echo.Context, db *gorm.DB, accountID uint) error {
+	query := db.Where("account_id = ?", accountID)
+	if from := c.QueryParam("from"); from != "" {
+		fromDate, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid from date"})
+		}
+		query = query.Where("created_at >= ?", fromDate)
+	}
+	if to := c.QueryParam("to"); to != "" {
+		toDate, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid to date"})
+		}
+		query = query.Where("created_at < ?", toDate.AddDate(0, 0, 1))
+	}
+	if kind := c.QueryParam("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var entries []models.LedgerEntry
+	if err := query.Order("created_at desc, id desc").Find(&entries).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to retrieve ledger"})
+	}
+
+	response := make([]LedgerEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		response = append(response, LedgerEntryResponse{
+			ID:            entry.ID,
+			Kind:          entry.Kind,
+			Amount:        entry.Amount,
+			Reason:        entry.Reason,
+			ActorID:       entry.ActorID,
+			TransactionID: entry.TransactionID,
+			PromoCreditID: entry.PromoCreditID,
+			CreatedAt:     entry.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// LedgerHandler lists the budget changes of the account
+// @Summary List budget changes
+// @Description List the top-ups, spending, admin adjustments and promotional credits of the account
+// @Tags budget
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param from query string false "From date (2006-01-02)"
+// @Param to query string false "To date (2006-01-02), inclusive"
+// @Param kind query string false "top_up, admin_credit, admin_debit, promo_credit, promo_expire or spend"
+// @Success 200 {array} LedgerEntryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/ledger [get]
+func LedgerHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+	return ledger(c, db, account.ID)
+}
+
+// AccountLedgerHandler lists the budget changes of an account.
+// @Summary List Account Budget Changes
+// @Description List the top-ups, spending, admin adjustments and promotional credits of the account
+// @Tags admin
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param from query string false "From date (2006-01-02)"
+// @Param to query string false "To date (2006-01-02), inclusive"
+// @Param kind query string false "top_up, admin_credit, admin_debit, promo_credit, promo_expire or spend"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} LedgerEntryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/accounts/{id}/ledger [get]
+func AccountLedgerHandler(c echo.Context, db *gorm.DB) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	return ledger(c, db, uint(id))
+}
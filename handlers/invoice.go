@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type InvoiceResponse struct {
+	ID                uint      `json:"id"`
+	Number            string    `json:"number" example:"INV-000001"`
+	TransactionID     uint      `json:"transactionID"`
+	Subtotal          int64     `json:"subtotal"`
+	VATPercent        int       `json:"vatPercent"`
+	VAT               int64     `json:"vat"`
+	Total             int64     `json:"total"`
+	BuyerName         string    `json:"buyerName"`
+	BuyerCompany      string    `json:"buyerCompany"`
+	BuyerNationalID   string    `json:"buyerNationalID"`
+	BuyerEconomicCode string    `json:"buyerEconomicCode"`
+	BuyerAddress      string    `json:"buyerAddress"`
+	BuyerPostalCode   string    `json:"buyerPostalCode"`
+	IssuedAt          time.Time `json:"issuedAt"`
+}
+
+type BillingDetails struct {
+	CompanyName  *string `json:"companyName" example:"Example Co."`
+	EconomicCode *string `json:"economicCode" example:"411111111111"`
+	Address      *string `json:"address" example:"Tehran"`
+	PostalCode   *string `json:"postalCode" example:"1234567890"`
+}
+
+func newInvoiceResponse(invoice models.Invoice) InvoiceResponse {
+	return InvoiceResponse{
+		ID:                invoice.ID,
+		Number:            invoice.Number,
+		TransactionID:     invoice.TransactionID,
+		Subtotal:          invoice.Subtotal,
+		VATPercent:        invoice.VATPercent,
+		VAT:               invoice.VAT,
+		Total:             invoice.Total,
+		BuyerName:         invoice.BuyerName,
+		BuyerCompany:      invoice.BuyerCompany,
+		BuyerNationalID:   invoice.BuyerNationalID,
+		BuyerEconomicCode: invoice.BuyerEconomicCode,
+		BuyerAddress:      invoice.BuyerAddress,
+		BuyerPostalCode:   invoice.BuyerPostalCode,
+		IssuedAt:          invoice.IssuedAt,
+	}
+}
+
+// ListInvoicesHandler lists the invoices of the account
+// @Summary List invoices
+// @Description List the invoices of the account's top-ups, filtered by issue date
+// @Tags invoices
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param from query string false "From date (2006-01-02)"
+// @Param to query string false "To date (2006-01-02), inclusive"
+// @Success 200 {array} InvoiceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/invoices [get]
+func ListInvoicesHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	query := db.Where("account_id = ?", account.ID)
+	if from := c.QueryParam("from"); from != "" {
+		fromDate, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid from date"})
+		}
+		query = query.Where("issued_at >= ?", fromDate)
+	}
+	if to := c.QueryParam("to"); to != "" {
+		toDate, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid to date"})
+		}
+		query = query.Where("issued_at < ?", toDate.AddDate(0, 0, 1))
+	}
+
+	var invoices []models.Invoice
+	if err := query.Order("issued_at desc, id desc").Find(&invoices).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to retrieve invoices"})
+	}
+
+	response := make([]InvoiceResponse, 0, len(invoices))
+	for _, invoice := range invoices {
+		response = append(response, newInvoiceResponse(invoice))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// InvoiceHandler returns an invoice of the account
+// @Summary Get an invoice
+// @Description Get an invoice as JSON, or download it as an HTML page or a PDF document
+// @Tags invoices
+// @Produce json,html,application/pdf
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Invoice ID"
+// @Param format query string false "json (default), html or pdf"
+// @Success 200 {object} InvoiceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/invoices/{id} [get]
+func InvoiceHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid invoice ID"})
+	}
+
+	var invoice models.Invoice
+	if err := db.Where("id = ? AND account_id = ?", id, account.ID).First(&invoice).Error; err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Invoice not found"})
+	}
+
+	switch c.QueryParam("format") {
+	case "", "json":
+		return c.JSON(http.StatusOK, newInvoiceResponse(invoice))
+	case "html":
+		page, err := utils.RenderInvoiceHTML(invoice)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to render invoice"})
+		}
+		return c.HTMLBlob(http.StatusOK, page)
+	case "pdf":
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", invoice.Number+".pdf"))
+		return c.Blob(http.StatusOK, "application/pdf", utils.RenderInvoicePDF(invoice))
+	}
+	return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid format"})
+}
+
+// BillingDetailsHandler returns the billing details which are printed on invoices
+// @Summary Get billing details
+// @Description Get the company details of the account's user which are printed on invoices
+// @Tags invoices
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {object} BillingDetails
+// @Failure 404 {object} ErrorResponse
+// @Router /accounts/billing [get]
+func BillingDetailsHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var user models.User
+	if err := db.First(&user, account.UserID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "User not found"})
+	}
+	return c.JSON(http.StatusOK, BillingDetails{
+		CompanyName:  &user.CompanyName,
+		EconomicCode: &user.EconomicCode,
+		Address:      &user.Address,
+		PostalCode:   &user.PostalCode,
+	})
+}
+
+// UpdateBillingDetailsHandler changes the billing details which are printed on invoices
+// @Summary Update billing details
+// @Description Update the company details of the account's user, they are printed on the invoices which are issued after it
+// @Tags invoices
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param body body BillingDetails true "Billing details, missing fields aren't changed"
+// @Success 200 {object} BillingDetails
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/billing [patch]
+func UpdateBillingDetailsHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var body BillingDetails
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+	if body.PostalCode != nil && *body.PostalCode != "" && !utils.IsNumeric(*body.PostalCode) {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Postal code must be numeric"})
+	}
+	if body.EconomicCode != nil && *body.EconomicCode != "" && !utils.IsNumeric(*body.EconomicCode) {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Economic code must be numeric"})
+	}
+
+	var user models.User
+	if err := db.First(&user, account.UserID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "User not found"})
+	}
+	before := user
+
+	if body.CompanyName != nil {
+		user.CompanyName = *body.CompanyName
+	}
+	if body.EconomicCode != nil {
+		user.EconomicCode = *body.EconomicCode
+	}
+	if body.Address != nil {
+		user.Address = *body.Address
+	}
+	if body.PostalCode != nil {
+		user.PostalCode = *body.PostalCode
+	}
+
+	tx := db.Begin()
+	err := tx.Model(&user).Updates(map[string]interface{}{
+		"company_name":  user.CompanyName,
+		"economic_code": user.EconomicCode,
+		"address":       user.Address,
+		"postal_code":   user.PostalCode,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update billing details"})
+	}
+	err = writeAuditLog(c, tx, models.AuditActionBillingUpdate, auditTarget("user", user.ID),
+		billingDetailsOf(before), billingDetailsOf(user))
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, billingDetailsOf(user))
+}
+
+func billingDetailsOf(user models.User) BillingDetails {
+	return BillingDetails{
+		CompanyName:  &user.CompanyName,
+		EconomicCode: &user.EconomicCode,
+		Address:      &user.Address,
+		PostalCode:   &user.PostalCode,
+	}
+}
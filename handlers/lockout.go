@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type LoginLockoutResponse struct {
+	ID            uint       `json:"id"`
+	Kind          string     `json:"kind" example:"username"`
+	Value         string     `json:"value" example:"johndoe"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil"`
+}
+
+func newLoginLockoutResponse(attempt models.LoginAttempt) LoginLockoutResponse {
+	return LoginLockoutResponse{
+		ID:            attempt.ID,
+		Kind:          attempt.Kind,
+		Value:         attempt.Value,
+		Failures:      attempt.Failures,
+		LastFailureAt: attempt.LastFailureAt,
+		LockedUntil:   attempt.LockedUntil,
+	}
+}
+
+// loginWithLockout logs in with utils.Login unless the username or the IP of the
+// request is locked out, and tracks the failed logins.
+func loginWithLockout(c echo.Context, db *gorm.DB, username, password string, isAdmin bool) (string, models.Account, error) {
+	ip := c.RealIP()
+	if lockedFor := utils.LoginLockedFor(db, username, ip); lockedFor > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+		return "Too Many Failed Logins, Try Again Later", models.Account{}, utils.ErrLoginLocked
+	}
+
+	msg, account, err := utils.Login(username, password, isAdmin, db)
+	switch {
+	case errors.Is(err, utils.ErrInvalidCredentials):
+		if recordErr := utils.RecordLoginFailure(db, username, ip); recordErr != nil {
+			log.Printf("Failed to record failed login: %s", recordErr.Error())
+		}
+	case err == nil || errors.Is(err, utils.ErrTwoFactorRequired):
+		if clearErr := utils.ClearLoginFailures(db, username); clearErr != nil {
+			log.Printf("Failed to clear failed logins: %s", clearErr.Error())
+		}
+	}
+	return msg, account, err
+}
+
+// LoginLockoutsHandler lists usernames and IP addresses with recent failed logins.
+// @Summary List login lockouts
+// @Description List usernames and IP addresses with recent failed logins, optionally only the locked ones
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param kind query string false "username or ip"
+// @Param locked query bool false "Only currently locked ones"
+// @Success 200 {array} LoginLockoutResponse
+// @Failure 500 {object} models.Response
+// @Router /admin/lockouts [get]
+func LoginLockoutsHandler(c echo.Context, db *gorm.DB) error {
+	query := db.Model(&models.LoginAttempt{})
+	if kind := c.QueryParam("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if locked, _ := strconv.ParseBool(c.QueryParam("locked")); locked {
+		query = query.Where("locked_until > ?", time.Now())
+	}
+
+	var attempts []models.LoginAttempt
+	if err := query.Order("last_failure_at desc").Find(&attempts).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed to retrieve lockouts"})
+	}
+
+	res := make([]LoginLockoutResponse, 0, len(attempts))
+	for _, attempt := range attempts {
+		res = append(res, newLoginLockoutResponse(attempt))
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// ClearLoginLockoutHandler clears the failed logins and lockout of a username or an IP address.
+// @Summary Clear a login lockout
+// @Description Clear the failed logins and lockout of a username or an IP address
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Lockout ID"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/lockouts/{id} [delete]
+func ClearLoginLockoutHandler(c echo.Context, db *gorm.DB) error {
+	var attempt models.LoginAttempt
+	if err := db.First(&attempt, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Lockout Not Found"})
+	}
+
+	tx := db.Begin()
+	if err := tx.Delete(&attempt).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Clear Lockout"})
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionLoginLockoutClear, auditTarget("login_attempt", attempt.ID), newLoginLockoutResponse(attempt), nil); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Lockout Cleared"})
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type LowBalanceAlertRequest struct {
+	Threshold   int64  `json:"threshold" example:"50000"`
+	NotifySMS   bool   `json:"notifySMS"`
+	NotifyEmail bool   `json:"notifyEmail"`
+	WebhookURL  string `json:"webhookURL" example:"https://example.com/hooks/low-balance"`
+	// AutoTopUpAmount creates a payment request of this amount when the alert is sent, 0 disables it
+	AutoTopUpAmount int64 `json:"autoTopUpAmount" example:"100000"`
+}
+
+type LowBalanceAlertResponse struct {
+	LowBalanceAlertRequest
+	Triggered       bool       `json:"triggered"`
+	LastTriggeredAt *time.Time `json:"lastTriggeredAt"`
+}
+
+// LowBalanceWebhookPayload is posted to the webhook of the alert when the budget
+// drops under its threshold.
+type LowBalanceWebhookPayload struct {
+	Event      string `json:"event" example:"low_balance"`
+	AccountID  uint   `json:"accountID"`
+	Budget     int64  `json:"budget"`
+	Threshold  int64  `json:"threshold"`
+	PaymentURL string `json:"paymentURL,omitempty"`
+}
+
+// CheckLowBalance alerts the account once when its budget drops under the threshold
+// of its alert, and rearms the alert when the budget goes back above it.
+func CheckLowBalance(db *gorm.DB, accountID uint) error {
+	var alert models.LowBalanceAlert
+	err := db.Where("account_id = ?", accountID).First(&alert).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var account models.Account
+	if err := db.First(&account, accountID).Error; err != nil {
+		return err
+	}
+
+	if account.Budget >= alert.Threshold {
+		if !alert.Triggered {
+			return nil
+		}
+		return db.Model(&models.LowBalanceAlert{}).
+			Where("id = ? AND triggered = ?", alert.ID, true).
+			Update("triggered", false).Error
+	}
+
+	// only the check which triggers the alert sends it
+	now := time.Now()
+	result := db.Model(&models.LowBalanceAlert{}).
+		Where("id = ? AND triggered = ?", alert.ID, false).
+		Updates(map[string]interface{}{"triggered": true, "last_triggered_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	return sendLowBalanceAlert(db, alert, account)
+}
+
+func sendLowBalanceAlert(db *gorm.DB, alert models.LowBalanceAlert, account models.Account) error {
+	var user models.User
+	if err := db.First(&user, account.UserID).Error; err != nil {
+		return err
+	}
+
+	var paymentURL string
+	if alert.AutoTopUpAmount > 0 {
+		_, session, err := utils.CreatePaymentTransaction(db, account.ID, user, alert.AutoTopUpAmount, "Automatic top-up of low budget")
+		if err != nil {
+			// the alert is still sent, without the payment link
+			log.Printf("Failed to create top-up payment of account %d: %v", account.ID, err)
+		}
+		paymentURL = session.PaymentURL
+	}
+
+	text := fmt.Sprintf("Your SMS panel budget is %d, which is under your alert threshold of %d.", account.Budget, alert.Threshold)
+	if paymentURL != "" {
+		text += " Top up your budget: " + paymentURL
+	}
+
+	var errs []error
+	if alert.NotifySMS && user.Phone != "" {
+		if err := SendSystemSMS(db, account.ID, user.Phone, text); err != nil {
+			errs = append(errs, fmt.Errorf("sms: %w", err))
+		}
+	}
+	if alert.NotifyEmail && user.Email != "" {
+		if err := utils.GetMailer().Send(user.Email, "Your SMS panel budget is low", text); err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	}
+	if alert.WebhookURL != "" {
+		err := utils.PostWebhook(alert.WebhookURL, LowBalanceWebhookPayload{
+			Event:      "low_balance",
+			AccountID:  account.ID,
+			Budget:     account.Budget,
+			Threshold:  alert.Threshold,
+			PaymentURL: paymentURL,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func lowBalanceAlertResponse(alert models.LowBalanceAlert) LowBalanceAlertResponse {
+	return LowBalanceAlertResponse{
+		LowBalanceAlertRequest: LowBalanceAlertRequest{
+			Threshold:       alert.Threshold,
+			NotifySMS:       alert.NotifySMS,
+			NotifyEmail:     alert.NotifyEmail,
+			WebhookURL:      alert.WebhookURL,
+			AutoTopUpAmount: alert.AutoTopUpAmount,
+		},
+		Triggered:       alert.Triggered,
+		LastTriggeredAt: alert.LastTriggeredAt,
+	}
+}
+
+// LowBalanceAlertHandler returns the low balance alert of the account
+// @Summary Get low balance alert
+// @Description Get the threshold under which the account is alerted that its budget is running out
+// @Tags accounts
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {object} LowBalanceAlertResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /accounts/low-balance-alert [get]
+func LowBalanceAlertHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var alert models.LowBalanceAlert
+	if err := db.Where("account_id = ?", account.ID).First(&alert).Error; err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Low balance alert not found"})
+	}
+	return c.JSON(http.StatusOK, lowBalanceAlertResponse(alert))
+}
+
+// UpdateLowBalanceAlertHandler sets the low balance alert of the account
+// @Summary Set low balance alert
+// @Description Set the threshold under which the account is alerted by SMS, email or webhook. The alert is sent once each time the budget drops under the threshold.
+// @Description With autoTopUpAmount a payment request of that amount is created and its link is sent with the alert.
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param body body LowBalanceAlertRequest true "Low balance alert"
+// @Success 200 {object} LowBalanceAlertResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/low-balance-alert [put]
+func UpdateLowBalanceAlertHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var body LowBalanceAlertRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+	if body.Threshold <= 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Threshold must be positive"})
+	}
+	if !body.NotifySMS && !body.NotifyEmail && body.WebhookURL == "" {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "At least one of SMS, email or webhook must be notified"})
+	}
+	if body.WebhookURL != "" && !utils.IsWebhookURL(body.WebhookURL) {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Webhook URL must be a public http or https URL"})
+	}
+	if body.AutoTopUpAmount != 0 && body.AutoTopUpAmount < 1000 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Auto top-up amount must not be under 1000"})
+	}
+
+	var alert models.LowBalanceAlert
+	var before interface{}
+	if err := db.Where("account_id = ?", account.ID).First(&alert).Error; err == nil {
+		before = lowBalanceAlertResponse(alert)
+	}
+
+	alert.AccountID = account.ID
+	alert.Threshold = body.Threshold
+	alert.NotifySMS = body.NotifySMS
+	alert.NotifyEmail = body.NotifyEmail
+	alert.WebhookURL = body.WebhookURL
+	alert.AutoTopUpAmount = body.AutoTopUpAmount
+	// the budget is checked against the new threshold
+	alert.Triggered = false
+
+	tx := db.Begin()
+	if err := tx.Save(&alert).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to save low balance alert"})
+	}
+	err := writeAuditLog(c, tx, models.AuditActionLowBalanceUpdate, auditTarget("account", account.ID),
+		before, lowBalanceAlertResponse(alert))
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, lowBalanceAlertResponse(alert))
+}
+
+// DeleteLowBalanceAlertHandler removes the low balance alert of the account
+// @Summary Delete low balance alert
+// @Description Stop alerting the account when its budget is low
+// @Tags accounts
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/low-balance-alert [delete]
+func DeleteLowBalanceAlertHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var alert models.LowBalanceAlert
+	if err := db.Where("account_id = ?", account.ID).First(&alert).Error; err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Low balance alert not found"})
+	}
+
+	tx := db.Begin()
+	if err := tx.Delete(&alert).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to delete low balance alert"})
+	}
+	err := writeAuditLog(c, tx, models.AuditActionLowBalanceDelete, auditTarget("account", account.ID),
+		lowBalanceAlertResponse(alert), nil)
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type CreateMemberRequest struct {
+	Username      string `json:"username" example:"john"`
+	Password      string `json:"password" example:"secret"`
+	Role          string `json:"role" example:"sender"`
+	SpendingLimit int64  `json:"spendingLimit" example:"10000"`
+}
+
+type UpdateMemberRequest struct {
+	Role          *string `json:"role" example:"viewer"`
+	SpendingLimit *int64  `json:"spendingLimit" example:"20000"`
+	ResetSpent    bool    `json:"resetSpent"`
+}
+
+type MemberResponse struct {
+	ID            uint   `json:"id"`
+	MemberID      uint   `json:"memberID"`
+	Username      string `json:"username"`
+	Role          string `json:"role"`
+	SpendingLimit int64  `json:"spendingLimit"`
+	Spent         int64  `json:"spent"`
+	IsActive      bool   `json:"isActive"`
+}
+
+func newMemberResponse(member models.AccountMember) MemberResponse {
+	return MemberResponse{
+		ID:            member.ID,
+		MemberID:      member.MemberID,
+		Username:      member.Member.Username,
+		Role:          member.Role,
+		SpendingLimit: member.SpendingLimit,
+		Spent:         member.Spent,
+		IsActive:      member.Member.IsActive,
+	}
+}
+
+// findMember returns the member with the id in path which belongs to the logged in account
+func findMember(c echo.Context, db *gorm.DB) (models.AccountMember, error) {
+	account := c.Get("account").(models.Account)
+
+	var member models.AccountMember
+	err := db.Preload("Member").
+		Where("id = ? AND account_id = ?", c.Param("id"), account.ID).
+		First(&member).Error
+	return member, err
+}
+
+// CreateMemberHandler invites a new member to the organization
+// @Summary Create a member
+// @Description Create a member login under the organization account with a role and spending limit
+// @Tags members
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param body body CreateMemberRequest true "Member details"
+// @Success 201 {object} MemberResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/members [post]
+func CreateMemberHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var body CreateMemberRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+
+	if len(strings.TrimSpace(body.Username)) == 0 || len(body.Password) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Username and password are required"})
+	}
+	if !models.IsValidMemberRole(body.Role) {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Invalid role"})
+	}
+	if body.SpendingLimit < 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Spending limit can't be negative"})
+	}
+
+	// Is Input Username Unique or Not
+	var existingAccount models.Account
+	db.Where("username = ?", body.Username).First(&existingAccount)
+	if existingAccount.ID != 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Input Username has already been registered"})
+	}
+
+	tx := db.Begin()
+
+	// members share the user details of the organization owner
+	msg, memberAccount, err := utils.CreateAccount(int(account.UserID), body.Username, false, body.Password, tx)
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: msg})
+	}
+
+	member := models.AccountMember{
+		AccountID:     account.ID,
+		MemberID:      memberAccount.ID,
+		Role:          body.Role,
+		SpendingLimit: body.SpendingLimit,
+	}
+	if err := tx.Create(&member).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Member creation failed"})
+	}
+
+	member.Member = memberAccount
+	res := newMemberResponse(member)
+	if err := writeAuditLog(c, tx, models.AuditActionMemberCreate, auditTarget("member", member.ID), nil, res); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	tx.Commit()
+
+	return c.JSON(http.StatusCreated, res)
+}
+
+// ListMembersHandler lists members of the organization
+// @Summary List members
+// @Description List all members of the organization account
+// @Tags members
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {array} MemberResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/members [get]
+func ListMembersHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var members []models.AccountMember
+	err := db.Preload("Member").
+		Where("account_id = ?", account.ID).
+		Order("id").
+		Find(&members).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	res := make([]MemberResponse, 0, len(members))
+	for _, member := range members {
+		res = append(res, newMemberResponse(member))
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// UpdateMemberHandler changes role or spending limit of a member
+// @Summary Update a member
+// @Description Change role, spending limit or reset the spent amount of a member
+// @Tags members
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Member ID"
+// @Param body body UpdateMemberRequest true "Member changes"
+// @Success 200 {object} MemberResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/members/{id} [patch]
+func UpdateMemberHandler(c echo.Context, db *gorm.DB) error {
+	member, err := findMember(c, db)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Member not found"})
+	}
+
+	var body UpdateMemberRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+	before := newMemberResponse(member)
+
+	if body.Role != nil {
+		if !models.IsValidMemberRole(*body.Role) {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Invalid role"})
+		}
+		member.Role = *body.Role
+	}
+	if body.SpendingLimit != nil {
+		if *body.SpendingLimit < 0 {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Spending limit can't be negative"})
+		}
+		member.SpendingLimit = *body.SpendingLimit
+	}
+
+	updates := map[string]interface{}{
+		"role":           member.Role,
+		"spending_limit": member.SpendingLimit,
+	}
+	// spent is only written when it is reset, so spending meanwhile isn't overwritten
+	if body.ResetSpent {
+		updates["spent"] = 0
+	}
+
+	tx := db.Begin()
+	err = tx.Model(&member).Updates(updates).Error
+	if err == nil {
+		err = tx.First(&member, member.ID).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	res := newMemberResponse(member)
+	if err := writeAuditLog(c, tx, models.AuditActionMemberUpdate, auditTarget("member", member.ID), before, res); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// DeleteMemberHandler removes a member from the organization
+// @Summary Delete a member
+// @Description Remove a member from the organization and deactivate its login
+// @Tags members
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Member ID"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/members/{id} [delete]
+func DeleteMemberHandler(c echo.Context, db *gorm.DB) error {
+	member, err := findMember(c, db)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Member not found"})
+	}
+
+	tx := db.Begin()
+	if err := tx.Delete(&member).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	// member login can't be used anymore
+	err = tx.Model(&models.Account{}).Where("id = ?", member.MemberID).
+		Updates(map[string]interface{}{"is_active": false, "token": ""}).Error
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	if err := writeAuditLog(c, tx, models.AuditActionMemberDelete, auditTarget("member", member.ID), newMemberResponse(member), nil); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Member removed"})
+}
+
+// MemberMessagesHandler lists messages sent by a member
+// @Summary Messages sent by a member
+// @Description Audit of the messages a member has sent on behalf of the organization
+// @Tags members
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Member ID"
+// @Success 200 {array} models.SMSMessage
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/members/{id}/messages [get]
+func MemberMessagesHandler(c echo.Context, db *gorm.DB) error {
+	member, err := findMember(c, db)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Member not found"})
+	}
+
+	var messages []models.SMSMessage
+	err = db.Where("account_id = ? AND member_id = ?", member.AccountID, member.MemberID).
+		Order("created_at desc").
+		Find(&messages).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	return c.JSON(http.StatusOK, messages)
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type NumberReservationRequest struct {
+	SenderNumber string `json:"senderNumber" example:"30001000"`
+}
+
+type NumberReservationResponse struct {
+	ID        uint      `json:"id"`
+	Number    string    `json:"number" example:"30001000"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type NumberWaitlistResponse struct {
+	ID     uint   `json:"id"`
+	Number string `json:"number" example:"30001000"`
+	// Position is the place of the account in the waitlist of the number, from 1
+	Position  int       `json:"position" example:"1"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// findMarketplaceNumber returns the number of the request which can be rented or bought
+func findMarketplaceNumber(db *gorm.DB, number string) (models.SenderNumber, error) {
+	var senderNumber models.SenderNumber
+	err := db.Where("number = ? AND is_default = ? AND retired_at IS NULL", number, false).First(&senderNumber).Error
+	return senderNumber, err
+}
+
+// NotifyNumberWaitlist notifies the accounts which wait for the number that it is
+// released, in the order they joined, and empties its waitlist.
+func NotifyNumberWaitlist(db *gorm.DB, numberID uint) {
+	var entries []models.NumberWaitlist
+	err := db.Preload("Number").Where("number_id = ?", numberID).Order("created_at, id").Find(&entries).Error
+	if err != nil {
+		log.Printf("Can't find waitlist of number %d: %v", numberID, err)
+		return
+	}
+
+	for _, entry := range entries {
+		var account models.Account
+		if err := db.First(&account, entry.AccountID).Error; err != nil {
+			continue
+		}
+		text := fmt.Sprintf("Sender number %s which you are waiting for is available now.", entry.Number.Number)
+		if err := SendNumberNotice(db, account, "Sender number is available", text); err != nil {
+			log.Printf("Can't notify account %d of sender number %s: %v", account.ID, entry.Number.Number, err)
+		}
+	}
+	if err := db.Where("number_id = ?", numberID).Delete(&models.NumberWaitlist{}).Error; err != nil {
+		log.Printf("Can't empty waitlist of number %d: %v", numberID, err)
+	}
+}
+
+// ReserveNumberHandler reserves a number during checkout
+// @Summary Reserve number
+// @Description Hold a number for 10 minutes while renting or buying it, other accounts can't rent or buy it meanwhile. Reserving it again extends the reservation.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param body body NumberReservationRequest true "Sender number"
+// @Success 200 {object} NumberReservationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/number-reservations [post]
+func ReserveNumberHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var body NumberReservationRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+
+	senderNumber, err := findMarketplaceNumber(db, body.SenderNumber)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Sender number not found!"})
+	}
+	if senderNumber.Type == models.SenderTypeShared {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Shared numbers don't need to be reserved!"})
+	}
+	if senderNumber.IsExclusive {
+		return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number is held by another account, join its waitlist instead!"})
+	}
+
+	tx := db.Begin()
+	reservation, err := utils.ReserveNumber(tx, senderNumber.ID, account.ID)
+	if errors.Is(err, utils.ErrNumberReserved) {
+		tx.Rollback()
+		return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number is reserved by another account!"})
+	}
+	if err == nil {
+		err = writeAuditLog(c, tx, models.AuditActionNumberReserve, auditTarget("sender_number", senderNumber.ID), nil,
+			map[string]interface{}{"number": senderNumber.Number, "expires_at": reservation.ExpiresAt})
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, NumberReservationResponse{
+		ID:        reservation.ID,
+		Number:    senderNumber.Number,
+		ExpiresAt: reservation.ExpiresAt,
+	})
+}
+
+// ListNumberReservationsHandler lists the reservations of the account
+// @Summary List number reservations
+// @Description List the numbers which the account reserved and which haven't expired
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {array} NumberReservationResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/number-reservations [get]
+func ListNumberReservationsHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var reservations []models.NumberReservation
+	err := db.Preload("Number").
+		Where("account_id = ? AND expires_at > ?", account.ID, time.Now()).
+		Order("expires_at").
+		Find(&reservations).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	response := make([]NumberReservationResponse, 0, len(reservations))
+	for _, reservation := range reservations {
+		response = append(response, NumberReservationResponse{
+			ID:        reservation.ID,
+			Number:    reservation.Number.Number,
+			ExpiresAt: reservation.ExpiresAt,
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// CancelNumberReservationHandler cancels a reservation of the account
+// @Summary Cancel number reservation
+// @Description Release a reserved number before its reservation expires
+// @Tags users
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Reservation ID"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/number-reservations/{id} [delete]
+func CancelNumberReservationHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var reservation models.NumberReservation
+	err := db.Where("id = ? AND account_id = ? AND expires_at > ?", c.Param("id"), account.ID, time.Now()).
+		First(&reservation).Error
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Reservation not found!"})
+	}
+
+	tx := db.Begin()
+	err = tx.Delete(&reservation).Error
+	if err == nil {
+		err = writeAuditLog(c, tx, models.AuditActionNumberUnreserve, auditTarget("sender_number", reservation.NumberID), nil, nil)
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// JoinNumberWaitlistHandler adds the account to the waitlist of a held number
+// @Summary Join number waitlist
+// @Description Wait for a number which another account holds, the account is notified by SMS and email when the number is released
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param body body NumberReservationRequest true "Sender number"
+// @Success 200 {object} NumberWaitlistResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/number-waitlist [post]
+func JoinNumberWaitlistHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var body NumberReservationRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+
+	senderNumber, err := findMarketplaceNumber(db, body.SenderNumber)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Sender number not found!"})
+	}
+	if !senderNumber.IsExclusive {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "This number is available, rent or buy it instead!"})
+	}
+	var held int64
+	db.Model(&models.UserNumbers{}).Where("number_id = ? AND user_id = ?", senderNumber.ID, account.UserID).Count(&held)
+	if held > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "You already hold this number!"})
+	}
+
+	entry := models.NumberWaitlist{NumberID: senderNumber.ID, AccountID: account.ID, CreatedAt: time.Now()}
+	tx := db.Begin()
+	if err := tx.Create(&entry).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusConflict, ErrorResponse{Message: "You are already in the waitlist of this number!"})
+	}
+	err = writeAuditLog(c, tx, models.AuditActionWaitlistJoin, auditTarget("sender_number", senderNumber.ID), nil,
+		map[string]interface{}{"number": senderNumber.Number})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	var position int64
+	db.Model(&models.NumberWaitlist{}).Where("number_id = ? AND id <= ?", senderNumber.ID, entry.ID).Count(&position)
+	return c.JSON(http.StatusOK, NumberWaitlistResponse{
+		ID:        entry.ID,
+		Number:    senderNumber.Number,
+		Position:  int(position),
+		CreatedAt: entry.CreatedAt,
+	})
+}
+
+// ListNumberWaitlistHandler lists the numbers which the account waits for
+// @Summary List number waitlist
+// @Description List the numbers which the account waits for, with its position in their waitlist
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {array} NumberWaitlistResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/number-waitlist [get]
+func ListNumberWaitlistHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var entries []models.NumberWaitlist
+	if err := db.Preload("Number").Where("account_id = ?", account.ID).Order("created_at, id").Find(&entries).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	response := make([]NumberWaitlistResponse, 0, len(entries))
+	for _, entry := range entries {
+		var position int64
+		db.Model(&models.NumberWaitlist{}).Where("number_id = ? AND id <= ?", entry.NumberID, entry.ID).Count(&position)
+		response = append(response, NumberWaitlistResponse{
+			ID:        entry.ID,
+			Number:    entry.Number.Number,
+			Position:  int(position),
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// LeaveNumberWaitlistHandler removes the account from the waitlist of a number
+// @Summary Leave number waitlist
+// @Description Stop waiting for a number
+// @Tags users
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Waitlist ID"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/number-waitlist/{id} [delete]
+func LeaveNumberWaitlistHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var entry models.NumberWaitlist
+	if err := db.Where("id = ? AND account_id = ?", c.Param("id"), account.ID).First(&entry).Error; err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Waitlist entry not found!"})
+	}
+
+	tx := db.Begin()
+	err := tx.Delete(&entry).Error
+	if err == nil {
+		err = writeAuditLog(c, tx, models.AuditActionWaitlistLeave, auditTarget("sender_number", entry.NumberID), nil, nil)
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.NoContent(http.StatusNoContent)
+}
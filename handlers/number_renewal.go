@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Statuses of the numbers which an account holds.
+const (
+	NumberStatusActive = "active"
+	NumberStatusGrace  = "grace"
+	NumberStatusBought = "bought"
+)
+
+type RentedNumberResponse struct {
+	ID      uint   `json:"id"`
+	Number  string `json:"number" example:"3000123"`
+	Package string `json:"package" example:"1 Month"`
+	// Status is active, grace when the rent has ended and the number is reserved for renewal, or bought
+	Status    string     `json:"status" example:"active"`
+	StartDate time.Time  `json:"startDate"`
+	EndDate   *time.Time `json:"endDate"`
+	// GraceEndsAt is when the number is released if the rent isn't renewed
+	GraceEndsAt *time.Time `json:"graceEndsAt"`
+	AutoRenew   bool       `json:"autoRenew"`
+}
+
+type RenewNumberRequest struct {
+	// SubscriptionNumberPackage is the title of a rent package, empty renews with the current package
+	SubscriptionNumberPackage string `json:"subscriptionNumberPackage" example:"1 Month"`
+}
+
+type AutoRenewRequest struct {
+	AutoRenew bool `json:"autoRenew"`
+}
+
+func newRentedNumberResponse(db *gorm.DB, userNumber models.UserNumbers) RentedNumberResponse {
+	response := RentedNumberResponse{
+		ID:        userNumber.ID,
+		Number:    userNumber.Number.Number,
+		Package:   userNumber.SubscriptionPackage.Title,
+		Status:    NumberStatusActive,
+		StartDate: userNumber.StartDate,
+		AutoRenew: userNumber.AutoRenew,
+	}
+	if userNumber.Type == models.PackageTypeBuy {
+		response.Status = NumberStatusBought
+		return response
+	}
+	endDate := userNumber.EndDate
+	response.EndDate = &endDate
+	if !userNumber.IsAvailable {
+		graceEnd := utils.NumberGraceEnd(db, endDate)
+		response.Status = NumberStatusGrace
+		response.GraceEndsAt = &graceEnd
+	}
+	return response
+}
+
+// findRentedNumber returns the number which the account holds by the id of the request
+func findRentedNumber(c echo.Context, db *gorm.DB) (models.UserNumbers, error) {
+	account := c.Get("account").(models.Account)
+	var userNumber models.UserNumbers
+	err := db.Preload("Number").Preload("SubscriptionPackage").
+		Where("id = ? AND user_id = ?", c.Param("id"), account.UserID).
+		First(&userNumber).Error
+	return userNumber, err
+}
+
+// SendNumberNotice sends the text about a sender number to the account by SMS and email.
+func SendNumberNotice(db *gorm.DB, account models.Account, subject string, text string) error {
+	var user models.User
+	if err := db.First(&user, account.UserID).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	if user.Phone != "" {
+		if err := SendSystemSMS(db, account.ID, user.Phone, text); err != nil {
+			errs = append(errs, fmt.Errorf("sms: %w", err))
+		}
+	}
+	if user.Email != "" {
+		if err := utils.GetMailer().Send(user.Email, subject, text); err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ListRentedNumbersHandler lists the numbers which the account holds
+// @Summary List rented numbers
+// @Description List the numbers which the account rented or bought, with the end of their rent and grace period
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {array} RentedNumberResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/rented-numbers [get]
+func ListRentedNumbersHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var userNumbers []models.UserNumbers
+	err := db.Preload("Number").Preload("SubscriptionPackage").
+		Where("user_id = ?", account.UserID).
+		Order("end_date, id").
+		Find(&userNumbers).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	response := make([]RentedNumberResponse, 0, len(userNumbers))
+	for _, userNumber := range userNumbers {
+		response = append(response, newRentedNumberResponse(db, userNumber))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// RenewNumberHandler renews the rent of a number
+// @Summary Renew number
+// @Description Charge the budget for another period of a rented number, from the end of the rent or from now in the grace period
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Rented number ID"
+// @Param body body RenewNumberRequest false "Subscription package"
+// @Success 200 {object} RentedNumberResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/rented-numbers/{id}/renew [post]
+func RenewNumberHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var body RenewNumberRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+
+	userNumber, err := findRentedNumber(c, db)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Rented number not found!"})
+	}
+	if userNumber.Type != models.PackageTypeRent {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Bought numbers don't need to be renewed!"})
+	}
+
+	subPackage := userNumber.SubscriptionPackage
+	if body.SubscriptionNumberPackage != "" {
+		subPackage = models.SubscriptionNumberPackage{}
+		err = db.Where("title = ? AND type = ? AND is_active = ?", body.SubscriptionNumberPackage, models.PackageTypeRent, true).
+			First(&subPackage).Error
+	} else if !subPackage.IsActive {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Subscription package does not exist."})
+	}
+	if subPackage.Duration <= 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Subscription package has no duration!"})
+	}
+	before := map[string]interface{}{"package": userNumber.SubscriptionPackage.Title, "end_date": userNumber.EndDate}
+
+	tx := db.Begin()
+	price, err := utils.RenewNumber(tx, account.ID, &userNumber, subPackage)
+	if err != nil {
+		tx.Rollback()
+		switch {
+		case errors.Is(err, utils.ErrInsufficientBudget):
+			return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "You don't have enough budget!"})
+		case errors.Is(err, utils.ErrNumberRetired):
+			return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Retired numbers can't be renewed!"})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Rented number not found!"})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	userNumber.SubscriptionPackage = subPackage
+
+	err = writeAuditLog(c, tx, models.AuditActionNumberRenew, auditTarget("sender_number", userNumber.NumberID), before,
+		map[string]interface{}{"package": subPackage.Title, "price": price, "end_date": userNumber.EndDate})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, newRentedNumberResponse(db, userNumber))
+}
+
+// SetAutoRenewHandler turns auto-renew of a rented number on or off
+// @Summary Set auto-renew
+// @Description With auto-renew the rent is renewed with its package a day before it ends, when the budget covers it
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Rented number ID"
+// @Param body body AutoRenewRequest true "Auto-renew"
+// @Success 200 {object} RentedNumberResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/rented-numbers/{id} [patch]
+func SetAutoRenewHandler(c echo.Context, db *gorm.DB) error {
+	var body AutoRenewRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+
+	userNumber, err := findRentedNumber(c, db)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Rented number not found!"})
+	}
+	if userNumber.Type != models.PackageTypeRent {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Bought numbers don't need to be renewed!"})
+	}
+	before := map[string]interface{}{"auto_renew": userNumber.AutoRenew}
+
+	tx := db.Begin()
+	err = tx.Model(&models.UserNumbers{}).Where("id = ?", userNumber.ID).Update("auto_renew", body.AutoRenew).Error
+	if err == nil {
+		err = writeAuditLog(c, tx, models.AuditActionNumberAutoRenew, auditTarget("sender_number", userNumber.NumberID), before,
+			map[string]interface{}{"auto_renew": body.AutoRenew})
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+	userNumber.AutoRenew = body.AutoRenew
+
+	return c.JSON(http.StatusOK, newRentedNumberResponse(db, userNumber))
+}
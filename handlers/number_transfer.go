@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type NumberReleaseResponse struct {
+	Number string `json:"number" example:"3000123"`
+	// Refund is the price of the unused days of the rent which is added to the budget
+	Refund int64 `json:"refund" example:"50"`
+}
+
+type NumberTransferRequest struct {
+	// Username is the account which the number is transferred to
+	Username string `json:"username" example:"jane"`
+}
+
+type NumberTransferResponse struct {
+	ID     uint   `json:"id"`
+	Number string `json:"number" example:"3000123"`
+	From   string `json:"from" example:"john"`
+	To     string `json:"to" example:"jane"`
+	// Status is pending, accepted, declined or cancelled
+	Status      string     `json:"status" example:"pending"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	RespondedAt *time.Time `json:"respondedAt"`
+}
+
+func newNumberTransferResponse(db *gorm.DB, transfer models.NumberTransfer) NumberTransferResponse {
+	var from, to models.Account
+	db.First(&from, transfer.FromAccountID)
+	db.First(&to, transfer.ToAccountID)
+	return NumberTransferResponse{
+		ID:          transfer.ID,
+		Number:      transfer.Number.Number,
+		From:        from.Username,
+		To:          to.Username,
+		Status:      transfer.Status,
+		ExpiresAt:   transfer.ExpiresAt,
+		CreatedAt:   transfer.CreatedAt,
+		RespondedAt: transfer.RespondedAt,
+	}
+}
+
+// findPendingTransfer returns the unexpired pending transfer of the request which is sent
+// to the account, or by it when sent is true
+func findPendingTransfer(c echo.Context, db *gorm.DB, sent bool) (models.NumberTransfer, error) {
+	account := c.Get("account").(models.Account)
+	column := "to_account_id"
+	if sent {
+		column = "from_account_id"
+	}
+	var transfer models.NumberTransfer
+	err := db.Preload("Number").
+		Where("id = ? AND "+column+" = ? AND status = ? AND expires_at > ?", c.Param("id"), account.ID, models.NumberTransferPending, time.Now()).
+		First(&transfer).Error
+	return transfer, err
+}
+
+// notifyTransferAccount sends the text about a transfer to the account, failures are only logged
+func notifyTransferAccount(db *gorm.DB, accountID uint, subject string, text string) {
+	var account models.Account
+	if err := db.First(&account, accountID).Error; err != nil {
+		return
+	}
+	if err := SendNumberNotice(db, account, subject, text); err != nil {
+		log.Printf("Can't notify account %d of number transfer: %v", account.ID, err)
+	}
+}
+
+// ReleaseNumberHandler gives a held number back before its rent ends
+// @Summary Release number
+// @Description Give a rented or bought number back so other accounts can rent or buy it. The unused whole days of a rent are refunded to the budget, times the number refund percent setting; bought numbers and rents in their grace period aren't refunded.
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Rented number ID"
+// @Success 200 {object} NumberReleaseResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/rented-numbers/{id}/release [post]
+func ReleaseNumberHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	userNumber, err := findRentedNumber(c, db)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Rented number not found!"})
+	}
+	before := map[string]interface{}{"type": userNumber.Type, "package": userNumber.SubscriptionPackage.Title}
+	if userNumber.Type == models.PackageTypeRent {
+		before["end_date"] = userNumber.EndDate
+	}
+
+	tx := db.Begin()
+	refund, err := utils.ReleaseNumber(tx, account.ID, userNumber)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Rented number not found!"})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	err = writeAuditLog(c, tx, models.AuditActionNumberRelease, auditTarget("sender_number", userNumber.NumberID), before,
+		map[string]interface{}{"refund": refund})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	if userNumber.Number.Type != models.SenderTypeShared {
+		NotifyNumberWaitlist(db, userNumber.NumberID)
+	}
+	return c.JSON(http.StatusOK, NumberReleaseResponse{Number: userNumber.Number.Number, Refund: refund})
+}
+
+// TransferNumberHandler offers a held number to another account
+// @Summary Transfer number
+// @Description Offer a rented or bought number to another account, the number is moved to it with its rent when it accepts the transfer within 3 days
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Rented number ID"
+// @Param body body NumberTransferRequest true "Recipient"
+// @Success 200 {object} NumberTransferResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/rented-numbers/{id}/transfer [post]
+func TransferNumberHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var body NumberTransferRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+
+	userNumber, err := findRentedNumber(c, db)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Rented number not found!"})
+	}
+	if !userNumber.IsAvailable {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Renew the number before transferring it!"})
+	}
+
+	// members use the numbers of their organization, so numbers are only transferred to owners
+	var recipient models.Account
+	err = db.Where("username = ? AND is_active = ? AND id NOT IN (SELECT member_id FROM account_members)", body.Username, true).
+		First(&recipient).Error
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Recipient account not found!"})
+	}
+	if recipient.UserID == account.UserID {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "You can't transfer a number to yourself!"})
+	}
+	var held int64
+	db.Model(&models.UserNumbers{}).Where("number_id = ? AND user_id = ?", userNumber.NumberID, recipient.UserID).Count(&held)
+	if held > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "The recipient already holds this number!"})
+	}
+
+	var pending int64
+	db.Model(&models.NumberTransfer{}).
+		Where("user_number_id = ? AND status = ? AND expires_at > ?", userNumber.ID, models.NumberTransferPending, time.Now()).
+		Count(&pending)
+	if pending > 0 {
+		return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number already has a pending transfer!"})
+	}
+
+	now := time.Now()
+	transfer := models.NumberTransfer{
+		UserNumberID:  userNumber.ID,
+		NumberID:      userNumber.NumberID,
+		FromAccountID: account.ID,
+		ToAccountID:   recipient.ID,
+		Status:        models.NumberTransferPending,
+		ExpiresAt:     now.Add(utils.NumberTransferTTL),
+		CreatedAt:     now,
+		Number:        userNumber.Number,
+	}
+	tx := db.Begin()
+	err = tx.Omit("Number").Create(&transfer).Error
+	if err == nil {
+		err = writeAuditLog(c, tx, models.AuditActionTransferCreate, auditTarget("sender_number", userNumber.NumberID), nil,
+			map[string]interface{}{"transfer_id": transfer.ID, "to": recipient.Username})
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	notifyTransferAccount(db, recipient.ID, "Sender number transfer",
+		fmt.Sprintf("%s offered you sender number %s. Accept the transfer within %d days to get it.",
+			account.Username, userNumber.Number.Number, int(utils.NumberTransferTTL.Hours()/24)))
+	return c.JSON(http.StatusOK, newNumberTransferResponse(db, transfer))
+}
+
+// ListNumberTransfersHandler lists the pending transfers of the account
+// @Summary List number transfers
+// @Description List the pending transfers which the account sent or received
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {array} NumberTransferResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/number-transfers [get]
+func ListNumberTransfersHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var transfers []models.NumberTransfer
+	err := db.Preload("Number").
+		Where("(from_account_id = ? OR to_account_id = ?) AND status = ? AND expires_at > ?",
+			account.ID, account.ID, models.NumberTransferPending, time.Now()).
+		Order("created_at, id").
+		Find(&transfers).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	response := make([]NumberTransferResponse, 0, len(transfers))
+	for _, transfer := range transfers {
+		response = append(response, newNumberTransferResponse(db, transfer))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// AcceptNumberTransferHandler accepts a transfer which is sent to the account
+// @Summary Accept number transfer
+// @Description Move the number of the transfer to the account with its rent, auto-renew is off until the account turns it on
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Transfer ID"
+// @Success 200 {object} NumberTransferResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/number-transfers/{id}/accept [post]
+func AcceptNumberTransferHandler(c echo.Context, db *gorm.DB) error {
+	transfer, err := findPendingTransfer(c, db, false)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Number transfer not found!"})
+	}
+
+	tx := db.Begin()
+	if err := utils.TransferNumber(tx, &transfer); err != nil {
+		tx.Rollback()
+		switch {
+		case errors.Is(err, utils.ErrNumberNotHeld):
+			return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number is no longer held by the sender!"})
+		case errors.Is(err, utils.ErrNumberAlreadyHeld):
+			return c.JSON(http.StatusConflict, ErrorResponse{Message: "You already hold this number!"})
+		case errors.Is(err, utils.ErrNumberTransferExpired):
+			return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Number transfer not found!"})
+		case errors.Is(err, utils.ErrNumberTransferClosed):
+			return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number transfer isn't pending anymore!"})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	err = writeAuditLog(c, tx, models.AuditActionTransferAccept, auditTarget("sender_number", transfer.NumberID),
+		map[string]interface{}{"from_account_id": transfer.FromAccountID},
+		map[string]interface{}{"transfer_id": transfer.ID, "to_account_id": transfer.ToAccountID})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	response := newNumberTransferResponse(db, transfer)
+	notifyTransferAccount(db, transfer.FromAccountID, "Sender number transfer",
+		fmt.Sprintf("%s accepted the transfer of sender number %s.", response.To, transfer.Number.Number))
+	return c.JSON(http.StatusOK, response)
+}
+
+// DeclineNumberTransferHandler declines a transfer which is sent to the account
+// @Summary Decline number transfer
+// @Description Decline a transfer, the number stays with its sender
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Transfer ID"
+// @Success 200 {object} NumberTransferResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/number-transfers/{id}/decline [post]
+func DeclineNumberTransferHandler(c echo.Context, db *gorm.DB) error {
+	transfer, err := findPendingTransfer(c, db, false)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Number transfer not found!"})
+	}
+	if err := respondNumberTransfer(c, db, &transfer, models.NumberTransferDeclined, models.AuditActionTransferDecline); err != nil {
+		if errors.Is(err, utils.ErrNumberTransferClosed) {
+			return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number transfer isn't pending anymore!"})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	response := newNumberTransferResponse(db, transfer)
+	notifyTransferAccount(db, transfer.FromAccountID, "Sender number transfer",
+		fmt.Sprintf("%s declined the transfer of sender number %s.", response.To, transfer.Number.Number))
+	return c.JSON(http.StatusOK, response)
+}
+
+// CancelNumberTransferHandler cancels a transfer which the account sent
+// @Summary Cancel number transfer
+// @Description Cancel a pending transfer before its recipient accepts it
+// @Tags users
+// @Param Authorization header string true "User Token"
+// @Param id path int true "Transfer ID"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/number-transfers/{id} [delete]
+func CancelNumberTransferHandler(c echo.Context, db *gorm.DB) error {
+	transfer, err := findPendingTransfer(c, db, true)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Number transfer not found!"})
+	}
+	if err := respondNumberTransfer(c, db, &transfer, models.NumberTransferCancelled, models.AuditActionTransferCancel); err != nil {
+		if errors.Is(err, utils.ErrNumberTransferClosed) {
+			return c.JSON(http.StatusConflict, ErrorResponse{Message: "This number transfer isn't pending anymore!"})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// respondNumberTransfer closes the pending transfer with the status and writes the audit log
+func respondNumberTransfer(c echo.Context, db *gorm.DB, transfer *models.NumberTransfer, status string, action string) error {
+	now := time.Now()
+	tx := db.Begin()
+	result := tx.Model(&models.NumberTransfer{}).Where("id = ? AND status = ?", transfer.ID, models.NumberTransferPending).
+		Updates(map[string]interface{}{"status": status, "responded_at": now})
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = utils.ErrNumberTransferClosed
+	}
+	if err == nil {
+		err = writeAuditLog(c, tx, action, auditTarget("sender_number", transfer.NumberID), nil,
+			map[string]interface{}{"transfer_id": transfer.ID})
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.Commit()
+
+	transfer.Status = status
+	transfer.RespondedAt = &now
+	return nil
+}
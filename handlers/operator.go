@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type OperatorRequest struct {
+	Name *string `json:"name" example:"MCI"`
+	// Provider sends the messages to the operator, empty uses the default provider
+	Provider *string `json:"provider" example:"default"`
+	// Prefixes are international prefixes without + or 00, or ranges of them, and replace the current prefixes
+	Prefixes []string `json:"prefixes" example:"98910-98919,98990"`
+}
+
+type OperatorResponse struct {
+	ID       uint     `json:"id"`
+	Name     string   `json:"name" example:"MCI"`
+	Provider string   `json:"provider" example:"default"`
+	Prefixes []string `json:"prefixes"`
+}
+
+type OperatorReportRow struct {
+	// OperatorID is null for the recipients whose operator isn't detected
+	OperatorID *uint  `json:"operatorID"`
+	Operator   string `json:"operator" example:"MCI"`
+	Messages   int64  `json:"messages"`
+	Delivered  int64  `json:"delivered"`
+}
+
+func newOperatorResponse(operator models.Operator) OperatorResponse {
+	prefixes := make([]string, 0, len(operator.Prefixes))
+	for _, prefix := range operator.Prefixes {
+		prefixes = append(prefixes, prefix.Prefix)
+	}
+	return OperatorResponse{ID: operator.ID, Name: operator.Name, Provider: operator.Provider, Prefixes: prefixes}
+}
+
+// applyOperatorRequest changes the operator by the fields which are in the request
+func applyOperatorRequest(db *gorm.DB, operator *models.Operator, body OperatorRequest) string {
+	if body.Name != nil {
+		if len(strings.TrimSpace(*body.Name)) == 0 {
+			return "Name Can't Be Empty"
+		}
+		var count int64
+		db.Model(&models.Operator{}).Where("name = ? AND id <> ?", *body.Name, operator.ID).Count(&count)
+		if count > 0 {
+			return "There Is An Operator With This Name"
+		}
+		operator.Name = *body.Name
+	}
+	if body.Provider != nil {
+		operator.Provider = strings.TrimSpace(*body.Provider)
+	}
+	if operator.Provider == "" {
+		operator.Provider = utils.DefaultProvider
+	}
+
+	if body.Prefixes == nil {
+		return ""
+	}
+	seen := make(map[string]bool)
+	var all []string
+	for _, prefixRange := range body.Prefixes {
+		prefixes, err := utils.ExpandPrefixRange(prefixRange)
+		if err != nil {
+			return err.Error()
+		}
+		for _, prefix := range prefixes {
+			if !seen[prefix] {
+				seen[prefix] = true
+				all = append(all, prefix)
+			}
+		}
+	}
+	if len(all) == 0 {
+		return "Prefixes Can't Be Empty"
+	}
+
+	var taken models.OperatorPrefix
+	err := db.Where("prefix IN ? AND operator_id <> ?", all, operator.ID).Limit(1).Find(&taken).Error
+	if err == nil && taken.ID != 0 {
+		return "Prefix " + taken.Prefix + " Belongs To Another Operator"
+	}
+
+	operator.Prefixes = nil
+	for _, prefix := range all {
+		operator.Prefixes = append(operator.Prefixes, models.OperatorPrefix{Prefix: prefix})
+	}
+	return ""
+}
+
+// saveOperator saves the operator, and its prefixes when they are replaced, and writes its audit log
+func saveOperator(c echo.Context, db *gorm.DB, action string, operator *models.Operator, before interface{}, replacePrefixes bool) error {
+	tx := db.Begin()
+	if err := tx.Omit("Prefixes").Save(operator).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Save Operator"})
+	}
+	if replacePrefixes {
+		if err := tx.Where("operator_id = ?", operator.ID).Delete(&models.OperatorPrefix{}).Error; err != nil {
+			tx.Rollback()
+			return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Save Operator"})
+		}
+		for i := range operator.Prefixes {
+			operator.Prefixes[i].OperatorID = operator.ID
+		}
+		if err := tx.Create(&operator.Prefixes).Error; err != nil {
+			tx.Rollback()
+			return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Save Operator"})
+		}
+	}
+	after := newOperatorResponse(*operator)
+	if err := writeAuditLog(c, tx, action, auditTarget("operator", operator.ID), before, after); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	if !replacePrefixes {
+		utils.Operators.Invalidate()
+	} else if err := utils.RedetectOperators(db); err != nil {
+		log.Printf("Failed to detect operators of phone book numbers: %v", err)
+	}
+	return c.JSON(http.StatusOK, after)
+}
+
+// ListOperatorsHandler lists the mobile operators.
+// @Summary List Operators
+// @Description List the mobile operators with their prefixes and the provider which their messages are sent through
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} OperatorResponse
+// @Failure 500 {object} models.Response
+// @Router /admin/operators [get]
+func ListOperatorsHandler(c echo.Context, db *gorm.DB) error {
+	var operators []models.Operator
+	err := db.Preload("Prefixes", func(db *gorm.DB) *gorm.DB { return db.Order("prefix") }).
+		Order("name").Find(&operators).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Operators"})
+	}
+
+	response := make([]OperatorResponse, 0, len(operators))
+	for _, operator := range operators {
+		response = append(response, newOperatorResponse(operator))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// CreateOperatorHandler creates a mobile operator.
+// @Summary Create Operator
+// @Description Create a mobile operator, recipients are detected by the longest matching prefix
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param body body OperatorRequest true "Operator"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} OperatorResponse
+// @Failure 400 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/operators [post]
+func CreateOperatorHandler(c echo.Context, db *gorm.DB) error {
+	var body OperatorRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if body.Name == nil || body.Prefixes == nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Name And Prefixes Are Required"})
+	}
+
+	var operator models.Operator
+	if msg := applyOperatorRequest(db, &operator, body); msg != "" {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: msg})
+	}
+	return saveOperator(c, db, models.AuditActionOperatorCreate, &operator, nil, true)
+}
+
+// UpdateOperatorHandler updates a mobile operator.
+// @Summary Update Operator
+// @Description Update the name, provider or prefixes of a mobile operator, the prefixes in the request replace the current ones
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Operator ID"
+// @Param body body OperatorRequest true "Operator"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} OperatorResponse
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/operators/{id} [patch]
+func UpdateOperatorHandler(c echo.Context, db *gorm.DB) error {
+	var operator models.Operator
+	if err := db.Preload("Prefixes").First(&operator, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Operator Not Found"})
+	}
+	before := newOperatorResponse(operator)
+
+	var body OperatorRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if msg := applyOperatorRequest(db, &operator, body); msg != "" {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: msg})
+	}
+	return saveOperator(c, db, models.AuditActionOperatorUpdate, &operator, before, body.Prefixes != nil)
+}
+
+// DeleteOperatorHandler deletes a mobile operator.
+// @Summary Delete Operator
+// @Description Delete a mobile operator and its route, its messages stay in the reports as messages of an unknown operator
+// @Tags admin
+// @Produce json
+// @Param id path int true "Operator ID"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/operators/{id} [delete]
+func DeleteOperatorHandler(c echo.Context, db *gorm.DB) error {
+	var operator models.Operator
+	if err := db.Preload("Prefixes").First(&operator, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Operator Not Found"})
+	}
+
+	tx := db.Begin()
+	err := tx.Where("operator_id = ?", operator.ID).Delete(&models.OperatorPrefix{}).Error
+	if err == nil {
+		err = tx.Model(&models.SMSMessage{}).Where("operator_id = ?", operator.ID).Update("operator_id", nil).Error
+	}
+	if err == nil {
+		err = tx.Model(&models.PhoneBookNumber{}).Where("operator_id = ?", operator.ID).Update("operator_id", nil).Error
+	}
+	if err == nil {
+		err = tx.Where("operator_id = ?", operator.ID).Delete(&models.ProviderRoute{}).Error
+	}
+	if err == nil {
+		err = tx.Delete(&operator).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Delete Operator"})
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionOperatorDelete, auditTarget("operator", operator.ID), newOperatorResponse(operator), nil); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+	utils.Operators.Invalidate()
+	utils.Providers.Invalidate()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Operator Deleted"})
+}
+
+// OperatorReportHandler reports the messages per operator.
+// @Summary Get Operator Report
+// @Description Count the messages and the delivered messages to each operator, optionally of one account and in a period
+// @Tags admin
+// @Produce json
+// @Param account_id query int false "Account ID"
+// @Param from query string false "From date (YYYY-MM-DD)"
+// @Param to query string false "To date (YYYY-MM-DD), inclusive"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} OperatorReportRow
+// @Failure 400 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/operators/report [get]
+func OperatorReportHandler(c echo.Context, db *gorm.DB) error {
+	query := db.Model(&models.SMSMessage{})
+	if accountID := c.QueryParam("account_id"); accountID != "" {
+		query = query.Where("sms_messages.account_id = ?", accountID)
+	}
+	if from := c.QueryParam("from"); from != "" {
+		fromDate, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid From Date"})
+		}
+		query = query.Where("sms_messages.created_at >= ?", fromDate)
+	}
+	if to := c.QueryParam("to"); to != "" {
+		toDate, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid To Date"})
+		}
+		query = query.Where("sms_messages.created_at < ?", toDate.AddDate(0, 0, 1))
+	}
+
+	var rows []OperatorReportRow
+	err := query.
+		Select("sms_messages.operator_id AS operator_id, COALESCE(operators.name, '') AS operator, "+
+			"COUNT(*) AS messages, SUM(CASE WHEN sms_messages.delivery_report = ? THEN 1 ELSE 0 END) AS delivered",
+			"Message sent successfully").
+		Joins("LEFT JOIN operators ON operators.id = sms_messages.operator_id").
+		Group("sms_messages.operator_id, operators.name").
+		Order("messages desc").
+		Scan(&rows).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Create Report"})
+	}
+	if rows == nil {
+		rows = []OperatorReportRow{}
+	}
+	return c.JSON(http.StatusOK, rows)
+}
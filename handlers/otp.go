@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	otpDefaultTemplate    = "Your verification code: %code"
+	otpDefaultLength      = 6
+	otpDefaultTTL         = 120
+	otpMaxTTL             = 900
+	otpDefaultMaxAttempts = 5
+)
+
+// Results of an OTP verification
+const (
+	OTPStatusVerified        = "verified"
+	OTPStatusInvalid         = "invalid"
+	OTPStatusExpired         = "expired"
+	OTPStatusTooManyAttempts = "too_many_attempts"
+)
+
+type OTPSendRequest struct {
+	SenderNumber string `json:"senderNumber" example:"10001"`
+	PhoneNumber  string `json:"phoneNumber" example:"09123456789"`
+	Template     string `json:"template" example:"Your login code is %code"`
+	Length       int    `json:"length" example:"6"`
+	TTL          int    `json:"ttl" example:"120"`
+	MaxAttempts  int    `json:"maxAttempts" example:"5"`
+}
+
+type OTPSendResponse struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type OTPVerifyRequest struct {
+	ID   string `json:"id"`
+	Code string `json:"code" example:"123456"`
+}
+
+type OTPVerifyResponse struct {
+	Status            string `json:"status" example:"verified"`
+	RemainingAttempts int    `json:"remainingAttempts"`
+}
+
+// SendOTPHandler generates a code and sends it to the phone number with high priority
+// @Summary Send an OTP code
+// @Description Generate a verification code and send it with a template in which %code is replaced by the code. It is charged like a single SMS.
+// @Tags otp
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param body body OTPSendRequest true "OTP details"
+// @Success 200 {object} OTPSendResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /otp/send [post]
+func SendOTPHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+	member, isMember := c.Get("member").(models.AccountMember)
+	ctx := c.Request().Context()
+
+	var body OTPSendRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+
+	if body.Template == "" {
+		body.Template = otpDefaultTemplate
+	}
+	if body.Length == 0 {
+		body.Length = otpDefaultLength
+	}
+	if body.TTL == 0 {
+		body.TTL = otpDefaultTTL
+	}
+	if body.MaxAttempts == 0 {
+		body.MaxAttempts = otpDefaultMaxAttempts
+	}
+
+	phone, err := utils.NormalizePhone(body.PhoneNumber, utils.IranCallingCode)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid phone number"})
+	}
+	body.PhoneNumber = phone
+	if !strings.Contains(body.Template, "%code") {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Template must contain %code"})
+	}
+	if body.Length < 4 || body.Length > 10 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Length must be between 4 and 10"})
+	}
+	if body.TTL < 0 || body.TTL > otpMaxTTL {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "TTL must be between 0 and 900 seconds"})
+	}
+	if body.MaxAttempts < 0 || body.MaxAttempts > 10 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Max attempts must be between 0 and 10"})
+	}
+
+	if !utils.IsSenderNumberExist(ctx, db, body.SenderNumber, account.UserID) {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "Sender number not found!"})
+	}
+
+	code, err := utils.GenerateNumericCode(body.Length)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to generate code"})
+	}
+	token, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to generate code"})
+	}
+
+	// the account and member are locked so parallel requests can't spend the same budget,
+	// and the code is charged before it is sent; the charge is refunded if sending fails
+	tx := db.Begin()
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, account.ID).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	if isMember {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&member, member.ID).Error; err != nil {
+			tx.Rollback()
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+		}
+	}
+
+	cost, err := utils.MessagePrice(tx, account, body.SenderNumber, body.PhoneNumber, false)
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to retrieve single SMS cost"})
+	}
+	if utils.AvailableBudget(account) < cost {
+		tx.Rollback()
+		return c.JSON(http.StatusForbidden, ErrorResponse{Message: "Insufficient budget"})
+	}
+	if isMember && !utils.CanMemberSpend(member, cost) {
+		tx.Rollback()
+		return c.JSON(http.StatusForbidden, ErrorResponse{Message: "Spending limit exceeded"})
+	}
+
+	err = tx.Model(&models.Account{}).Where("id = ?", account.ID).
+		Update("budget", gorm.Expr("budget - ?", cost)).Error
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update account's budget"})
+	}
+	if err := utils.RecordSpending(tx, account.ID, cost, "otp"); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update account's budget"})
+	}
+	if isMember {
+		if err := utils.AddMemberSpending(tx, member.ID, cost); err != nil {
+			tx.Rollback()
+			if errors.Is(err, utils.ErrSpendingLimitExceeded) {
+				return c.JSON(http.StatusForbidden, ErrorResponse{Message: "Spending limit exceeded"})
+			}
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update member's spending"})
+		}
+	}
+
+	otp := models.OTPCode{
+		AccountID:    account.ID,
+		Token:        token,
+		SenderNumber: body.SenderNumber,
+		Recipient:    body.PhoneNumber,
+		CodeHash:     utils.HashCode(code),
+		MaxAttempts:  body.MaxAttempts,
+		ExpiresAt:    time.Now().Add(time.Duration(body.TTL) * time.Second),
+		CreatedAt:    time.Now(),
+	}
+	if err := tx.Create(&otp).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to save OTP code"})
+	}
+	if err := tx.Commit().Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update account's budget"})
+	}
+
+	text := strings.ReplaceAll(body.Template, "%code", code)
+	deliveryReport, err := SendMessage(&Message{
+		Text:        text,
+		Source:      body.SenderNumber,
+		Destination: body.PhoneNumber,
+		Priority:    PriorityHigh,
+		RateLimits:  messageRateLimits(c, db),
+	}, db)
+	if err != nil {
+		if refundErr := refundOTP(db, otp, member, isMember, cost); refundErr != nil {
+			log.Printf("Failed to refund OTP of account %d: %v", account.ID, refundErr)
+		}
+		if rateLimitErr, ok := err.(utils.RateLimitError); ok {
+			setRetryAfter(c, rateLimitErr)
+			return c.JSON(http.StatusTooManyRequests, ErrorResponse{Message: "Rate limit exceeded"})
+		}
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: err.Error()})
+	}
+
+	// the code itself isn't kept in the message history
+	sms := models.SMSMessage{
+		Sender:         body.SenderNumber,
+		Recipient:      body.PhoneNumber,
+		Message:        strings.ReplaceAll(body.Template, "%code", strings.Repeat("*", body.Length)),
+		DeliveryReport: deliveryReport,
+		CreatedAt:      time.Now(),
+		AccountID:      account.ID,
+		MemberID:       member.MemberID,
+		OperatorID:     utils.DetectOperatorID(db, body.PhoneNumber),
+	}
+	if err := db.Create(&sms).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to save SMS message"})
+	}
+
+	return c.JSON(http.StatusOK, OTPSendResponse{ID: otp.Token, ExpiresAt: otp.ExpiresAt})
+}
+
+// refundOTP gives back the cost of an OTP which couldn't be sent and removes its code
+func refundOTP(db *gorm.DB, otp models.OTPCode, member models.AccountMember, isMember bool, cost int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&otp).Error; err != nil {
+			return err
+		}
+		if err := utils.RefundSpending(tx, otp.AccountID, cost, "otp not sent"); err != nil {
+			return err
+		}
+		if isMember {
+			return utils.AddMemberSpending(tx, member.ID, -cost)
+		}
+		return nil
+	})
+}
+
+// VerifyOTPHandler checks a code sent by SendOTPHandler
+// @Summary Verify an OTP code
+// @Description Check a code which is sent with /otp/send. A code can be verified once, before it is expired and within its attempt limit.
+// @Tags otp
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param body body OTPVerifyRequest true "OTP ID and code"
+// @Success 200 {object} OTPVerifyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} OTPVerifyResponse
+// @Failure 422 {object} OTPVerifyResponse
+// @Failure 429 {object} OTPVerifyResponse
+// @Router /otp/verify [post]
+func VerifyOTPHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	var body OTPVerifyRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+
+	var otp models.OTPCode
+	if err := db.Where("token = ? AND account_id = ?", body.ID, account.ID).First(&otp).Error; err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Message: "OTP not found"})
+	}
+
+	if otp.VerifiedAt != nil || time.Now().After(otp.ExpiresAt) {
+		return c.JSON(http.StatusGone, OTPVerifyResponse{Status: OTPStatusExpired})
+	}
+
+	// attempts are counted in the database so concurrent guesses can't pass the limit
+	result := db.Model(&models.OTPCode{}).
+		Where("id = ? AND attempts < max_attempts", otp.ID).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusTooManyRequests, OTPVerifyResponse{Status: OTPStatusTooManyAttempts})
+	}
+	remaining := otp.MaxAttempts - otp.Attempts - 1
+
+	if !utils.CheckCodeHash(strings.TrimSpace(body.Code), otp.CodeHash) {
+		return c.JSON(http.StatusUnprocessableEntity, OTPVerifyResponse{Status: OTPStatusInvalid, RemainingAttempts: remaining})
+	}
+
+	// a code can be verified once
+	now := time.Now()
+	result = db.Model(&models.OTPCode{}).
+		Where("id = ? AND verified_at IS NULL", otp.ID).
+		Update("verified_at", &now)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusGone, OTPVerifyResponse{Status: OTPStatusExpired})
+	}
+
+	return c.JSON(http.StatusOK, OTPVerifyResponse{Status: OTPStatusVerified, RemainingAttempts: remaining})
+}
@@ -68,14 +68,17 @@ func (p *PhonebookHandler) CreatePhoneBookNumber(c echo.Context) error {
 	phoneBookNumber.PhoneBook = phoneBook
 	phoneBookNumber.PhoneBook.AccountID = account.ID
 
-	// Check Phone Number Validation
-	if !utils.ValidatePhone(phoneBookNumber.Phone) {
-		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "Invalid Phone Number"})
+	// Check Phone Number Validation, national numbers are of the country of the prefix
+	phone, err := utils.NormalizePhone(phoneBookNumber.Phone, phoneBookNumber.Prefix)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
 	}
+	phoneBookNumber.Phone = phone
+	phoneBookNumber.Prefix = utils.PhoneCallingCode(phone)
 
 	// Is Input Phone Number Unique or Not
 	var existingPhoneBookNumber models.PhoneBookNumber
-	p.db.Where("phone = ? AND prefix = ?", phoneBookNumber.Phone, phoneBookNumber.Prefix).First(&existingPhoneBookNumber)
+	p.db.Where("phone = ?", phoneBookNumber.Phone).First(&existingPhoneBookNumber)
 	if existingPhoneBookNumber.ID != 0 {
 		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "Input Phone Number has already been registered"})
 	}
@@ -85,6 +88,7 @@ func (p *PhonebookHandler) CreatePhoneBookNumber(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "Input Username has already been registered"})
 	}
 
+	phoneBookNumber.OperatorID = utils.DetectOperatorID(p.db, phoneBookNumber.Phone)
 	result = p.db.Create(&phoneBookNumber)
 	if result.Error != nil {
 		return c.JSON(http.StatusInternalServerError, result.Error.Error())
@@ -182,14 +186,24 @@ func (p *PhonebookHandler) UpdatePhoneBookNumber(c echo.Context) error {
 	}
 
 	// Update the fields of the existing phone book number
-	if updatedPhoneBookNumber.Prefix != "" {
-		existingPhoneBookNumber.Prefix = updatedPhoneBookNumber.Prefix
-	}
 	if updatedPhoneBookNumber.Name != "" {
 		existingPhoneBookNumber.Name = updatedPhoneBookNumber.Name
 	}
-	if updatedPhoneBookNumber.Phone != "" {
-		existingPhoneBookNumber.Phone = updatedPhoneBookNumber.Phone
+	// the prefix is the country of the phone, a national phone is of the country of the new prefix
+	if updatedPhoneBookNumber.Phone != "" || updatedPhoneBookNumber.Prefix != "" {
+		if updatedPhoneBookNumber.Phone == "" {
+			updatedPhoneBookNumber.Phone = existingPhoneBookNumber.Phone
+		}
+		if updatedPhoneBookNumber.Prefix == "" {
+			updatedPhoneBookNumber.Prefix = existingPhoneBookNumber.Prefix
+		}
+		phone, err := utils.NormalizePhone(updatedPhoneBookNumber.Phone, updatedPhoneBookNumber.Prefix)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		existingPhoneBookNumber.Phone = phone
+		existingPhoneBookNumber.Prefix = utils.PhoneCallingCode(phone)
+		existingPhoneBookNumber.OperatorID = utils.DetectOperatorID(p.db, phone)
 	}
 
 	// Use the `clause.OnConflict` to avoid updating the primary key
@@ -5,16 +5,19 @@ import (
 	"net/http"
 
 	"SMS-panel/models"
+	"SMS-panel/utils"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
 type SendSMessageToPhoneBooksBody struct {
-	Account      models.Account `json:"-"`
-	SenderNumber string         `json:"senderNumbers" binding:"required"`
-	PhoneBooks   []string       `json:"phoneBooks" binding:"required"`
-	Message      string         `json:"message" binding:"required"`
+	Account      models.Account       `json:"-"`
+	Member       models.AccountMember `json:"-"`
+	RateLimits   []utils.RateLimit    `json:"-"`
+	SenderNumber string               `json:"senderNumbers" binding:"required"`
+	PhoneBooks   []string             `json:"phoneBooks" binding:"required"`
+	Message      string               `json:"message" binding:"required"`
 }
 
 type SmsPhoneBookHandler struct {
@@ -35,12 +38,16 @@ func NewSmsPhoneBookHandler(db *gorm.DB) *SmsPhoneBookHandler {
 // @Success 200 {object} SendSMSResponse
 // @Failure 204 {object} ErrorResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /sms/phonebooks [post]
 func (sp *SmsPhoneBookHandler) SendMessageToPhoneBooksHandler(c echo.Context) error {
 	account := c.Get("account").(models.Account)
 	body := SendSMessageToPhoneBooksBody{}
 	body.Account = account
+	body.Member, _ = c.Get("member").(models.AccountMember)
+	body.RateLimits = messageRateLimits(c, sp.db)
 	ctx := c.Request().Context()
 
 	if err := c.Bind(&body); err != nil {
@@ -51,6 +58,10 @@ func (sp *SmsPhoneBookHandler) SendMessageToPhoneBooksHandler(c echo.Context) er
 	}
 
 	err := SendMessageToPhoneBooks(ctx, body, sp.db)
+	// a campaign may stop partway when the budget runs out, so it is alerted right away
+	if checkErr := CheckLowBalance(sp.db, account.ID); checkErr != nil {
+		log.Printf("Failed to check low balance of account %d: %v", account.ID, checkErr)
+	}
 	if err != nil {
 		errorResponse := ErrorResponse{
 			Message: err.Error(),
@@ -64,6 +75,11 @@ func (sp *SmsPhoneBookHandler) SendMessageToPhoneBooksHandler(c echo.Context) er
 			return c.JSON(http.StatusNoContent, errorResponse)
 		case SenderNumberNotFoundError:
 			return c.JSON(http.StatusNotFound, errorResponse)
+		case MemberSpendingLimitError:
+			return c.JSON(http.StatusForbidden, errorResponse)
+		case utils.RateLimitError:
+			setRetryAfter(c, e)
+			return c.JSON(http.StatusTooManyRequests, ErrorResponse{Message: "Rate limit exceeded"})
 		default:
 			log.Println(e)
 			errorResponse := ErrorResponse{
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -40,10 +41,12 @@ type SendSMSRequestPeriodic struct {
 // @Failure 400 {string} string "Recipient not provided"
 // @Failure 400 {string} string "Recipient does not exist in the phone book"
 // @Failure 400 {string} string "Insufficient budget"
+// @Failure 403 {string} string "Spending limit exceeded"
 // @Failure 500 {string} string "Internal server error"
 // @Router /sms/periodic [post]
 func PeriodicSendSMSHandler(c echo.Context, db *gorm.DB) error {
 	account := c.Get("account").(models.Account)
+	member, _ := c.Get("member").(models.AccountMember)
 	ctx := c.Request().Context()
 	var request SendSMSRequestPeriodic
 	if err := c.Bind(&request); err != nil {
@@ -75,7 +78,11 @@ func PeriodicSendSMSHandler(c echo.Context, db *gorm.DB) error {
 		Where("phone_books.account_id = ?", account.ID)
 
 	if request.Phone != "" {
-		phoneNumberQuery = phoneNumberQuery.Where("phone_book_numbers.phone = ?", request.Phone)
+		phone, err := utils.NormalizePhone(request.Phone, utils.IranCallingCode)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid phone number")
+		}
+		phoneNumberQuery = phoneNumberQuery.Where("phone_book_numbers.phone = ?", phone)
 	} else if request.Username != "" {
 		phoneNumberQuery = phoneNumberQuery.Where("phone_book_numbers.username = ?", request.Username)
 	} else if request.PhoneBookID != "" {
@@ -86,13 +93,25 @@ func PeriodicSendSMSHandler(c echo.Context, db *gorm.DB) error {
 	if err := phoneNumberQuery.Preload("PhoneBook").Find(&phoneBookNumbers).Error; err != nil {
 		return c.String(http.StatusBadRequest, "Recipient does not exist in the phone book")
 	}
-	smsCount := len(phoneBookNumbers)
-	reduceErr := reduceAccountBudget(db, account, smsCount)
+	recipients := make([]string, 0, len(phoneBookNumbers))
+	for _, phoneBookNumber := range phoneBookNumbers {
+		recipients = append(recipients, phoneBookNumber.Phone)
+	}
+	prices, err := utils.LoadPriceList(db, account, request.SenderNumber, len(phoneBookNumbers) > 1)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to retrieve SMS costs")
+	}
+	// the messages are charged when they are sent on each run, the first run must be affordable
+	checkErr := checkAccountBudget(db, account, member, prices.Total(recipients))
 
-	if reduceErr != nil {
+	if checkErr != nil {
+		if _, ok := checkErr.(MemberSpendingLimitError); ok {
+			return c.String(http.StatusForbidden, "Spending limit exceeded")
+		}
 		return c.String(http.StatusBadRequest, "Insufficient budget")
 	}
 
+	rateLimits := messageRateLimits(c, db)
 	scheduler := gocron.NewScheduler(time.UTC)
 
 	switch request.Interval {
@@ -100,7 +119,7 @@ func PeriodicSendSMSHandler(c echo.Context, db *gorm.DB) error {
 		_, err := scheduler.Every(1).Hour().StartAt(scheduleTime).Do(func() {
 			log.Println("schdule time is 2 ", scheduleTime)
 			log.Println("now is in cron jobs ", time.Now().UTC())
-			sendSMS(db, request.SenderNumber, phoneBookNumbers, account, request, scheduleTime)
+			sendSMS(db, request.SenderNumber, phoneBookNumbers, account, member, rateLimits, request, scheduleTime)
 		})
 		if err != nil {
 			log.Printf("Failed to schedule hourly task: %s", err.Error())
@@ -109,7 +128,7 @@ func PeriodicSendSMSHandler(c echo.Context, db *gorm.DB) error {
 
 	case "daily":
 		_, err := scheduler.Every(1).Day().At(scheduleTime.Format("15:04")).Do(func() {
-			sendSMS(db, request.SenderNumber, phoneBookNumbers, account, request, scheduleTime)
+			sendSMS(db, request.SenderNumber, phoneBookNumbers, account, member, rateLimits, request, scheduleTime)
 		})
 		if err != nil {
 			return c.String(http.StatusInternalServerError, "Failed to schedule SMS")
@@ -121,17 +140,26 @@ func PeriodicSendSMSHandler(c echo.Context, db *gorm.DB) error {
 	return c.String(http.StatusOK, "SMS scheduled successfully")
 }
 
-func sendSMS(db *gorm.DB, senderNumber string, phoneBookNumbers []models.PhoneBookNumber, account models.Account, request SendSMSRequestPeriodic, scheduleTime time.Time) {
+func sendSMS(db *gorm.DB, senderNumber string, phoneBookNumbers []models.PhoneBookNumber, account models.Account, member models.AccountMember, rateLimits []utils.RateLimit, request SendSMSRequestPeriodic, scheduleTime time.Time) {
+	// prices are loaded on every run, the plan and the volume tier may have changed
+	prices, err := utils.LoadPriceList(db, account, senderNumber, len(phoneBookNumbers) > 1)
+	if err != nil {
+		log.Printf("Failed to retrieve SMS costs: %s", err.Error())
+		return
+	}
+
 	for _, phoneBookNumber := range phoneBookNumbers {
 		templateMessage := CreateSMSTemplate(request.Message, phoneBookNumber)
 		sms := &models.SMSMessage{
-			Sender:    senderNumber,
-			Recipient: phoneBookNumber.Phone,
-			Message:   templateMessage,
-			AccountID: account.ID,
-			Schedule:  &scheduleTime,
+			Sender:     senderNumber,
+			Recipient:  phoneBookNumber.Phone,
+			Message:    templateMessage,
+			AccountID:  account.ID,
+			MemberID:   member.MemberID,
+			Schedule:   &scheduleTime,
+			OperatorID: utils.DetectOperatorID(db, phoneBookNumber.Phone),
 		}
-		reduceErr := reduceAccountBudget(db, account, 1)
+		reduceErr := reduceAccountBudget(db, account, member, prices.Price(phoneBookNumber.Phone))
 		log.Println("Budget reduced")
 
 		if reduceErr != nil {
@@ -145,14 +173,19 @@ func sendSMS(db *gorm.DB, senderNumber string, phoneBookNumbers []models.PhoneBo
 			continue
 		}
 
-		deliveryReport, err := MockSendMessage(&Message{
-			Text:        sms.Message,
-			Source:      sms.Sender,
-			Destination: sms.Recipient,
+		deliveryReport, err := SendMessage(&Message{
+			Text:             sms.Message,
+			Source:           sms.Sender,
+			Destination:      sms.Recipient,
+			RateLimits:       rateLimits,
+			WaitForRateLimit: true,
 		}, db)
 		if err != nil {
 			sms.DeliveryReport = deliveryReport
 			log.Printf("Failed to send SMS: %s", err.Error())
+			if err := refundMessage(db, account.ID, member.ID, prices.Price(phoneBookNumber.Phone), "periodic sms not sent"); err != nil {
+				log.Printf("Failed to refund periodic sms of account %d: %v", account.ID, err)
+			}
 		} else {
 			sms.DeliveryReport = deliveryReport
 		}
@@ -166,6 +199,10 @@ func sendSMS(db *gorm.DB, senderNumber string, phoneBookNumbers []models.PhoneBo
 
 		time.Sleep(time.Second)
 	}
+
+	if err := CheckLowBalance(db, account.ID); err != nil {
+		log.Printf("Failed to check low balance of account %d: %v", account.ID, err)
+	}
 }
 
 func parseTime(schedule string) (time.Time, error) {
@@ -191,37 +228,42 @@ func parseTime(schedule string) (time.Time, error) {
 	return scheduleTime, nil
 }
 
-func reduceAccountBudget(db *gorm.DB, account models.Account, smsCount int) error {
-	var smsCost int
-
-	if smsCount == 1 {
-		if err := db.Table("configuration").
-			Where("name = ?", "single sms").
-			Pluck("value", &smsCost).Error; err != nil {
-			log.Printf("Failed to retrieve single SMS cost: %s", err.Error())
-			return err
-		}
-	} else {
-		if err := db.Table("configuration").
-			Where("name IN (?)", []string{"single sms", "group sms"}).
-			Pluck("value", &smsCost).Error; err != nil {
-			log.Printf("Failed to retrieve SMS costs: %s", err.Error())
-			return err
-		}
+// checkAccountBudget checks that the account can afford the cost and the member can spend it
+func checkAccountBudget(db *gorm.DB, account models.Account, member models.AccountMember, totalCost int64) error {
+	// reload account, its budget may have changed since it was put in the context
+	if err := db.First(&account, account.ID).Error; err != nil {
+		return err
 	}
-
-	totalCost := smsCost * smsCount
-
-	if account.Budget < int64(totalCost) {
+	if utils.AvailableBudget(account) < totalCost {
 		return fmt.Errorf("insufficient budget")
 	}
 
-	account.Budget -= int64(totalCost)
-
-	if err := db.Save(&account).Error; err != nil {
-		log.Printf("Failed to update account's budget: %s", err.Error())
-		return err
+	if member.ID != 0 {
+		if err := db.First(&member, member.ID).Error; err != nil {
+			return err
+		}
+		if !utils.CanMemberSpend(member, totalCost) {
+			return MemberSpendingLimitError{Message: "Spending limit exceeded"}
+		}
 	}
-
 	return nil
 }
+
+// reduceAccountBudget charges the account and the member for a run of the job. The budget
+// and the spending limit are checked by the updates, the account and member which the job
+// was scheduled with may be long out of date.
+func reduceAccountBudget(db *gorm.DB, account models.Account, member models.AccountMember, totalCost int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := utils.ChargeBudget(tx, account.ID, totalCost, "periodic sms"); err != nil {
+			return err
+		}
+		if member.ID != 0 {
+			err := utils.AddMemberSpending(tx, member.ID, totalCost)
+			if errors.Is(err, utils.ErrSpendingLimitExceeded) {
+				return MemberSpendingLimitError{Message: "Spending limit exceeded"}
+			}
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type PriceTierRequest struct {
+	MinMessages     int `json:"minMessages" example:"10000"`
+	DiscountPercent int `json:"discountPercent" example:"10"`
+}
+
+type PriceRateRequest struct {
+	// Prefix is matched with the recipient without + or 00, e.g. 98912
+	Prefix string `json:"prefix" example:"98912"`
+	Name   string `json:"name" example:"MCI"`
+	Price  int64  `json:"price" example:"150"`
+}
+
+type PriceSurchargeRequest struct {
+	SenderType string `json:"senderType" example:"exclusive"`
+	Amount     int64  `json:"amount" example:"20"`
+}
+
+type PricesResponse struct {
+	Tiers      []models.PriceTier      `json:"tiers"`
+	Rates      []models.PriceRate      `json:"rates"`
+	Surcharges []models.PriceSurcharge `json:"surcharges"`
+}
+
+type PriceQuoteResponse struct {
+	Price           int64 `json:"price"`
+	Base            int64 `json:"base"`
+	DiscountPercent int   `json:"discountPercent"`
+	Surcharge       int64 `json:"surcharge"`
+}
+
+// savePriceRule saves the rule of the plan and writes its audit log, before is nil for a new rule
+func savePriceRule(c echo.Context, db *gorm.DB, kind string, id func() uint, rule interface{}, before interface{}) error {
+	tx := db.Begin()
+	if err := tx.Save(rule).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Save Price"})
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionPriceRuleSet, auditTarget(kind, id()), before, rule); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// deletePriceRule deletes the rule of the request's plan and writes its audit log
+func deletePriceRule(c echo.Context, db *gorm.DB, kind string, rule interface{}) error {
+	ruleID, _ := strconv.Atoi(c.Param("ruleID"))
+	err := db.Where("id = ? AND pricing_plan_id = ?", ruleID, c.Param("id")).First(rule).Error
+	if err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Price Not Found"})
+	}
+
+	tx := db.Begin()
+	if err := tx.Delete(rule).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Delete Price"})
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionPriceRuleDelete, auditTarget(kind, uint(ruleID)), rule, nil); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Price Deleted"})
+}
+
+// PricesHandler lists the volume tiers, destination rates and sender surcharges of a plan.
+// @Summary List prices of a pricing plan
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Pricing plan ID"
+// @Success 200 {object} PricesResponse
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans/{id}/prices [get]
+func PricesHandler(c echo.Context, db *gorm.DB) error {
+	var plan models.PricingPlan
+	if err := db.First(&plan, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Pricing Plan Not Found"})
+	}
+
+	response := PricesResponse{
+		Tiers:      []models.PriceTier{},
+		Rates:      []models.PriceRate{},
+		Surcharges: []models.PriceSurcharge{},
+	}
+	err := db.Where("pricing_plan_id = ?", plan.ID).Order("min_messages").Find(&response.Tiers).Error
+	if err == nil {
+		err = db.Where("pricing_plan_id = ?", plan.ID).Order("prefix").Find(&response.Rates).Error
+	}
+	if err == nil {
+		err = db.Where("pricing_plan_id = ?", plan.ID).Order("sender_type").Find(&response.Surcharges).Error
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Prices"})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// SetPriceTierHandler sets the discount of a volume tier of a plan.
+// @Summary Set a volume tier of a pricing plan
+// @Description Messages of the accounts which have sent at least minMessages messages in the current month are discounted, the tier with the most messages is used
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Pricing plan ID"
+// @Param body body PriceTierRequest true "Volume tier"
+// @Success 200 {object} models.PriceTier
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans/{id}/tiers [put]
+func SetPriceTierHandler(c echo.Context, db *gorm.DB) error {
+	var plan models.PricingPlan
+	if err := db.First(&plan, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Pricing Plan Not Found"})
+	}
+
+	var body PriceTierRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if body.MinMessages <= 0 {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Min Messages Must Be Positive"})
+	}
+	if body.DiscountPercent < 0 || body.DiscountPercent > 100 {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Discount Percent Must Be Between 0 And 100"})
+	}
+
+	var tier models.PriceTier
+	var before interface{}
+	if db.Where("pricing_plan_id = ? AND min_messages = ?", plan.ID, body.MinMessages).First(&tier).Error == nil {
+		before = tier
+	}
+	tier.PricingPlanID = plan.ID
+	tier.MinMessages = body.MinMessages
+	tier.DiscountPercent = body.DiscountPercent
+
+	return savePriceRule(c, db, "price_tier", func() uint { return tier.ID }, &tier, before)
+}
+
+// DeletePriceTierHandler deletes a volume tier of a plan.
+// @Summary Delete a volume tier of a pricing plan
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Pricing plan ID"
+// @Param ruleID path int true "Volume tier ID"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans/{id}/tiers/{ruleID} [delete]
+func DeletePriceTierHandler(c echo.Context, db *gorm.DB) error {
+	return deletePriceRule(c, db, "price_tier", &models.PriceTier{})
+}
+
+// SetPriceRateHandler sets the price of the messages to a destination prefix.
+// @Summary Set a destination rate of a pricing plan
+// @Description Messages to the recipients whose number starts with the prefix have the price instead of the plan's price, the longest matching prefix is used
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Pricing plan ID"
+// @Param body body PriceRateRequest true "Destination rate"
+// @Success 200 {object} models.PriceRate
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans/{id}/rates [put]
+func SetPriceRateHandler(c echo.Context, db *gorm.DB) error {
+	var plan models.PricingPlan
+	if err := db.First(&plan, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Pricing Plan Not Found"})
+	}
+
+	var body PriceRateRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	prefix := utils.InternationalPrefix(body.Prefix)
+	if prefix == "" || len(prefix) > 20 || !utils.IsNumeric(prefix) {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Prefix Must Be Digits"})
+	}
+	if body.Price < 0 {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Price Must Not Be Negative"})
+	}
+
+	var rate models.PriceRate
+	var before interface{}
+	if db.Where("pricing_plan_id = ? AND prefix = ?", plan.ID, prefix).First(&rate).Error == nil {
+		before = rate
+	}
+	rate.PricingPlanID = plan.ID
+	rate.Prefix = prefix
+	rate.Name = strings.TrimSpace(body.Name)
+	rate.Price = body.Price
+
+	return savePriceRule(c, db, "price_rate", func() uint { return rate.ID }, &rate, before)
+}
+
+// DeletePriceRateHandler deletes a destination rate of a plan.
+// @Summary Delete a destination rate of a pricing plan
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Pricing plan ID"
+// @Param ruleID path int true "Destination rate ID"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans/{id}/rates/{ruleID} [delete]
+func DeletePriceRateHandler(c echo.Context, db *gorm.DB) error {
+	return deletePriceRule(c, db, "price_rate", &models.PriceRate{})
+}
+
+// SetPriceSurchargeHandler sets the surcharge of the messages from a type of sender number.
+// @Summary Set a sender surcharge of a pricing plan
+// @Description The amount is added to the price of the messages which are sent from a shared, an exclusive or a vanity sender number
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Pricing plan ID"
+// @Param body body PriceSurchargeRequest true "Sender surcharge"
+// @Success 200 {object} models.PriceSurcharge
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans/{id}/surcharges [put]
+func SetPriceSurchargeHandler(c echo.Context, db *gorm.DB) error {
+	var plan models.PricingPlan
+	if err := db.First(&plan, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Pricing Plan Not Found"})
+	}
+
+	var body PriceSurchargeRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	switch body.SenderType {
+	case models.SenderTypeShared, models.SenderTypeExclusive, models.SenderTypeVanity:
+	default:
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Sender Type Must Be shared, exclusive Or vanity"})
+	}
+	if body.Amount < 0 {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Amount Must Not Be Negative"})
+	}
+
+	var surcharge models.PriceSurcharge
+	var before interface{}
+	if db.Where("pricing_plan_id = ? AND sender_type = ?", plan.ID, body.SenderType).First(&surcharge).Error == nil {
+		before = surcharge
+	}
+	surcharge.PricingPlanID = plan.ID
+	surcharge.SenderType = body.SenderType
+	surcharge.Amount = body.Amount
+
+	return savePriceRule(c, db, "price_surcharge", func() uint { return surcharge.ID }, &surcharge, before)
+}
+
+// DeletePriceSurchargeHandler deletes a sender surcharge of a plan.
+// @Summary Delete a sender surcharge of a pricing plan
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Pricing plan ID"
+// @Param ruleID path int true "Sender surcharge ID"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans/{id}/surcharges/{ruleID} [delete]
+func DeletePriceSurchargeHandler(c echo.Context, db *gorm.DB) error {
+	return deletePriceRule(c, db, "price_surcharge", &models.PriceSurcharge{})
+}
+
+// PriceQuoteHandler returns the price of a message of the account
+// @Summary Quote message price
+// @Description Get the price of a message from the sender number to the recipient with the account's pricing plan
+// @Tags sms
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param sender query string false "Sender number"
+// @Param recipient query string true "Recipient phone number"
+// @Param group query bool false "Price of a phone book message"
+// @Success 200 {object} PriceQuoteResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/prices/quote [get]
+func PriceQuoteHandler(c echo.Context, db *gorm.DB) error {
+	account := c.Get("account").(models.Account)
+
+	recipient := c.QueryParam("recipient")
+	if recipient == "" {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Recipient is required"})
+	}
+
+	prices, err := utils.LoadPriceList(db, account, c.QueryParam("sender"), c.QueryParam("group") == "true")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to retrieve prices"})
+	}
+	return c.JSON(http.StatusOK, PriceQuoteResponse{
+		Price:           prices.Price(recipient),
+		Base:            prices.Base,
+		DiscountPercent: prices.DiscountPercent,
+		Surcharge:       prices.Surcharge,
+	})
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"SMS-panel/models"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type PricingPlanRequest struct {
+	Name              *string  `json:"name" example:"business"`
+	IsDefault         *bool    `json:"isDefault"`
+	RequestsPerSecond *float64 `json:"requestsPerSecond" example:"20"`
+	MessagesPerMinute *int     `json:"messagesPerMinute" example:"1200"`
+	// SinglePrice and GroupPrice are the prices of a message, 0 uses the "single sms" and "group sms" configurations
+	SinglePrice *int64 `json:"singlePrice" example:"120"`
+	GroupPrice  *int64 `json:"groupPrice" example:"100"`
+}
+
+type SetAccountPricingPlanRequest struct {
+	// PricingPlanID is null to use the default plan
+	PricingPlanID *uint `json:"pricingPlanID"`
+}
+
+// applyPricingPlanRequest changes the plan by the fields which are in the request
+func applyPricingPlanRequest(plan *models.PricingPlan, body PricingPlanRequest) string {
+	if body.Name != nil {
+		if len(strings.TrimSpace(*body.Name)) == 0 {
+			return "Name Can't Be Empty"
+		}
+		plan.Name = *body.Name
+	}
+	if body.IsDefault != nil {
+		plan.IsDefault = *body.IsDefault
+	}
+	if body.RequestsPerSecond != nil {
+		if *body.RequestsPerSecond <= 0 {
+			return "Requests Per Second Must Be Positive"
+		}
+		plan.RequestsPerSecond = *body.RequestsPerSecond
+	}
+	if body.MessagesPerMinute != nil {
+		if *body.MessagesPerMinute <= 0 {
+			return "Messages Per Minute Must Be Positive"
+		}
+		plan.MessagesPerMinute = *body.MessagesPerMinute
+	}
+	if body.SinglePrice != nil {
+		if *body.SinglePrice < 0 {
+			return "Single Price Must Not Be Negative"
+		}
+		plan.SinglePrice = *body.SinglePrice
+	}
+	if body.GroupPrice != nil {
+		if *body.GroupPrice < 0 {
+			return "Group Price Must Not Be Negative"
+		}
+		plan.GroupPrice = *body.GroupPrice
+	}
+	return ""
+}
+
+// savePricingPlan saves the plan, there is only one default plan
+func savePricingPlan(tx *gorm.DB, plan *models.PricingPlan) error {
+	if plan.IsDefault {
+		err := tx.Model(&models.PricingPlan{}).Where("id <> ? AND is_default = ?", plan.ID, true).
+			Update("is_default", false).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Save(plan).Error
+}
+
+// CreatePricingPlanHandler creates a pricing plan.
+// @Summary Create a pricing plan
+// @Description Create a pricing plan with its rate limits and message prices
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param body body PricingPlanRequest true "Pricing plan"
+// @Success 201 {object} models.PricingPlan
+// @Failure 400 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans [post]
+func CreatePricingPlanHandler(c echo.Context, db *gorm.DB) error {
+	var body PricingPlanRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if body.Name == nil || body.RequestsPerSecond == nil || body.MessagesPerMinute == nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Name, Requests Per Second And Messages Per Minute Are Required"})
+	}
+
+	var plan models.PricingPlan
+	if msg := applyPricingPlanRequest(&plan, body); msg != "" {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: msg})
+	}
+
+	tx := db.Begin()
+	if err := savePricingPlan(tx, &plan); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Failed To Create Pricing Plan"})
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionPricingPlanCreate, auditTarget("pricing_plan", plan.ID), nil, plan); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusCreated, plan)
+}
+
+// ListPricingPlansHandler lists pricing plans.
+// @Summary List pricing plans
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} models.PricingPlan
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans [get]
+func ListPricingPlansHandler(c echo.Context, db *gorm.DB) error {
+	var plans []models.PricingPlan
+	if err := db.Order("id").Find(&plans).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Pricing Plans"})
+	}
+	return c.JSON(http.StatusOK, plans)
+}
+
+// UpdatePricingPlanHandler changes a pricing plan.
+// @Summary Update a pricing plan
+// @Description Change the fields of a pricing plan which are in the request
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Pricing plan ID"
+// @Param body body PricingPlanRequest true "Pricing plan changes"
+// @Success 200 {object} models.PricingPlan
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans/{id} [patch]
+func UpdatePricingPlanHandler(c echo.Context, db *gorm.DB) error {
+	var plan models.PricingPlan
+	if err := db.First(&plan, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Pricing Plan Not Found"})
+	}
+	before := plan
+
+	var body PricingPlanRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if msg := applyPricingPlanRequest(&plan, body); msg != "" {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: msg})
+	}
+
+	tx := db.Begin()
+	if err := savePricingPlan(tx, &plan); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Failed To Update Pricing Plan"})
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionPricingPlanUpdate, auditTarget("pricing_plan", plan.ID), before, plan); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, plan)
+}
+
+// DeletePricingPlanHandler deletes a pricing plan which no account uses.
+// @Summary Delete a pricing plan
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Pricing plan ID"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/pricing-plans/{id} [delete]
+func DeletePricingPlanHandler(c echo.Context, db *gorm.DB) error {
+	var plan models.PricingPlan
+	if err := db.First(&plan, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Pricing Plan Not Found"})
+	}
+
+	var accounts int64
+	db.Model(&models.Account{}).Where("pricing_plan_id = ?", plan.ID).Count(&accounts)
+	if accounts > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Pricing Plan Is Used By " + strconv.FormatInt(accounts, 10) + " Accounts"})
+	}
+
+	tx := db.Begin()
+	for _, rule := range []interface{}{&models.PriceTier{}, &models.PriceRate{}, &models.PriceSurcharge{}} {
+		if err := tx.Where("pricing_plan_id = ?", plan.ID).Delete(rule).Error; err != nil {
+			tx.Rollback()
+			return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Delete Pricing Plan"})
+		}
+	}
+	if err := tx.Delete(&plan).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Delete Pricing Plan"})
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionPricingPlanDelete, auditTarget("pricing_plan", plan.ID), plan, nil); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Pricing Plan Deleted"})
+}
+
+// SetAccountPricingPlanHandler assigns a pricing plan to an account.
+// @Summary Assign a pricing plan to an account
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Param id path int true "Account ID"
+// @Param body body SetAccountPricingPlanRequest true "Pricing plan, null for the default plan"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/accounts/{id}/pricing-plan [patch]
+func SetAccountPricingPlanHandler(c echo.Context, db *gorm.DB) error {
+	var account models.Account
+	if err := db.First(&account, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Account Not Found"})
+	}
+
+	var body SetAccountPricingPlanRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if body.PricingPlanID != nil {
+		if err := db.First(&models.PricingPlan{}, *body.PricingPlanID).Error; err != nil {
+			return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Pricing Plan Not Found"})
+		}
+	}
+
+	tx := db.Begin()
+	if err := tx.Model(&account).Update("pricing_plan_id", body.PricingPlanID).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Update Account"})
+	}
+	err := writeAuditLog(c, tx, models.AuditActionAccountPlan, auditTarget("account", account.ID),
+		map[string]*uint{"pricing_plan_id": account.PricingPlanID}, map[string]*uint{"pricing_plan_id": body.PricingPlanID})
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Pricing Plan Assigned"})
+}
@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type ProviderRequest struct {
+	Name *string `json:"name" example:"magfa"`
+	// Price is what the provider charges for a message, it is used by least-cost routing
+	Price   *int64 `json:"price" example:"90"`
+	Enabled *bool  `json:"enabled" example:"true"`
+}
+
+type ProviderResponse struct {
+	ID      uint                 `json:"id"`
+	Name    string               `json:"name" example:"magfa"`
+	Price   int64                `json:"price" example:"90"`
+	Enabled bool                 `json:"enabled"`
+	Health  utils.ProviderHealth `json:"health"`
+}
+
+type RouteRequest struct {
+	// OperatorID is the operator of the route, null is the default route
+	OperatorID *uint `json:"operatorID" example:"1"`
+	// Providers are the names of the providers which are tried in order, empty removes the route
+	Providers []string `json:"providers" example:"magfa,kavenegar"`
+}
+
+type RouteResponse struct {
+	// OperatorID is null for the default route
+	OperatorID *uint    `json:"operatorID"`
+	Operator   string   `json:"operator" example:"MCI"`
+	Providers  []string `json:"providers"`
+}
+
+func newProviderResponse(provider models.SMSProvider) ProviderResponse {
+	return ProviderResponse{
+		ID:      provider.ID,
+		Name:    provider.Name,
+		Price:   provider.Price,
+		Enabled: provider.Enabled,
+		Health:  utils.ProviderBreakers.Get(provider.Name).Health(),
+	}
+}
+
+// auditProvider is the provider in the audit logs, without its health which changes by itself
+type auditProvider struct {
+	Name    string `json:"name"`
+	Price   int64  `json:"price"`
+	Enabled bool   `json:"enabled"`
+}
+
+func newAuditProvider(provider models.SMSProvider) auditProvider {
+	return auditProvider{Name: provider.Name, Price: provider.Price, Enabled: provider.Enabled}
+}
+
+// applyProviderRequest changes the provider by the fields which are in the request
+func applyProviderRequest(db *gorm.DB, provider *models.SMSProvider, body ProviderRequest) string {
+	if body.Name != nil {
+		name := strings.TrimSpace(*body.Name)
+		if name == "" {
+			return "Name Can't Be Empty"
+		}
+		var count int64
+		db.Model(&models.SMSProvider{}).Where("name = ? AND id <> ?", name, provider.ID).Count(&count)
+		if count > 0 {
+			return "There Is A Provider With This Name"
+		}
+		provider.Name = name
+	}
+	if body.Price != nil {
+		if *body.Price < 0 {
+			return "Price Can't Be Negative"
+		}
+		provider.Price = *body.Price
+	}
+	if body.Enabled != nil {
+		provider.Enabled = *body.Enabled
+	}
+	return ""
+}
+
+// saveProvider saves the provider and writes its audit log
+func saveProvider(c echo.Context, db *gorm.DB, action string, provider *models.SMSProvider, before interface{}) error {
+	tx := db.Begin()
+	if err := tx.Save(provider).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Save Provider"})
+	}
+	if err := writeAuditLog(c, tx, action, auditTarget("provider", provider.ID), before, newAuditProvider(*provider)); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+	utils.Providers.Invalidate()
+
+	return c.JSON(http.StatusOK, newProviderResponse(*provider))
+}
+
+// ListProvidersHandler lists the SMS providers with their health.
+// @Summary List Providers
+// @Description List the SMS providers with their price and the state of their circuit breaker
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} ProviderResponse
+// @Failure 500 {object} models.Response
+// @Router /admin/providers [get]
+func ListProvidersHandler(c echo.Context, db *gorm.DB) error {
+	var providers []models.SMSProvider
+	if err := db.Order("name").Find(&providers).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Providers"})
+	}
+
+	response := make([]ProviderResponse, 0, len(providers))
+	for _, provider := range providers {
+		response = append(response, newProviderResponse(provider))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// CreateProviderHandler creates an SMS provider.
+// @Summary Create Provider
+// @Description Create an SMS provider, it is enabled unless enabled is false
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param body body ProviderRequest true "Provider"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} ProviderResponse
+// @Failure 400 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/providers [post]
+func CreateProviderHandler(c echo.Context, db *gorm.DB) error {
+	var body ProviderRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if body.Name == nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Name Is Required"})
+	}
+
+	provider := models.SMSProvider{Enabled: true}
+	if msg := applyProviderRequest(db, &provider, body); msg != "" {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: msg})
+	}
+	return saveProvider(c, db, models.AuditActionProviderCreate, &provider, nil)
+}
+
+// UpdateProviderHandler updates an SMS provider.
+// @Summary Update Provider
+// @Description Update the name, price or enabled state of an SMS provider
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Provider ID"
+// @Param body body ProviderRequest true "Provider"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} ProviderResponse
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/providers/{id} [patch]
+func UpdateProviderHandler(c echo.Context, db *gorm.DB) error {
+	var provider models.SMSProvider
+	if err := db.First(&provider, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Provider Not Found"})
+	}
+	before := newAuditProvider(provider)
+
+	var body ProviderRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if msg := applyProviderRequest(db, &provider, body); msg != "" {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: msg})
+	}
+	return saveProvider(c, db, models.AuditActionProviderUpdate, &provider, before)
+}
+
+// DeleteProviderHandler deletes an SMS provider.
+// @Summary Delete Provider
+// @Description Delete an SMS provider, remove it from the routes and unbind its sender numbers
+// @Tags admin
+// @Produce json
+// @Param id path int true "Provider ID"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/providers/{id} [delete]
+func DeleteProviderHandler(c echo.Context, db *gorm.DB) error {
+	var provider models.SMSProvider
+	if err := db.First(&provider, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Provider Not Found"})
+	}
+
+	tx := db.Begin()
+	err := tx.Where("provider_id = ?", provider.ID).Delete(&models.ProviderRoute{}).Error
+	if err == nil {
+		err = tx.Model(&models.SenderNumber{}).Where("provider_id = ?", provider.ID).Update("provider_id", nil).Error
+	}
+	if err == nil {
+		err = tx.Delete(&provider).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Delete Provider"})
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionProviderDelete, auditTarget("provider", provider.ID), newAuditProvider(provider), nil); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+	utils.Providers.Invalidate()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Provider Deleted"})
+}
+
+// ResetProviderHandler closes the circuit of an SMS provider.
+// @Summary Reset Provider
+// @Description Close the circuit breaker of an SMS provider, so messages are sent through it again right away
+// @Tags admin
+// @Produce json
+// @Param id path int true "Provider ID"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} ProviderResponse
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/providers/{id}/reset [post]
+func ResetProviderHandler(c echo.Context, db *gorm.DB) error {
+	var provider models.SMSProvider
+	if err := db.First(&provider, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Provider Not Found"})
+	}
+
+	breaker := utils.ProviderBreakers.Get(provider.Name)
+	before := breaker.Health()
+	if err := writeAuditLog(c, db, models.AuditActionProviderReset, auditTarget("provider", provider.ID), before, nil); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	breaker.Reset()
+
+	return c.JSON(http.StatusOK, newProviderResponse(provider))
+}
+
+// ListRoutesHandler lists the routes of the operators.
+// @Summary List Routes
+// @Description List the providers which the messages to each operator are tried through in order, the route without an operator is the default route
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} RouteResponse
+// @Failure 500 {object} models.Response
+// @Router /admin/routes [get]
+func ListRoutesHandler(c echo.Context, db *gorm.DB) error {
+	type routeRow struct {
+		OperatorID *uint
+		Operator   string
+		Provider   string
+	}
+	var rows []routeRow
+	err := db.Model(&models.ProviderRoute{}).
+		Select("provider_routes.operator_id AS operator_id, COALESCE(operators.name, '') AS operator, sms_providers.name AS provider").
+		Joins("JOIN sms_providers ON sms_providers.id = provider_routes.provider_id").
+		Joins("LEFT JOIN operators ON operators.id = provider_routes.operator_id").
+		Order("operators.name, provider_routes.position").
+		Scan(&rows).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Routes"})
+	}
+
+	response := []RouteResponse{}
+	for _, row := range rows {
+		last := len(response) - 1
+		if last < 0 || !sameOperator(response[last].OperatorID, row.OperatorID) {
+			response = append(response, RouteResponse{OperatorID: row.OperatorID, Operator: row.Operator})
+			last++
+		}
+		response[last].Providers = append(response[last].Providers, row.Provider)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func sameOperator(a, b *uint) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// SetRouteHandler replaces the route of an operator.
+// @Summary Set Route
+// @Description Set the providers which the messages to an operator are tried through in order, the next provider is tried when one fails or times out. Without operatorID the default route is set, and empty providers remove the route.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param body body RouteRequest true "Route"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} RouteResponse
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/routes [put]
+func SetRouteHandler(c echo.Context, db *gorm.DB) error {
+	var body RouteRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+
+	response := RouteResponse{OperatorID: body.OperatorID, Providers: []string{}}
+	condition, args := "provider_routes.operator_id IS NULL", []interface{}{}
+	target := "route:default"
+	if body.OperatorID != nil {
+		var operator models.Operator
+		if err := db.First(&operator, *body.OperatorID).Error; err != nil {
+			return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Operator Not Found"})
+		}
+		response.Operator = operator.Name
+		condition, args = "provider_routes.operator_id = ?", []interface{}{operator.ID}
+		target = auditTarget("route", operator.ID)
+	}
+
+	var providers []models.SMSProvider
+	seen := make(map[string]bool)
+	for _, name := range body.Providers {
+		if seen[name] {
+			return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Provider " + name + " Is Repeated"})
+		}
+		seen[name] = true
+		var provider models.SMSProvider
+		if err := db.Where("name = ?", name).First(&provider).Error; err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Provider " + name + " Not Found"})
+		}
+		providers = append(providers, provider)
+		response.Providers = append(response.Providers, provider.Name)
+	}
+
+	var before []string
+	err := db.Model(&models.ProviderRoute{}).Where(condition, args...).
+		Joins("JOIN sms_providers ON sms_providers.id = provider_routes.provider_id").
+		Order("provider_routes.position").Pluck("sms_providers.name", &before).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Routes"})
+	}
+
+	tx := db.Begin()
+	if err := tx.Where(condition, args...).Delete(&models.ProviderRoute{}).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Save Route"})
+	}
+	for i, provider := range providers {
+		route := models.ProviderRoute{OperatorID: body.OperatorID, ProviderID: provider.ID, Position: i}
+		if err := tx.Create(&route).Error; err != nil {
+			tx.Rollback()
+			return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Save Route"})
+		}
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionRouteSet, target, before, response.Providers); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+	utils.Providers.Invalidate()
+
+	return c.JSON(http.StatusOK, response)
+}
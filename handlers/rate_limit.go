@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"strconv"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// messageRateLimits returns the messages per minute limits of the request's account and API key
+func messageRateLimits(c echo.Context, db *gorm.DB) []utils.RateLimit {
+	account := c.Get("account").(models.Account)
+	apiKey, _ := c.Get("api_key").(models.APIKey)
+	return utils.MessageRateLimits(utils.AccountPricingPlan(db, account), account.ID, apiKey.ID)
+}
+
+func setRetryAfter(c echo.Context, err utils.RateLimitError) {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(err.RetryAfterSeconds()))
+}
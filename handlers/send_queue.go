@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"SMS-panel/utils"
+
+	"gorm.io/gorm"
+)
+
+// Priorities of messages in the send queue. High priority messages, e.g. OTP
+// and login codes, are always sent before the normal ones which are waiting.
+const (
+	PriorityNormal = iota
+	PriorityHigh
+)
+
+const (
+	sendWorkersCount = 8
+	sendQueueSize    = 1000
+)
+
+type sendJob struct {
+	message *Message
+	db      *gorm.DB
+	result  chan sendResult
+}
+
+type sendResult struct {
+	deliveryReport string
+	err            error
+}
+
+var (
+	highPriorityQueue   = make(chan sendJob, sendQueueSize)
+	normalPriorityQueue = make(chan sendJob, sendQueueSize)
+	startSendWorkers    sync.Once
+)
+
+func sendWorker() {
+	for {
+		var job sendJob
+		// take a high priority message whenever there is one
+		select {
+		case job = <-highPriorityQueue:
+		default:
+			select {
+			case job = <-highPriorityQueue:
+			case job = <-normalPriorityQueue:
+			}
+		}
+
+		if err := utils.MessageLimiter.Allow(1, job.message.RateLimits...); err != nil {
+			job.result <- sendResult{deliveryReport: "message not sent", err: err}
+			continue
+		}
+
+		deliveryReport, err := deliverMessage(job.message, job.db)
+		job.result <- sendResult{deliveryReport: deliveryReport, err: err}
+	}
+}
+
+// SendMessage puts the message in the send queue of its priority and waits until it is sent.
+// Messages which exceed their rate limits aren't sent and a utils.RateLimitError is
+// returned, unless the message waits for its rate limits.
+func SendMessage(message *Message, db *gorm.DB) (string, error) {
+	startSendWorkers.Do(func() {
+		for i := 0; i < sendWorkersCount; i++ {
+			go sendWorker()
+		}
+	})
+	if message.Provider == "" {
+		message.Provider = utils.SenderProvider(db, message.Source)
+	}
+	for {
+		job := sendJob{message: message, db: db, result: make(chan sendResult, 1)}
+		if message.Priority == PriorityHigh {
+			highPriorityQueue <- job
+		} else {
+			normalPriorityQueue <- job
+		}
+
+		result := <-job.result
+		rateLimitErr, limited := result.err.(utils.RateLimitError)
+		if !limited || !message.WaitForRateLimit {
+			return result.deliveryReport, result.err
+		}
+		time.Sleep(rateLimitErr.RetryAfter)
+	}
+}
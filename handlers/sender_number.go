@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type SenderNumberRequest struct {
+	// Number is only set when the number is created
+	Number *string `json:"number" example:"30001234"`
+	// Type is default, shared, exclusive or vanity, numbers are exclusive when it isn't set
+	Type *string `json:"type" example:"exclusive"`
+	// RentPrice is the price of a month of rent, 0 uses the price of the subscription package
+	RentPrice *int64 `json:"rentPrice" example:"25"`
+	// BuyPrice is the price of buying the number, 0 uses the price of the buy package
+	BuyPrice *int64 `json:"buyPrice" example:"500"`
+	// Provider is the name of the provider which the messages from the number are sent through, empty unbinds it
+	Provider *string `json:"provider" example:"magfa"`
+	// Retired numbers aren't offered anymore, their holders keep them until their rent ends
+	Retired *bool `json:"retired" example:"false"`
+}
+
+type SenderNumberHolder struct {
+	UserNumberID uint   `json:"userNumberID"`
+	UserID       uint   `json:"userID"`
+	Username     string `json:"username" example:"john"`
+	Package      string `json:"package" example:"1 Month"`
+	// Bought is true for the numbers which are bought, they don't have an end date
+	Bought    bool       `json:"bought"`
+	StartDate time.Time  `json:"startDate"`
+	EndDate   *time.Time `json:"endDate,omitempty"`
+	// InGrace is true when the rent has ended and the number is reserved for the account to renew it
+	InGrace bool `json:"inGrace"`
+}
+
+type SenderNumberResponse struct {
+	ID        uint       `json:"id"`
+	Number    string     `json:"number" example:"30001234"`
+	Type      string     `json:"type" example:"exclusive"`
+	RentPrice int64      `json:"rentPrice" example:"25"`
+	BuyPrice  int64      `json:"buyPrice" example:"500"`
+	Provider  string     `json:"provider,omitempty" example:"magfa"`
+	RetiredAt *time.Time `json:"retiredAt,omitempty"`
+	// Holders are the accounts which currently have the number
+	Holders []SenderNumberHolder `json:"holders"`
+}
+
+// auditSenderNumber is the sender number in the audit logs, without its holders
+type auditSenderNumber struct {
+	Number     string     `json:"number"`
+	Type       string     `json:"type"`
+	RentPrice  int64      `json:"rentPrice"`
+	BuyPrice   int64      `json:"buyPrice"`
+	ProviderID *uint      `json:"providerID"`
+	RetiredAt  *time.Time `json:"retiredAt"`
+}
+
+func newAuditSenderNumber(number models.SenderNumber) auditSenderNumber {
+	return auditSenderNumber{
+		Number:     number.Number,
+		Type:       number.Type,
+		RentPrice:  number.RentPrice,
+		BuyPrice:   number.BuyPrice,
+		ProviderID: number.ProviderID,
+		RetiredAt:  number.RetiredAt,
+	}
+}
+
+// senderNumberHolders returns the current holders of the numbers by their ID
+func senderNumberHolders(db *gorm.DB, numberIDs []uint) (map[uint][]SenderNumberHolder, error) {
+	type holderRow struct {
+		UserNumberID uint
+		NumberID     uint
+		UserID       uint
+		Username     string
+		Package      string
+		Type         string
+		StartDate    time.Time
+		EndDate      time.Time
+		IsAvailable  bool
+	}
+	var rows []holderRow
+	err := db.Table("user_numbers").
+		Select("user_numbers.id AS user_number_id, user_numbers.number_id, user_numbers.user_id, "+
+			"COALESCE(accounts.username, '') AS username, COALESCE(subscription_number_package.title, '') AS package, "+
+			"user_numbers.type, user_numbers.start_date, user_numbers.end_date, user_numbers.is_available").
+		// members have the user of their organization, the organization's account holds the number
+		Joins("LEFT JOIN accounts ON accounts.user_id = user_numbers.user_id AND accounts.id NOT IN (SELECT member_id FROM account_members)").
+		Joins("LEFT JOIN subscription_number_package ON subscription_number_package.id = user_numbers.subscription_package_id").
+		Where("user_numbers.number_id IN ?", numberIDs).
+		Order("user_numbers.start_date, user_numbers.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	holders := make(map[uint][]SenderNumberHolder)
+	for _, row := range rows {
+		holder := SenderNumberHolder{
+			UserNumberID: row.UserNumberID,
+			UserID:       row.UserID,
+			Username:     row.Username,
+			Package:      row.Package,
+			Bought:       row.Type == models.PackageTypeBuy,
+			StartDate:    row.StartDate,
+			InGrace:      !row.IsAvailable,
+		}
+		if !holder.Bought && !row.EndDate.IsZero() {
+			endDate := row.EndDate
+			holder.EndDate = &endDate
+		}
+		holders[row.NumberID] = append(holders[row.NumberID], holder)
+	}
+	return holders, nil
+}
+
+// newSenderNumberResponses adds the providers and the holders to the numbers
+func newSenderNumberResponses(db *gorm.DB, numbers []models.SenderNumber) ([]SenderNumberResponse, error) {
+	var ids []uint
+	for _, number := range numbers {
+		ids = append(ids, number.ID)
+	}
+	holders, err := senderNumberHolders(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	var providers []models.SMSProvider
+	if err := db.Find(&providers).Error; err != nil {
+		return nil, err
+	}
+	providerNames := make(map[uint]string, len(providers))
+	for _, provider := range providers {
+		providerNames[provider.ID] = provider.Name
+	}
+
+	response := make([]SenderNumberResponse, 0, len(numbers))
+	for _, number := range numbers {
+		item := SenderNumberResponse{
+			ID:        number.ID,
+			Number:    number.Number,
+			Type:      number.Type,
+			RentPrice: number.RentPrice,
+			BuyPrice:  number.BuyPrice,
+			RetiredAt: number.RetiredAt,
+			Holders:   holders[number.ID],
+		}
+		if number.ProviderID != nil {
+			item.Provider = providerNames[*number.ProviderID]
+		}
+		if item.Holders == nil {
+			item.Holders = []SenderNumberHolder{}
+		}
+		response = append(response, item)
+	}
+	return response, nil
+}
+
+// applySenderNumberRequest changes the number by the fields which are in the request
+func applySenderNumberRequest(db *gorm.DB, number *models.SenderNumber, body SenderNumberRequest) string {
+	if body.Type != nil && *body.Type != number.Type {
+		switch *body.Type {
+		case models.SenderTypeDefault, models.SenderTypeShared, models.SenderTypeExclusive, models.SenderTypeVanity:
+		default:
+			return "Type Must Be default, shared, exclusive Or vanity"
+		}
+		if number.ID != 0 {
+			var held int64
+			db.Model(&models.UserNumbers{}).Where("number_id = ?", number.ID).Count(&held)
+			if held > 0 {
+				return "Type Of A Held Number Can't Be Changed"
+			}
+		}
+		number.Type = *body.Type
+		number.IsDefault = number.Type == models.SenderTypeDefault
+	}
+	if body.RentPrice != nil {
+		if *body.RentPrice < 0 {
+			return "Rent Price Can't Be Negative"
+		}
+		number.RentPrice = *body.RentPrice
+	}
+	if body.BuyPrice != nil {
+		if *body.BuyPrice < 0 {
+			return "Buy Price Can't Be Negative"
+		}
+		number.BuyPrice = *body.BuyPrice
+	}
+	if body.Provider != nil {
+		number.ProviderID = nil
+		if name := strings.TrimSpace(*body.Provider); name != "" {
+			var provider models.SMSProvider
+			if err := db.Where("name = ?", name).First(&provider).Error; err != nil {
+				return "Provider " + name + " Not Found"
+			}
+			number.ProviderID = &provider.ID
+		}
+	}
+	if body.Retired != nil {
+		if !*body.Retired {
+			number.RetiredAt = nil
+		} else if number.RetiredAt == nil {
+			now := time.Now()
+			number.RetiredAt = &now
+		}
+	}
+	return ""
+}
+
+// saveSenderNumber saves the number and writes its audit log
+func saveSenderNumber(c echo.Context, db *gorm.DB, action string, number *models.SenderNumber, before interface{}) error {
+	tx := db.Begin()
+	if err := tx.Save(number).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Save Sender Number"})
+	}
+	if err := writeAuditLog(c, tx, action, auditTarget("sender_number", number.ID), before, newAuditSenderNumber(*number)); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	response, err := newSenderNumberResponses(db, []models.SenderNumber{*number})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Sender Number"})
+	}
+	return c.JSON(http.StatusOK, response[0])
+}
+
+// ListSenderNumbersHandler lists the sender numbers.
+// @Summary List Sender Numbers
+// @Description List the sender numbers with their type, prices, provider and current holders
+// @Tags admin
+// @Produce json
+// @Param type query string false "Type of the numbers (default, shared, exclusive or vanity)"
+// @Param retired query bool false "Only the retired numbers, or only the numbers which aren't retired"
+// @Param held query bool false "Only the numbers which are held by an account, or only the ones which aren't"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} SenderNumberResponse
+// @Failure 500 {object} models.Response
+// @Router /admin/sender-numbers [get]
+func ListSenderNumbersHandler(c echo.Context, db *gorm.DB) error {
+	query := db.Model(&models.SenderNumber{})
+	if numberType := c.QueryParam("type"); numberType != "" {
+		query = query.Where("type = ?", numberType)
+	}
+	switch c.QueryParam("retired") {
+	case "true":
+		query = query.Where("retired_at IS NOT NULL")
+	case "false":
+		query = query.Where("retired_at IS NULL")
+	}
+	held := "SELECT number_id FROM user_numbers"
+	switch c.QueryParam("held") {
+	case "true":
+		query = query.Where("id IN (" + held + ")")
+	case "false":
+		query = query.Where("id NOT IN (" + held + ")")
+	}
+
+	var numbers []models.SenderNumber
+	if err := query.Order("number").Find(&numbers).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Sender Numbers"})
+	}
+	response, err := newSenderNumberResponses(db, numbers)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Sender Numbers"})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// GetSenderNumberHandler returns a sender number with its holders.
+// @Summary Get Sender Number
+// @Description Get a sender number with its type, prices, provider and the accounts which currently hold it
+// @Tags admin
+// @Produce json
+// @Param id path int true "Sender number ID"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} SenderNumberResponse
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/sender-numbers/{id} [get]
+func GetSenderNumberHandler(c echo.Context, db *gorm.DB) error {
+	var number models.SenderNumber
+	if err := db.First(&number, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Sender Number Not Found"})
+	}
+	response, err := newSenderNumberResponses(db, []models.SenderNumber{number})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Sender Number"})
+	}
+	return c.JSON(http.StatusOK, response[0])
+}
+
+// CreateSenderNumberHandler adds a sender number to the pool.
+// @Summary Create Sender Number
+// @Description Add a sender number, default numbers are used by all accounts and the other types are rented or bought
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param body body SenderNumberRequest true "Sender number"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} SenderNumberResponse
+// @Failure 400 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/sender-numbers [post]
+func CreateSenderNumberHandler(c echo.Context, db *gorm.DB) error {
+	var body SenderNumberRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if body.Number == nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Number Is Required"})
+	}
+	number := models.SenderNumber{Number: strings.TrimSpace(*body.Number), Type: models.SenderTypeExclusive}
+	if !utils.IsNumeric(strings.TrimPrefix(number.Number, "+")) {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Number Must Be Digits"})
+	}
+	var count int64
+	db.Model(&models.SenderNumber{}).Where("number = ?", number.Number).Count(&count)
+	if count > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "There Is A Sender Number With This Number"})
+	}
+
+	if msg := applySenderNumberRequest(db, &number, body); msg != "" {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: msg})
+	}
+	return saveSenderNumber(c, db, models.AuditActionNumberCreate, &number, nil)
+}
+
+// UpdateSenderNumberHandler updates a sender number.
+// @Summary Update Sender Number
+// @Description Change the type, prices or provider of a sender number, or retire it. The type of a held number can't be changed.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Sender number ID"
+// @Param body body SenderNumberRequest true "Sender number"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} SenderNumberResponse
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/sender-numbers/{id} [patch]
+func UpdateSenderNumberHandler(c echo.Context, db *gorm.DB) error {
+	var number models.SenderNumber
+	if err := db.First(&number, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Sender Number Not Found"})
+	}
+	before := newAuditSenderNumber(number)
+
+	var body SenderNumberRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if body.Number != nil && *body.Number != number.Number {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Number Can't Be Changed"})
+	}
+	if msg := applySenderNumberRequest(db, &number, body); msg != "" {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: msg})
+	}
+	return saveSenderNumber(c, db, models.AuditActionNumberUpdate, &number, before)
+}
+
+// DeleteSenderNumberHandler deletes a sender number.
+// @Summary Delete Sender Number
+// @Description Delete a sender number which has never been rented or bought, the other numbers are retired instead
+// @Tags admin
+// @Produce json
+// @Param id path int true "Sender number ID"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 409 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/sender-numbers/{id} [delete]
+func DeleteSenderNumberHandler(c echo.Context, db *gorm.DB) error {
+	var number models.SenderNumber
+	if err := db.First(&number, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Sender Number Not Found"})
+	}
+	var count int64
+	db.Model(&models.UserNumbers{}).Where("number_id = ?", number.ID).Count(&count)
+	if count > 0 {
+		return c.JSON(http.StatusConflict, models.Response{ResponseCode: 409, Message: "Sender Number Has Been Held, Retire It Instead"})
+	}
+
+	tx := db.Begin()
+	if err := tx.Delete(&number).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Delete Sender Number"})
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionNumberDelete, auditTarget("sender_number", number.ID), newAuditSenderNumber(number), nil); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Sender Number Deleted"})
+}
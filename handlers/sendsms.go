@@ -48,6 +48,14 @@ func (e SenderNumberNotFoundError) Error() string {
 	return fmt.Sprintf(e.Message)
 }
 
+type MemberSpendingLimitError struct {
+	Message string
+}
+
+func (e MemberSpendingLimitError) Error() string {
+	return fmt.Sprintf(e.Message)
+}
+
 type SendMessageStatus struct {
 	ID     int
 	Status bool
@@ -57,9 +65,19 @@ type Message struct {
 	Text        string `json:"text"`
 	Source      string `json:"source"`
 	Destination string `json:"destination"`
+	Priority    int    `json:"priority"`
+	// Provider sends the message, it is the provider of the sender number when it's bound to one.
+	// Otherwise the providers of the route of the destination's operator are tried, and it is set
+	// to the provider which sent the message
+	Provider string `json:"-"`
+	// RateLimits are the messages per minute limits the message is counted in, empty for system messages
+	RateLimits []utils.RateLimit `json:"-"`
+	// WaitForRateLimit makes SendMessage wait instead of failing when a rate limit is exceeded
+	WaitForRateLimit bool `json:"-"`
 }
 
-func MockSendMessage(message *Message, db *gorm.DB) (string, error) {
+// deliverMessage sends the message through the providers of its route, unless it has a bad word.
+func deliverMessage(message *Message, db *gorm.DB) (string, error) {
 	// Query the database to retrieve bad words
 	var badWords []models.Bad_Word
 	db.Find(&badWords)
@@ -71,9 +89,16 @@ func MockSendMessage(message *Message, db *gorm.DB) (string, error) {
 		}
 	}
 
-	log.Printf("Message sent - Text: %s, Source: %s, Destination: %s", message.Text, message.Source, message.Destination)
-
-	return "Message sent successfully", nil
+	deliveryReport, provider, err := utils.RouteMessage(db, message.Provider, utils.ProviderMessage{
+		Text:        message.Text,
+		Source:      message.Source,
+		Destination: message.Destination,
+	})
+	if err != nil {
+		return deliveryReport, err
+	}
+	message.Provider = provider
+	return deliveryReport, nil
 }
 
 func CreateSMSTemplate(template string, phoneNumber models.PhoneBookNumber) string {
@@ -125,34 +150,57 @@ func SendMessageToPhoneBooks(
 	fmt.Println(phoneBookNumbers)
 
 	// Check that if user have enough budget
-	var smsCost int
-	err = db.WithContext(ctx).Table("configuration").
-		Where("name = (?)", "group sms").
-		Pluck("value", &smsCost).Error
-
+	prices, err := utils.LoadPriceList(db.WithContext(ctx), body.Account, body.SenderNumber, true)
 	if err != nil {
 		log.Printf("Failed to retrieve SMS costs: %s", err.Error())
 		return err
 	}
 
-	cost := int64(smsCost * len(phoneBookNumbers))
+	recipients := make([]string, 0, len(phoneBookNumbers))
+	for _, phoneNumber := range phoneBookNumbers {
+		recipients = append(recipients, phoneNumber.Phone)
+	}
+	cost := prices.Total(recipients)
 	haveAccountBudget := utils.DoesAcountHaveBudget(
-		body.Account.Budget, cost,
+		utils.AvailableBudget(body.Account), cost,
 	)
 	if !haveAccountBudget {
 		return AcountDoesNotHaveBudgetError{Message: "You don't have enough budget!"}
 	}
+	if body.Member.ID != 0 && !utils.CanMemberSpend(body.Member, cost) {
+		return MemberSpendingLimitError{Message: "Spending limit exceeded"}
+	}
+	// messages wait for the rate limits while they are sent, but the limits mustn't be exhausted already
+	if err := utils.MessageLimiter.Check(1, body.RateLimits...); err != nil {
+		return err
+	}
+	// all the messages are charged before they are sent, so parallel sends can't spend the same
+	// budget or pass the member's limit; the charge of the messages which aren't sent is given back
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := utils.ChargeBudget(tx, body.Account.ID, cost, "phone book sms"); err != nil {
+			return err
+		}
+		if body.Member.ID != 0 {
+			return utils.AddMemberSpending(tx, body.Member.ID, cost)
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, utils.ErrInsufficientBudget):
+		return AcountDoesNotHaveBudgetError{Message: "You don't have enough budget!"}
+	case errors.Is(err, utils.ErrSpendingLimitExceeded):
+		return MemberSpendingLimitError{Message: "Spending limit exceeded"}
+	case err != nil:
+		log.Printf("Failed to update account's budget: %s", err.Error())
+		return err
+	}
 
 	// send message
 	statusOfMessages := make(chan SendMessageStatus, len(phoneBookNumbers))
 	for messageID, phoneNumber := range phoneBookNumbers {
-		cost := smsCost
-		if !utils.DoesAcountHaveBudget(body.Account.Budget, int64(cost)) {
-			return AcountDoesNotHaveBudgetError{Message: "You don't have enough budget!"}
-		}
 		message := CreateSMSTemplate(body.Message, phoneNumber)
 		go SendGroupMessage(
-			statusOfMessages, message, messageID, body.Account, phoneNumber, db,
+			statusOfMessages, message, messageID, body.SenderNumber, phoneNumber, body.RateLimits, db,
 		)
 	}
 
@@ -162,24 +210,24 @@ func SendMessageToPhoneBooks(
 		phoneNumber := phoneBookNumbers[messageStatus.ID]
 		message := CreateSMSTemplate(body.Message, phoneNumber)
 		sms := models.SMSMessage{
-			Sender:    body.SenderNumber,
-			Recipient: phoneNumber.Phone,
-			Message:   message,
-			Schedule:  nil,
-			CreatedAt: time.Now(),
-			AccountID: body.Account.ID,
+			Sender:     body.SenderNumber,
+			Recipient:  phoneNumber.Phone,
+			Message:    message,
+			Schedule:   nil,
+			CreatedAt:  time.Now(),
+			AccountID:  body.Account.ID,
+			MemberID:   body.Member.MemberID,
+			OperatorID: utils.DetectOperatorID(db, phoneNumber.Phone),
 		}
 
 		if messageStatus.Status {
 			sms.DeliveryReport = "Message sent successfully"
-
-			body.Account.Budget -= int64(smsCost)
-			if err := db.Save(&body.Account).Error; err != nil {
-				log.Printf("Failed to update account's budget: %s", err.Error())
-				return err
-			}
 		} else {
 			sms.DeliveryReport = "Message sent field"
+			err := refundMessage(db, body.Account.ID, body.Member.ID, prices.Price(phoneNumber.Phone), "phone book sms not sent")
+			if err != nil {
+				log.Printf("Failed to refund phone book sms of account %d: %v", body.Account.ID, err)
+			}
 		}
 
 		if err := db.Create(&sms).Error; err != nil {
@@ -218,15 +266,18 @@ func SendGroupMessage(
 	ch chan<- SendMessageStatus,
 	message string,
 	messageID int,
-	account models.Account,
+	senderNumber string,
 	phoneNumber models.PhoneBookNumber,
+	rateLimits []utils.RateLimit,
 	db *gorm.DB,
 ) {
-	_, err := MockSendMessage(
+	_, err := SendMessage(
 		&Message{
-			Text:        message,
-			Source:      account.Username,
-			Destination: phoneNumber.Phone,
+			Text:             message,
+			Source:           senderNumber,
+			Destination:      phoneNumber.Phone,
+			RateLimits:       rateLimits,
+			WaitForRateLimit: true,
 		}, db,
 	)
 	if err != nil {
@@ -234,7 +285,7 @@ func SendGroupMessage(
 		log.Printf(
 			"Field to sent message - Text: %s, Source: %s, Destination: %s \n DetailError: %s",
 			message,
-			account.Username,
+			senderNumber,
 			phoneNumber.Phone,
 			err,
 		)
@@ -244,7 +295,7 @@ func SendGroupMessage(
 	log.Printf(
 		"Message sent - Text: %s, Source: %s, Destination: %s",
 		message,
-		account.Username,
+		senderNumber,
 		phoneNumber.Phone,
 	)
 	ch <- SendMessageStatus{ID: messageID, Status: true}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type SettingRequest struct {
+	// Value has the type of the setting: a number for int and float settings, true or false for bool settings
+	Value interface{} `json:"value" swaggertype:"number" example:"15"`
+}
+
+type SettingResponse struct {
+	Key         string      `json:"key" example:"bill due days"`
+	Type        string      `json:"type" example:"int"`
+	Value       interface{} `json:"value" swaggertype:"number" example:"20"`
+	Default     interface{} `json:"default" swaggertype:"number" example:"15"`
+	Description string      `json:"description"`
+	// IsSet is false when the setting has its default value
+	IsSet bool `json:"isSet"`
+	// Declared is false for configurations which aren't known settings
+	Declared bool `json:"declared"`
+}
+
+// settingDefinition returns the declaration of the setting, configurations which
+// aren't declared are float settings without validation.
+func settingDefinition(key string) utils.SettingDefinition {
+	if definition, ok := utils.LookupSetting(key); ok {
+		return definition
+	}
+	return utils.SettingDefinition{Key: key, Type: utils.SettingTypeFloat}
+}
+
+func newSettingResponse(definition utils.SettingDefinition, conf *models.Configuration) SettingResponse {
+	_, declared := utils.LookupSetting(definition.Key)
+	response := SettingResponse{
+		Key:         definition.Key,
+		Type:        string(definition.Type),
+		Value:       definition.Format(definition.Default),
+		Default:     definition.Format(definition.Default),
+		Description: definition.Description,
+		Declared:    declared,
+	}
+	if conf != nil {
+		response.Value = definition.Format(conf.Value)
+		response.IsSet = true
+	}
+	return response
+}
+
+// ListSettingsHandler lists the settings.
+// @Summary List Settings
+// @Description List the declared settings with their type, value, default and description, and the configurations which aren't declared
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} SettingResponse
+// @Failure 500 {object} models.Response
+// @Router /admin/settings [get]
+func ListSettingsHandler(c echo.Context, db *gorm.DB) error {
+	var configurations []models.Configuration
+	if err := db.Order("name").Find(&configurations).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Settings"})
+	}
+	stored := make(map[string]*models.Configuration, len(configurations))
+	for i := range configurations {
+		stored[configurations[i].Name] = &configurations[i]
+	}
+
+	var response []SettingResponse
+	for _, definition := range utils.SettingDefinitions() {
+		response = append(response, newSettingResponse(definition, stored[definition.Key]))
+	}
+	for i := range configurations {
+		if _, declared := utils.LookupSetting(configurations[i].Name); !declared {
+			response = append(response, newSettingResponse(settingDefinition(configurations[i].Name), &configurations[i]))
+		}
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// UpdateSettingHandler sets the value of a setting.
+// @Summary Update Setting
+// @Description Set the value of a declared setting, or of a configuration which isn't declared. The value is validated by the type of the setting.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key path string true "Setting key"
+// @Param body body SettingRequest true "Value"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} SettingResponse
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/settings/{key} [put]
+func UpdateSettingHandler(c echo.Context, db *gorm.DB) error {
+	key := c.Param("key")
+
+	var conf models.Configuration
+	err := db.Where("name = ?", key).First(&conf).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Setting"})
+	}
+	exists := err == nil
+	if _, declared := utils.LookupSetting(key); !declared && !exists {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: utils.ErrUnknownSetting.Error()})
+	}
+	definition := settingDefinition(key)
+
+	var body SettingRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	value, err := definition.Parse(body.Value)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: err.Error()})
+	}
+
+	var before interface{}
+	if exists {
+		before = newSettingResponse(definition, &conf)
+	}
+	conf.Name = key
+	conf.Value = value
+
+	tx := db.Begin()
+	if err := tx.Save(&conf).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Update Setting"})
+	}
+	after := newSettingResponse(definition, &conf)
+	if err := writeAuditLog(c, tx, models.AuditActionConfigUpdate, auditTarget("config", conf.ID), before, after); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+	utils.Settings.Invalidate()
+
+	return c.JSON(http.StatusOK, after)
+}
+
+// DeleteSettingHandler resets a setting to its default.
+// @Summary Delete Setting
+// @Description Delete the value of a setting, declared settings go back to their default
+// @Tags admin
+// @Produce json
+// @Param key path string true "Setting key"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/settings/{key} [delete]
+func DeleteSettingHandler(c echo.Context, db *gorm.DB) error {
+	key := c.Param("key")
+
+	var conf models.Configuration
+	if err := db.Where("name = ?", key).First(&conf).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Setting Is Not Set"})
+	}
+
+	tx := db.Begin()
+	if err := tx.Delete(&conf).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Delete Setting"})
+	}
+	before := newSettingResponse(settingDefinition(key), &conf)
+	if err := writeAuditLog(c, tx, models.AuditActionConfigDelete, auditTarget("config", conf.ID), before, nil); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+	utils.Settings.Invalidate()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Setting Is Deleted"})
+}
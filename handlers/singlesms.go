@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -36,16 +37,20 @@ type ErrorResponseSingle struct {
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Authorization Token"
+// @Param Idempotency-Key header string false "Key to safely retry the request, its first response is replayed for 24 hours"
 // @Param sendSMSRequest body SendSMSRequest true "SMS message details"
 // @Success 200 {object} SendSMSResponse
 // @Failure 400 {object} ErrorResponseSingle
 // @Failure 401 {string} string
 // @Failure 403 {object} ErrorResponseSingle
 // @Failure 404 {object} ErrorResponseSingle
+// @Failure 422 {object} ErrorResponseSingle
+// @Failure 429 {object} ErrorResponseSingle
 // @Failure 500 {object} ErrorResponseSingle
 // @Router /sms/single [post]
 func SendSingleSMSHandler(c echo.Context, db *gorm.DB) error {
 	account := c.Get("account").(models.Account)
+	member, isMember := c.Get("member").(models.AccountMember)
 	ctx := c.Request().Context()
 
 	reqBody := new(SendSMSRequest)
@@ -57,12 +62,16 @@ func SendSingleSMSHandler(c echo.Context, db *gorm.DB) error {
 		return c.JSON(http.StatusBadRequest, errResponse)
 	}
 
-	if reqBody.PhoneNumber != "" && !utils.ValidatePhone(reqBody.PhoneNumber) {
-		errResponse := ErrorResponseSingle{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid phone number",
+	if reqBody.PhoneNumber != "" {
+		phone, err := utils.NormalizePhone(reqBody.PhoneNumber, utils.IranCallingCode)
+		if err != nil {
+			errResponse := ErrorResponseSingle{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid phone number",
+			}
+			return c.JSON(http.StatusBadRequest, errResponse)
 		}
-		return c.JSON(http.StatusBadRequest, errResponse)
+		reqBody.PhoneNumber = phone
 	}
 	// Check if sender number is available
 	senderNumberExisted := utils.IsSenderNumberExist(
@@ -76,28 +85,9 @@ func SendSingleSMSHandler(c echo.Context, db *gorm.DB) error {
 		return c.JSON(http.StatusInternalServerError, errResponse)
 	}
 
-	tx := db.Begin()
+	rateLimits := messageRateLimits(c, db)
 
-	var singleSMSCost int
-	if err := tx.Table("configuration").Where("name = ?", "single sms").Select("value").Scan(&singleSMSCost).Error; err != nil {
-		tx.Rollback()
-		errResponse := ErrorResponseSingle{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to retrieve single SMS cost",
-		}
-		return c.JSON(http.StatusInternalServerError, errResponse)
-	}
-
-	if account.Budget < int64(singleSMSCost) {
-		tx.Rollback()
-		errResponse := ErrorResponseSingle{
-			Code:    http.StatusForbidden,
-			Message: "Insufficient budget",
-		}
-		return c.JSON(http.StatusForbidden, errResponse)
-	}
-
-	account.Budget -= int64(singleSMSCost)
+	tx := db.Begin()
 
 	var phoneNumber models.PhoneBookNumber
 	var message string
@@ -143,48 +133,135 @@ func SendSingleSMSHandler(c echo.Context, db *gorm.DB) error {
 		}
 	}
 
-	deliveryReport, err := MockSendMessage(&Message{
+	// the price depends on the recipient, so it is known after the phone book lookup
+	singleSMSCost, err := utils.MessagePrice(tx, account, reqBody.SenderNumber, destination, false)
+	if err != nil {
+		tx.Rollback()
+		errResponse := ErrorResponseSingle{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to retrieve single SMS cost",
+		}
+		return c.JSON(http.StatusInternalServerError, errResponse)
+	}
+
+	if utils.AvailableBudget(account) < singleSMSCost {
+		tx.Rollback()
+		errResponse := ErrorResponseSingle{
+			Code:    http.StatusForbidden,
+			Message: "Insufficient budget",
+		}
+		return c.JSON(http.StatusForbidden, errResponse)
+	}
+
+	if isMember && !utils.CanMemberSpend(member, singleSMSCost) {
+		tx.Rollback()
+		errResponse := ErrorResponseSingle{
+			Code:    http.StatusForbidden,
+			Message: "Spending limit exceeded",
+		}
+		return c.JSON(http.StatusForbidden, errResponse)
+	}
+
+	// the message is charged before it is sent, so parallel sends can't spend the same budget
+	// or pass the spending limit; the charge is given back if the message isn't sent
+	if err := utils.ChargeBudget(tx, account.ID, singleSMSCost, "single sms"); err != nil {
+		tx.Rollback()
+		if errors.Is(err, utils.ErrInsufficientBudget) {
+			return c.JSON(http.StatusForbidden, ErrorResponseSingle{Code: http.StatusForbidden, Message: "Insufficient budget"})
+		}
+		errResponse := ErrorResponseSingle{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to update account's budget",
+		}
+		return c.JSON(http.StatusInternalServerError, errResponse)
+	}
+
+	if isMember {
+		if err := utils.AddMemberSpending(tx, member.ID, singleSMSCost); err != nil {
+			tx.Rollback()
+			if errors.Is(err, utils.ErrSpendingLimitExceeded) {
+				return c.JSON(http.StatusForbidden, ErrorResponseSingle{Code: http.StatusForbidden, Message: "Spending limit exceeded"})
+			}
+			errResponse := ErrorResponseSingle{
+				Code:    http.StatusInternalServerError,
+				Message: "Failed to update member's spending",
+			}
+			return c.JSON(http.StatusInternalServerError, errResponse)
+		}
+	}
+
+	provider := utils.SenderProvider(tx, reqBody.SenderNumber)
+	if err := tx.Commit().Error; err != nil {
+		errResponse := ErrorResponseSingle{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to update account's budget",
+		}
+		return c.JSON(http.StatusInternalServerError, errResponse)
+	}
+
+	deliveryReport, err := SendMessage(&Message{
 		Text:        message,
-		Source:      account.Username,
+		Source:      reqBody.SenderNumber,
 		Destination: destination,
+		Provider:    provider,
+		RateLimits:  rateLimits,
 	}, db)
+	if err != nil {
+		if refundErr := refundMessage(db, account.ID, member.ID, singleSMSCost, "single sms not sent"); refundErr != nil {
+			log.Printf("Failed to refund single sms of account %d: %v", account.ID, refundErr)
+		}
+	}
+	if rateLimitErr, ok := err.(utils.RateLimitError); ok {
+		setRetryAfter(c, rateLimitErr)
+		errResponse := ErrorResponseSingle{
+			Code:    http.StatusTooManyRequests,
+			Message: "Rate limit exceeded",
+		}
+		return c.JSON(http.StatusTooManyRequests, errResponse)
+	}
 
 	sms := models.SMSMessage{
 		Sender:         reqBody.SenderNumber,
-		Recipient:      reqBody.PhoneNumber,
+		Recipient:      destination,
 		Message:        message,
 		Schedule:       nil,
 		DeliveryReport: deliveryReport,
 		CreatedAt:      time.Now(),
 		AccountID:      account.ID,
+		MemberID:       member.MemberID,
+		OperatorID:     utils.DetectOperatorID(db, destination),
 	}
-	if err != nil {
-		tx.Rollback()
-		sms.DeliveryReport = deliveryReport
-		log.Println("SMS have badword")
-	}
-	if err := tx.Create(&sms).Error; err != nil {
-		tx.Rollback()
+	if err := db.Create(&sms).Error; err != nil {
 		errResponse := ErrorResponseSingle{
 			Code:    http.StatusInternalServerError,
 			Message: "Failed to save SMS message",
 		}
 		return c.JSON(http.StatusInternalServerError, errResponse)
 	}
-
-	if err := tx.Model(&account).Update("budget", account.Budget).Error; err != nil {
-		tx.Rollback()
+	if err != nil {
 		errResponse := ErrorResponseSingle{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to update account's budget",
+			Code:    http.StatusUnprocessableEntity,
+			Message: err.Error(),
 		}
-		return c.JSON(http.StatusInternalServerError, errResponse)
+		return c.JSON(http.StatusUnprocessableEntity, errResponse)
 	}
 
-	tx.Commit()
-
 	response := SendSMSResponse{
 		Message: "SMS sent successfully",
 	}
 	return c.JSON(http.StatusOK, response)
 }
+
+// refundMessage gives back the charge of a message which wasn't sent, and the spending
+// of the member who sent it; memberID is zero when the account sent it itself
+func refundMessage(db *gorm.DB, accountID, memberID uint, cost int64, reason string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := utils.RefundSpending(tx, accountID, cost, reason); err != nil {
+			return err
+		}
+		if memberID != 0 {
+			return utils.AddMemberSpending(tx, memberID, -cost)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"SMS-panel/models"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type SubscriptionPackageRequest struct {
+	Title *string `json:"title" example:"3 Month"`
+	Price *int64  `json:"price" example:"40"`
+	// Type is rent or buy, it can't be changed after the package is created
+	Type *string `json:"type" example:"rent"`
+	// Duration is the length of a rent in durationUnit, buy packages don't have a duration
+	Duration     *int    `json:"duration" example:"3"`
+	DurationUnit *string `json:"durationUnit" example:"month"`
+	IsActive     *bool   `json:"isActive" example:"true"`
+}
+
+type SubscriptionPackageResponse struct {
+	ID           uint   `json:"id"`
+	Title        string `json:"title" example:"3 Month"`
+	Price        int64  `json:"price" example:"40"`
+	Type         string `json:"type" example:"rent"`
+	Duration     int    `json:"duration" example:"3"`
+	DurationUnit string `json:"durationUnit" example:"month"`
+	IsActive     bool   `json:"isActive"`
+}
+
+func newSubscriptionPackageResponse(subPackage models.SubscriptionNumberPackage) SubscriptionPackageResponse {
+	return SubscriptionPackageResponse{
+		ID:           subPackage.ID,
+		Title:        subPackage.Title,
+		Price:        subPackage.Price,
+		Type:         subPackage.Type,
+		Duration:     subPackage.Duration,
+		DurationUnit: subPackage.DurationUnit,
+		IsActive:     subPackage.IsActive,
+	}
+}
+
+// applySubscriptionPackageRequest changes the package by the fields which are in the request
+func applySubscriptionPackageRequest(db *gorm.DB, subPackage *models.SubscriptionNumberPackage, body SubscriptionPackageRequest) string {
+	if body.Title != nil {
+		title := strings.TrimSpace(*body.Title)
+		if title == "" {
+			return "Title Can't Be Empty"
+		}
+		var count int64
+		db.Model(&models.SubscriptionNumberPackage{}).Where("title = ? AND id <> ?", title, subPackage.ID).Count(&count)
+		if count > 0 {
+			return "There Is A Package With This Title"
+		}
+		subPackage.Title = title
+	}
+	if body.Price != nil {
+		if *body.Price < 0 {
+			return "Price Can't Be Negative"
+		}
+		subPackage.Price = *body.Price
+	}
+	if body.Type != nil && *body.Type != subPackage.Type {
+		if subPackage.ID != 0 {
+			return "Type Of A Package Can't Be Changed"
+		}
+		if *body.Type != models.PackageTypeRent && *body.Type != models.PackageTypeBuy {
+			return "Type Must Be rent Or buy"
+		}
+		subPackage.Type = *body.Type
+	}
+	if body.Duration != nil {
+		subPackage.Duration = *body.Duration
+	}
+	if body.DurationUnit != nil {
+		if *body.DurationUnit != models.DurationUnitDay && *body.DurationUnit != models.DurationUnitMonth {
+			return "Duration Unit Must Be day Or month"
+		}
+		subPackage.DurationUnit = *body.DurationUnit
+	}
+	if body.IsActive != nil {
+		subPackage.IsActive = *body.IsActive
+	}
+
+	if subPackage.Type == models.PackageTypeRent && subPackage.Duration <= 0 {
+		return "Duration Of A Rent Package Must Be Positive"
+	}
+	if subPackage.Type == models.PackageTypeBuy && subPackage.Duration != 0 {
+		return "Buy Packages Don't Have A Duration"
+	}
+	return ""
+}
+
+// saveSubscriptionPackage saves the package and writes its audit log
+func saveSubscriptionPackage(c echo.Context, db *gorm.DB, action string, subPackage *models.SubscriptionNumberPackage, before interface{}) error {
+	tx := db.Begin()
+	if err := tx.Save(subPackage).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Save Subscription Package"})
+	}
+	response := newSubscriptionPackageResponse(*subPackage)
+	if err := writeAuditLog(c, tx, action, auditTarget("subscription_package", subPackage.ID), before, response); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// ListSubscriptionPackagesHandler lists the subscription packages.
+// @Summary List Subscription Packages
+// @Description List the rent and buy packages, inactive packages are listed too
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} SubscriptionPackageResponse
+// @Failure 500 {object} models.Response
+// @Router /admin/subscription-packages [get]
+func ListSubscriptionPackagesHandler(c echo.Context, db *gorm.DB) error {
+	var subPackages []models.SubscriptionNumberPackage
+	if err := db.Order("id").Find(&subPackages).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Retrieve Subscription Packages"})
+	}
+
+	response := make([]SubscriptionPackageResponse, 0, len(subPackages))
+	for _, subPackage := range subPackages {
+		response = append(response, newSubscriptionPackageResponse(subPackage))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// CreateSubscriptionPackageHandler creates a subscription package.
+// @Summary Create Subscription Package
+// @Description Create a rent package with a duration in days or months, or a buy package without a duration
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param body body SubscriptionPackageRequest true "Subscription Package"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} SubscriptionPackageResponse
+// @Failure 400 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/subscription-packages [post]
+func CreateSubscriptionPackageHandler(c echo.Context, db *gorm.DB) error {
+	var body SubscriptionPackageRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if body.Title == nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Title Is Required"})
+	}
+
+	subPackage := models.SubscriptionNumberPackage{
+		Type:         models.PackageTypeRent,
+		DurationUnit: models.DurationUnitMonth,
+		IsActive:     true,
+	}
+	if msg := applySubscriptionPackageRequest(db, &subPackage, body); msg != "" {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: msg})
+	}
+	return saveSubscriptionPackage(c, db, models.AuditActionPackageCreate, &subPackage, nil)
+}
+
+// UpdateSubscriptionPackageHandler updates a subscription package.
+// @Summary Update Subscription Package
+// @Description Update the title, price, duration or active state of a subscription package, the numbers which are already held keep their end date
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Subscription Package ID"
+// @Param body body SubscriptionPackageRequest true "Subscription Package"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} SubscriptionPackageResponse
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/subscription-packages/{id} [patch]
+func UpdateSubscriptionPackageHandler(c echo.Context, db *gorm.DB) error {
+	var subPackage models.SubscriptionNumberPackage
+	if err := db.First(&subPackage, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Subscription Package Not Found"})
+	}
+	before := newSubscriptionPackageResponse(subPackage)
+
+	var body SubscriptionPackageRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{ResponseCode: 400, Message: "Invalid JSON"})
+	}
+	if msg := applySubscriptionPackageRequest(db, &subPackage, body); msg != "" {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: msg})
+	}
+	return saveSubscriptionPackage(c, db, models.AuditActionPackageUpdate, &subPackage, before)
+}
+
+// DeleteSubscriptionPackageHandler deletes a subscription package.
+// @Summary Delete Subscription Package
+// @Description Delete a subscription package which no number has been held with, other packages can be deactivated instead
+// @Tags admin
+// @Produce json
+// @Param id path int true "Subscription Package ID"
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 409 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/subscription-packages/{id} [delete]
+func DeleteSubscriptionPackageHandler(c echo.Context, db *gorm.DB) error {
+	var subPackage models.SubscriptionNumberPackage
+	if err := db.First(&subPackage, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{ResponseCode: 404, Message: "Subscription Package Not Found"})
+	}
+
+	var count int64
+	db.Model(&models.UserNumbers{}).Where("subscription_package_id = ?", subPackage.ID).Count(&count)
+	if count > 0 {
+		return c.JSON(http.StatusConflict, models.Response{ResponseCode: 409, Message: "Numbers Have Been Held With This Package, Deactivate It Instead"})
+	}
+
+	tx := db.Begin()
+	if err := tx.Delete(&subPackage).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Delete Subscription Package"})
+	}
+	if err := writeAuditLog(c, tx, models.AuditActionPackageDelete, auditTarget("subscription_package", subPackage.ID), newSubscriptionPackageResponse(subPackage), nil); err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Write Audit Log"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Subscription Package Deleted"})
+}
+
+// GetSubscriptionPackagesHandler lists the packages which numbers can be held with.
+// @Summary Get Subscription Packages
+// @Description Get the active rent and buy packages
+// @Tags account
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Authorization header with Bearer token"
+// @Success 200 {array} SubscriptionPackageResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/subscription-packages [get]
+func GetSubscriptionPackagesHandler(c echo.Context, db *gorm.DB) error {
+	var subPackages []models.SubscriptionNumberPackage
+	if err := db.Where("is_active = ?", true).Order("type DESC, price").Find(&subPackages).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "failed to retrieve subscription packages"})
+	}
+
+	response := make([]SubscriptionPackageResponse, 0, len(subPackages))
+	for _, subPackage := range subPackages {
+		response = append(response, newSubscriptionPackageResponse(subPackage))
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"gorm.io/gorm"
+)
+
+// SendSystemSMS sends a message on behalf of the panel itself, e.g. login codes,
+// from a default sender number. It isn't charged from the account budget.
+func SendSystemSMS(db *gorm.DB, accountID uint, recipient string, text string) error {
+	var senderNumber models.SenderNumber
+	err := db.Where("is_default = ?", true).Order("id").First(&senderNumber).Error
+	if err != nil {
+		return SenderNumberNotFoundError{Message: "Default sender number not found!"}
+	}
+
+	deliveryReport, sendErr := SendMessage(&Message{
+		Text:        text,
+		Source:      senderNumber.Number,
+		Destination: recipient,
+		Priority:    PriorityHigh,
+	}, db)
+
+	sms := models.SMSMessage{
+		Sender:         senderNumber.Number,
+		Recipient:      recipient,
+		Message:        text,
+		DeliveryReport: deliveryReport,
+		CreatedAt:      time.Now(),
+		AccountID:      accountID,
+		OperatorID:     utils.DetectOperatorID(db, recipient),
+	}
+	if err := db.Create(&sms).Error; err != nil {
+		return err
+	}
+
+	return sendErr
+}
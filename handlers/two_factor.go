@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+	recoveryCodesCount        = 10
+	totpIssuer                = "SMS-panel"
+)
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	Challenge         string `json:"challenge"`
+	Method            string `json:"method" example:"totp"`
+}
+
+type VerifyTwoFactorRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code" example:"123456"`
+}
+
+type TOTPSetupResponse struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" example:"123456"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// loginAccount returns the account which has logged in, the member's own
+// account when a member acts on behalf of an organization.
+func loginAccount(c echo.Context, db *gorm.DB) (models.Account, error) {
+	if member, ok := c.Get("member").(models.AccountMember); ok {
+		var account models.Account
+		err := db.First(&account, member.MemberID).Error
+		return account, err
+	}
+	return c.Get("account").(models.Account), nil
+}
+
+// startTwoFactorChallenge creates a login challenge for an account whose password is accepted
+// and sends the login code by SMS if needed.
+func startTwoFactorChallenge(c echo.Context, db *gorm.DB, account models.Account, forAdmin bool) error {
+	method := account.TwoFactorMethod
+	// admins which haven't chosen a method receive codes by SMS
+	if method == "" {
+		method = models.TwoFactorSMS
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Create Login Challenge"})
+	}
+	challenge := models.LoginChallenge{
+		AccountID: account.ID,
+		Token:     token,
+		Method:    method,
+		ForAdmin:  forAdmin,
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+		CreatedAt: time.Now(),
+	}
+
+	var code string
+	if method == models.TwoFactorSMS {
+		code, err = utils.GenerateNumericCode(6)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Create Login Challenge"})
+		}
+		challenge.CodeHash = utils.HashCode(code)
+	}
+
+	if err := db.Create(&challenge).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Create Login Challenge"})
+	}
+
+	if method == models.TwoFactorSMS {
+		var user models.User
+		if err := db.First(&user, account.UserID).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "User Not Founded"})
+		}
+		if err := SendSystemSMS(db, account.ID, user.Phone, "Your login code: "+code); err != nil {
+			log.Printf("Failed to send login code: %s", err.Error())
+			return c.JSON(http.StatusBadGateway, models.Response{ResponseCode: 502, Message: "Failed To Send Login Code"})
+		}
+	}
+
+	return c.JSON(http.StatusAccepted, TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		Challenge:         challenge.Token,
+		Method:            method,
+	})
+}
+
+// useRecoveryCode marks a matching unused recovery code of the account as used
+func useRecoveryCode(db *gorm.DB, accountID uint, code string) bool {
+	var recoveryCodes []models.RecoveryCode
+	db.Where("account_id = ? AND used_at IS NULL", accountID).Find(&recoveryCodes)
+
+	code = strings.ToLower(strings.TrimSpace(code))
+	for _, recoveryCode := range recoveryCodes {
+		if utils.CheckCodeHash(code, recoveryCode.CodeHash) {
+			now := time.Now()
+			result := db.Model(&models.RecoveryCode{}).
+				Where("id = ? AND used_at IS NULL", recoveryCode.ID).
+				Update("used_at", &now)
+			return result.Error == nil && result.RowsAffected == 1
+		}
+	}
+	return false
+}
+
+// generateRecoveryCodes replaces the recovery codes of the account
+func generateRecoveryCodes(db *gorm.DB, accountID uint) ([]string, error) {
+	if err := db.Where("account_id = ?", accountID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		code, err := utils.GenerateRandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		recoveryCode := models.RecoveryCode{AccountID: accountID, CodeHash: utils.HashCode(code)}
+		if err := db.Create(&recoveryCode).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// VerifyTwoFactorHandler completes a login with the second factor
+// @Summary Verify login code
+// @Description Complete a login with a TOTP code, an SMS code or a recovery code
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body VerifyTwoFactorRequest true "Login challenge and code"
+// @Success 200 {object} AccountResponse
+// @Failure 422 {object} ErrorResponseRegisterLogin
+// @Failure 429 {object} ErrorResponseRegisterLogin
+// @Router /accounts/login/verify [post]
+// @Router /admin/login/verify [post]
+func VerifyTwoFactorHandler(c echo.Context, db *gorm.DB) error {
+	var body VerifyTwoFactorRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Invalid JSON"})
+	}
+
+	var challenge models.LoginChallenge
+	err := db.Where("token = ? AND used_at IS NULL", body.Challenge).First(&challenge).Error
+	if err != nil || time.Now().After(challenge.ExpiresAt) {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Login Challenge Is Expired"})
+	}
+	if challenge.Attempts >= loginChallengeMaxAttempts {
+		return c.JSON(http.StatusTooManyRequests, models.Response{ResponseCode: 429, Message: "Too Many Attempts"})
+	}
+
+	var account models.Account
+	if err := db.First(&account, challenge.AccountID).Error; err != nil || (!account.IsActive && account.SuspendedAt == nil) {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Your Account Isn't Active"})
+	}
+
+	valid := false
+	switch challenge.Method {
+	case models.TwoFactorTOTP:
+		valid = utils.ValidateTOTP(account.TOTPSecret, body.Code, time.Now()) ||
+			useRecoveryCode(db, account.ID, body.Code)
+	case models.TwoFactorSMS:
+		valid = utils.CheckCodeHash(body.Code, challenge.CodeHash)
+	}
+	if !valid {
+		db.Model(&challenge).Update("attempts", gorm.Expr("attempts + 1"))
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Invalid Code"})
+	}
+
+	// challenge can be used once
+	now := time.Now()
+	result := db.Model(&models.LoginChallenge{}).
+		Where("id = ? AND used_at IS NULL", challenge.ID).
+		Update("used_at", &now)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Login Challenge Is Expired"})
+	}
+
+	tokenString, err := utils.GenerateToken(account.ID, challenge.ForAdmin)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Create Token"})
+	}
+	account.Token = tokenString
+	db.Save(&account)
+
+	return c.JSON(http.StatusOK, account)
+}
+
+// SetupTOTPHandler creates a new authenticator app secret
+// @Summary Setup authenticator app
+// @Description Create a TOTP secret for the logged in account, it's used after enabling with a valid code
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {object} TOTPSetupResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/2fa/totp/setup [post]
+func SetupTOTPHandler(c echo.Context, db *gorm.DB) error {
+	account, err := loginAccount(c, db)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	if account.TwoFactorMethod == models.TwoFactorTOTP {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Authenticator app is already enabled"})
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx := db.Begin()
+	err = tx.Model(&account).Update("totp_secret", secret).Error
+	if err == nil {
+		err = writeAuditLog(c, tx, models.AuditActionTwoFactorSetup, auditTarget("account", account.ID), nil, nil)
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, TOTPSetupResponse{
+		Secret: secret,
+		URL:    utils.TOTPURL(totpIssuer, account.Username, secret),
+	})
+}
+
+// EnableTOTPHandler enables authenticator app after checking a code
+// @Summary Enable authenticator app
+// @Description Enable two factor authentication with the secret created in setup and return recovery codes
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param body body TwoFactorCodeRequest true "Code of authenticator app"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/2fa/totp/enable [post]
+func EnableTOTPHandler(c echo.Context, db *gorm.DB) error {
+	account, err := loginAccount(c, db)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	var body TwoFactorCodeRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+	if account.TOTPSecret == "" {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Authenticator app isn't set up"})
+	}
+	if !utils.ValidateTOTP(account.TOTPSecret, body.Code, time.Now()) {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Invalid Code"})
+	}
+
+	tx := db.Begin()
+	if err := tx.Model(&account).Update("two_factor_method", models.TwoFactorTOTP).Error; err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	codes, err := generateRecoveryCodes(tx, account.ID)
+	if err == nil {
+		err = writeAuditLog(c, tx, models.AuditActionTwoFactorEnable, auditTarget("account", account.ID),
+			map[string]interface{}{"method": account.TwoFactorMethod}, map[string]interface{}{"method": models.TwoFactorTOTP})
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// EnableSMSTwoFactorHandler enables login codes by SMS
+// @Summary Enable SMS login codes
+// @Description Enable two factor authentication with codes sent to the phone of the user
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {object} models.Response
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/2fa/sms/enable [post]
+func EnableSMSTwoFactorHandler(c echo.Context, db *gorm.DB) error {
+	account, err := loginAccount(c, db)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	tx := db.Begin()
+	err = tx.Model(&account).Updates(map[string]interface{}{
+		"two_factor_method": models.TwoFactorSMS,
+		"totp_secret":       "",
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	err = tx.Where("account_id = ?", account.ID).Delete(&models.RecoveryCode{}).Error
+	if err == nil {
+		err = writeAuditLog(c, tx, models.AuditActionTwoFactorEnable, auditTarget("account", account.ID),
+			map[string]interface{}{"method": account.TwoFactorMethod}, map[string]interface{}{"method": models.TwoFactorSMS})
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "SMS login codes enabled"})
+}
+
+// DisableTwoFactorHandler disables two factor authentication
+// @Summary Disable two factor authentication
+// @Description Disable two factor authentication after checking the password, admins keep receiving SMS codes
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param body body DisableTwoFactorRequest true "Account password"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/2fa/disable [post]
+func DisableTwoFactorHandler(c echo.Context, db *gorm.DB) error {
+	account, err := loginAccount(c, db)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+
+	var body DisableTwoFactorRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request payload"})
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(body.Password)) != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Wrong Password"})
+	}
+
+	tx := db.Begin()
+	err = tx.Model(&account).Updates(map[string]interface{}{
+		"two_factor_method": "",
+		"totp_secret":       "",
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	err = tx.Where("account_id = ?", account.ID).Delete(&models.RecoveryCode{}).Error
+	if err == nil {
+		err = writeAuditLog(c, tx, models.AuditActionTwoFactorDisable, auditTarget("account", account.ID),
+			map[string]interface{}{"method": account.TwoFactorMethod}, nil)
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Two factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodesHandler replaces recovery codes
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes of the authenticator app
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounts/2fa/recovery-codes [post]
+func RegenerateRecoveryCodesHandler(c echo.Context, db *gorm.DB) error {
+	account, err := loginAccount(c, db)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	if account.TwoFactorMethod != models.TwoFactorTOTP {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: "Authenticator app isn't enabled"})
+	}
+
+	tx := db.Begin()
+	codes, err := generateRecoveryCodes(tx, account.ID)
+	if err == nil {
+		// the codes themselves are never written to the audit log
+		err = writeAuditLog(c, tx, models.AuditActionRecoveryCodes, auditTarget("account", account.ID), nil, nil)
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	phoneVerificationTTL         = 10 * time.Minute
+	emailVerificationTTL         = 24 * time.Hour
+	passwordResetTTL             = 15 * time.Minute
+	verificationMaxAttempts      = 5
+	verificationResendInterval   = time.Minute
+	passwordResetRequestResponse = "If the account exists, a reset token has been sent"
+)
+
+type VerifyPhoneRequest struct {
+	Username string `json:"username" example:"johndoe"`
+	Code     string `json:"code" example:"123456"`
+}
+
+type ResendVerificationRequest struct {
+	Username string `json:"username" example:"johndoe"`
+	Channel  string `json:"channel" example:"sms"`
+}
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username" example:"johndoe"`
+	Channel  string `json:"channel" example:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// issueVerificationToken stores the hash of a new token and expires the previous
+// unused tokens of the account with the same purpose.
+func issueVerificationToken(db *gorm.DB, accountID uint, purpose, channel, token string, ttl time.Duration) error {
+	now := time.Now()
+	err := db.Model(&models.VerificationToken{}).
+		Where("account_id = ? AND purpose = ? AND used_at IS NULL", accountID, purpose).
+		Update("used_at", &now).Error
+	if err != nil {
+		return err
+	}
+
+	verificationToken := models.VerificationToken{
+		AccountID: accountID,
+		Purpose:   purpose,
+		Channel:   channel,
+		TokenHash: utils.HashCode(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	return db.Create(&verificationToken).Error
+}
+
+// useVerificationToken marks the token as used, a token can be used once.
+func useVerificationToken(db *gorm.DB, verificationToken models.VerificationToken) bool {
+	now := time.Now()
+	result := db.Model(&models.VerificationToken{}).
+		Where("id = ? AND used_at IS NULL", verificationToken.ID).
+		Update("used_at", &now)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// sendVerificationCode sends a code to the phone or a token to the email of the account
+func sendVerificationCode(db *gorm.DB, account models.Account, user models.User, channel string) error {
+	switch channel {
+	case models.VerificationChannelSMS:
+		code, err := utils.GenerateNumericCode(6)
+		if err != nil {
+			return err
+		}
+		if err := issueVerificationToken(db, account.ID, models.VerificationPhone, channel, code, phoneVerificationTTL); err != nil {
+			return err
+		}
+		return SendSystemSMS(db, account.ID, user.Phone, "Your verification code: "+code)
+	default:
+		token, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			return err
+		}
+		if err := issueVerificationToken(db, account.ID, models.VerificationEmail, channel, token, emailVerificationTTL); err != nil {
+			return err
+		}
+		return utils.GetMailer().Send(user.Email, "Verify your email",
+			"Open /accounts/verify/email?token="+token+" to verify your email address.")
+	}
+}
+
+// sendRegistrationVerification sends verification codes to the phone and email of a new account
+func sendRegistrationVerification(db *gorm.DB, account models.Account, user models.User) {
+	for _, channel := range []string{models.VerificationChannelSMS, models.VerificationChannelEmail} {
+		if err := sendVerificationCode(db, account, user, channel); err != nil {
+			log.Printf("Failed to send %s verification: %s", channel, err.Error())
+		}
+	}
+}
+
+// completeVerification records the verified contact of the user and lets the
+// account log in if it was waiting for verification.
+func completeVerification(c echo.Context, db *gorm.DB, account models.Account, purpose string) error {
+	column := "phone_verified_at"
+	if purpose == models.VerificationEmail {
+		column = "email_verified_at"
+	}
+
+	tx := db.Begin()
+	if err := tx.Model(&models.User{}).Where("id = ?", account.UserID).Update(column, time.Now()).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if account.PendingVerification {
+		if err := tx.Model(&account).Update("pending_verification", false).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	err := writeAuditLogAs(c, tx, account.ID, models.AuditActionAccountVerify, auditTarget("account", account.ID), nil,
+		map[string]interface{}{"purpose": purpose})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// VerifyPhoneHandler verifies the phone number of an account with the code sent by SMS
+// @Summary Verify phone number
+// @Description Verify the phone number with the code sent by SMS. The account can log in after its first verification.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body VerifyPhoneRequest true "Username and code"
+// @Success 200 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 429 {object} models.Response
+// @Router /accounts/verify/phone [post]
+func VerifyPhoneHandler(c echo.Context, db *gorm.DB) error {
+	var body VerifyPhoneRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Invalid JSON"})
+	}
+
+	var account models.Account
+	db.Where("username = ?", body.Username).First(&account)
+
+	var verificationToken models.VerificationToken
+	err := db.Where("account_id = ? AND purpose = ? AND used_at IS NULL", account.ID, models.VerificationPhone).
+		Order("id desc").
+		First(&verificationToken).Error
+	if account.ID == 0 || err != nil || time.Now().After(verificationToken.ExpiresAt) {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Verification Code Is Expired"})
+	}
+	if verificationToken.Attempts >= verificationMaxAttempts {
+		return c.JSON(http.StatusTooManyRequests, models.Response{ResponseCode: 429, Message: "Too Many Attempts"})
+	}
+
+	if !utils.CheckCodeHash(strings.TrimSpace(body.Code), verificationToken.TokenHash) {
+		db.Model(&verificationToken).Update("attempts", gorm.Expr("attempts + 1"))
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Invalid Code"})
+	}
+	if !useVerificationToken(db, verificationToken) {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Verification Code Is Expired"})
+	}
+
+	if err := completeVerification(c, db, account, models.VerificationPhone); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Verification Failed"})
+	}
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Phone Number Verified"})
+}
+
+// VerifyEmailHandler verifies the email address of an account with the token sent by email
+// @Summary Verify email address
+// @Description Verify the email address with the token sent by email. The account can log in after its first verification.
+// @Tags users
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Router /accounts/verify/email [get]
+func VerifyEmailHandler(c echo.Context, db *gorm.DB) error {
+	var verificationToken models.VerificationToken
+	err := db.Where("token_hash = ? AND purpose = ? AND used_at IS NULL", utils.HashCode(c.QueryParam("token")), models.VerificationEmail).
+		First(&verificationToken).Error
+	if err != nil || time.Now().After(verificationToken.ExpiresAt) || !useVerificationToken(db, verificationToken) {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Verification Token Is Invalid Or Expired"})
+	}
+
+	var account models.Account
+	if err := db.First(&account, verificationToken.AccountID).Error; err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Verification Token Is Invalid Or Expired"})
+	}
+
+	if err := completeVerification(c, db, account, models.VerificationEmail); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Verification Failed"})
+	}
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Email Address Verified"})
+}
+
+// ResendVerificationHandler sends a new verification code
+// @Summary Resend verification code
+// @Description Send a new verification code by SMS or email. The response doesn't tell whether the account exists.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body ResendVerificationRequest true "Username and channel (sms or email)"
+// @Success 200 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Failure 429 {object} models.Response
+// @Router /accounts/verify/resend [post]
+func ResendVerificationHandler(c echo.Context, db *gorm.DB) error {
+	var body ResendVerificationRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Invalid JSON"})
+	}
+	if body.Channel != models.VerificationChannelSMS && body.Channel != models.VerificationChannelEmail {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Channel Must Be sms Or email"})
+	}
+
+	response := models.Response{ResponseCode: 200, Message: "If the account isn't verified, a verification code has been sent"}
+
+	var account models.Account
+	db.Where("username = ?", body.Username).First(&account)
+	var user models.User
+	if account.ID == 0 || db.First(&user, account.UserID).Error != nil {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	purpose := models.VerificationPhone
+	verified := user.PhoneVerifiedAt != nil
+	if body.Channel == models.VerificationChannelEmail {
+		purpose = models.VerificationEmail
+		verified = user.EmailVerifiedAt != nil
+	}
+	if verified {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	var lastToken models.VerificationToken
+	db.Where("account_id = ? AND purpose = ?", account.ID, purpose).Order("id desc").First(&lastToken)
+	if lastToken.ID != 0 && time.Since(lastToken.CreatedAt) < verificationResendInterval {
+		return c.JSON(http.StatusTooManyRequests, models.Response{ResponseCode: 429, Message: "Please Wait Before Requesting A New Code"})
+	}
+
+	if err := sendVerificationCode(db, account, user, body.Channel); err != nil {
+		log.Printf("Failed to send %s verification: %s", body.Channel, err.Error())
+	}
+	err := writeAuditLogAs(c, db, account.ID, models.AuditActionVerifyResend, auditTarget("account", account.ID), nil,
+		map[string]interface{}{"channel": body.Channel})
+	if err != nil {
+		log.Printf("Failed to write audit log of %s verification: %s", body.Channel, err.Error())
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// ForgotPasswordHandler sends a password reset token
+// @Summary Request password reset
+// @Description Send a single use password reset token by SMS or email. The response doesn't tell whether the account exists.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body ForgotPasswordRequest true "Username and channel (sms or email)"
+// @Success 200 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Router /accounts/password/forgot [post]
+func ForgotPasswordHandler(c echo.Context, db *gorm.DB) error {
+	var body ForgotPasswordRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Invalid JSON"})
+	}
+	if body.Channel == "" {
+		body.Channel = models.VerificationChannelSMS
+	}
+	if body.Channel != models.VerificationChannelSMS && body.Channel != models.VerificationChannelEmail {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Channel Must Be sms Or email"})
+	}
+
+	response := models.Response{ResponseCode: 200, Message: passwordResetRequestResponse}
+
+	var account models.Account
+	db.Where("username = ?", body.Username).First(&account)
+	var user models.User
+	if account.ID == 0 || db.First(&user, account.UserID).Error != nil {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	token, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Create Reset Token"})
+	}
+	tx := db.Begin()
+	err = issueVerificationToken(tx, account.ID, models.VerificationPasswordReset, body.Channel, token, passwordResetTTL)
+	if err == nil {
+		// the token itself is never written to the audit log
+		err = writeAuditLogAs(c, tx, account.ID, models.AuditActionPasswordForgot, auditTarget("account", account.ID), nil,
+			map[string]interface{}{"channel": body.Channel})
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Create Reset Token"})
+	}
+	tx.Commit()
+
+	text := "Your password reset token: " + token
+	if body.Channel == models.VerificationChannelSMS {
+		err = SendSystemSMS(db, account.ID, user.Phone, text)
+	} else {
+		err = utils.GetMailer().Send(user.Email, "Reset your password", text)
+	}
+	if err != nil {
+		log.Printf("Failed to send password reset token: %s", err.Error())
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// ResetPasswordHandler sets a new password with a password reset token
+// @Summary Reset password
+// @Description Set a new password with the token sent by /accounts/password/forgot
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} models.Response
+// @Failure 422 {object} models.Response
+// @Router /accounts/password/reset [post]
+func ResetPasswordHandler(c echo.Context, db *gorm.DB) error {
+	var body ResetPasswordRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Invalid JSON"})
+	}
+	if len(body.Password) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Password Can't Be Empty"})
+	}
+
+	var verificationToken models.VerificationToken
+	err := db.Where("token_hash = ? AND purpose = ? AND used_at IS NULL", utils.HashCode(strings.TrimSpace(body.Token)), models.VerificationPasswordReset).
+		First(&verificationToken).Error
+	if err != nil || time.Now().After(verificationToken.ExpiresAt) || !useVerificationToken(db, verificationToken) {
+		return c.JSON(http.StatusUnprocessableEntity, models.Response{ResponseCode: 422, Message: "Reset Token Is Invalid Or Expired"})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed to Hashing Password"})
+	}
+
+	tx := db.Begin()
+	err = tx.Model(&models.Account{}).Where("id = ?", verificationToken.AccountID).
+		Update("password", string(hash)).Error
+	if err == nil {
+		err = writeAuditLogAs(c, tx, verificationToken.AccountID, models.AuditActionPasswordReset,
+			auditTarget("account", verificationToken.AccountID), nil, nil)
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.JSON(http.StatusInternalServerError, models.Response{ResponseCode: 500, Message: "Failed To Reset Password"})
+	}
+	tx.Commit()
+
+	return c.JSON(http.StatusOK, models.Response{ResponseCode: 200, Message: "Password Changed"})
+}
@@ -64,6 +64,8 @@ func IsAdmin(next echo.HandlerFunc) echo.HandlerFunc {
 				return echo.ErrUnauthorized
 			}
 
+			//Add Account Object To Context
+			c.Set("account", account)
 			return next(c)
 
 		} else {
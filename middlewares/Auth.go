@@ -1,70 +1,154 @@
 package middlewares
 
 import (
+	"net/http"
 	"os"
+	"strings"
 
 	database "SMS-panel/database"
 	"SMS-panel/models"
+	"SMS-panel/utils"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 func IsLoggedIn(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		req := c.Request()
-		tokenString := req.Header.Get("Authorization")
-
-		//Account Doesn't have Token
-		if tokenString == "" {
-			return echo.ErrConflict
+		//Connect To Database
+		db, err := database.GetConnection()
+		if err != nil {
+			return echo.ErrInternalServerError
 		}
+		return IsLoggedInWithDB(db)(next)(c)
+	}
+}
 
-		//Parse Token
-		token, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+// IsLoggedInWithDB is IsLoggedIn with the given database connection.
+func IsLoggedInWithDB(db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
 
-			//Wrong Algorithm
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("Unexpected Sigining Method %v", token.Header["alg"])
+			//Authenticate With API Key
+			if apiKey := req.Header.Get("X-API-Key"); apiKey != "" {
+				return authenticateAPIKey(c, next, db, apiKey)
 			}
-			return []byte(os.Getenv("SECRET")), nil
 
-		})
+			tokenString := req.Header.Get("Authorization")
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-
-			//Check Expiration Time
-			if float64(time.Now().Unix()) > claims["exp"].(float64) {
-				return echo.ErrUnauthorized
+			//Account Doesn't have Token
+			if tokenString == "" {
+				return echo.ErrConflict
 			}
 
-			//Connect To Database
-			db, err := database.GetConnection()
-			if err != nil {
-				return echo.ErrInternalServerError
-			}
+			//Parse Token
+			token, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 
-			//Find Account
-			var account models.Account
-			db.First(&account, claims["id"])
+				//Wrong Algorithm
+				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+					return nil, fmt.Errorf("Unexpected Sigining Method %v", token.Header["alg"])
+				}
+				return []byte(os.Getenv("SECRET")), nil
 
-			//Token And Id are not For Same Accounts
-			if account.ID == 0 {
-				return echo.ErrUnauthorized
-			}
-			//account is deactive
-			if account.Token == "" && account.IsActive == false {
+			})
+
+			if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+
+				//Check Expiration Time
+				if float64(time.Now().Unix()) > claims["exp"].(float64) {
+					return echo.ErrUnauthorized
+				}
+
+				//Find Account
+				var account models.Account
+				db.First(&account, claims["id"])
+
+				//Token And Id are not For Same Accounts
+				if account.ID == 0 {
+					return echo.ErrUnauthorized
+				}
+				//account is deactive
+				if account.Token == "" && account.IsActive == false {
+					return echo.ErrUnauthorized
+				}
+
+				if err := authorizeAccount(c, db, account); err != nil {
+					return err
+				}
+				return next(c)
+
+			} else {
 				return echo.ErrUnauthorized
 			}
+		}
+	}
+}
 
-			//Add Account Object To Context
-			c.Set("account", account)
-			return next(c)
+// authenticateAPIKey adds the account of the API key to the context
+func authenticateAPIKey(c echo.Context, next echo.HandlerFunc, db *gorm.DB, apiKey string) error {
+	var key models.APIKey
+	db.Where("key_hash = ? AND revoked_at IS NULL", utils.HashCode(apiKey)).First(&key)
+	if key.ID == 0 {
+		return echo.ErrUnauthorized
+	}
+
+	var account models.Account
+	db.First(&account, key.AccountID)
+	if account.ID == 0 {
+		return echo.ErrUnauthorized
+	}
+	if err := authorizeAccount(c, db, account); err != nil {
+		return err
+	}
+	db.Model(&key).Update("last_used_at", time.Now())
+
+	c.Set("api_key", key)
+	return next(c)
+}
+
+// authorizeAccount checks the state of the authenticated account and adds it to the context,
+// so tokens and API keys of the same account get the same response
+func authorizeAccount(c echo.Context, db *gorm.DB, account models.Account) error {
+	//Account is deactivated, accounts which are suspended for an overdue bill are inactive too
+	if !account.IsActive && account.SuspendedAt == nil {
+		return echo.ErrUnauthorized
+	}
 
-		} else {
+	//Account is a member of an organization, act on behalf of the organization
+	var member models.AccountMember
+	db.Where("member_id = ?", account.ID).First(&member)
+	if member.ID != 0 {
+		var owner models.Account
+		db.First(&owner, member.AccountID)
+		if owner.ID == 0 || (!owner.IsActive && owner.SuspendedAt == nil) {
 			return echo.ErrUnauthorized
 		}
+		c.Set("member", member)
+		account = owner
+	}
+
+	//Account is suspended for an overdue bill, it can only pay its bills
+	if account.SuspendedAt != nil && !isBillingPath(c.Path()) {
+		return echo.NewHTTPError(http.StatusPaymentRequired, "Account Is Suspended For An Overdue Bill")
+	}
+
+	//Add Account Object To Context
+	c.Set("account", account)
+	return nil
+}
+
+// paths which accounts that are suspended for an overdue bill can use to pay it
+var billingPaths = []string{"/accounts/bills", "/accounts/payment", "/accounts/invoices", "/accounts/ledger", "/accounts/billing"}
+
+func isBillingPath(path string) bool {
+	for _, prefix := range billingPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,92 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	database "SMS-panel/database"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const idempotencyKeyMaxLength = 255
+
+// Idempotency replays the first response to a request of the logged in account
+// which is retried with the same Idempotency-Key header.
+func Idempotency(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		db, err := database.GetConnection()
+		if err != nil {
+			return echo.ErrInternalServerError
+		}
+		return IdempotencyWithDB(db)(next)(c)
+	}
+}
+
+// IdempotencyWithDB is Idempotency with the given database connection.
+func IdempotencyWithDB(db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			key := req.Header.Get("Idempotency-Key")
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > idempotencyKeyMaxLength {
+				return echo.NewHTTPError(http.StatusBadRequest, "Idempotency-Key is too long")
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			account := c.Get("account").(models.Account)
+			requestHash := utils.IdempotencyRequestHash(req.Method, c.Path(), body)
+
+			record, completed, err := utils.BeginIdempotentRequest(db, account.ID, key, requestHash)
+			switch {
+			case err == utils.ErrIdempotencyConflict:
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, "Idempotency-Key is used for another request")
+			case err == utils.ErrIdempotencyInProgress:
+				return echo.NewHTTPError(http.StatusConflict, "Request with this Idempotency-Key is in progress")
+			case err != nil:
+				return echo.ErrInternalServerError
+			case completed:
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				return c.Blob(record.StatusCode, record.ContentType, record.ResponseBody)
+			}
+
+			res := c.Response()
+			recorder := &responseRecorder{ResponseWriter: res.Writer}
+			res.Writer = recorder
+			err = next(c)
+			res.Writer = recorder.ResponseWriter
+
+			// failed requests can be retried with the same key
+			if err != nil || res.Status >= http.StatusInternalServerError || res.Status == http.StatusTooManyRequests {
+				utils.ReleaseIdempotencyKey(db, record.ID)
+				return err
+			}
+
+			utils.CompleteIdempotentRequest(db, record.ID, res.Status, res.Header().Get(echo.HeaderContentType), recorder.body.Bytes())
+			return nil
+		}
+	}
+}
+
+// responseRecorder keeps a copy of the response body which is written.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"SMS-panel/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MemberRoles lets organization owners through and only allows members
+// whose role is one of the given roles. Must run after IsLoggedIn.
+func MemberRoles(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			member, ok := c.Get("member").(models.AccountMember)
+
+			//Logged in account is the owner itself
+			if !ok {
+				return next(c)
+			}
+
+			for _, role := range roles {
+				if member.Role == role {
+					return next(c)
+				}
+			}
+			return echo.ErrForbidden
+		}
+	}
+}
+
+// IsAccountOwner only allows the organization owner, never its members.
+var IsAccountOwner = MemberRoles()
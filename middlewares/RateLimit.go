@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+
+	database "SMS-panel/database"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimit limits the requests per second of the logged in account, and of its
+// API key if it's used, by the pricing plan of the account.
+func RateLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		db, err := database.GetConnection()
+		if err != nil {
+			return echo.ErrInternalServerError
+		}
+
+		account := c.Get("account").(models.Account)
+		apiKey, _ := c.Get("api_key").(models.APIKey)
+		plan := utils.AccountPricingPlan(db, account)
+
+		err = utils.RequestLimiter.Allow(1, utils.RequestRateLimits(plan, account.ID, apiKey.ID)...)
+		if rateLimitErr, ok := err.(utils.RateLimitError); ok {
+			c.Response().Header().Set("Retry-After", strconv.Itoa(rateLimitErr.RetryAfterSeconds()))
+			return echo.NewHTTPError(http.StatusTooManyRequests, "Rate limit exceeded")
+		}
+		return next(c)
+	}
+}
@@ -1,12 +1,28 @@
 package models
 
+import "time"
+
+// Two factor authentication methods of an account.
+const (
+	TwoFactorTOTP = "totp"
+	TwoFactorSMS  = "sms"
+)
+
 type Account struct {
-	ID       uint   `gorm:"primary_key"`
-	UserID   uint   `gorm:"not null"`
-	Username string `gorm:"type:varchar(255);unique;not null"`
-	Budget   int64  `gorm:"type:bigint"`
-	Password string `gorm:"type:varchar(255)"`
-	Token    string `gorm:"not null"`
-	IsActive bool   `gorm:"default:true"`
-	IsAdmin  bool   `gorm:"default:false"`
+	ID                  uint   `gorm:"primary_key"`
+	UserID              uint   `gorm:"not null"`
+	Username            string `gorm:"type:varchar(255);unique;not null"`
+	Budget              int64  `gorm:"type:bigint"`
+	Password            string `gorm:"type:varchar(255)"`
+	Token               string `gorm:"not null"`
+	IsActive            bool   `gorm:"default:true"`
+	IsAdmin             bool   `gorm:"default:false"`
+	TwoFactorMethod     string `gorm:"type:varchar(10);default:''"`
+	TOTPSecret          string `gorm:"type:varchar(255);default:''" json:"-"`
+	PendingVerification bool   `gorm:"default:false"`
+	PricingPlanID       *uint  `gorm:"default:null"`
+	// CreditLimit is how far the budget of a postpaid account may go under zero
+	CreditLimit int64 `gorm:"type:bigint;not null;default:0"`
+	// SuspendedAt is set when the account is deactivated for an overdue bill
+	SuspendedAt *time.Time
 }
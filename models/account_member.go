@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Roles a member account can have inside an organization account.
+const (
+	MemberRoleSender         = "sender"
+	MemberRoleContactManager = "contact_manager"
+	MemberRoleViewer         = "viewer"
+)
+
+// AccountMember links a member's own login account to the organization
+// account that owns the budget, sender numbers and phone books.
+type AccountMember struct {
+	ID            uint      `gorm:"primary_key"`
+	AccountID     uint      `gorm:"not null"`
+	MemberID      uint      `gorm:"unique;not null"`
+	Role          string    `gorm:"type:varchar(55);not null"`
+	SpendingLimit int64     `gorm:"type:bigint;default:0"`
+	Spent         int64     `gorm:"type:bigint;default:0"`
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	Member        Account   `gorm:"foreignKey:MemberID"`
+}
+
+func (AccountMember) TableName() string {
+	return "account_members"
+}
+
+func IsValidMemberRole(role string) bool {
+	switch role {
+	case MemberRoleSender, MemberRoleContactManager, MemberRoleViewer:
+		return true
+	}
+	return false
+}
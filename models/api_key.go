@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// APIKey authenticates requests of an account with the X-API-Key header
+// instead of a login token. Only its hash is stored.
+type APIKey struct {
+	ID         uint       `gorm:"primary_key"`
+	AccountID  uint       `gorm:"not null;index"`
+	Name       string     `gorm:"type:varchar(255);not null"`
+	Prefix     string     `gorm:"type:varchar(20);not null"`
+	KeyHash    string     `gorm:"type:varchar(255);unique;not null"`
+	LastUsedAt *time.Time `gorm:"default:null"`
+	RevokedAt  *time.Time `gorm:"default:null"`
+	CreatedAt  time.Time  `gorm:"default:current_timestamp"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
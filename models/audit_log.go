@@ -0,0 +1,96 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditActionAccountActivate   = "account.activate"
+	AuditActionAccountDeactivate = "account.deactivate"
+	AuditActionConfigCreate      = "config.create"
+	AuditActionConfigUpdate      = "config.update"
+	AuditActionConfigDelete      = "config.delete"
+	AuditActionBadWordCreate     = "bad_word.create"
+	AuditActionMemberCreate      = "member.create"
+	AuditActionMemberUpdate      = "member.update"
+	AuditActionMemberDelete      = "member.delete"
+	AuditActionNumberRent        = "sender_number.rent"
+	AuditActionNumberBuy         = "sender_number.buy"
+	AuditActionNumberRenew       = "sender_number.renew"
+	AuditActionNumberAutoRenew   = "sender_number.auto_renew"
+	AuditActionNumberReserve     = "sender_number.reserve"
+	AuditActionNumberUnreserve   = "sender_number.unreserve"
+	AuditActionWaitlistJoin      = "sender_number.waitlist_join"
+	AuditActionWaitlistLeave     = "sender_number.waitlist_leave"
+	AuditActionNumberRelease     = "sender_number.release"
+	AuditActionTransferCreate    = "sender_number.transfer"
+	AuditActionTransferAccept    = "sender_number.transfer_accept"
+	AuditActionTransferDecline   = "sender_number.transfer_decline"
+	AuditActionTransferCancel    = "sender_number.transfer_cancel"
+	AuditActionNumberCreate      = "sender_number.create"
+	AuditActionNumberUpdate      = "sender_number.update"
+	AuditActionNumberDelete      = "sender_number.delete"
+	AuditActionPackageCreate     = "subscription_package.create"
+	AuditActionPackageUpdate     = "subscription_package.update"
+	AuditActionPackageDelete     = "subscription_package.delete"
+	AuditActionLoginLockoutClear = "login_lockout.clear"
+	AuditActionTwoFactorSetup    = "two_factor.setup"
+	AuditActionTwoFactorEnable   = "two_factor.enable"
+	AuditActionTwoFactorDisable  = "two_factor.disable"
+	AuditActionRecoveryCodes     = "two_factor.recovery_codes"
+	AuditActionAccountVerify     = "account.verify"
+	AuditActionVerifyResend      = "account.verification_resend"
+	AuditActionPasswordForgot    = "account.password_forgot"
+	AuditActionPasswordReset     = "account.password_reset"
+	AuditActionPricingPlanCreate = "pricing_plan.create"
+	AuditActionPricingPlanUpdate = "pricing_plan.update"
+	AuditActionPricingPlanDelete = "pricing_plan.delete"
+	AuditActionAccountPlan       = "account.pricing_plan"
+	AuditActionAPIKeyCreate      = "api_key.create"
+	AuditActionAPIKeyRevoke      = "api_key.revoke"
+	AuditActionBillingUpdate     = "account.billing"
+	AuditActionBudgetCredit      = "account.budget_credit"
+	AuditActionBudgetDebit       = "account.budget_debit"
+	AuditActionLowBalanceUpdate  = "low_balance_alert.update"
+	AuditActionLowBalanceDelete  = "low_balance_alert.delete"
+	AuditActionCreditLimit       = "account.credit_limit"
+	AuditActionPriceRuleSet      = "price_rule.set"
+	AuditActionPriceRuleDelete   = "price_rule.delete"
+	AuditActionOperatorCreate    = "operator.create"
+	AuditActionOperatorUpdate    = "operator.update"
+	AuditActionOperatorDelete    = "operator.delete"
+	AuditActionProviderCreate    = "provider.create"
+	AuditActionProviderUpdate    = "provider.update"
+	AuditActionProviderDelete    = "provider.delete"
+	AuditActionProviderReset     = "provider.reset"
+	AuditActionRouteSet          = "route.set"
+)
+
+var ErrAuditLogImmutable = errors.New("audit logs can't be changed")
+
+type AuditLog struct {
+	ID        uint      `gorm:"primary_key"`
+	ActorID   uint      `gorm:"not null;index"`
+	Action    string    `gorm:"type:varchar(100);not null;index"`
+	Target    string    `gorm:"type:varchar(255)"`
+	Before    string    `gorm:"type:text"`
+	After     string    `gorm:"type:text"`
+	IP        string    `gorm:"type:varchar(100)"`
+	CreatedAt time.Time `gorm:"default:current_timestamp;index"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+func (AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+func (AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
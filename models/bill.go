@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Statuses of a postpaid bill
+const (
+	BillStatusUnpaid = "unpaid"
+	BillStatusPaid   = "paid"
+)
+
+// Bill is the monthly usage of a postpaid account. Amount is the part of the
+// usage which the budget didn't cover, and it must be paid until DueAt.
+type Bill struct {
+	ID          uint      `gorm:"primary_key"`
+	AccountID   uint      `gorm:"not null;uniqueIndex:idx_bills_account_period"`
+	PeriodStart time.Time `gorm:"not null;uniqueIndex:idx_bills_account_period"`
+	PeriodEnd   time.Time `gorm:"not null"`
+	Usage       int64     `gorm:"type:bigint;not null"`
+	Amount      int64     `gorm:"type:bigint;not null"`
+	Status      string    `gorm:"type:varchar(10);not null;index"`
+	DueAt       time.Time `gorm:"not null"`
+	PaidAt      *time.Time
+	CreatedAt   time.Time `gorm:"not null"`
+}
+
+func (Bill) TableName() string {
+	return "bills"
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyKey keeps the first response to a request sent with an Idempotency-Key header,
+// so retries of the request get the same response instead of being done again.
+type IdempotencyKey struct {
+	ID           uint       `gorm:"primary_key"`
+	AccountID    uint       `gorm:"not null;uniqueIndex:idx_idempotency_keys_account_key"`
+	Key          string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_keys_account_key"`
+	RequestHash  string     `gorm:"type:varchar(64);not null"`
+	StatusCode   int        `gorm:"default:0"`
+	ContentType  string     `gorm:"type:varchar(255)"`
+	ResponseBody []byte     `gorm:"default:null"`
+	CompletedAt  *time.Time `gorm:"default:null"`
+	ExpiresAt    time.Time  `gorm:"not null;index"`
+	CreatedAt    time.Time  `gorm:"not null"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Invoice is the tax receipt of a successful top-up transaction. The buyer's details
+// are copied when it is issued, so later changes of the user don't change it.
+type Invoice struct {
+	ID                uint      `gorm:"primary_key"`
+	Number            string    `gorm:"type:varchar(50);unique;not null"`
+	AccountID         uint      `gorm:"not null;index"`
+	TransactionID     uint      `gorm:"not null;unique"`
+	Subtotal          int64     `gorm:"type:bigint;not null"`
+	VATPercent        int       `gorm:"column:vat_percent;not null"`
+	VAT               int64     `gorm:"column:vat;type:bigint;not null"`
+	Total             int64     `gorm:"type:bigint;not null"`
+	BuyerName         string    `gorm:"type:varchar(255)"`
+	BuyerCompany      string    `gorm:"type:varchar(255)"`
+	BuyerNationalID   string    `gorm:"type:varchar(255)"`
+	BuyerEconomicCode string    `gorm:"type:varchar(255)"`
+	BuyerAddress      string    `gorm:"type:varchar(1000)"`
+	BuyerPostalCode   string    `gorm:"type:varchar(20)"`
+	BuyerPhone        string    `gorm:"type:varchar(255)"`
+	BuyerEmail        string    `gorm:"type:varchar(255)"`
+	IssuedAt          time.Time `gorm:"not null;index"`
+	CreatedAt         time.Time `gorm:"not null"`
+}
+
+func (Invoice) TableName() string {
+	return "invoices"
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Kinds of budget changes which are recorded in the ledger
+const (
+	LedgerTopUp       = "top_up"
+	LedgerAdminCredit = "admin_credit"
+	LedgerAdminDebit  = "admin_debit"
+	LedgerPromoCredit = "promo_credit"
+	LedgerPromoExpire = "promo_expire"
+	LedgerSpend       = "spend"
+	LedgerRefund      = "refund"
+)
+
+// LedgerEntry records a change of an account's budget. Amount is negative when
+// the budget is decreased.
+type LedgerEntry struct {
+	ID            uint      `gorm:"primary_key"`
+	AccountID     uint      `gorm:"not null;index"`
+	Kind          string    `gorm:"type:varchar(20);not null"`
+	Amount        int64     `gorm:"type:bigint;not null"`
+	Reason        string    `gorm:"type:varchar(1000)"`
+	ActorID       uint      `gorm:"default:0"`
+	TransactionID *uint     `gorm:"default:null"`
+	PromoCreditID *uint     `gorm:"default:null"`
+	CreatedAt     time.Time `gorm:"not null;index"`
+}
+
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Kinds of keys which failed logins are tracked by.
+const (
+	LoginAttemptUsername = "username"
+	LoginAttemptIP       = "ip"
+)
+
+// LoginAttempt tracks the recent failed logins of a username or an IP address.
+type LoginAttempt struct {
+	ID            uint       `gorm:"primary_key"`
+	Kind          string     `gorm:"type:varchar(10);not null;uniqueIndex:idx_login_attempts_kind_value"`
+	Value         string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_login_attempts_kind_value"`
+	Failures      int        `gorm:"default:0"`
+	LastFailureAt time.Time  `gorm:"not null"`
+	LockedUntil   *time.Time `gorm:"default:null"`
+}
+
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// LowBalanceAlert is the threshold under which the account is alerted that its
+// budget is running out. Triggered is set once the alert is sent and it is reset
+// when the budget goes back above the threshold, so each drop is alerted once.
+type LowBalanceAlert struct {
+	ID              uint   `gorm:"primary_key"`
+	AccountID       uint   `gorm:"not null;uniqueIndex"`
+	Threshold       int64  `gorm:"type:bigint;not null"`
+	NotifySMS       bool   `gorm:"not null;default:false"`
+	NotifyEmail     bool   `gorm:"not null;default:false"`
+	WebhookURL      string `gorm:"type:varchar(1000)"`
+	AutoTopUpAmount int64  `gorm:"type:bigint;not null;default:0"`
+	Triggered       bool   `gorm:"not null;default:false"`
+	LastTriggeredAt *time.Time
+	UpdatedAt       time.Time `gorm:"not null"`
+}
+
+func (LowBalanceAlert) TableName() string {
+	return "low_balance_alerts"
+}
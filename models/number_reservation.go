@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// NumberReservation holds a sender number for an account while it rents or buys it,
+// other accounts can't rent or buy the number until the reservation expires.
+type NumberReservation struct {
+	ID        uint         `gorm:"primary_key"`
+	NumberID  uint         `gorm:"not null;uniqueIndex"`
+	AccountID uint         `gorm:"not null;index"`
+	ExpiresAt time.Time    `gorm:"not null"`
+	CreatedAt time.Time    `gorm:"not null"`
+	Number    SenderNumber `gorm:"foreignKey:NumberID"`
+}
+
+func (NumberReservation) TableName() string {
+	return "number_reservations"
+}
+
+// NumberWaitlist is an account which waits for a held sender number, it is notified
+// and removed from the waitlist when the number is released.
+type NumberWaitlist struct {
+	ID        uint         `gorm:"primary_key"`
+	NumberID  uint         `gorm:"not null;uniqueIndex:idx_number_waitlist"`
+	AccountID uint         `gorm:"not null;uniqueIndex:idx_number_waitlist"`
+	CreatedAt time.Time    `gorm:"not null"`
+	Number    SenderNumber `gorm:"foreignKey:NumberID"`
+}
+
+func (NumberWaitlist) TableName() string {
+	return "number_waitlists"
+}
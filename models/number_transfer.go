@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Statuses of the transfers of sender numbers
+const (
+	NumberTransferPending   = "pending"
+	NumberTransferAccepted  = "accepted"
+	NumberTransferDeclined  = "declined"
+	NumberTransferCancelled = "cancelled"
+)
+
+// NumberTransfer offers a held sender number to another account, the number is moved
+// to the recipient when it accepts the transfer before it expires.
+type NumberTransfer struct {
+	ID            uint         `gorm:"primary_key"`
+	UserNumberID  uint         `gorm:"not null;index"`
+	NumberID      uint         `gorm:"not null"`
+	FromAccountID uint         `gorm:"not null;index"`
+	ToAccountID   uint         `gorm:"not null;index"`
+	Status        string       `gorm:"type:varchar(20);not null;default:pending"`
+	ExpiresAt     time.Time    `gorm:"not null"`
+	CreatedAt     time.Time    `gorm:"not null"`
+	RespondedAt   *time.Time   `gorm:"default:null"`
+	Number        SenderNumber `gorm:"foreignKey:NumberID"`
+}
+
+func (NumberTransfer) TableName() string {
+	return "number_transfers"
+}
@@ -0,0 +1,26 @@
+package models
+
+// Operator is a mobile operator, recipients are detected by the prefixes of their numbers.
+type Operator struct {
+	ID   uint   `gorm:"primary_key"`
+	Name string `gorm:"type:varchar(100);unique;not null"`
+	// Provider is the SMS provider which the messages to the operator are sent through
+	Provider string           `gorm:"type:varchar(100);not null"`
+	Prefixes []OperatorPrefix `gorm:"foreignKey:OperatorID"`
+}
+
+func (Operator) TableName() string {
+	return "operators"
+}
+
+// OperatorPrefix is a prefix of the international numbers of an operator without
+// + or 00, e.g. 98912. The longest matching prefix is used.
+type OperatorPrefix struct {
+	ID         uint   `gorm:"primary_key"`
+	OperatorID uint   `gorm:"not null;index"`
+	Prefix     string `gorm:"type:varchar(20);unique;not null"`
+}
+
+func (OperatorPrefix) TableName() string {
+	return "operator_prefixes"
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// OTPCode is a verification code sent by a customer to its own users through the OTP API.
+type OTPCode struct {
+	ID           uint       `gorm:"primary_key"`
+	AccountID    uint       `gorm:"not null;index"`
+	Token        string     `gorm:"type:varchar(255);unique;not null"`
+	SenderNumber string     `gorm:"type:varchar(255);not null"`
+	Recipient    string     `gorm:"type:varchar(255);not null"`
+	CodeHash     string     `gorm:"type:varchar(255);not null"`
+	Attempts     int        `gorm:"default:0"`
+	MaxAttempts  int        `gorm:"not null"`
+	ExpiresAt    time.Time  `gorm:"not null"`
+	VerifiedAt   *time.Time `gorm:"default:null"`
+	CreatedAt    time.Time  `gorm:"default:current_timestamp"`
+}
+
+func (OTPCode) TableName() string {
+	return "otp_codes"
+}
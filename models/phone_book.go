@@ -13,5 +13,6 @@ type PhoneBookNumber struct {
 	Prefix      string    `gorm:"type:varchar(255);default:+98"`
 	Name        string    `gorm:"type:varchar(255);not null"`
 	Phone       string    `gorm:"type:varchar(255);unique;not null"`
+	OperatorID  *uint     `gorm:"default:null"`
 	PhoneBook   PhoneBook `gorm:"association_autoupdate:false"`
 }
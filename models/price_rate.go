@@ -0,0 +1,15 @@
+package models
+
+// PriceRate is the price of the messages to the recipients whose number starts
+// with Prefix, e.g. an operator or a country. The longest matching prefix is used.
+type PriceRate struct {
+	ID            uint   `gorm:"primary_key"`
+	PricingPlanID uint   `gorm:"not null;uniqueIndex:idx_price_rates_plan_prefix"`
+	Prefix        string `gorm:"type:varchar(20);not null;uniqueIndex:idx_price_rates_plan_prefix"`
+	Name          string `gorm:"type:varchar(255)"`
+	Price         int64  `gorm:"type:bigint;not null"`
+}
+
+func (PriceRate) TableName() string {
+	return "price_rates"
+}
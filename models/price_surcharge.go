@@ -0,0 +1,14 @@
+package models
+
+// PriceSurcharge is added to the price of the messages which are sent from a
+// sender number of SenderType, which is shared, exclusive or vanity.
+type PriceSurcharge struct {
+	ID            uint   `gorm:"primary_key"`
+	PricingPlanID uint   `gorm:"not null;uniqueIndex:idx_price_surcharges_plan_type"`
+	SenderType    string `gorm:"type:varchar(20);not null;uniqueIndex:idx_price_surcharges_plan_type"`
+	Amount        int64  `gorm:"type:bigint;not null"`
+}
+
+func (PriceSurcharge) TableName() string {
+	return "price_surcharges"
+}
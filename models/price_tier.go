@@ -0,0 +1,14 @@
+package models
+
+// PriceTier discounts the messages of the accounts on the plan which have sent
+// at least MinMessages messages in the current month.
+type PriceTier struct {
+	ID              uint `gorm:"primary_key"`
+	PricingPlanID   uint `gorm:"not null;uniqueIndex:idx_price_tiers_plan_min"`
+	MinMessages     int  `gorm:"not null;uniqueIndex:idx_price_tiers_plan_min"`
+	DiscountPercent int  `gorm:"not null"`
+}
+
+func (PriceTier) TableName() string {
+	return "price_tiers"
+}
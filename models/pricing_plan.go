@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// PricingPlan is a plan which accounts are assigned to by admins. Accounts
+// without a plan use the default plan. Prices which are 0 fall back to the
+// "single sms" and "group sms" configurations.
+type PricingPlan struct {
+	ID                uint      `gorm:"primary_key"`
+	Name              string    `gorm:"type:varchar(255);unique;not null"`
+	IsDefault         bool      `gorm:"default:false"`
+	RequestsPerSecond float64   `gorm:"not null"`
+	MessagesPerMinute int       `gorm:"not null"`
+	SinglePrice       int64     `gorm:"type:bigint;not null;default:0"`
+	GroupPrice        int64     `gorm:"type:bigint;not null;default:0"`
+	CreatedAt         time.Time `gorm:"default:current_timestamp"`
+}
+
+func (PricingPlan) TableName() string {
+	return "pricing_plans"
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// PromoCredit is budget which is granted by an admin until ExpiresAt. It is a part
+// of the account's budget, and it is spent before the paid budget.
+type PromoCredit struct {
+	ID        uint      `gorm:"primary_key"`
+	AccountID uint      `gorm:"not null;index"`
+	Amount    int64     `gorm:"type:bigint;not null"`
+	Remaining int64     `gorm:"type:bigint;not null"`
+	Reason    string    `gorm:"type:varchar(1000)"`
+	ActorID   uint      `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+func (PromoCredit) TableName() string {
+	return "promo_credits"
+}
@@ -1,10 +1,32 @@
 package models
 
+import "time"
+
+// Types of sender numbers. Default numbers are used by all accounts, shared numbers
+// are rented by several accounts at once, and exclusive and vanity numbers are rented
+// or bought by a single account.
+const (
+	SenderTypeDefault   = "default"
+	SenderTypeShared    = "shared"
+	SenderTypeExclusive = "exclusive"
+	SenderTypeVanity    = "vanity"
+)
+
 type SenderNumber struct {
-	ID         uint   `gorm:"primary_key"`
-	Number     string `gorm:"type:varchar(255); unique; not null"`
+	ID     uint   `gorm:"primary_key"`
+	Number string `gorm:"type:varchar(255); unique; not null"`
+	// IsExclusive is true while an exclusive or vanity number is held by an account
 	IsExclusive bool   `gorm:"type:bool; default:false; not null"`
-	IsDefault  bool   `gorm:"type:bool; default:false; not null"`
+	IsDefault   bool   `gorm:"type:bool; default:false; not null"`
+	Type        string `gorm:"type:varchar(20); default:exclusive; not null"`
+	// RentPrice is the price of a month of rent, 0 uses the price of the subscription package
+	RentPrice int64 `gorm:"type:bigint; default:0; not null"`
+	// BuyPrice is the price of buying the number, 0 uses the price of the buy package
+	BuyPrice int64 `gorm:"type:bigint; default:0; not null"`
+	// ProviderID is the provider which the messages from the number are sent through, nil uses the routes
+	ProviderID *uint
+	// RetiredAt is set when the number isn't offered anymore, its holders keep it until their rent ends
+	RetiredAt *time.Time
 }
 
 func (SenderNumber) TableName() string {
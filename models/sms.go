@@ -13,4 +13,6 @@ type SMSMessage struct {
 	DeliveryReport string     `gorm:"type:text"`
 	CreatedAt      time.Time  `gorm:"default:current_timestamp"`
 	AccountID      uint       `gorm:"not null"`
+	MemberID       uint       `gorm:"default:null"`
+	OperatorID     *uint      `gorm:"index;default:null"`
 }
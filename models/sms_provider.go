@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// SMSProvider is a provider which messages are sent through. The messages are sent
+// through the providers of the route of their recipient's operator in order, until
+// one of them sends the message.
+type SMSProvider struct {
+	ID   uint   `gorm:"primary_key"`
+	Name string `gorm:"type:varchar(100);unique;not null"`
+	// Price is what the provider charges for a message, providers are ordered by it with least-cost routing
+	Price int64 `gorm:"not null"`
+	// Enabled is false for the providers which are left out of all routes
+	Enabled   bool `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (SMSProvider) TableName() string {
+	return "sms_providers"
+}
+
+// ProviderRoute is a provider in the route of an operator, the providers are tried by
+// their position. The route without an operator is used for the operators which don't
+// have a route and the recipients whose operator isn't detected.
+type ProviderRoute struct {
+	ID         uint  `gorm:"primary_key"`
+	OperatorID *uint `gorm:"index"`
+	ProviderID uint  `gorm:"not null;index"`
+	Position   int   `gorm:"not null"`
+}
+
+func (ProviderRoute) TableName() string {
+	return "provider_routes"
+}
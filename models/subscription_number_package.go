@@ -1,11 +1,40 @@
 package models
 
+import "time"
+
+// Types of subscription packages. Rent packages hold a number for their duration and
+// buy packages hold it until it is released.
+const (
+	PackageTypeRent = "rent"
+	PackageTypeBuy  = "buy"
+)
+
+// Units of the duration of rent packages.
+const (
+	DurationUnitDay   = "day"
+	DurationUnitMonth = "month"
+)
+
 type SubscriptionNumberPackage struct {
 	ID    uint   `gorm:"primary_key"`
 	Title string `gorm:"type:varchar(55);not null;unique"`
 	Price int64  `gorm:"type:bigint"`
+	Type  string `gorm:"type:varchar(10);not null;default:rent"`
+	// Duration is the length of the rent in DurationUnit, buy packages don't have a duration
+	Duration     int    `gorm:"not null;default:0"`
+	DurationUnit string `gorm:"type:varchar(10);not null;default:month"`
+	// Inactive packages aren't offered anymore, the numbers which are held with them are kept
+	IsActive bool `gorm:"not null;default:true"`
 }
 
 func (SubscriptionNumberPackage) TableName() string {
 	return "subscription_number_package"
 }
+
+// EndDate returns the end of the rent which starts at start.
+func (p SubscriptionNumberPackage) EndDate(start time.Time) time.Time {
+	if p.DurationUnit == DurationUnitDay {
+		return start.AddDate(0, 0, p.Duration)
+	}
+	return start.AddDate(0, p.Duration, 0)
+}
@@ -2,11 +2,23 @@ package models
 
 import "time"
 
+// Statuses of a payment transaction
+const (
+	TransactionStatusWait   = "Wait"
+	TransactionStatusOkay   = "Okay"
+	TransactionStatusFailed = "Failed"
+	// the user didn't pay the transaction in time
+	TransactionStatusExpired = "Expired"
+)
+
 type Transaction struct {
-	ID        uint      `gorm:"primary_key"`
-	AccountID uint      `gorm:"not null"`
-	Amount    int64     `gorm:"type:bigint"`
-	Status    string    `gorm:"type:varchar(255)"`
-	Authority string    `gorm:"type:varchar(255)"`
-	CreatedAt time.Time `gorm:"type:datetime"`
+	ID         uint       `gorm:"primary_key"`
+	AccountID  uint       `gorm:"not null"`
+	Amount     int64      `gorm:"type:bigint"`
+	Status     string     `gorm:"type:varchar(255)"`
+	Authority  string     `gorm:"type:varchar(255)"`
+	RefID      string     `gorm:"type:varchar(255)"`
+	CardHash   string     `gorm:"type:varchar(255)"`
+	VerifiedAt *time.Time `gorm:"default:null"`
+	CreatedAt  time.Time  `gorm:"type:datetime"`
 }
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// RecoveryCode is a single use code which replaces a TOTP code when the
+// authenticator app is lost.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primary_key"`
+	AccountID uint       `gorm:"not null;index"`
+	CodeHash  string     `gorm:"type:varchar(255);not null"`
+	UsedAt    *time.Time `gorm:"default:null"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+// LoginChallenge is created when the password of an account with two factor
+// authentication is accepted, and is answered with the second factor.
+type LoginChallenge struct {
+	ID        uint       `gorm:"primary_key"`
+	AccountID uint       `gorm:"not null"`
+	Token     string     `gorm:"type:varchar(255);unique;not null"`
+	Method    string     `gorm:"type:varchar(10);not null"`
+	CodeHash  string     `gorm:"type:varchar(255)"`
+	ForAdmin  bool       `gorm:"default:false"`
+	Attempts  int        `gorm:"default:0"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time `gorm:"default:null"`
+	CreatedAt time.Time  `gorm:"default:current_timestamp"`
+}
+
+func (LoginChallenge) TableName() string {
+	return "login_challenges"
+}
@@ -1,10 +1,19 @@
 package models
 
+import "time"
+
 type User struct {
-	ID         uint   `gorm:"primary_key"`
-	FirstName  string `gorm:"type:varchar(255);not null"`
-	LastName   string `gorm:"type:varchar(255);not null"`
-	Phone      string `gorm:"type:varchar(255);unique;not null"`
-	Email      string `gorm:"type:varchar(255);unique;not null"`
-	NationalID string `gorm:"type:varchar(255);unique;not null"`
+	ID              uint       `gorm:"primary_key"`
+	FirstName       string     `gorm:"type:varchar(255);not null"`
+	LastName        string     `gorm:"type:varchar(255);not null"`
+	Phone           string     `gorm:"type:varchar(255);unique;not null"`
+	Email           string     `gorm:"type:varchar(255);unique;not null"`
+	NationalID      string     `gorm:"type:varchar(255);unique;not null"`
+	PhoneVerifiedAt *time.Time `gorm:"default:null"`
+	EmailVerifiedAt *time.Time `gorm:"default:null"`
+	// billing details which are printed on invoices
+	CompanyName  string `gorm:"type:varchar(255);default:''"`
+	EconomicCode string `gorm:"type:varchar(255);default:''"`
+	Address      string `gorm:"type:varchar(1000);default:''"`
+	PostalCode   string `gorm:"type:varchar(20);default:''"`
 }
@@ -3,16 +3,31 @@ package models
 import "time"
 
 type UserNumbers struct {
-	ID                    uint      				`gorm:"primary_key"`
-	UserID                uint      				`gorm:"not null"`
-	NumberID              uint      				`gorm:"not null"`
-	StartDate             time.Time 				`gorm:"type:date"`
-	EndDate               time.Time 				`gorm:"type:date"`
-	IsAvailable           bool      				`gorm:"default:true"`
+	ID        uint      `gorm:"primary_key"`
+	UserID    uint      `gorm:"not null"`
+	NumberID  uint      `gorm:"not null"`
+	StartDate time.Time `gorm:"type:date"`
+	// EndDate is the end of the rent, bought numbers don't have an end date
+	EndDate time.Time `gorm:"type:date"`
+	// IsAvailable is false in the grace period after the rent ends, the number can't be
+	// used then but it is reserved for the account until the grace period ends
+	IsAvailable bool `gorm:"default:true"`
+	// Type is the type of the package which the number is held with, rent or buy
+	Type string `gorm:"type:varchar(10);not null;default:rent"`
+	// AutoRenew charges the account for another period before the rent ends
+	AutoRenew bool `gorm:"not null;default:false"`
+	// RemindedAt is when the account was reminded of the end of the rent, it is reset by renewals
+	RemindedAt *time.Time
+	// RenewalFailedAt is when auto-renew failed for the current end date, it is reset by renewals
+	RenewalFailedAt *time.Time
+	// PeriodStart is the start of the current period of the rent, which ends at EndDate
+	PeriodStart time.Time
+	// PaidPrice is what the account paid for the current period of the rent, or for buying the number
+	PaidPrice             int64 `gorm:"not null;default:0"`
 	SubscriptionPackageID uint
 	SubscriptionPackage   SubscriptionNumberPackage `gorm:"foreignKey:SubscriptionPackageID"`
 	User                  User
-	Number                SenderNumber 				`gorm:"foreignKey:NumberID"`
+	Number                SenderNumber `gorm:"foreignKey:NumberID"`
 }
 
 func (UserNumbers) TableName() string {
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Purposes of verification tokens.
+const (
+	VerificationPhone         = "phone_verification"
+	VerificationEmail         = "email_verification"
+	VerificationPasswordReset = "password_reset"
+)
+
+// Channels which verification tokens are delivered by.
+const (
+	VerificationChannelSMS   = "sms"
+	VerificationChannelEmail = "email"
+)
+
+// VerificationToken is a single use, expiring token which is sent to the phone or
+// email of an account to verify it or to reset its password. Only its hash is stored.
+type VerificationToken struct {
+	ID        uint       `gorm:"primary_key"`
+	AccountID uint       `gorm:"not null;index"`
+	Purpose   string     `gorm:"type:varchar(50);not null"`
+	Channel   string     `gorm:"type:varchar(10);not null"`
+	TokenHash string     `gorm:"type:varchar(255);not null;index"`
+	Attempts  int        `gorm:"default:0"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time `gorm:"default:null"`
+	CreatedAt time.Time  `gorm:"default:current_timestamp"`
+}
+
+func (VerificationToken) TableName() string {
+	return "verification_tokens"
+}
@@ -24,10 +24,68 @@ func WithDBConnection(handlerFunc func(c echo.Context, db *gorm.DB) error) echo.
 
 func accountRoutes(e *echo.Echo) {
 	e.POST("/accounts/login", WithDBConnection(handlers.LoginHandler))
+	e.POST("/accounts/login/verify", WithDBConnection(handlers.VerifyTwoFactorHandler))
 	e.POST("/accounts/register", WithDBConnection(handlers.RegisterHandler))
+	e.POST("/accounts/verify/phone", WithDBConnection(handlers.VerifyPhoneHandler))
+	e.GET("/accounts/verify/email", WithDBConnection(handlers.VerifyEmailHandler))
+	e.POST("/accounts/verify/resend", WithDBConnection(handlers.ResendVerificationHandler))
+	e.POST("/accounts/password/forgot", WithDBConnection(handlers.ForgotPasswordHandler))
+	e.POST("/accounts/password/reset", WithDBConnection(handlers.ResetPasswordHandler))
 	e.GET("/accounts/budget", handlers.BudgetAmountHandler, middlewares.IsLoggedIn)
-	e.POST("/accounts/rent-number", WithDBConnection(handlers.RentNumberHandler), middlewares.IsLoggedIn)
-	e.POST("/accounts/buy-number", WithDBConnection(handlers.BuyNumberHandler), middlewares.IsLoggedIn)
+	e.GET("/accounts/prices/quote", WithDBConnection(handlers.PriceQuoteHandler), middlewares.IsLoggedIn)
+	e.GET("/accounts/ledger", WithDBConnection(handlers.LedgerHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.POST("/accounts/rent-number", WithDBConnection(handlers.RentNumberHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.POST("/accounts/buy-number", WithDBConnection(handlers.BuyNumberHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
 	e.GET("/accounts/sender-numbers", WithDBConnection(handlers.GetAllSenderNumbersHandler), middlewares.IsLoggedIn)
 	e.GET("/accounts/sender-numbers/sale", WithDBConnection(handlers.GetAllSenderNumbersForSaleHandler), middlewares.IsLoggedIn)
-}
\ No newline at end of file
+	e.GET("/accounts/subscription-packages", WithDBConnection(handlers.GetSubscriptionPackagesHandler), middlewares.IsLoggedIn)
+	e.GET("/accounts/rented-numbers", WithDBConnection(handlers.ListRentedNumbersHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.POST("/accounts/rented-numbers/:id/renew", WithDBConnection(handlers.RenewNumberHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.PATCH("/accounts/rented-numbers/:id", WithDBConnection(handlers.SetAutoRenewHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.POST("/accounts/rented-numbers/:id/release", WithDBConnection(handlers.ReleaseNumberHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.POST("/accounts/rented-numbers/:id/transfer", WithDBConnection(handlers.TransferNumberHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.GET("/accounts/number-transfers", WithDBConnection(handlers.ListNumberTransfersHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.POST("/accounts/number-transfers/:id/accept", WithDBConnection(handlers.AcceptNumberTransferHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.POST("/accounts/number-transfers/:id/decline", WithDBConnection(handlers.DeclineNumberTransferHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.DELETE("/accounts/number-transfers/:id", WithDBConnection(handlers.CancelNumberTransferHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.POST("/accounts/number-reservations", WithDBConnection(handlers.ReserveNumberHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.GET("/accounts/number-reservations", WithDBConnection(handlers.ListNumberReservationsHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.DELETE("/accounts/number-reservations/:id", WithDBConnection(handlers.CancelNumberReservationHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.POST("/accounts/number-waitlist", WithDBConnection(handlers.JoinNumberWaitlistHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.GET("/accounts/number-waitlist", WithDBConnection(handlers.ListNumberWaitlistHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.DELETE("/accounts/number-waitlist/:id", WithDBConnection(handlers.LeaveNumberWaitlistHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+
+	// Two factor authentication
+	e.POST("/accounts/2fa/totp/setup", WithDBConnection(handlers.SetupTOTPHandler), middlewares.IsLoggedIn)
+	e.POST("/accounts/2fa/totp/enable", WithDBConnection(handlers.EnableTOTPHandler), middlewares.IsLoggedIn)
+	e.POST("/accounts/2fa/sms/enable", WithDBConnection(handlers.EnableSMSTwoFactorHandler), middlewares.IsLoggedIn)
+	e.POST("/accounts/2fa/disable", WithDBConnection(handlers.DisableTwoFactorHandler), middlewares.IsLoggedIn)
+	e.POST("/accounts/2fa/recovery-codes", WithDBConnection(handlers.RegenerateRecoveryCodesHandler), middlewares.IsLoggedIn)
+
+	// API keys
+	e.POST("/accounts/api-keys", WithDBConnection(handlers.CreateAPIKeyHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.GET("/accounts/api-keys", WithDBConnection(handlers.ListAPIKeysHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.DELETE("/accounts/api-keys/:id", WithDBConnection(handlers.RevokeAPIKeyHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+
+	// Invoices
+	e.GET("/accounts/invoices", WithDBConnection(handlers.ListInvoicesHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.GET("/accounts/invoices/:id", WithDBConnection(handlers.InvoiceHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.GET("/accounts/billing", WithDBConnection(handlers.BillingDetailsHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.PATCH("/accounts/billing", WithDBConnection(handlers.UpdateBillingDetailsHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+
+	// Postpaid bills
+	e.GET("/accounts/bills", WithDBConnection(handlers.ListBillsHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.POST("/accounts/bills/:id/pay", WithDBConnection(handlers.PayBillHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+
+	// Low balance alerts
+	e.GET("/accounts/low-balance-alert", WithDBConnection(handlers.LowBalanceAlertHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.PUT("/accounts/low-balance-alert", WithDBConnection(handlers.UpdateLowBalanceAlertHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.DELETE("/accounts/low-balance-alert", WithDBConnection(handlers.DeleteLowBalanceAlertHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+
+	// Organization members
+	e.POST("/accounts/members", WithDBConnection(handlers.CreateMemberHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.GET("/accounts/members", WithDBConnection(handlers.ListMembersHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.PATCH("/accounts/members/:id", WithDBConnection(handlers.UpdateMemberHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.DELETE("/accounts/members/:id", WithDBConnection(handlers.DeleteMemberHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+	e.GET("/accounts/members/:id/messages", WithDBConnection(handlers.MemberMessagesHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner)
+}
@@ -9,6 +9,7 @@ import (
 
 func adminRoutes(e *echo.Echo) {
 	e.POST("/admin/login", WithDBConnection(handlers.AdminLoginHandler))
+	e.POST("/admin/login/verify", WithDBConnection(handlers.VerifyTwoFactorHandler))
 	e.POST("/admin/register", WithDBConnection(handlers.AdminRegisterHandler))
 	e.POST("/admin/add-config", WithDBConnection(handlers.AddConfigHandler), middlewares.IsAdmin)
 	e.GET("/admin/sms-report", WithDBConnection(handlers.SmsReportHandler), middlewares.IsAdmin)
@@ -16,4 +17,64 @@ func adminRoutes(e *echo.Echo) {
 	e.GET("/admin/search/:word", WithDBConnection(handlers.SmsSearchHandler), middlewares.IsAdmin)
 	e.PATCH("/admin/deactivate/:id", WithDBConnection(handlers.DeactivateHandler), middlewares.IsAdmin)
 	e.PATCH("/admin/activate/:id", WithDBConnection(handlers.ActivateHandler), middlewares.IsAdmin)
+	e.GET("/admin/audit-logs", WithDBConnection(handlers.AuditLogsHandler), middlewares.IsAdmin)
+	e.GET("/admin/lockouts", WithDBConnection(handlers.LoginLockoutsHandler), middlewares.IsAdmin)
+	e.DELETE("/admin/lockouts/:id", WithDBConnection(handlers.ClearLoginLockoutHandler), middlewares.IsAdmin)
+
+	// Settings
+	e.GET("/admin/settings", WithDBConnection(handlers.ListSettingsHandler), middlewares.IsAdmin)
+	e.PUT("/admin/settings/:key", WithDBConnection(handlers.UpdateSettingHandler), middlewares.IsAdmin)
+	e.DELETE("/admin/settings/:key", WithDBConnection(handlers.DeleteSettingHandler), middlewares.IsAdmin)
+
+	// Pricing plans
+	e.POST("/admin/pricing-plans", WithDBConnection(handlers.CreatePricingPlanHandler), middlewares.IsAdmin)
+	e.GET("/admin/pricing-plans", WithDBConnection(handlers.ListPricingPlansHandler), middlewares.IsAdmin)
+	e.PATCH("/admin/pricing-plans/:id", WithDBConnection(handlers.UpdatePricingPlanHandler), middlewares.IsAdmin)
+	e.DELETE("/admin/pricing-plans/:id", WithDBConnection(handlers.DeletePricingPlanHandler), middlewares.IsAdmin)
+	e.PATCH("/admin/accounts/:id/pricing-plan", WithDBConnection(handlers.SetAccountPricingPlanHandler), middlewares.IsAdmin)
+	e.GET("/admin/pricing-plans/:id/prices", WithDBConnection(handlers.PricesHandler), middlewares.IsAdmin)
+	e.PUT("/admin/pricing-plans/:id/tiers", WithDBConnection(handlers.SetPriceTierHandler), middlewares.IsAdmin)
+	e.DELETE("/admin/pricing-plans/:id/tiers/:ruleID", WithDBConnection(handlers.DeletePriceTierHandler), middlewares.IsAdmin)
+	e.PUT("/admin/pricing-plans/:id/rates", WithDBConnection(handlers.SetPriceRateHandler), middlewares.IsAdmin)
+	e.DELETE("/admin/pricing-plans/:id/rates/:ruleID", WithDBConnection(handlers.DeletePriceRateHandler), middlewares.IsAdmin)
+	e.PUT("/admin/pricing-plans/:id/surcharges", WithDBConnection(handlers.SetPriceSurchargeHandler), middlewares.IsAdmin)
+	e.DELETE("/admin/pricing-plans/:id/surcharges/:ruleID", WithDBConnection(handlers.DeletePriceSurchargeHandler), middlewares.IsAdmin)
+
+	// Mobile operators
+	e.GET("/admin/operators", WithDBConnection(handlers.ListOperatorsHandler), middlewares.IsAdmin)
+	e.POST("/admin/operators", WithDBConnection(handlers.CreateOperatorHandler), middlewares.IsAdmin)
+	e.GET("/admin/operators/report", WithDBConnection(handlers.OperatorReportHandler), middlewares.IsAdmin)
+	e.PATCH("/admin/operators/:id", WithDBConnection(handlers.UpdateOperatorHandler), middlewares.IsAdmin)
+	e.DELETE("/admin/operators/:id", WithDBConnection(handlers.DeleteOperatorHandler), middlewares.IsAdmin)
+
+	// Sender numbers
+	e.GET("/admin/sender-numbers", WithDBConnection(handlers.ListSenderNumbersHandler), middlewares.IsAdmin)
+	e.POST("/admin/sender-numbers", WithDBConnection(handlers.CreateSenderNumberHandler), middlewares.IsAdmin)
+	e.GET("/admin/sender-numbers/:id", WithDBConnection(handlers.GetSenderNumberHandler), middlewares.IsAdmin)
+	e.PATCH("/admin/sender-numbers/:id", WithDBConnection(handlers.UpdateSenderNumberHandler), middlewares.IsAdmin)
+	e.DELETE("/admin/sender-numbers/:id", WithDBConnection(handlers.DeleteSenderNumberHandler), middlewares.IsAdmin)
+
+	// Subscription packages which numbers are rented or bought with
+	e.GET("/admin/subscription-packages", WithDBConnection(handlers.ListSubscriptionPackagesHandler), middlewares.IsAdmin)
+	e.POST("/admin/subscription-packages", WithDBConnection(handlers.CreateSubscriptionPackageHandler), middlewares.IsAdmin)
+	e.PATCH("/admin/subscription-packages/:id", WithDBConnection(handlers.UpdateSubscriptionPackageHandler), middlewares.IsAdmin)
+	e.DELETE("/admin/subscription-packages/:id", WithDBConnection(handlers.DeleteSubscriptionPackageHandler), middlewares.IsAdmin)
+
+	// SMS providers and their routes
+	e.GET("/admin/providers", WithDBConnection(handlers.ListProvidersHandler), middlewares.IsAdmin)
+	e.POST("/admin/providers", WithDBConnection(handlers.CreateProviderHandler), middlewares.IsAdmin)
+	e.PATCH("/admin/providers/:id", WithDBConnection(handlers.UpdateProviderHandler), middlewares.IsAdmin)
+	e.DELETE("/admin/providers/:id", WithDBConnection(handlers.DeleteProviderHandler), middlewares.IsAdmin)
+	e.POST("/admin/providers/:id/reset", WithDBConnection(handlers.ResetProviderHandler), middlewares.IsAdmin)
+	e.GET("/admin/routes", WithDBConnection(handlers.ListRoutesHandler), middlewares.IsAdmin)
+	e.PUT("/admin/routes", WithDBConnection(handlers.SetRouteHandler), middlewares.IsAdmin)
+
+	// Budget adjustments
+	e.POST("/admin/accounts/:id/credit", WithDBConnection(handlers.CreditAccountHandler), middlewares.IsAdmin)
+	e.POST("/admin/accounts/:id/debit", WithDBConnection(handlers.DebitAccountHandler), middlewares.IsAdmin)
+	e.GET("/admin/accounts/:id/ledger", WithDBConnection(handlers.AccountLedgerHandler), middlewares.IsAdmin)
+
+	// Postpaid accounts
+	e.PATCH("/admin/accounts/:id/credit-limit", WithDBConnection(handlers.SetCreditLimitHandler), middlewares.IsAdmin)
+	e.GET("/admin/accounts/:id/bills", WithDBConnection(handlers.AccountBillsHandler), middlewares.IsAdmin)
 }
@@ -8,6 +8,8 @@ import (
 )
 
 func paymentRoutes(e *echo.Echo) {
-	e.POST("/accounts/payment/request", WithDBConnection(handlers.PaymentRequestHandler), middlewares.IsLoggedIn)
+	e.POST("/accounts/payment/request", WithDBConnection(handlers.PaymentRequestHandler), middlewares.IsLoggedIn, middlewares.IsAccountOwner, middlewares.Idempotency)
 	e.GET("/accounts/payment/verify", WithDBConnection(handlers.PaymentVerifyHandler))
+	// some gateways post the callback parameters
+	e.POST("/accounts/payment/verify", WithDBConnection(handlers.PaymentVerifyHandler))
 }
@@ -4,9 +4,11 @@ import (
 	"log"
 	"time"
 
+	"SMS-panel/config"
 	database "SMS-panel/database"
 	"SMS-panel/handlers"
 	"SMS-panel/tasks"
+	"SMS-panel/utils"
 
 	"github.com/labstack/echo/v4"
 	echoSwagger "github.com/swaggo/echo-swagger"
@@ -24,9 +26,45 @@ func StartServer() {
 		log.Fatal(err)
 	}
 
+	// emails are only logged when SMTP isn't configured
+	cfg, err := config.NewConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.SMTP.HOST != "" {
+		utils.SetMailer(utils.NewSMTPMailer(cfg.SMTP.HOST, cfg.SMTP.PORT, cfg.SMTP.USER, cfg.SMTP.PASSWORD, cfg.SMTP.FROM))
+	}
+
+	paymentGateway, err := utils.NewPaymentGateway(cfg.Payment.GATEWAY, utils.PaymentGatewayOptions{
+		MerchantID:  cfg.Payment.MERCHANT_ID,
+		CallbackURL: cfg.Payment.CALLBACK_URL,
+		APIURL:      cfg.Payment.API_URL,
+		GateURL:     cfg.Payment.GATE_URL,
+		Sandbox:     cfg.Payment.SANDBOX,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	utils.SetPaymentGateway(paymentGateway)
+
+	utils.SetInvoiceSeller(utils.InvoiceSeller{
+		Name:         cfg.Invoice.SELLER_NAME,
+		EconomicCode: cfg.Invoice.SELLER_ECONOMIC_CODE,
+		NationalID:   cfg.Invoice.SELLER_NATIONAL_ID,
+		Address:      cfg.Invoice.SELLER_ADDRESS,
+		PostalCode:   cfg.Invoice.SELLER_POSTAL_CODE,
+		Phone:        cfg.Invoice.SELLER_PHONE,
+	})
+
 	// task scheduler
 	taskSchaduler := tasks.NewTaskScheduler()
 	taskSchaduler.AddTask(tasks.RentNumberTask(db), 10*time.Second, 11, 51, 0)
+	taskSchaduler.AddTask(tasks.PurgeIdempotencyKeysTask(db), 24*time.Hour, 3, 0, 0)
+	taskSchaduler.AddTask(tasks.PurgeNumberReservationsTask(db), time.Hour, 0, 0, 0)
+	taskSchaduler.AddTask(tasks.ReconcilePaymentsTask(db, 15*time.Minute, 24*time.Hour), 10*time.Minute, 0, 0, 0)
+	taskSchaduler.AddTask(tasks.ExpirePromoCreditsTask(db), time.Hour, 0, 0, 0)
+	taskSchaduler.AddTask(tasks.LowBalanceAlertTask(db), time.Minute, 0, 0, 0)
+	taskSchaduler.AddTask(tasks.PostpaidBillingTask(db), time.Hour, 0, 0, 0)
 
 	taskSchaduler.Run()
 
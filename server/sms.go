@@ -4,12 +4,18 @@ import (
 	"SMS-panel/handlers"
 
 	"SMS-panel/middlewares"
+	"SMS-panel/models"
 
 	"github.com/labstack/echo/v4"
 )
 
 func smsRouter(e *echo.Echo, handler *handlers.SmsPhoneBookHandler) {
-	e.POST("/sms/single", WithDBConnection(handlers.SendSingleSMSHandler), middlewares.IsLoggedIn)
-	e.POST("/sms/periodic", WithDBConnection(handlers.PeriodicSendSMSHandler), middlewares.IsLoggedIn)
-	e.POST("/sms/phonebooks", handler.SendMessageToPhoneBooksHandler, middlewares.IsLoggedIn)
+	sender := middlewares.MemberRoles(models.MemberRoleSender)
+
+	e.POST("/sms/single", WithDBConnection(handlers.SendSingleSMSHandler), middlewares.IsLoggedIn, middlewares.RateLimit, sender, middlewares.Idempotency)
+	e.POST("/sms/periodic", WithDBConnection(handlers.PeriodicSendSMSHandler), middlewares.IsLoggedIn, middlewares.RateLimit, sender)
+	e.POST("/sms/phonebooks", handler.SendMessageToPhoneBooksHandler, middlewares.IsLoggedIn, middlewares.RateLimit, sender)
+
+	e.POST("/otp/send", WithDBConnection(handlers.SendOTPHandler), middlewares.IsLoggedIn, middlewares.RateLimit, sender)
+	e.POST("/otp/verify", WithDBConnection(handlers.VerifyOTPHandler), middlewares.IsLoggedIn, middlewares.RateLimit, sender)
 }
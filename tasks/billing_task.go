@@ -0,0 +1,45 @@
+package tasks
+
+import (
+	"SMS-panel/models"
+	"SMS-panel/utils"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PostpaidBillingTask issues the bills of the last month for the postpaid accounts
+// and suspends the accounts whose bills are overdue.
+func PostpaidBillingTask(db *gorm.DB) TaskFunc {
+	return func() {
+		periodStart := utils.MonthStart(utils.MonthStart(time.Now()).AddDate(0, -1, 0))
+
+		// accounts which had their credit limit removed still pay their debt
+		var accountIDs []uint
+		err := db.Model(&models.Account{}).
+			Where("(credit_limit > 0 OR budget < 0) AND NOT EXISTS (?)",
+				db.Model(&models.Bill{}).Select("1").
+					Where("bills.account_id = accounts.id AND bills.period_start = ?", periodStart)).
+			Pluck("id", &accountIDs).Error
+		if err != nil {
+			log.Println("Can't find postpaid accounts:", err)
+			return
+		}
+
+		for _, accountID := range accountIDs {
+			if _, err := utils.IssueBill(db, accountID, periodStart); err != nil {
+				log.Printf("Can't issue bill of account %d: %v", accountID, err)
+			}
+		}
+
+		suspended, err := utils.SuspendOverdueAccounts(db)
+		if err != nil {
+			log.Println("Can't suspend accounts with overdue bills:", err)
+			return
+		}
+		for _, accountID := range suspended {
+			log.Printf("Account %d is suspended for an overdue bill", accountID)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package tasks
+
+import (
+	"SMS-panel/utils"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+func PurgeIdempotencyKeysTask(db *gorm.DB) TaskFunc {
+	return func() {
+		count, err := utils.PurgeIdempotencyKeys(db)
+		if err != nil {
+			log.Println("Can't purge idempotency keys:", err)
+			return
+		}
+		log.Println(count, "expired idempotency keys are purged")
+	}
+}
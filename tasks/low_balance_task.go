@@ -0,0 +1,30 @@
+package tasks
+
+import (
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// LowBalanceAlertTask alerts the accounts whose budget dropped under the threshold
+// of their low balance alert, and rearms the alerts of the accounts which topped up.
+func LowBalanceAlertTask(db *gorm.DB) TaskFunc {
+	return func() {
+		var alerts []models.LowBalanceAlert
+		err := db.Joins("JOIN accounts ON accounts.id = low_balance_alerts.account_id").
+			Where("(accounts.budget < low_balance_alerts.threshold) <> low_balance_alerts.triggered").
+			Find(&alerts).Error
+		if err != nil {
+			log.Println("Can't find low balance alerts:", err)
+			return
+		}
+
+		for _, alert := range alerts {
+			if err := handlers.CheckLowBalance(db, alert.AccountID); err != nil {
+				log.Printf("Can't check low balance of account %d: %v", alert.AccountID, err)
+			}
+		}
+	}
+}
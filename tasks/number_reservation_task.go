@@ -0,0 +1,19 @@
+package tasks
+
+import (
+	"SMS-panel/utils"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+func PurgeNumberReservationsTask(db *gorm.DB) TaskFunc {
+	return func() {
+		count, err := utils.PurgeNumberReservations(db)
+		if err != nil {
+			log.Println("Can't purge number reservations:", err)
+			return
+		}
+		log.Println(count, "expired number reservations are purged")
+	}
+}
@@ -0,0 +1,72 @@
+package tasks
+
+import (
+	"SMS-panel/models"
+	"SMS-panel/utils"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReconcilePaymentsTask resolves the transactions which are still waiting for payment
+// after checkAfter, usually because the user closed the browser before being redirected
+// back. Paid ones are verified and credited, failed ones are marked as failed and the
+// ones which aren't paid after expireAfter are marked as expired.
+func ReconcilePaymentsTask(db *gorm.DB, checkAfter, expireAfter time.Duration) TaskFunc {
+	return func() {
+		now := time.Now()
+		var transactions []models.Transaction
+		err := db.Where("status = ? AND created_at < ?", models.TransactionStatusWait, now.Add(-checkAfter)).
+			Find(&transactions).Error
+		if err != nil {
+			log.Println("Can't find pending transactions:", err)
+			return
+		}
+
+		gateway := utils.GetPaymentGateway()
+		for _, transaction := range transactions {
+			expired := transaction.CreatedAt.Before(now.Add(-expireAfter))
+
+			// the payment wasn't created in the gateway
+			if transaction.Authority == "" {
+				if expired {
+					utils.CloseTransaction(db, transaction.ID, models.TransactionStatusExpired)
+				}
+				continue
+			}
+
+			payment := utils.PaymentVerifyRequest{
+				OrderID:   fmt.Sprint(transaction.ID),
+				Authority: transaction.Authority,
+				Amount:    transaction.Amount,
+			}
+			status, err := gateway.Inquire(payment)
+			if err != nil {
+				log.Printf("Can't inquire transaction %d: %v", transaction.ID, err)
+				continue
+			}
+
+			switch status {
+			case utils.PaymentStatusPaid, utils.PaymentStatusVerified:
+				verification, err := gateway.Verify(payment)
+				if err != nil || !verification.Verified {
+					log.Printf("Can't verify transaction %d: %v", transaction.ID, err)
+					continue
+				}
+				if err := utils.CreditTransaction(db, transaction.ID, verification); err != nil {
+					log.Printf("Can't credit transaction %d: %v", transaction.ID, err)
+					continue
+				}
+				log.Printf("Transaction %d is verified by reconciliation", transaction.ID)
+			case utils.PaymentStatusFailed:
+				utils.CloseTransaction(db, transaction.ID, models.TransactionStatusFailed)
+			case utils.PaymentStatusPending:
+				if expired {
+					utils.CloseTransaction(db, transaction.ID, models.TransactionStatusExpired)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package tasks
+
+import (
+	"SMS-panel/models"
+	"SMS-panel/utils"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExpirePromoCreditsTask removes the unspent part of expired promotional credits
+// from the budget of their accounts.
+func ExpirePromoCreditsTask(db *gorm.DB) TaskFunc {
+	return func() {
+		var promoCredits []models.PromoCredit
+		err := db.Where("remaining > 0 AND expires_at <= ?", time.Now()).Find(&promoCredits).Error
+		if err != nil {
+			log.Println("Can't find expired promotional credits:", err)
+			return
+		}
+
+		for _, promoCredit := range promoCredits {
+			if err := utils.ExpirePromoCredit(db, promoCredit.ID); err != nil {
+				log.Printf("Can't expire promotional credit %d: %v", promoCredit.ID, err)
+			}
+		}
+	}
+}
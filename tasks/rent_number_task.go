@@ -1,8 +1,11 @@
 package tasks
 
 import (
+	"SMS-panel/handlers"
 	"SMS-panel/models"
 	"SMS-panel/utils"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
@@ -10,39 +13,208 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+// Auto-renew which failed is tried again after this long, so topping up the budget
+// renews the number in the grace period too.
+const autoRenewRetryAfter = time.Hour
+
+// RentNumberTask auto-renews the rented numbers which are about to end, reminds their
+// accounts before they end, keeps the ended numbers reserved for their renters in the
+// grace period, and releases them after it.
 func RentNumberTask(db *gorm.DB) TaskFunc {
 	return func() {
 		now := time.Now()
-		log.Println("Start ------------------------", now)
-		var userNumberObjects []models.UserNumbers
-
-		tx := db.Begin()
-
-		err := tx.Clauses(clause.Returning{Columns: []clause.Column{{Name: "number_id"}}}).
-			Where(
-				"user_numbers.subscription_package_id != ? AND user_numbers.end_date < ?",
-				utils.SUBSCRIOPTION_PACKAGE_BUY_ID, now,
-			).
-			Delete(&userNumberObjects).Error
-		log.Println(userNumberObjects, "=====")
-		if err != nil || len(userNumberObjects) == 0 {
-			log.Println("There is no userNumber to delete")
-			return
+		autoRenewNumbers(db, now)
+		remindNumbers(db, now)
+		expireNumbers(db, now)
+		releaseNumbers(db, now)
+	}
+}
+
+func notifyNumberHolder(db *gorm.DB, userNumber models.UserNumbers, text string) {
+	account, err := utils.NumberHolderAccount(db, userNumber.UserID)
+	if err != nil {
+		log.Printf("Can't find account of user %d: %v", userNumber.UserID, err)
+		return
+	}
+	if err := handlers.SendNumberNotice(db, account, "Your sender number rent", text); err != nil {
+		log.Printf("Can't notify account %d of sender number %s: %v", account.ID, userNumber.Number.Number, err)
+	}
+}
+
+func autoRenewNumbers(db *gorm.DB, now time.Time) {
+	var userNumbers []models.UserNumbers
+	err := db.Preload("Number").Preload("SubscriptionPackage").
+		Where("type = ? AND auto_renew = ? AND end_date < ?", models.PackageTypeRent, true, now.Add(utils.NumberAutoRenewBefore)).
+		Where("renewal_failed_at IS NULL OR renewal_failed_at < ?", now.Add(-autoRenewRetryAfter)).
+		Find(&userNumbers).Error
+	if err != nil {
+		log.Println("Can't find numbers to auto-renew:", err)
+		return
+	}
+
+	for _, userNumber := range userNumbers {
+		account, err := utils.NumberHolderAccount(db, userNumber.UserID)
+		if err != nil {
+			log.Printf("Can't find account of user %d: %v", userNumber.UserID, err)
+			continue
 		}
 
-		var userNumbersIDs []int
-		for _, userNumber := range userNumberObjects {
-			userNumbersIDs = append(userNumbersIDs, int(userNumber.NumberID))
+		if !userNumber.SubscriptionPackage.IsActive {
+			err = errors.New("its subscription package isn't offered anymore")
+		} else {
+			tx := db.Begin()
+			// only the run which claims the number renews it, the number isn't due after it's renewed
+			result := tx.Model(&models.UserNumbers{}).
+				Where("id = ? AND auto_renew = ? AND end_date < ?", userNumber.ID, true, now.Add(utils.NumberAutoRenewBefore)).
+				Update("renewal_failed_at", gorm.Expr("renewal_failed_at"))
+			if result.Error != nil || result.RowsAffected == 0 {
+				tx.Rollback()
+				continue
+			}
+			_, err = utils.RenewNumber(tx, account.ID, &userNumber, userNumber.SubscriptionPackage)
+			if err != nil {
+				tx.Rollback()
+			} else {
+				err = tx.Commit().Error
+			}
+		}
+		if err == nil {
+			notifyNumberHolder(db, userNumber, fmt.Sprintf("Your sender number %s is renewed until %s.",
+				userNumber.Number.Number, userNumber.EndDate.Format("2006-01-02")))
+			continue
 		}
 
-		err = tx.Table("sender_numbers").
-			Where("id IN ?", userNumbersIDs).
-			Updates(map[string]interface{}{"is_exclusive": false}).Error
-		if err != nil {
-			log.Println("Can't update senderNumbers")
+		log.Printf("Can't auto-renew sender number %s of account %d: %v", userNumber.Number.Number, account.ID, err)
+		failed := userNumber.RenewalFailedAt == nil
+		if err := db.Model(&models.UserNumbers{}).Where("id = ?", userNumber.ID).Update("renewal_failed_at", now).Error; err != nil {
+			log.Println("Can't update userNumber:", err)
+		}
+		// the account is notified of the first failure of each end date
+		if failed {
+			reason := "renewal failed"
+			if errors.Is(err, utils.ErrInsufficientBudget) {
+				reason = "your budget isn't enough"
+			}
+			notifyNumberHolder(db, userNumber, fmt.Sprintf("Auto-renew of your sender number %s failed, %s. Renew it before %s to keep the number.",
+				userNumber.Number.Number, reason, utils.NumberGraceEnd(db, userNumber.EndDate).Format("2006-01-02")))
+		}
+	}
+}
+
+func remindNumbers(db *gorm.DB, now time.Time) {
+	days := int(utils.SettingInt(db, utils.SettingNumberReminderDays))
+	if days == 0 {
+		return
+	}
+
+	var userNumbers []models.UserNumbers
+	err := db.Preload("Number").
+		Where("type = ? AND is_available = ? AND reminded_at IS NULL AND end_date < ?", models.PackageTypeRent, true, now.AddDate(0, 0, days)).
+		Find(&userNumbers).Error
+	if err != nil {
+		log.Println("Can't find numbers to remind:", err)
+		return
+	}
+
+	for _, userNumber := range userNumbers {
+		// only the run which marks the number reminds its account
+		result := db.Model(&models.UserNumbers{}).
+			Where("id = ? AND reminded_at IS NULL", userNumber.ID).
+			Update("reminded_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		endDate := userNumber.EndDate.Format("2006-01-02")
+		text := fmt.Sprintf("The rent of your sender number %s ends on %s. Renew it to keep the number.", userNumber.Number.Number, endDate)
+		if userNumber.AutoRenew {
+			text = fmt.Sprintf("The rent of your sender number %s ends on %s, it will be renewed automatically from your budget.", userNumber.Number.Number, endDate)
+		}
+		notifyNumberHolder(db, userNumber, text)
+	}
+}
+
+func expireNumbers(db *gorm.DB, now time.Time) {
+	var userNumbers []models.UserNumbers
+	err := db.Preload("Number").
+		Where("type = ? AND is_available = ? AND end_date < ?", models.PackageTypeRent, true, now).
+		Find(&userNumbers).Error
+	if err != nil {
+		log.Println("Can't find ended numbers:", err)
+		return
+	}
+
+	graceDays := utils.SettingInt(db, utils.SettingNumberGraceDays)
+	for _, userNumber := range userNumbers {
+		result := db.Model(&models.UserNumbers{}).
+			Where("id = ? AND is_available = ?", userNumber.ID, true).
+			Update("is_available", false)
+		if result.Error != nil || result.RowsAffected == 0 || graceDays == 0 {
+			continue
+		}
+
+		notifyNumberHolder(db, userNumber, fmt.Sprintf("The rent of your sender number %s has ended. It is reserved for you until %s, renew it to keep the number.",
+			userNumber.Number.Number, utils.NumberGraceEnd(db, userNumber.EndDate).Format("2006-01-02")))
+	}
+}
+
+func releaseNumbers(db *gorm.DB, now time.Time) {
+	graceDays := int(utils.SettingInt(db, utils.SettingNumberGraceDays))
+	graceEnd := now.AddDate(0, 0, -graceDays)
+
+	tx := db.Begin()
+	// the rents are locked, so a renewal which is committed before waits for them or isn't released
+	var userNumbers []models.UserNumbers
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Number").
+		Where("type = ? AND is_available = ? AND end_date < ?", models.PackageTypeRent, false, graceEnd).
+		Find(&userNumbers).Error
+	if err != nil || len(userNumbers) == 0 {
+		tx.Rollback()
+		return
+	}
+
+	var released []models.UserNumbers
+	var userNumberIDs, numberIDs []uint
+	for _, userNumber := range userNumbers {
+		result := tx.Where("id = ? AND is_available = ? AND end_date < ?", userNumber.ID, false, graceEnd).
+			Delete(&models.UserNumbers{})
+		if result.Error != nil {
+			tx.Rollback()
+			log.Println("Can't delete userNumbers:", result.Error)
 			return
 		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		released = append(released, userNumber)
+		userNumberIDs = append(userNumberIDs, userNumber.ID)
+		numberIDs = append(numberIDs, userNumber.NumberID)
+	}
+	if len(released) == 0 {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Table("sender_numbers").
+		Where("id IN ?", numberIDs).
+		Updates(map[string]interface{}{"is_exclusive": false}).Error
+	if err != nil {
+		tx.Rollback()
+		log.Println("Can't update senderNumbers:", err)
+		return
+	}
+	if err := utils.CancelNumberTransfers(tx, userNumberIDs); err != nil {
+		tx.Rollback()
+		log.Println("Can't cancel number transfers:", err)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Println("Can't release numbers:", err)
+		return
+	}
 
-		tx.Commit()
+	for _, userNumber := range released {
+		notifyNumberHolder(db, userNumber, fmt.Sprintf("Your sender number %s is released because its rent wasn't renewed.", userNumber.Number.Number))
+		handlers.NotifyNumberWaitlist(db, userNumber.NumberID)
 	}
 }
@@ -216,6 +216,8 @@ func TestAdminLoginHandler(t *testing.T) {
 	assert.NoError(t, err)
 	account := models.Account{UserID: user.ID, Username: "admin", Password: string(hash), Token: "testtoken", IsActive: true, IsAdmin: true}
 	db.Create(&account)
+	senderNumber := models.SenderNumber{Number: "10001", IsDefault: true}
+	db.Create(&senderNumber)
 
 	t.Run("ValidRequest", func(t *testing.T) {
 		requestBody := map[string]interface{}{
@@ -236,11 +238,34 @@ func TestAdminLoginHandler(t *testing.T) {
 		err = handlers.AdminLoginHandler(c, db)
 
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, http.StatusAccepted, rec.Code)
 
-		var response models.Account
+		var response handlers.TwoFactorChallengeResponse
 		err = json.Unmarshal(rec.Body.Bytes(), &response)
 		assert.NoError(t, err)
+		assert.True(t, response.TwoFactorRequired)
+		assert.Equal(t, models.TwoFactorSMS, response.Method)
+
+		// login code is sent to the admin's phone
+		var sms models.SMSMessage
+		err = db.Where("recipient = ?", user.Phone).Last(&sms).Error
+		assert.NoError(t, err)
+		code := strings.TrimPrefix(sms.Message, "Your login code: ")
+
+		verifyBody := fmt.Sprintf(`{"challenge": "%s", "code": "%s"}`, response.Challenge, code)
+		req = httptest.NewRequest(http.MethodPost, "/admin/login/verify", strings.NewReader(verifyBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec = httptest.NewRecorder()
+		c = e.NewContext(req, rec)
+
+		err = handlers.VerifyTwoFactorHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var loggedIn models.Account
+		err = json.Unmarshal(rec.Body.Bytes(), &loggedIn)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, loggedIn.Token)
 	})
 
 	t.Run("InvalidJSON", func(t *testing.T) {
@@ -288,7 +313,7 @@ func TestAdminLoginHandler(t *testing.T) {
 		assert.NoError(t, err)
 
 		assert.Equal(t, 422, int(response.ResponseCode))
-		assert.Equal(t, "Wrong Password", response.Message)
+		assert.Equal(t, utils.InvalidCredentialsMessage, response.Message)
 	})
 }
 
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	assert.NoError(t, db.Create(&admin).Error)
+	account := models.Account{Username: "user", IsActive: true}
+	assert.NoError(t, db.Create(&account).Error)
+
+	t.Run("DeactivateWritesAuditLog", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPatch, "/", nil)
+		req.Header.Set(echo.HeaderXRealIP, "10.0.0.1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(account.ID))
+		c.Set("account", admin)
+
+		err := handlers.DeactivateHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var auditLog models.AuditLog
+		err = db.Where("action = ?", models.AuditActionAccountDeactivate).First(&auditLog).Error
+		assert.NoError(t, err)
+		assert.Equal(t, admin.ID, auditLog.ActorID)
+		assert.Equal(t, fmt.Sprintf("account:%d", account.ID), auditLog.Target)
+		assert.Equal(t, `{"is_active":true}`, auditLog.Before)
+		assert.Equal(t, `{"is_active":false}`, auditLog.After)
+		assert.Equal(t, "10.0.0.1", auditLog.IP)
+	})
+
+	t.Run("AddBadWordWritesAuditLog", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("word")
+		c.SetParamValues("bad")
+		c.Set("account", admin)
+
+		err := handlers.AddBadWordHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionBadWordCreate).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("AuditLogIsImmutable", func(t *testing.T) {
+		var auditLog models.AuditLog
+		assert.NoError(t, db.First(&auditLog).Error)
+
+		err := db.Model(&auditLog).Update("action", "changed").Error
+		assert.ErrorIs(t, err, models.ErrAuditLogImmutable)
+		err = db.Delete(&auditLog).Error
+		assert.ErrorIs(t, err, models.ErrAuditLogImmutable)
+	})
+
+	t.Run("FilterByAction", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit-logs?action=account.deactivate&actor="+fmt.Sprint(admin.ID), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handlers.AuditLogsHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var logs []handlers.AuditLogResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &logs))
+		assert.Len(t, logs, 1)
+		assert.Equal(t, models.AuditActionAccountDeactivate, logs[0].Action)
+	})
+
+	t.Run("InvalidDate", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit-logs?from=yesterday", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handlers.AuditLogsHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,146 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/tasks"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestBudgetAdjustments(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+	account := models.Account{Username: "user", IsActive: true}
+	db.Create(&account)
+
+	adjust := func(handler func(echo.Context, *gorm.DB) error, body string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(account.ID))
+		c.Set("account", admin)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+	budget := func() int64 {
+		db.First(&account, account.ID)
+		return account.Budget
+	}
+	promoRemaining := func() int64 {
+		var promoCredit models.PromoCredit
+		db.Where("account_id = ?", account.ID).First(&promoCredit)
+		return promoCredit.Remaining
+	}
+
+	t.Run("Validation", func(t *testing.T) {
+		rec := adjust(handlers.CreditAccountHandler, `{"amount": 1000}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = adjust(handlers.CreditAccountHandler, `{"amount": -1000, "reason": "test"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = adjust(handlers.CreditAccountHandler, `{"amount": 1000, "reason": "test", "expiresAt": "2000-01-01T00:00:00Z"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Equal(t, int64(0), budget())
+	})
+
+	t.Run("Credit", func(t *testing.T) {
+		rec := adjust(handlers.CreditAccountHandler, `{"amount": 1000, "reason": "Compensation"}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		rec = adjust(handlers.CreditAccountHandler, `{"amount": 500, "reason": "Welcome gift", "expiresAt": "`+expiresAt+`"}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		assert.Equal(t, int64(1500), budget())
+		assert.Equal(t, int64(500), promoRemaining())
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionBudgetCredit).Count(&count)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("PromoCreditIsSpentFirst", func(t *testing.T) {
+		db.Model(&account).Update("budget", gorm.Expr("budget - ?", 300))
+		assert.NoError(t, utils.RecordSpending(db, account.ID, 300, "single sms"))
+
+		assert.Equal(t, int64(1200), budget())
+		assert.Equal(t, int64(200), promoRemaining())
+	})
+
+	t.Run("Debit", func(t *testing.T) {
+		// paid budget is debited first
+		rec := adjust(handlers.DebitAccountHandler, `{"amount": 1000, "reason": "Correction"}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, int64(200), budget())
+		assert.Equal(t, int64(200), promoRemaining())
+
+		rec = adjust(handlers.DebitAccountHandler, `{"amount": 100, "reason": "Correction"}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, int64(100), budget())
+		assert.Equal(t, int64(100), promoRemaining())
+
+		rec = adjust(handlers.DebitAccountHandler, `{"amount": 500, "reason": "Correction"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Equal(t, int64(100), budget())
+	})
+
+	t.Run("PromoCreditExpires", func(t *testing.T) {
+		db.Model(&models.PromoCredit{}).Where("account_id = ?", account.ID).Update("expires_at", time.Now().Add(-time.Minute))
+
+		tasks.ExpirePromoCreditsTask(db)()
+		assert.Equal(t, int64(0), budget())
+		assert.Equal(t, int64(0), promoRemaining())
+
+		// expired credits aren't removed twice
+		db.Model(&account).Update("budget", 50)
+		tasks.ExpirePromoCreditsTask(db)()
+		assert.Equal(t, int64(50), budget())
+	})
+
+	t.Run("Ledger", func(t *testing.T) {
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/accounts/ledger", nil), rec)
+		c.Set("account", account)
+
+		assert.NoError(t, handlers.LedgerHandler(c, db))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var entries []handlers.LedgerEntryResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+
+		var kinds []string
+		var total int64
+		for _, entry := range entries {
+			kinds = append(kinds, entry.Kind)
+			total += entry.Amount
+		}
+		assert.Equal(t, []string{
+			models.LedgerPromoExpire, models.LedgerAdminDebit, models.LedgerAdminDebit,
+			models.LedgerSpend, models.LedgerPromoCredit, models.LedgerAdminCredit,
+		}, kinds)
+		assert.Equal(t, int64(0), total)
+		assert.Equal(t, admin.ID, entries[len(entries)-1].ActorID)
+	})
+}
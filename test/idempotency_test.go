@@ -0,0 +1,110 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/middlewares"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	account := models.Account{Username: "user", IsActive: true}
+	db.Create(&account)
+
+	calls := 0
+	status := http.StatusOK
+	handler := middlewares.IdempotencyWithDB(db)(func(c echo.Context) error {
+		calls++
+		return c.JSON(status, map[string]int{"call": calls})
+	})
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/sms/single", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/sms/single")
+		c.Set("account", account)
+
+		if err := handler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	t.Run("ReplayFirstResponse", func(t *testing.T) {
+		rec := send("key-1", `{"message": "hello"}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		first := rec.Body.String()
+
+		rec = send("key-1", `{"message": "hello"}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, first, rec.Body.String())
+		assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("ConflictingPayload", func(t *testing.T) {
+		rec := send("key-1", `{"message": "bye"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("WithoutKey", func(t *testing.T) {
+		send("", `{"message": "hello"}`)
+		send("", `{"message": "hello"}`)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("FailedRequestCanBeRetried", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		rec := send("key-2", `{"message": "hello"}`)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		status = http.StatusOK
+		rec = send("key-2", `{"message": "hello"}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 5, calls)
+	})
+
+	t.Run("InProgress", func(t *testing.T) {
+		_, _, err := utils.BeginIdempotentRequest(db, account.ID, "key-3", utils.IdempotencyRequestHash(http.MethodPost, "/sms/single", []byte("{}")))
+		assert.NoError(t, err)
+
+		rec := send("key-3", `{}`)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("ExpiredKeyCanBeReused", func(t *testing.T) {
+		db.Model(&models.IdempotencyKey{}).Where("key = ?", "key-1").Update("expires_at", time.Now().Add(-time.Minute))
+
+		rec := send("key-1", `{"message": "bye"}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 6, calls)
+	})
+
+	t.Run("KeysArePerAccount", func(t *testing.T) {
+		other := models.Account{Username: "other", IsActive: true}
+		db.Create(&other)
+		_, completed, err := utils.BeginIdempotentRequest(db, other.ID, "key-2", "another request")
+		assert.NoError(t, err)
+		assert.False(t, completed)
+	})
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestInvoices(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	user := models.User{FirstName: "john", LastName: "doe", Phone: "09376304339", Email: "test@gmail.com", NationalID: "123456789"}
+	db.Create(&user)
+	account := models.Account{UserID: user.ID, Username: "testuser", IsActive: true}
+	db.Create(&account)
+	other := models.Account{Username: "other", IsActive: true}
+	db.Create(&other)
+	db.Create(&models.Configuration{Name: "vat percent", Value: 9})
+
+	call := func(handler func(echo.Context, *gorm.DB) error, method, target, body string, account models.Account, id uint) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("account", account)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+
+	t.Run("UpdateBillingDetails", func(t *testing.T) {
+		rec := call(handlers.UpdateBillingDetailsHandler, http.MethodPatch, "/accounts/billing", `{"postalCode": "12-34"}`, account, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = call(handlers.UpdateBillingDetailsHandler, http.MethodPatch, "/accounts/billing", `{"companyName": "Example Co.", "economicCode": "411111111111", "postalCode": "1234567890"}`, account, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		db.First(&user, user.ID)
+		assert.Equal(t, "Example Co.", user.CompanyName)
+		assert.Equal(t, "1234567890", user.PostalCode)
+	})
+
+	var invoice models.Invoice
+
+	t.Run("IssuedForSuccessfulTopUp", func(t *testing.T) {
+		transaction := models.Transaction{AccountID: account.ID, Amount: 109000, Status: models.TransactionStatusWait, Authority: "A1", CreatedAt: time.Now()}
+		db.Create(&transaction)
+
+		err := utils.CreditTransaction(db, transaction.ID, utils.PaymentVerification{Verified: true, Amount: 109000, RefID: "1"})
+		assert.NoError(t, err)
+
+		assert.NoError(t, db.Where("transaction_id = ?", transaction.ID).First(&invoice).Error)
+		assert.Equal(t, fmt.Sprintf("INV-%06d", invoice.ID), invoice.Number)
+		assert.Equal(t, int64(100000), invoice.Subtotal)
+		assert.Equal(t, int64(9000), invoice.VAT)
+		assert.Equal(t, int64(109000), invoice.Total)
+		assert.Equal(t, "Example Co.", invoice.BuyerCompany)
+		assert.Equal(t, "john doe", invoice.BuyerName)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		today := time.Now().Format("2006-01-02")
+		rec := call(handlers.ListInvoicesHandler, http.MethodGet, "/accounts/invoices?from="+today+"&to="+today, "", account, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var invoices []handlers.InvoiceResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &invoices))
+		assert.Len(t, invoices, 1)
+		assert.Equal(t, invoice.Number, invoices[0].Number)
+
+		rec = call(handlers.ListInvoicesHandler, http.MethodGet, "/accounts/invoices?to=2000-01-01", "", account, 0)
+		assert.Equal(t, "[]\n", rec.Body.String())
+
+		rec = call(handlers.ListInvoicesHandler, http.MethodGet, "/accounts/invoices?from=yesterday", "", account, 0)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		rec := call(handlers.InvoiceHandler, http.MethodGet, "/accounts/invoices/1?format=html", "", account, invoice.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), invoice.Number)
+		assert.Contains(t, rec.Body.String(), "VAT (9%)")
+
+		rec = call(handlers.InvoiceHandler, http.MethodGet, "/accounts/invoices/1?format=pdf", "", account, invoice.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/pdf", rec.Header().Get(echo.HeaderContentType))
+		assert.True(t, strings.HasPrefix(rec.Body.String(), "%PDF-1.4"))
+		assert.Contains(t, rec.Body.String(), "Total: 109000 Rials")
+
+		rec = call(handlers.InvoiceHandler, http.MethodGet, "/accounts/invoices/1?format=doc", "", account, invoice.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("OtherAccount", func(t *testing.T) {
+		rec := call(handlers.InvoiceHandler, http.MethodGet, "/accounts/invoices/1", "", other, invoice.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
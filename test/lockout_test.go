@@ -0,0 +1,111 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginLockout(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	user := models.User{FirstName: "testuser", LastName: "testuser", Phone: "09376304339", Email: "amir@gmail.com", NationalID: "0265670578"}
+	db.Create(&user)
+	hash, err := bcrypt.GenerateFromPassword([]byte("test123"), bcrypt.DefaultCost)
+	assert.NoError(t, err)
+	account := models.Account{UserID: user.ID, Username: "testuser", Password: string(hash), Token: "testtoken", IsActive: true}
+	db.Create(&account)
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+
+	login := func(username, password, ip string) *httptest.ResponseRecorder {
+		e := echo.New()
+		body := fmt.Sprintf(`{"username": "%s", "password": "%s"}`, username, password)
+		req := httptest.NewRequest(http.MethodPost, "/accounts/login", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXRealIP, ip)
+		rec := httptest.NewRecorder()
+
+		err := handlers.LoginHandler(e.NewContext(req, rec), db)
+		assert.NoError(t, err)
+		return rec
+	}
+
+	t.Run("SameMessageForUnknownUsername", func(t *testing.T) {
+		unknown := login("nobody", "test123", "10.0.0.1")
+		wrong := login("testuser", "wrong", "10.0.0.1")
+		assert.Equal(t, http.StatusUnprocessableEntity, unknown.Code)
+		assert.Equal(t, unknown.Body.String(), wrong.Body.String())
+
+		rec := login("testuser", "test123", "10.0.0.1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("LockedAfterFailures", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			rec := login("testuser", "wrong", "10.0.0.2")
+			assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		}
+
+		// the correct password is refused while the username is locked
+		rec := login("testuser", "test123", "10.0.0.3")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("AdminListsAndClearsLockouts", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/admin/lockouts?kind=username&locked=true", nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handlers.LoginLockoutsHandler(e.NewContext(req, rec), db))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var lockouts []handlers.LoginLockoutResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &lockouts))
+		if !assert.Len(t, lockouts, 1) {
+			return
+		}
+		assert.Equal(t, "testuser", lockouts[0].Value)
+		assert.Equal(t, 3, lockouts[0].Failures)
+
+		req = httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec = httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(lockouts[0].ID))
+		c.Set("account", admin)
+		assert.NoError(t, handlers.ClearLoginLockoutHandler(c, db))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionLoginLockoutClear).Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		rec = login("testuser", "test123", "10.0.0.3")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("IPLockedAcrossUsernames", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			login(fmt.Sprintf("guess%d", i), "wrong", "10.0.0.4")
+		}
+		rec := login("testuser", "test123", "10.0.0.4")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+		rec = login("testuser", "test123", "10.0.0.5")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
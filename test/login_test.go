@@ -145,7 +145,7 @@ func TestLoginHandler(t *testing.T) {
 		"InvalidCredentials": {
 			requestBody:    `{"username": "testuser", "password": "wrongpassword"}`,
 			expectedStatus: http.StatusUnprocessableEntity,
-			expectedBody:   `{"responsecode": 422, "message": "Wrong Password"}`,
+			expectedBody:   `{"responsecode": 422, "message": "Invalid Username Or Password"}`,
 		},
 	}
 
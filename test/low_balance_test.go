@@ -0,0 +1,187 @@
+package test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/tasks"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestLowBalanceAlerts(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	smtpServer, err := utils.StartTestSMTPServer()
+	assert.NoError(t, err)
+	defer smtpServer.Close()
+	utils.SetMailer(utils.NewSMTPMailer(smtpServer.Host(), smtpServer.Port(), "", "", "no-reply@sms-panel.local"))
+	defer utils.SetMailer(utils.LogMailer{})
+
+	gatewayServer := newFakeZarinpal()
+	defer gatewayServer.Close()
+	defer utils.SetPaymentGateway(utils.GetPaymentGateway())
+	utils.SetPaymentGateway(utils.NewZarinpalGateway(utils.PaymentGatewayOptions{
+		MerchantID:  "merchant",
+		CallbackURL: "http://localhost/accounts/payment/verify",
+		APIURL:      gatewayServer.URL,
+		GateURL:     "https://gateway.test/pay/",
+	}))
+
+	var webhookMu sync.Mutex
+	var webhookPayloads []handlers.LowBalanceWebhookPayload
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload handlers.LowBalanceWebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		webhookMu.Lock()
+		webhookPayloads = append(webhookPayloads, payload)
+		webhookMu.Unlock()
+	}))
+	defer webhook.Close()
+	webhookCount := func() int {
+		webhookMu.Lock()
+		defer webhookMu.Unlock()
+		return len(webhookPayloads)
+	}
+
+	assert.NoError(t, db.Create(&models.SenderNumber{Number: "10001", IsDefault: true}).Error)
+	user := models.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com", Phone: "09376304339"}
+	assert.NoError(t, db.Create(&user).Error)
+	account := models.Account{UserID: user.ID, Username: "john", Budget: 100000, IsActive: true}
+	assert.NoError(t, db.Create(&account).Error)
+
+	request := func(handler func(echo.Context, *gorm.DB) error, method string, body string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("account", account)
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+	setBudget := func(budget int64) {
+		assert.NoError(t, db.Model(&account).Update("budget", budget).Error)
+	}
+	alertSMSCount := func() int64 {
+		var count int64
+		db.Model(&models.SMSMessage{}).Where("recipient = ? AND message LIKE ?", user.Phone, "%alert threshold%").Count(&count)
+		return count
+	}
+
+	t.Run("Validation", func(t *testing.T) {
+		rec := request(handlers.UpdateLowBalanceAlertHandler, http.MethodPut, `{"threshold": 0, "notifySMS": true}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = request(handlers.UpdateLowBalanceAlertHandler, http.MethodPut, `{"threshold": 50000}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = request(handlers.UpdateLowBalanceAlertHandler, http.MethodPut, `{"threshold": 50000, "webhookURL": "ftp://example.com"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		for _, webhookURL := range []string{webhook.URL, "http://10.0.0.1/hook", "http://169.254.169.254/latest", "http://[::1]/hook", "http://0.0.0.0/hook"} {
+			rec = request(handlers.UpdateLowBalanceAlertHandler, http.MethodPut, `{"threshold": 50000, "webhookURL": "`+webhookURL+`"}`)
+			assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, webhookURL)
+		}
+		assert.ErrorIs(t, utils.PostWebhook(webhook.URL, handlers.LowBalanceWebhookPayload{}), utils.ErrWebhookAddress)
+		assert.Equal(t, 0, webhookCount())
+
+		rec = request(handlers.UpdateLowBalanceAlertHandler, http.MethodPut, `{"threshold": 50000, "notifySMS": true, "autoTopUpAmount": 500}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = request(handlers.LowBalanceAlertHandler, http.MethodGet, "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	// the webhook of the test is served on the loopback address
+	utils.SetWebhookIPFilter(func(net.IP) bool { return true })
+	defer utils.SetWebhookIPFilter(utils.IsPublicIP)
+
+	t.Run("Set", func(t *testing.T) {
+		rec := request(handlers.UpdateLowBalanceAlertHandler, http.MethodPut,
+			`{"threshold": 50000, "notifySMS": true, "notifyEmail": true, "webhookURL": "`+webhook.URL+`", "autoTopUpAmount": 100000}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = request(handlers.LowBalanceAlertHandler, http.MethodGet, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response handlers.LowBalanceAlertResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, int64(50000), response.Threshold)
+		assert.Equal(t, int64(100000), response.AutoTopUpAmount)
+		assert.False(t, response.Triggered)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionLowBalanceUpdate).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("NotTriggeredAboveThreshold", func(t *testing.T) {
+		tasks.LowBalanceAlertTask(db)()
+		assert.Equal(t, int64(0), alertSMSCount())
+		assert.Equal(t, 0, webhookCount())
+	})
+
+	t.Run("TriggeredOnce", func(t *testing.T) {
+		setBudget(20000)
+		tasks.LowBalanceAlertTask(db)()
+		tasks.LowBalanceAlertTask(db)()
+		assert.NoError(t, handlers.CheckLowBalance(db, account.ID))
+
+		assert.Equal(t, int64(1), alertSMSCount())
+		assert.Len(t, smtpServer.Mails(), 1)
+		if assert.Equal(t, 1, webhookCount()) {
+			payload := webhookPayloads[0]
+			assert.Equal(t, "low_balance", payload.Event)
+			assert.Equal(t, account.ID, payload.AccountID)
+			assert.Equal(t, int64(20000), payload.Budget)
+			assert.Equal(t, int64(50000), payload.Threshold)
+			assert.True(t, strings.HasPrefix(payload.PaymentURL, "https://gateway.test/pay/"))
+		}
+
+		var transaction models.Transaction
+		assert.NoError(t, db.Where("account_id = ?", account.ID).First(&transaction).Error)
+		assert.Equal(t, int64(100000), transaction.Amount)
+		assert.Equal(t, models.TransactionStatusWait, transaction.Status)
+		assert.Equal(t, "https://gateway.test/pay/"+transaction.Authority, webhookPayloads[0].PaymentURL)
+
+		var alert models.LowBalanceAlert
+		db.Where("account_id = ?", account.ID).First(&alert)
+		assert.True(t, alert.Triggered)
+		assert.NotNil(t, alert.LastTriggeredAt)
+	})
+
+	t.Run("RearmedAfterTopUp", func(t *testing.T) {
+		setBudget(120000)
+		tasks.LowBalanceAlertTask(db)()
+
+		var alert models.LowBalanceAlert
+		db.Where("account_id = ?", account.ID).First(&alert)
+		assert.False(t, alert.Triggered)
+
+		setBudget(10000)
+		tasks.LowBalanceAlertTask(db)()
+		assert.Equal(t, int64(2), alertSMSCount())
+		assert.Equal(t, 2, webhookCount())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		rec := request(handlers.DeleteLowBalanceAlertHandler, http.MethodDelete, "")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = request(handlers.DeleteLowBalanceAlertHandler, http.MethodDelete, "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.NoError(t, handlers.CheckLowBalance(db, account.ID))
+	})
+}
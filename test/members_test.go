@@ -0,0 +1,264 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/middlewares"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemberHandlers(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	user := models.User{
+		FirstName:  "john",
+		LastName:   "doe",
+		Phone:      "09376304339",
+		Email:      "test@gmail.com",
+		NationalID: "123456789",
+	}
+	err = db.Create(&user).Error
+	assert.NoError(t, err)
+
+	account := models.Account{
+		UserID:   user.ID,
+		Username: "owner",
+		Budget:   1000,
+		Password: "password",
+		IsActive: true,
+	}
+	err = db.Create(&account).Error
+	assert.NoError(t, err)
+
+	var created handlers.MemberResponse
+
+	t.Run("CreateMember", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/accounts/members", strings.NewReader(`{"username":"staff","password":"secret","role":"sender","spendingLimit":500}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("account", account)
+
+		err := handlers.CreateMemberHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		err = json.Unmarshal(rec.Body.Bytes(), &created)
+		assert.NoError(t, err)
+		assert.Equal(t, "staff", created.Username)
+		assert.Equal(t, models.MemberRoleSender, created.Role)
+		assert.Equal(t, int64(500), created.SpendingLimit)
+
+		var memberAccount models.Account
+		db.First(&memberAccount, created.MemberID)
+		assert.Equal(t, user.ID, memberAccount.UserID)
+	})
+
+	t.Run("InvalidRole", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/accounts/members", strings.NewReader(`{"username":"other","password":"secret","role":"boss"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("account", account)
+
+		err := handlers.CreateMemberHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("DuplicateUsername", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/accounts/members", strings.NewReader(`{"username":"staff","password":"secret","role":"viewer"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("account", account)
+
+		err := handlers.CreateMemberHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("UpdateMember", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"role":"viewer","spendingLimit":100}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(created.ID))
+		c.Set("account", account)
+
+		err := handlers.UpdateMemberHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var member models.AccountMember
+		db.First(&member, created.ID)
+		assert.Equal(t, models.MemberRoleViewer, member.Role)
+		assert.Equal(t, int64(100), member.SpendingLimit)
+	})
+
+	t.Run("OtherOrganizationMember", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(created.ID))
+		c.Set("account", models.Account{ID: account.ID + 100})
+
+		err := handlers.DeleteMemberHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("DeleteMember", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(created.ID))
+		c.Set("account", account)
+
+		err := handlers.DeleteMemberHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var memberAccount models.Account
+		db.First(&memberAccount, created.MemberID)
+		assert.False(t, memberAccount.IsActive)
+	})
+}
+
+func TestMemberRoles(t *testing.T) {
+	next := func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}
+	handler := middlewares.MemberRoles(models.MemberRoleSender)(next)
+
+	t.Run("Owner", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+		assert.NoError(t, handler(c))
+	})
+
+	t.Run("AllowedRole", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+		c.Set("member", models.AccountMember{ID: 1, Role: models.MemberRoleSender})
+		assert.NoError(t, handler(c))
+	})
+
+	t.Run("ForbiddenRole", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+		c.Set("member", models.AccountMember{ID: 1, Role: models.MemberRoleViewer})
+		assert.Equal(t, echo.ErrForbidden, handler(c))
+	})
+
+	t.Run("OwnerOnly", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+		c.Set("member", models.AccountMember{ID: 1, Role: models.MemberRoleSender})
+		assert.Equal(t, echo.ErrForbidden, middlewares.IsAccountOwner(next)(c))
+	})
+}
+
+func TestMemberSpendingLimit(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	user := models.User{
+		FirstName:  "john",
+		LastName:   "doe",
+		Phone:      "09376304339",
+		Email:      "test@gmail.com",
+		NationalID: "123456789",
+	}
+	assert.NoError(t, db.Create(&user).Error)
+	account := models.Account{UserID: user.ID, Username: "owner", Budget: 1000, IsActive: true}
+	assert.NoError(t, db.Create(&account).Error)
+	memberAccount := models.Account{UserID: user.ID, Username: "staff", IsActive: true}
+	assert.NoError(t, db.Create(&memberAccount).Error)
+	member := models.AccountMember{AccountID: account.ID, MemberID: memberAccount.ID, Role: models.MemberRoleSender, SpendingLimit: 150}
+	assert.NoError(t, db.Create(&member).Error)
+
+	phoneBook := models.PhoneBook{AccountID: account.ID, Name: "Test"}
+	assert.NoError(t, db.Create(&phoneBook).Error)
+	assert.NoError(t, db.Create(&models.PhoneBookNumber{PhoneBookID: phoneBook.ID, Username: "test", Name: "test", Phone: "+989376304339"}).Error)
+	senderNumber := models.SenderNumber{Number: "123456789", IsDefault: true}
+	assert.NoError(t, db.Create(&senderNumber).Error)
+	assert.NoError(t, db.Create(&models.UserNumbers{UserID: user.ID, NumberID: senderNumber.ID, StartDate: time.Now(), EndDate: time.Now().AddDate(1, 0, 0), IsAvailable: true}).Error)
+	assert.NoError(t, db.Create(&models.Configuration{Name: "single sms", Value: 100}).Error)
+
+	send := func() *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/sms/single", strings.NewReader(`{ "senderNumbers": "123456789", "phone_number": "09376304339","message":"hello" }`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		db.First(&account, account.ID)
+		db.First(&member, member.ID)
+		c.Set("account", account)
+		c.Set("member", member)
+
+		err := handlers.SendSingleSMSHandler(c, db)
+		assert.NoError(t, err)
+		return rec
+	}
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		rec := send()
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var sms models.SMSMessage
+		db.Last(&sms)
+		assert.Equal(t, memberAccount.ID, sms.MemberID)
+
+		db.First(&member, member.ID)
+		assert.Equal(t, int64(100), member.Spent)
+	})
+
+	t.Run("StaleMember", func(t *testing.T) {
+		// a parallel send which checked the limit before the last send was charged
+		stale := member
+		stale.Spent = 0
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/sms/single", strings.NewReader(`{ "senderNumbers": "123456789", "phone_number": "09376304339","message":"hello" }`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("account", account)
+		c.Set("member", stale)
+		assert.NoError(t, handlers.SendSingleSMSHandler(c, db))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		db.First(&member, member.ID)
+		assert.Equal(t, int64(100), member.Spent)
+		db.First(&account, account.ID)
+		assert.Equal(t, int64(900), account.Budget)
+	})
+
+	t.Run("LimitExceeded", func(t *testing.T) {
+		rec := send()
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		var response handlers.ErrorResponseSingle
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, "Spending limit exceeded", response.Message)
+	})
+}
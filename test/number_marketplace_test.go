@@ -0,0 +1,206 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/tasks"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNumberMarketplace(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	assert.NoError(t, db.Create(&models.SenderNumber{Number: "10001", IsDefault: true, Type: models.SenderTypeDefault}).Error)
+	for _, number := range []models.SenderNumber{
+		{Number: "30001000"},
+		{Number: "30002000"},
+		{Number: "30001001", Type: models.SenderTypeVanity, BuyPrice: 500},
+		{Number: "40001000", Type: models.SenderTypeShared},
+	} {
+		assert.NoError(t, db.Create(&number).Error)
+	}
+	johnUser := models.User{FirstName: "John", LastName: "Doe", Email: "john@example.com", Phone: "09121111111", NationalID: "1"}
+	db.Create(&johnUser)
+	janeUser := models.User{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Phone: "09122222222", NationalID: "2"}
+	db.Create(&janeUser)
+	john := models.Account{UserID: johnUser.ID, Username: "john", Budget: 1000, IsActive: true}
+	db.Create(&john)
+	jane := models.Account{UserID: janeUser.ID, Username: "jane", Budget: 1000, IsActive: true}
+	db.Create(&jane)
+	db.Create(&models.SubscriptionNumberPackage{Title: "1 Month", Price: 100, Duration: 1})
+	db.Create(&models.SubscriptionNumberPackage{Title: "Buy", Price: 300, Type: models.PackageTypeBuy})
+
+	call := func(handler func(echo.Context, *gorm.DB) error, account models.Account, target, body string, id uint) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("account", account)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+	forSale := func(account models.Account, query string) []string {
+		rec := call(handlers.GetAllSenderNumbersForSaleHandler, account, "/?"+query, "", 0)
+		assert.Equal(t, http.StatusOK, rec.Code, query)
+		var response handlers.SenderNumbersResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response.Numbers
+	}
+
+	t.Run("Search", func(t *testing.T) {
+		assert.Equal(t, []string{"30001000", "30001001", "30002000", "40001000"}, forSale(john, ""))
+		assert.Equal(t, []string{"30001000", "30002000", "40001000"}, forSale(john, "pattern=*000"))
+		assert.Equal(t, []string{"30001000", "40001000"}, forSale(john, "pattern=*1000"))
+		assert.Equal(t, []string{"30001000", "30001001"}, forSale(john, "pattern=3000100?"))
+		assert.Equal(t, []string{"30001001"}, forSale(john, "type=vanity"))
+
+		rec := call(handlers.GetAllSenderNumbersForSaleHandler, john, "/?pattern=3000%25", "", 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	var reservation handlers.NumberReservationResponse
+	t.Run("Reserve", func(t *testing.T) {
+		rec := call(handlers.ReserveNumberHandler, john, "/", `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reservation))
+		assert.WithinDuration(t, time.Now().Add(utils.NumberReservationTTL), reservation.ExpiresAt, time.Minute)
+
+		// reserving it again extends the reservation
+		rec = call(handlers.ReserveNumberHandler, john, "/", `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reservation))
+		var count int64
+		db.Model(&models.NumberReservation{}).Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		rec = call(handlers.ReserveNumberHandler, jane, "/", `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		rec = call(handlers.RentNumberHandler, jane, "/", `{"senderNumber": "30001000", "subscriptionNumberPackage": "1 Month"}`, 0)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		rec = call(handlers.BuyNumberHandler, jane, "/", `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), "reserved by another account")
+		var number models.SenderNumber
+		db.Where("number = ?", "30001000").First(&number)
+		assert.False(t, number.IsExclusive)
+		var janeAccount models.Account
+		db.First(&janeAccount, jane.ID)
+		assert.Equal(t, jane.Budget, janeAccount.Budget)
+		assert.NotContains(t, forSale(jane, ""), "30001000")
+		assert.Contains(t, forSale(john, ""), "30001000")
+
+		rec = call(handlers.ReserveNumberHandler, john, "/", `{"senderNumber": "40001000"}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.ReserveNumberHandler, john, "/", `{"senderNumber": "10001"}`, 0)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("ExpiredReservation", func(t *testing.T) {
+		db.Model(&models.NumberReservation{}).Where("id = ?", reservation.ID).Update("expires_at", time.Now().Add(-time.Second))
+
+		rec := call(handlers.ReserveNumberHandler, jane, "/", `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var janeReservation handlers.NumberReservationResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &janeReservation))
+
+		var reservations []handlers.NumberReservationResponse
+		rec = call(handlers.ListNumberReservationsHandler, jane, "/", "", 0)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reservations))
+		assert.Len(t, reservations, 1)
+
+		rec = call(handlers.CancelNumberReservationHandler, john, "/", "", janeReservation.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = call(handlers.CancelNumberReservationHandler, jane, "/", "", janeReservation.ID)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("RentReservedNumber", func(t *testing.T) {
+		rec := call(handlers.ReserveNumberHandler, john, "/", `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.RentNumberHandler, john, "/", `{"senderNumber": "30001000", "subscriptionNumberPackage": "1 Month"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var count int64
+		db.Model(&models.NumberReservation{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+		assert.Equal(t, []string{"30001000"}, forSale(jane, "held=true"))
+
+		rec = call(handlers.ReserveNumberHandler, jane, "/", `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("Waitlist", func(t *testing.T) {
+		rec := call(handlers.JoinNumberWaitlistHandler, jane, "/", `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var entry handlers.NumberWaitlistResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entry))
+		assert.Equal(t, 1, entry.Position)
+
+		rec = call(handlers.JoinNumberWaitlistHandler, jane, "/", `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		rec = call(handlers.JoinNumberWaitlistHandler, john, "/", `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.JoinNumberWaitlistHandler, jane, "/", `{"senderNumber": "30002000"}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		var entries []handlers.NumberWaitlistResponse
+		rec = call(handlers.ListNumberWaitlistHandler, jane, "/", "", 0)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("NotifiedWhenReleased", func(t *testing.T) {
+		db.Model(&models.UserNumbers{}).Where("user_id = ?", johnUser.ID).
+			Updates(map[string]interface{}{"end_date": time.Now().AddDate(0, 0, -utils.DefaultNumberGraceDays-1), "is_available": false})
+		tasks.RentNumberTask(db)()
+
+		var count int64
+		db.Model(&models.SMSMessage{}).Where("recipient = ? AND message LIKE ?", janeUser.Phone, "%30001000 which you are waiting for%").Count(&count)
+		assert.Equal(t, int64(1), count)
+		db.Model(&models.NumberWaitlist{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+		assert.Contains(t, forSale(jane, ""), "30001000")
+	})
+
+	t.Run("LeaveWaitlist", func(t *testing.T) {
+		rec := call(handlers.BuyNumberHandler, john, "/", `{"senderNumber": "30001001"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.JoinNumberWaitlistHandler, jane, "/", `{"senderNumber": "30001001"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var entry handlers.NumberWaitlistResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entry))
+
+		rec = call(handlers.LeaveNumberWaitlistHandler, john, "/", "", entry.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = call(handlers.LeaveNumberWaitlistHandler, jane, "/", "", entry.ID)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		rec := call(handlers.ReserveNumberHandler, jane, "/", `{"senderNumber": "30002000"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		db.Model(&models.NumberReservation{}).Where("account_id = ?", jane.ID).Update("expires_at", time.Now().Add(-time.Second))
+
+		count, err := utils.PurgeNumberReservations(db)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+	})
+}
@@ -0,0 +1,208 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/tasks"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNumberRenewal(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	assert.NoError(t, db.Create(&models.SenderNumber{Number: "10001", IsDefault: true, Type: models.SenderTypeDefault}).Error)
+	number := models.SenderNumber{Number: "3002"}
+	assert.NoError(t, db.Create(&number).Error)
+	user := models.User{FirstName: "John", LastName: "Doe", Phone: "09376304339"}
+	assert.NoError(t, db.Create(&user).Error)
+	account := models.Account{UserID: user.ID, Username: "john", Budget: 1000, IsActive: true}
+	assert.NoError(t, db.Create(&account).Error)
+	jane := models.Account{UserID: user.ID + 1, Username: "jane", Budget: 1000, IsActive: true}
+	assert.NoError(t, db.Create(&jane).Error)
+	db.Create(&models.SubscriptionNumberPackage{Title: "1 Month", Price: 100, Duration: 1})
+	db.Create(&models.SubscriptionNumberPackage{Title: "10 Day", Price: 40, Duration: 10, DurationUnit: models.DurationUnitDay})
+
+	call := func(handler func(echo.Context, *gorm.DB) error, account models.Account, body string, id uint) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("account", account)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+	noticeCount := func(text string) int64 {
+		var count int64
+		db.Model(&models.SMSMessage{}).Where("recipient = ? AND message LIKE ?", user.Phone, "%"+text+"%").Count(&count)
+		return count
+	}
+	budget := func() int64 {
+		var current models.Account
+		db.First(&current, account.ID)
+		return current.Budget
+	}
+	var userNumber models.UserNumbers
+	reload := func() {
+		id := userNumber.ID
+		userNumber = models.UserNumbers{}
+		db.First(&userNumber, id)
+	}
+	setEndDate := func(endDate time.Time) {
+		assert.NoError(t, db.Model(&models.UserNumbers{}).Where("id = ?", userNumber.ID).Update("end_date", endDate).Error)
+		reload()
+	}
+
+	t.Run("Rent", func(t *testing.T) {
+		rec := call(handlers.RentNumberHandler, account, `{"senderNumber": "3002", "subscriptionNumberPackage": "1 Month"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		db.Last(&userNumber)
+		assert.False(t, userNumber.AutoRenew)
+
+		var rented []handlers.RentedNumberResponse
+		rec = call(handlers.ListRentedNumbersHandler, account, "", 0)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rented))
+		if assert.Len(t, rented, 1) {
+			assert.Equal(t, "3002", rented[0].Number)
+			assert.Equal(t, handlers.NumberStatusActive, rented[0].Status)
+			assert.NotNil(t, rented[0].EndDate)
+			assert.Nil(t, rented[0].GraceEndsAt)
+		}
+	})
+
+	t.Run("Reminder", func(t *testing.T) {
+		setEndDate(time.Now().AddDate(0, 0, 2))
+		tasks.RentNumberTask(db)()
+		tasks.RentNumberTask(db)()
+		assert.Equal(t, int64(1), noticeCount("Renew it to keep the number"))
+		reload()
+		assert.NotNil(t, userNumber.RemindedAt)
+	})
+
+	t.Run("Renew", func(t *testing.T) {
+		endDate := userNumber.EndDate
+		rec := call(handlers.RenewNumberHandler, account, "", userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		reload()
+		assert.Equal(t, endDate.AddDate(0, 1, 0).Format("2006-01-02"), userNumber.EndDate.Format("2006-01-02"))
+		assert.Nil(t, userNumber.RemindedAt)
+		assert.Equal(t, int64(1000-100-100), budget())
+
+		rec = call(handlers.RenewNumberHandler, jane, "", userNumber.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = call(handlers.RenewNumberHandler, account, `{"subscriptionNumberPackage": "2 Month"}`, userNumber.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		// a renewal which read the rent before the other renewal adds its period after it
+		var subPackage models.SubscriptionNumberPackage
+		db.Where("title = ?", "1 Month").First(&subPackage)
+		stale := userNumber
+		stale.EndDate = endDate
+		tx := db.Begin()
+		_, err := utils.RenewNumber(tx, account.ID, &stale, subPackage)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit().Error)
+		reload()
+		assert.Equal(t, endDate.AddDate(0, 2, 0).Format("2006-01-02"), userNumber.EndDate.Format("2006-01-02"))
+		assert.Equal(t, endDate.AddDate(0, 1, 0).Format("2006-01-02"), userNumber.PeriodStart.Format("2006-01-02"))
+		assert.Equal(t, int64(100), userNumber.PaidPrice)
+		assert.Equal(t, int64(1000-3*100), budget())
+	})
+
+	t.Run("AutoRenew", func(t *testing.T) {
+		rec := call(handlers.SetAutoRenewHandler, account, `{"autoRenew": true}`, userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		endDate := time.Now().Add(12 * time.Hour)
+		setEndDate(endDate)
+		tasks.RentNumberTask(db)()
+		reload()
+		assert.Equal(t, endDate.AddDate(0, 1, 0).Format("2006-01-02"), userNumber.EndDate.Format("2006-01-02"))
+		assert.Equal(t, int64(1000-4*100), budget())
+		assert.Equal(t, int64(1), noticeCount("is renewed until"))
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionNumberAutoRenew).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("AutoRenewFails", func(t *testing.T) {
+		db.Model(&models.Account{}).Where("id = ?", account.ID).Update("budget", 50)
+		setEndDate(time.Now().Add(12 * time.Hour))
+		tasks.RentNumberTask(db)()
+		tasks.RentNumberTask(db)()
+		reload()
+		assert.NotNil(t, userNumber.RenewalFailedAt)
+		assert.Equal(t, int64(50), budget())
+		assert.Equal(t, int64(1), noticeCount("your budget isn't enough"))
+	})
+
+	t.Run("GracePeriod", func(t *testing.T) {
+		db.Model(&models.UserNumbers{}).Where("id = ?", userNumber.ID).Update("auto_renew", false)
+		setEndDate(time.Now().AddDate(0, 0, -1))
+		tasks.RentNumberTask(db)()
+		reload()
+		assert.False(t, userNumber.IsAvailable)
+		assert.Equal(t, int64(1), noticeCount("It is reserved for you"))
+		assert.False(t, utils.IsSenderNumberExist(context.Background(), db, "3002", user.ID))
+
+		// the number is reserved for its renter
+		rec := call(handlers.RentNumberHandler, jane, `{"senderNumber": "3002", "subscriptionNumberPackage": "1 Month"}`, 0)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		var rented []handlers.RentedNumberResponse
+		rec = call(handlers.ListRentedNumbersHandler, account, "", 0)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rented))
+		if assert.Len(t, rented, 1) {
+			assert.Equal(t, handlers.NumberStatusGrace, rented[0].Status)
+			assert.NotNil(t, rented[0].GraceEndsAt)
+		}
+
+		db.Model(&models.Account{}).Where("id = ?", account.ID).Update("budget", 30)
+		rec = call(handlers.RenewNumberHandler, account, `{"subscriptionNumberPackage": "10 Day"}`, userNumber.ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		db.Model(&models.Account{}).Where("id = ?", account.ID).Update("budget", 1000)
+		rec = call(handlers.RenewNumberHandler, account, `{"subscriptionNumberPackage": "10 Day"}`, userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		reload()
+		assert.True(t, userNumber.IsAvailable)
+		assert.Nil(t, userNumber.RenewalFailedAt)
+		assert.Equal(t, time.Now().AddDate(0, 0, 10).Format("2006-01-02"), userNumber.EndDate.Format("2006-01-02"))
+		assert.True(t, utils.IsSenderNumberExist(context.Background(), db, "3002", user.ID))
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		setEndDate(time.Now().AddDate(0, 0, -utils.DefaultNumberGraceDays-1))
+		tasks.RentNumberTask(db)()
+		tasks.RentNumberTask(db)()
+
+		var count int64
+		db.Model(&models.UserNumbers{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+		db.First(&number, number.ID)
+		assert.False(t, number.IsExclusive)
+		assert.Equal(t, int64(1), noticeCount("is released"))
+
+		rec := call(handlers.RentNumberHandler, jane, `{"senderNumber": "3002", "subscriptionNumberPackage": "1 Month"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
@@ -0,0 +1,254 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNumberTransfer(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	assert.NoError(t, db.Create(&models.SenderNumber{Number: "10001", IsDefault: true, Type: models.SenderTypeDefault}).Error)
+	for _, number := range []models.SenderNumber{
+		{Number: "30001000"},
+		{Number: "30002000"},
+		{Number: "30001001", Type: models.SenderTypeVanity, BuyPrice: 500},
+		{Number: "40001000", Type: models.SenderTypeShared},
+	} {
+		assert.NoError(t, db.Create(&number).Error)
+	}
+	johnUser := models.User{FirstName: "John", LastName: "Doe", Email: "john@example.com", Phone: "09121111111", NationalID: "1"}
+	db.Create(&johnUser)
+	janeUser := models.User{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Phone: "09122222222", NationalID: "2"}
+	db.Create(&janeUser)
+	john := models.Account{UserID: johnUser.ID, Username: "john", Budget: 1000, IsActive: true}
+	db.Create(&john)
+	jane := models.Account{UserID: janeUser.ID, Username: "jane", Budget: 1000, IsActive: true}
+	db.Create(&jane)
+	db.Create(&models.SubscriptionNumberPackage{Title: "10 Day", Price: 100, Duration: 10, DurationUnit: models.DurationUnitDay})
+	db.Create(&models.SubscriptionNumberPackage{Title: "Buy", Price: 300, Type: models.PackageTypeBuy})
+
+	call := func(handler func(echo.Context, *gorm.DB) error, account models.Account, body string, id uint) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("account", account)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+	// setDaysLeft moves the current 10 days period of the rent, so the days are left of it
+	setDaysLeft := func(userNumber models.UserNumbers, days int) {
+		endDate := time.Now().Add(time.Duration(days)*24*time.Hour + time.Hour)
+		db.Model(&models.UserNumbers{}).Where("id = ?", userNumber.ID).
+			Updates(map[string]interface{}{"period_start": endDate.AddDate(0, 0, -10), "end_date": endDate})
+	}
+	budget := func(account models.Account) int64 {
+		var current models.Account
+		db.First(&current, account.ID)
+		return current.Budget
+	}
+	isExclusive := func(number string) bool {
+		var senderNumber models.SenderNumber
+		db.Where("number = ?", number).First(&senderNumber)
+		return senderNumber.IsExclusive
+	}
+	rent := func(account models.Account, number string) models.UserNumbers {
+		rec := call(handlers.RentNumberHandler, account, `{"senderNumber": "`+number+`", "subscriptionNumberPackage": "10 Day"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var userNumber models.UserNumbers
+		db.Last(&userNumber)
+		return userNumber
+	}
+
+	t.Run("ReleaseRent", func(t *testing.T) {
+		userNumber := rent(john, "30001000")
+		assert.True(t, isExclusive("30001000"))
+		assert.Equal(t, int64(100), userNumber.PaidPrice)
+		setDaysLeft(userNumber, 5)
+		// the refund is of the price which was paid
+		db.Model(&models.SubscriptionNumberPackage{}).Where("title = ?", "10 Day").Update("price", 1000)
+		defer db.Model(&models.SubscriptionNumberPackage{}).Where("title = ?", "10 Day").Update("price", 100)
+		rec := call(handlers.JoinNumberWaitlistHandler, jane, `{"senderNumber": "30001000"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = call(handlers.ReleaseNumberHandler, jane, "", userNumber.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = call(handlers.ReleaseNumberHandler, john, "", userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response handlers.NumberReleaseResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, int64(50), response.Refund)
+		assert.Equal(t, int64(1000-100+50), budget(john))
+		assert.False(t, isExclusive("30001000"))
+
+		var count int64
+		db.Model(&models.LedgerEntry{}).Where("account_id = ? AND kind = ? AND amount = ?", john.ID, models.LedgerRefund, 50).Count(&count)
+		assert.Equal(t, int64(1), count)
+		db.Model(&models.SMSMessage{}).Where("recipient = ? AND message LIKE ?", janeUser.Phone, "%30001000 which you are waiting for%").Count(&count)
+		assert.Equal(t, int64(1), count)
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionNumberRelease).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("RefundPercent", func(t *testing.T) {
+		db.Create(&models.Configuration{Name: utils.SettingNumberRefundPercent, Value: 50})
+		utils.Settings.Invalidate()
+		defer func() {
+			db.Where("name = ?", utils.SettingNumberRefundPercent).Delete(&models.Configuration{})
+			utils.Settings.Invalidate()
+		}()
+
+		userNumber := rent(john, "30001000")
+		setDaysLeft(userNumber, 5)
+		before := budget(john)
+		rec := call(handlers.ReleaseNumberHandler, john, "", userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, before+25, budget(john))
+	})
+
+	t.Run("ReleaseBought", func(t *testing.T) {
+		rec := call(handlers.BuyNumberHandler, john, `{"senderNumber": "30001001"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var userNumber models.UserNumbers
+		db.Last(&userNumber)
+		before := budget(john)
+
+		rec = call(handlers.ReleaseNumberHandler, john, "", userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response handlers.NumberReleaseResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, int64(0), response.Refund)
+		assert.Equal(t, before, budget(john))
+		assert.False(t, isExclusive("30001001"))
+	})
+
+	var transfer handlers.NumberTransferResponse
+	var userNumber models.UserNumbers
+	t.Run("Transfer", func(t *testing.T) {
+		userNumber = rent(john, "30002000")
+		rec := call(handlers.SetAutoRenewHandler, john, `{"autoRenew": true}`, userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = call(handlers.TransferNumberHandler, john, `{"username": "nobody"}`, userNumber.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = call(handlers.TransferNumberHandler, john, `{"username": "john"}`, userNumber.ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.TransferNumberHandler, john, `{"username": "jane"}`, userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &transfer))
+		assert.Equal(t, models.NumberTransferPending, transfer.Status)
+		assert.Equal(t, "jane", transfer.To)
+		rec = call(handlers.TransferNumberHandler, john, `{"username": "jane"}`, userNumber.ID)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		var transfers []handlers.NumberTransferResponse
+		rec = call(handlers.ListNumberTransfersHandler, jane, "", 0)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &transfers))
+		assert.Len(t, transfers, 1)
+	})
+
+	t.Run("Accept", func(t *testing.T) {
+		rec := call(handlers.AcceptNumberTransferHandler, john, "", transfer.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = call(handlers.AcceptNumberTransferHandler, jane, "", transfer.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var moved models.UserNumbers
+		db.First(&moved, userNumber.ID)
+		assert.Equal(t, janeUser.ID, moved.UserID)
+		assert.Equal(t, userNumber.EndDate.Format("2006-01-02"), moved.EndDate.Format("2006-01-02"))
+		assert.False(t, moved.AutoRenew)
+		assert.True(t, isExclusive("30002000"))
+
+		rec = call(handlers.AcceptNumberTransferHandler, jane, "", transfer.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = call(handlers.ReleaseNumberHandler, john, "", userNumber.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		// a release which read the number before it was transferred doesn't release it
+		tx := db.Begin()
+		_, err := utils.ReleaseNumber(tx, john.ID, userNumber)
+		tx.Rollback()
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("DeclineAndCancel", func(t *testing.T) {
+		rec := call(handlers.TransferNumberHandler, jane, `{"username": "john"}`, userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &transfer))
+		rec = call(handlers.DeclineNumberTransferHandler, john, "", transfer.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &transfer))
+		assert.Equal(t, models.NumberTransferDeclined, transfer.Status)
+
+		rec = call(handlers.TransferNumberHandler, jane, `{"username": "john"}`, userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &transfer))
+		rec = call(handlers.CancelNumberTransferHandler, john, "", transfer.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = call(handlers.CancelNumberTransferHandler, jane, "", transfer.ID)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		rec = call(handlers.AcceptNumberTransferHandler, john, "", transfer.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		// an accept which read the transfer before it was cancelled doesn't move the number
+		var stale models.NumberTransfer
+		db.First(&stale, transfer.ID)
+		stale.Status = models.NumberTransferPending
+		tx := db.Begin()
+		assert.ErrorIs(t, utils.TransferNumber(tx, &stale), utils.ErrNumberTransferClosed)
+		tx.Rollback()
+		var held models.UserNumbers
+		db.First(&held, userNumber.ID)
+		assert.Equal(t, janeUser.ID, held.UserID)
+	})
+
+	t.Run("ReleaseCancelsTransfer", func(t *testing.T) {
+		rec := call(handlers.TransferNumberHandler, jane, `{"username": "john"}`, userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &transfer))
+		rec = call(handlers.ReleaseNumberHandler, jane, "", userNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var current models.NumberTransfer
+		db.First(&current, transfer.ID)
+		assert.Equal(t, models.NumberTransferCancelled, current.Status)
+		rec = call(handlers.AcceptNumberTransferHandler, john, "", transfer.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("SharedNumber", func(t *testing.T) {
+		johnNumber := rent(john, "40001000")
+		rent(jane, "40001000")
+
+		rec := call(handlers.TransferNumberHandler, john, `{"username": "jane"}`, johnNumber.ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.ReleaseNumberHandler, john, "", johnNumber.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.False(t, isExclusive("40001000"))
+
+		var count int64
+		db.Model(&models.UserNumbers{}).Where("user_id = ?", janeUser.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
@@ -0,0 +1,153 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestExpandPrefixRange(t *testing.T) {
+	prefixes, err := utils.ExpandPrefixRange("98910-98913")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"98910", "98911", "98912", "98913"}, prefixes)
+
+	prefixes, err = utils.ExpandPrefixRange("0935")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"98935"}, prefixes)
+
+	for _, prefix := range []string{"", "98a", "98919-98910", "9891-98919", "98000-98999"} {
+		_, err := utils.ExpandPrefixRange(prefix)
+		assert.Error(t, err, prefix)
+	}
+
+	assert.Equal(t, "989121234567", utils.InternationalNumber("09121234567"))
+	assert.Equal(t, "989121234567", utils.InternationalNumber("+989121234567"))
+	assert.Equal(t, "989121234567", utils.InternationalNumber("00989121234567"))
+	assert.Equal(t, "989121234567", utils.InternationalNumber("9121234567"))
+}
+
+func TestOperators(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+	account := models.Account{Username: "user", IsActive: true}
+	db.Create(&account)
+	db.Create(&models.SenderNumber{Number: "3000", IsDefault: true})
+	phoneBook := models.PhoneBook{AccountID: account.ID, Name: "friends"}
+	db.Create(&phoneBook)
+	number := models.PhoneBookNumber{PhoneBookID: phoneBook.ID, Name: "mci", Phone: "09121234567"}
+	db.Create(&number)
+
+	call := func(handler func(echo.Context, *gorm.DB) error, target, body string, id uint) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("account", admin)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+
+	var mci, irancell handlers.OperatorResponse
+	t.Run("Create", func(t *testing.T) {
+		rec := call(handlers.CreateOperatorHandler, "/", `{"name": "MCI", "provider": "magfa", "prefixes": ["98910-98919", "0990"]}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &mci))
+		assert.Len(t, mci.Prefixes, 11)
+
+		rec = call(handlers.CreateOperatorHandler, "/", `{"name": "Irancell", "prefixes": ["98930", "98935-98939"]}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &irancell))
+		assert.Equal(t, utils.DefaultProvider, irancell.Provider)
+
+		rec = call(handlers.CreateOperatorHandler, "/", `{"name": "Rightel", "prefixes": ["98912"]}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.CreateOperatorHandler, "/", `{"name": "Rightel", "prefixes": ["98x20"]}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.CreateOperatorHandler, "/", `{"name": "MCI", "prefixes": ["98920"]}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		// phone book numbers which are already saved get their operator
+		var reloaded models.PhoneBookNumber
+		db.First(&reloaded, number.ID)
+		if assert.NotNil(t, reloaded.OperatorID) {
+			assert.Equal(t, mci.ID, *reloaded.OperatorID)
+		}
+	})
+
+	t.Run("Routing", func(t *testing.T) {
+		assert.Equal(t, "magfa", utils.MessageProvider(db, "09121234567"))
+		assert.Equal(t, "magfa", utils.MessageProvider(db, "+989901234567"))
+		assert.Equal(t, utils.DefaultProvider, utils.MessageProvider(db, "09351234567"))
+		assert.Equal(t, utils.DefaultProvider, utils.MessageProvider(db, "09201234567"))
+		assert.Nil(t, utils.DetectOperatorID(db, "09201234567"))
+
+		rec := call(handlers.UpdateOperatorHandler, "/", `{"provider": "kavenegar"}`, irancell.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "kavenegar", utils.MessageProvider(db, "09351234567"))
+
+		var prefixes int64
+		db.Model(&models.OperatorPrefix{}).Where("operator_id = ?", irancell.ID).Count(&prefixes)
+		assert.Equal(t, int64(6), prefixes)
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		for _, recipient := range []string{"09121234567", "09901234567", "09351234567", "09201234567"} {
+			assert.NoError(t, handlers.SendSystemSMS(db, account.ID, recipient, "hello"))
+		}
+
+		var sms models.SMSMessage
+		db.Where("recipient = ?", "09121234567").First(&sms)
+		if assert.NotNil(t, sms.OperatorID) {
+			assert.Equal(t, mci.ID, *sms.OperatorID)
+		}
+
+		rec := call(handlers.OperatorReportHandler, fmt.Sprintf("/?account_id=%d", account.ID), "", 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var rows []handlers.OperatorReportRow
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rows))
+		report := make(map[string]int64)
+		for _, row := range rows {
+			report[row.Operator] = row.Messages
+			assert.Equal(t, row.Messages, row.Delivered)
+		}
+		assert.Equal(t, map[string]int64{"MCI": 2, "Irancell": 1, "": 1}, report)
+
+		rec = call(handlers.OperatorReportHandler, "/?from=bad", "", 0)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		rec := call(handlers.DeleteOperatorHandler, "/", "", mci.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.DeleteOperatorHandler, "/", "", mci.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		assert.Equal(t, utils.DefaultProvider, utils.MessageProvider(db, "09121234567"))
+		var count int64
+		db.Model(&models.SMSMessage{}).Where("operator_id IS NULL").Count(&count)
+		assert.Equal(t, int64(3), count)
+		db.Model(&models.AuditLog{}).Where("action IN ?", []string{
+			models.AuditActionOperatorCreate, models.AuditActionOperatorUpdate, models.AuditActionOperatorDelete,
+		}).Count(&count)
+		assert.Equal(t, int64(4), count)
+	})
+}
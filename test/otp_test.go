@@ -0,0 +1,171 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOTPHandlers(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	user := models.User{FirstName: "john", LastName: "doe", Phone: "09376304339", Email: "test@gmail.com", NationalID: "123456789"}
+	assert.NoError(t, db.Create(&user).Error)
+	account := models.Account{UserID: user.ID, Username: "testuser", Budget: 250, IsActive: true}
+	assert.NoError(t, db.Create(&account).Error)
+	assert.NoError(t, db.Create(&models.SenderNumber{Number: "10001", IsDefault: true}).Error)
+	assert.NoError(t, db.Create(&models.Configuration{Name: "single sms", Value: 100}).Error)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/otp/send", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("account", account)
+
+		err := handlers.SendOTPHandler(c, db)
+		assert.NoError(t, err)
+		return rec
+	}
+
+	verify := func(id, code string) (*httptest.ResponseRecorder, handlers.OTPVerifyResponse) {
+		e := echo.New()
+		body := fmt.Sprintf(`{"id": "%s", "code": "%s"}`, id, code)
+		req := httptest.NewRequest(http.MethodPost, "/otp/verify", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("account", account)
+
+		err := handlers.VerifyOTPHandler(c, db)
+		assert.NoError(t, err)
+
+		var res handlers.OTPVerifyResponse
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		return rec, res
+	}
+
+	// replaces the code of an OTP, since only its hash is stored
+	setCode := func(id, code string) {
+		err := db.Model(&models.OTPCode{}).Where("token = ?", id).Update("code_hash", utils.HashCode(code)).Error
+		assert.NoError(t, err)
+	}
+
+	t.Run("InvalidTemplate", func(t *testing.T) {
+		rec := send(`{"senderNumber": "10001", "phoneNumber": "09123456789", "template": "no code here"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("InvalidTTL", func(t *testing.T) {
+		rec := send(`{"senderNumber": "10001", "phoneNumber": "09123456789", "ttl": -1}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), "TTL must be between 0 and 900 seconds")
+	})
+
+	t.Run("SenderNumberNotFound", func(t *testing.T) {
+		rec := send(`{"senderNumber": "20002", "phoneNumber": "09123456789"}`)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("SendAndVerify", func(t *testing.T) {
+		rec := send(`{"senderNumber": "10001", "phoneNumber": "09123456789", "template": "Code: %code", "length": 5}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var res handlers.OTPSendResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.NotEmpty(t, res.ID)
+
+		var updatedAccount models.Account
+		db.First(&updatedAccount, account.ID)
+		assert.Equal(t, int64(150), updatedAccount.Budget)
+
+		// the code isn't stored in message history
+		var sms models.SMSMessage
+		db.Where("recipient = ?", "+989123456789").Last(&sms)
+		assert.Equal(t, "Code: *****", sms.Message)
+
+		setCode(res.ID, "12345")
+		rec, verifyRes := verify(res.ID, "54321")
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Equal(t, handlers.OTPStatusInvalid, verifyRes.Status)
+		assert.Equal(t, 4, verifyRes.RemainingAttempts)
+
+		rec, verifyRes = verify(res.ID, "12345")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, handlers.OTPStatusVerified, verifyRes.Status)
+
+		// a code can't be verified twice
+		rec, verifyRes = verify(res.ID, "12345")
+		assert.Equal(t, http.StatusGone, rec.Code)
+		assert.Equal(t, handlers.OTPStatusExpired, verifyRes.Status)
+	})
+
+	t.Run("TooManyAttempts", func(t *testing.T) {
+		account.Budget = 150
+		rec := send(`{"senderNumber": "10001", "phoneNumber": "09123456789", "maxAttempts": 2}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var res handlers.OTPSendResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		setCode(res.ID, "123456")
+
+		verify(res.ID, "000000")
+		verify(res.ID, "000000")
+		rec, verifyRes := verify(res.ID, "123456")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, handlers.OTPStatusTooManyAttempts, verifyRes.Status)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		otp := models.OTPCode{AccountID: account.ID, Token: "expired", SenderNumber: "10001", Recipient: "09123456789", CodeHash: utils.HashCode("123456"), MaxAttempts: 5}
+		assert.NoError(t, db.Create(&otp).Error)
+
+		rec, verifyRes := verify("expired", "123456")
+		assert.Equal(t, http.StatusGone, rec.Code)
+		assert.Equal(t, handlers.OTPStatusExpired, verifyRes.Status)
+	})
+
+	t.Run("FailedSendIsRefunded", func(t *testing.T) {
+		assert.NoError(t, db.Create(&models.Bad_Word{Word: "forbidden", Regex: "forbidden"}).Error)
+		db.Model(&models.Account{}).Where("id = ?", account.ID).Update("budget", 250)
+		var before models.Account
+		db.First(&before, account.ID)
+		var otpCount, ledgerCount int64
+		db.Model(&models.OTPCode{}).Count(&otpCount)
+		db.Model(&models.LedgerEntry{}).Where("account_id = ? AND reason = ?", account.ID, "otp").Count(&ledgerCount)
+
+		rec := send(`{"senderNumber": "10001", "phoneNumber": "09123456789", "template": "forbidden %code"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		var after models.Account
+		db.First(&after, account.ID)
+		assert.Equal(t, before.Budget, after.Budget)
+		var count int64
+		db.Model(&models.OTPCode{}).Count(&count)
+		assert.Equal(t, otpCount, count)
+		db.Model(&models.LedgerEntry{}).Where("account_id = ? AND reason = ?", account.ID, "otp").Count(&count)
+		assert.Equal(t, ledgerCount+1, count)
+		db.Model(&models.LedgerEntry{}).Where("account_id = ? AND kind = ?", account.ID, models.LedgerRefund).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("InsufficientBudget", func(t *testing.T) {
+		// the budget is read from the database, not from the account of the request
+		db.Model(&models.Account{}).Where("id = ?", account.ID).Update("budget", 50)
+		rec := send(`{"senderNumber": "10001", "phoneNumber": "09123456789"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
@@ -0,0 +1,330 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGateway is a local payment gateway server which accepts every payment
+// made with the "merchant" merchant ID.
+type fakeGateway struct {
+	*httptest.Server
+	mu       sync.Mutex
+	amounts  map[string]int64
+	verified map[string]bool
+	refunded map[string]bool
+	paid     map[string]bool
+	failed   map[string]bool
+}
+
+// authorities are unique between the fake gateways
+var fakeGatewayPayments int
+
+func newFakeGateway(routes func(g *fakeGateway, mux *http.ServeMux)) *fakeGateway {
+	g := &fakeGateway{amounts: map[string]int64{}, verified: map[string]bool{}, refunded: map[string]bool{}, paid: map[string]bool{}, failed: map[string]bool{}}
+	mux := http.NewServeMux()
+	routes(g, mux)
+	g.Server = httptest.NewServer(mux)
+	return g
+}
+
+func (g *fakeGateway) create(amount int64) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fakeGatewayPayments++
+	authority := fmt.Sprintf("A%035d", fakeGatewayPayments)
+	g.amounts[authority] = amount
+	return authority
+}
+
+// verify returns 1 for a new verification, 2 for a repeated one and 0 for an unknown payment
+func (g *fakeGateway) verify(authority string, amount int64) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if a, ok := g.amounts[authority]; !ok || (amount != 0 && a != amount) {
+		return 0
+	}
+	if g.verified[authority] {
+		return 2
+	}
+	g.verified[authority] = true
+	return 1
+}
+
+// inquire returns the status of a payment like zarinpal's inquiry API
+func (g *fakeGateway) inquire(authority string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case g.verified[authority]:
+		return "VERIFIED"
+	case g.failed[authority]:
+		return "FAILED"
+	case g.paid[authority]:
+		return "PAID"
+	}
+	return "IN_BANK"
+}
+
+func decodeJSON(r *http.Request) map[string]interface{} {
+	body := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&body)
+	return body
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func amountOf(body map[string]interface{}) int64 {
+	amount, _ := body["amount"].(float64)
+	return int64(amount)
+}
+
+func newFakeZarinpal() *fakeGateway {
+	return newFakeGateway(func(g *fakeGateway, mux *http.ServeMux) {
+		invalid := map[string]interface{}{"data": []interface{}{}, "errors": map[string]interface{}{"code": -9, "message": "The input params invalid, validation error."}}
+
+		mux.HandleFunc("/pg/v4/payment/request.json", func(w http.ResponseWriter, r *http.Request) {
+			body := decodeJSON(r)
+			if body["merchant_id"] != "merchant" || body["callback_url"] == "" {
+				writeJSON(w, invalid)
+				return
+			}
+			authority := g.create(amountOf(body))
+			writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"code": 100, "message": "Success", "authority": authority}, "errors": []interface{}{}})
+		})
+		mux.HandleFunc("/pg/v4/payment/verify.json", func(w http.ResponseWriter, r *http.Request) {
+			body := decodeJSON(r)
+			authority, _ := body["authority"].(string)
+			g.mu.Lock()
+			amount, ok := g.amounts[authority]
+			g.mu.Unlock()
+			if ok && amount != amountOf(body) {
+				writeJSON(w, map[string]interface{}{"data": []interface{}{}, "errors": map[string]interface{}{"code": -50, "message": "Session is not valid, amounts values is not the same."}})
+				return
+			}
+			switch g.verify(authority, amountOf(body)) {
+			case 1:
+				writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"code": 100, "message": "Paid", "ref_id": 201, "card_pan": "502229******5995", "card_hash": "1EBE3EBEBE35C7EC"}, "errors": []interface{}{}})
+			case 2:
+				writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"code": 101, "message": "Verified", "ref_id": 201}, "errors": []interface{}{}})
+			default:
+				writeJSON(w, map[string]interface{}{"data": []interface{}{}, "errors": map[string]interface{}{"code": -51, "message": "Session is not valid, session is not active paid try."}})
+			}
+		})
+		mux.HandleFunc("/pg/v4/payment/inquiry.json", func(w http.ResponseWriter, r *http.Request) {
+			authority, _ := decodeJSON(r)["authority"].(string)
+			writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"code": 100, "message": "Success", "status": g.inquire(authority)}, "errors": []interface{}{}})
+		})
+		mux.HandleFunc("/pg/v4/payment/reverse.json", func(w http.ResponseWriter, r *http.Request) {
+			authority, _ := decodeJSON(r)["authority"].(string)
+			g.mu.Lock()
+			g.refunded[authority] = g.verified[authority]
+			g.mu.Unlock()
+			writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"code": 100, "message": "Reversed"}, "errors": []interface{}{}})
+		})
+	})
+}
+
+func newFakeIDPay() *fakeGateway {
+	return newFakeGateway(func(g *fakeGateway, mux *http.ServeMux) {
+		mux.HandleFunc("/payment", func(w http.ResponseWriter, r *http.Request) {
+			body := decodeJSON(r)
+			if r.Header.Get("X-API-KEY") != "merchant" || body["order_id"] == "" {
+				w.WriteHeader(http.StatusForbidden)
+				writeJSON(w, map[string]interface{}{"error_code": 11, "error_message": "User is blocked"})
+				return
+			}
+			id := g.create(amountOf(body))
+			writeJSON(w, map[string]interface{}{"id": id, "link": "https://idpay.ir/p/ws-sandbox/" + id})
+		})
+		mux.HandleFunc("/payment/verify", func(w http.ResponseWriter, r *http.Request) {
+			id, _ := decodeJSON(r)["id"].(string)
+			g.mu.Lock()
+			amount := g.amounts[id]
+			g.mu.Unlock()
+			switch g.verify(id, 0) {
+			case 1:
+				writeJSON(w, map[string]interface{}{"status": 100, "track_id": 10012, "id": id, "amount": amount, "payment": map[string]interface{}{"track_id": 888001, "card_no": "123456******1234", "hashed_card_no": "E59FA6241C94B8"}})
+			case 2:
+				writeJSON(w, map[string]interface{}{"status": 101, "id": id, "amount": amount})
+			default:
+				w.WriteHeader(http.StatusNotAcceptable)
+				writeJSON(w, map[string]interface{}{"error_code": 53, "error_message": "Payment is not verified"})
+			}
+		})
+	})
+}
+
+func newFakeNextPay() *fakeGateway {
+	return newFakeGateway(func(g *fakeGateway, mux *http.ServeMux) {
+		mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+			body := decodeJSON(r)
+			if body["api_key"] != "merchant" {
+				writeJSON(w, map[string]interface{}{"code": -32})
+				return
+			}
+			writeJSON(w, map[string]interface{}{"code": -1, "trans_id": g.create(amountOf(body))})
+		})
+		mux.HandleFunc("/verify", func(w http.ResponseWriter, r *http.Request) {
+			body := decodeJSON(r)
+			transID, _ := body["trans_id"].(string)
+			if body["refund_request"] == "yes_money_back" {
+				g.mu.Lock()
+				g.refunded[transID] = g.verified[transID]
+				g.mu.Unlock()
+				writeJSON(w, map[string]interface{}{"code": -90})
+				return
+			}
+			switch g.verify(transID, amountOf(body)) {
+			case 1, 2:
+				writeJSON(w, map[string]interface{}{"code": 0, "amount": amountOf(body), "card_holder": "5022-29**-****-5995", "Shaparak_Ref_Id": "1234567890"})
+			default:
+				writeJSON(w, map[string]interface{}{"code": -49})
+			}
+		})
+	})
+}
+
+func TestPaymentGateways(t *testing.T) {
+	defer utils.SetPaymentGateway(utils.GetPaymentGateway())
+
+	cases := []struct {
+		name     string
+		server   func() *fakeGateway
+		callback func(authority string) url.Values
+	}{
+		{utils.PaymentGatewayZarinpal, newFakeZarinpal, func(authority string) url.Values {
+			return url.Values{"Authority": {authority}, "Status": {"OK"}}
+		}},
+		{utils.PaymentGatewayIDPay, newFakeIDPay, func(authority string) url.Values {
+			return url.Values{"id": {authority}, "status": {"10"}, "order_id": {"1"}}
+		}},
+		{utils.PaymentGatewayNextPay, newFakeNextPay, func(authority string) url.Values {
+			return url.Values{"trans_id": {authority}, "order_id": {"1"}}
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := tc.server()
+			defer server.Close()
+
+			gateway, err := utils.NewPaymentGateway(tc.name, utils.PaymentGatewayOptions{
+				MerchantID: "merchant",
+				APIURL:     server.URL,
+				GateURL:    "https://gateway.test/pay/",
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.name, gateway.Name())
+			utils.SetPaymentGateway(gateway)
+
+			db, err := utils.CreateTestDatabase()
+			assert.NoError(t, err)
+			defer utils.CloseTestDatabase(db)
+
+			user := models.User{FirstName: "john", LastName: "doe", Phone: "09376304339", Email: "test@gmail.com", NationalID: "123456789"}
+			db.Create(&user)
+			account := models.Account{UserID: user.ID, Username: "testuser", IsActive: true}
+			db.Create(&account)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/accounts/payment/request", strings.NewReader(`{"fee": 50000}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("account", account)
+
+			assert.NoError(t, handlers.PaymentRequestHandler(c, db))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var response handlers.RequestResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+
+			var transaction models.Transaction
+			db.First(&transaction)
+			assert.Equal(t, "https://gateway.test/pay/"+transaction.Authority, response.PaymentUrl)
+
+			verify := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/accounts/payment/verify?"+tc.callback(transaction.Authority).Encode(), nil)
+				rec := httptest.NewRecorder()
+				assert.NoError(t, handlers.PaymentVerifyHandler(e.NewContext(req, rec), db))
+				return rec
+			}
+
+			rec = verify()
+			assert.Equal(t, http.StatusOK, rec.Code)
+			db.First(&account, account.ID)
+			assert.Equal(t, int64(50000), account.Budget)
+
+			err = gateway.Refund(utils.PaymentVerifyRequest{OrderID: "1", Authority: transaction.Authority, Amount: transaction.Amount})
+			if tc.name == utils.PaymentGatewayIDPay {
+				assert.ErrorIs(t, err, utils.ErrRefundNotSupported)
+			} else {
+				assert.NoError(t, err)
+				assert.True(t, server.refunded[transaction.Authority])
+			}
+		})
+	}
+
+	t.Run("WrongMerchant", func(t *testing.T) {
+		server := newFakeZarinpal()
+		defer server.Close()
+
+		gateway := utils.NewZarinpalGateway(utils.PaymentGatewayOptions{MerchantID: "wrong", APIURL: server.URL})
+		_, err := gateway.CreatePayment(utils.PaymentRequest{OrderID: "1", Amount: 1000})
+		assert.Error(t, err)
+
+		verification, err := gateway.Verify(utils.PaymentVerifyRequest{Authority: "unknown", Amount: 1000})
+		assert.NoError(t, err)
+		assert.False(t, verification.Verified)
+	})
+
+	t.Run("AmountMismatch", func(t *testing.T) {
+		server := newFakeZarinpal()
+		defer server.Close()
+
+		gateway := utils.NewZarinpalGateway(utils.PaymentGatewayOptions{MerchantID: "merchant", APIURL: server.URL})
+		session, err := gateway.CreatePayment(utils.PaymentRequest{OrderID: "1", Amount: 1000})
+		assert.NoError(t, err)
+		verification, err := gateway.Verify(utils.PaymentVerifyRequest{Authority: session.Authority, Amount: 500})
+		assert.NoError(t, err)
+		assert.False(t, verification.Verified)
+
+		// gateways which answer with the amount which was paid are checked against the transaction
+		db, err := utils.CreateTestDatabase()
+		assert.NoError(t, err)
+		defer utils.CloseTestDatabase(db)
+		account := models.Account{Username: "testuser", IsActive: true}
+		db.Create(&account)
+		transaction := models.Transaction{AccountID: account.ID, Amount: 1000, Status: models.TransactionStatusWait, Authority: "mismatch"}
+		db.Create(&transaction)
+
+		err = utils.CreditTransaction(db, transaction.ID, utils.PaymentVerification{Verified: true, Amount: 500, RefID: "1"})
+		assert.ErrorIs(t, err, utils.ErrPaymentAmountMismatch)
+		db.First(&account, account.ID)
+		assert.Equal(t, int64(0), account.Budget)
+		db.First(&transaction, transaction.ID)
+		assert.Equal(t, models.TransactionStatusFailed, transaction.Status)
+	})
+
+	t.Run("UnknownGateway", func(t *testing.T) {
+		_, err := utils.NewPaymentGateway("paypal", utils.PaymentGatewayOptions{})
+		assert.Error(t, err)
+	})
+}
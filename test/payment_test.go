@@ -83,6 +83,11 @@ func TestPaymentRequestHandler(t *testing.T) {
 		assert.Equal(t, "Input Json doesn't include fee", response.Message)
 	})
 	t.Run("SuccessfulRequest", func(t *testing.T) {
+		server := newFakeZarinpal()
+		defer server.Close()
+		defer utils.SetPaymentGateway(utils.GetPaymentGateway())
+		utils.SetPaymentGateway(utils.NewZarinpalGateway(utils.PaymentGatewayOptions{MerchantID: "merchant", APIURL: server.URL}))
+
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodPost, "/accounts/payment/request", strings.NewReader(`{ "fee": 100000 }`))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -216,3 +221,137 @@ func TestPaymentVerifyHandler(t *testing.T) {
 		assert.Equal(t, "\"Failed Payment\"\n", rec.Body.String())
 	})
 }
+
+func TestSecurePaymentVerification(t *testing.T) {
+	defer utils.SetPaymentGateway(utils.GetPaymentGateway())
+
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	// the account ID is different from the user ID
+	other := models.User{FirstName: "jane", LastName: "doe", Phone: "09123456789", Email: "jane@gmail.com", NationalID: "987654321"}
+	db.Create(&other)
+	user := models.User{FirstName: "john", LastName: "doe", Phone: "09376304339", Email: "test@gmail.com", NationalID: "123456789"}
+	db.Create(&user)
+	account := models.Account{UserID: user.ID, Username: "testuser", IsActive: true}
+	db.Create(&account)
+	assert.NotEqual(t, user.ID, account.ID)
+
+	e := echo.New()
+	request := func(t *testing.T) models.Transaction {
+		req := httptest.NewRequest(http.MethodPost, "/accounts/payment/request", strings.NewReader(`{"fee": 20000}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("account", account)
+
+		assert.NoError(t, handlers.PaymentRequestHandler(c, db))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var transaction models.Transaction
+		db.Last(&transaction)
+		return transaction
+	}
+	verify := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/accounts/payment/verify?"+query, nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handlers.PaymentVerifyHandler(e.NewContext(req, rec), db))
+		return rec
+	}
+
+	t.Run("CreditedOnce", func(t *testing.T) {
+		server := newFakeZarinpal()
+		defer server.Close()
+		utils.SetPaymentGateway(utils.NewZarinpalGateway(utils.PaymentGatewayOptions{MerchantID: "merchant", APIURL: server.URL}))
+
+		transaction := request(t)
+		assert.Equal(t, account.ID, transaction.AccountID)
+
+		query := "Authority=" + transaction.Authority + "&Status=OK"
+		rec := verify(query)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "\"Successful Payment\"\n", rec.Body.String())
+
+		rec = verify(query)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "\"Transaction had verified\"\n", rec.Body.String())
+
+		// a failed callback doesn't change a verified payment
+		rec = verify("Authority=" + transaction.Authority + "&Status=NOK")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		db.First(&account, account.ID)
+		assert.Equal(t, int64(20000), account.Budget)
+
+		db.First(&transaction, transaction.ID)
+		assert.Equal(t, models.TransactionStatusOkay, transaction.Status)
+		assert.Equal(t, "201", transaction.RefID)
+		assert.Equal(t, "1EBE3EBEBE35C7EC", transaction.CardHash)
+		assert.NotNil(t, transaction.VerifiedAt)
+	})
+
+	t.Run("AmountMismatch", func(t *testing.T) {
+		server := newFakeIDPay()
+		defer server.Close()
+		utils.SetPaymentGateway(utils.NewIDPayGateway(utils.PaymentGatewayOptions{MerchantID: "merchant", APIURL: server.URL}))
+
+		transaction := request(t)
+		db.Model(&transaction).Update("amount", 2000000)
+
+		rec := verify("id=" + transaction.Authority + "&status=10")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		db.First(&transaction, transaction.ID)
+		assert.Equal(t, models.TransactionStatusFailed, transaction.Status)
+		db.First(&account, account.ID)
+		assert.Equal(t, int64(20000), account.Budget)
+	})
+
+	t.Run("ForgedFailedCallback", func(t *testing.T) {
+		server := newFakeZarinpal()
+		defer server.Close()
+		utils.SetPaymentGateway(utils.NewZarinpalGateway(utils.PaymentGatewayOptions{MerchantID: "merchant", APIURL: server.URL}))
+
+		// the gateway reports the payment as paid, so a failed callback doesn't close it
+		transaction := request(t)
+		server.paid[transaction.Authority] = true
+		rec := verify("Authority=" + transaction.Authority + "&Status=NOK")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		db.First(&transaction, transaction.ID)
+		assert.Equal(t, models.TransactionStatusOkay, transaction.Status)
+		db.First(&account, account.ID)
+		assert.Equal(t, int64(40000), account.Budget)
+
+		// a payment which isn't paid yet is left for reconciliation
+		transaction = request(t)
+		rec = verify("Authority=" + transaction.Authority + "&Status=NOK")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		db.First(&transaction, transaction.ID)
+		assert.Equal(t, models.TransactionStatusWait, transaction.Status)
+
+		// it is closed when the gateway says it failed
+		server.failed[transaction.Authority] = true
+		rec = verify("Authority=" + transaction.Authority + "&Status=NOK")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		db.First(&transaction, transaction.ID)
+		assert.Equal(t, models.TransactionStatusFailed, transaction.Status)
+	})
+
+	t.Run("NotPaid", func(t *testing.T) {
+		server := newFakeZarinpal()
+		defer server.Close()
+		utils.SetPaymentGateway(utils.NewZarinpalGateway(utils.PaymentGatewayOptions{MerchantID: "merchant", APIURL: server.URL}))
+
+		transaction := request(t)
+		db.Model(&transaction).Update("authority", "A-forged")
+		db.First(&account, account.ID)
+		budget := account.Budget
+
+		// the gateway doesn't know the payment
+		rec := verify("Authority=A-forged&Status=OK")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		db.First(&account, account.ID)
+		assert.Equal(t, budget, account.Budget)
+	})
+}
@@ -59,7 +59,7 @@ func TestCreatePhoneBookNumber(t *testing.T) {
 		requestBody := models.PhoneBookNumber{
 			Name:        "John Doe",
 			Phone:       "09376304339",
-			Prefix:      "1",
+			Prefix:      "+98",
 			Username:    "johndoe",
 			PhoneBookID: phoneBook.ID,
 			PhoneBook:   phoneBook,
@@ -83,7 +83,7 @@ func TestCreatePhoneBookNumber(t *testing.T) {
 		assert.NoError(t, err)
 		log.Println(response)
 		assert.Equal(t, requestBody.Name, response.Name)
-		assert.Equal(t, requestBody.Phone, response.Phone)
+		assert.Equal(t, "+989376304339", response.Phone)
 		assert.Equal(t, requestBody.Prefix, response.Prefix)
 		assert.Equal(t, requestBody.Username, response.Username)
 	})
@@ -209,13 +209,14 @@ func TestCreatePhoneBookNumber(t *testing.T) {
 	t.Run("CreatePhoneBookNumberDuplicatePhone", func(t *testing.T) {
 		requestBody := models.PhoneBookNumber{
 			Name:        "john doe",
-			Phone:       "09376304339",
+			Phone:       "+989376304339",
 			Prefix:      "1",
 			Username:    "johndoe",
 			PhoneBookID: phoneBook.ID,
 			PhoneBook:   phoneBook,
 		}
-		// in this test this object with this phone number is created in success test so should return error
+		// in this test this object with this phone number is created in success test so should return error,
+		// the number is the same in the international format
 		jsonBody, _ := json.Marshal(requestBody)
 
 		req := httptest.NewRequest(http.MethodPost, "/account/phone-books/phone-book-numbers", bytes.NewReader(jsonBody))
@@ -452,18 +453,19 @@ func TestUpdatePhoneBookNumber(t *testing.T) {
 
 		existingPhoneBookNumber := models.PhoneBookNumber{
 			Name:   "John Doe",
-			Phone:  "123456789",
-			Prefix: "1",
+			Phone:  "+989121234567",
+			Prefix: "+98",
 		}
 		err = db.Create(&existingPhoneBookNumber).Error
 		assert.NoError(t, err)
 
 		e := echo.New()
 
+		// a national phone is of the country of the prefix
 		updatedPhoneBookNumber := handlers.UpdatePhoneBookNumberRequest{
-			Prefix: "2",
+			Prefix: "+44",
 			Name:   "Jane Smith",
-			Phone:  "987654321",
+			Phone:  "07911123456",
 		}
 		jsonBody, _ := json.Marshal(updatedPhoneBookNumber)
 
@@ -486,7 +488,7 @@ func TestUpdatePhoneBookNumber(t *testing.T) {
 
 		assert.Equal(t, updatedPhoneBookNumber.Prefix, response.Prefix)
 		assert.Equal(t, updatedPhoneBookNumber.Name, response.Name)
-		assert.Equal(t, updatedPhoneBookNumber.Phone, response.Phone)
+		assert.Equal(t, "+447911123456", response.Phone)
 
 		// Verify that the object is updated in the database
 		var updatedObject models.PhoneBookNumber
@@ -494,7 +496,7 @@ func TestUpdatePhoneBookNumber(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, updatedPhoneBookNumber.Prefix, updatedObject.Prefix)
 		assert.Equal(t, updatedPhoneBookNumber.Name, updatedObject.Name)
-		assert.Equal(t, updatedPhoneBookNumber.Phone, updatedObject.Phone)
+		assert.Equal(t, "+447911123456", updatedObject.Phone)
 	})
 
 	t.Run("PhoneBookNumberNotFound", func(t *testing.T) {
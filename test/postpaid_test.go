@@ -0,0 +1,166 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/tasks"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func TestPostpaidAccounts(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+	utils.MessageLimiter = utils.NewRateLimiter()
+
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+	user := models.User{FirstName: "john", LastName: "doe", Phone: "09376304339", Email: "test@gmail.com", NationalID: "123456789"}
+	db.Create(&user)
+	hash, err := bcrypt.GenerateFromPassword([]byte("test123"), bcrypt.DefaultCost)
+	assert.NoError(t, err)
+	account := models.Account{UserID: user.ID, Username: "enterprise", Password: string(hash), Budget: 100, IsActive: true}
+	db.Create(&account)
+	phoneBook := models.PhoneBook{AccountID: account.ID, Name: "Test"}
+	db.Create(&phoneBook)
+	db.Create(&models.PhoneBookNumber{PhoneBookID: phoneBook.ID, Username: "test", Name: "test", Phone: "+989376304339"})
+	db.Create(&models.Configuration{Name: "single sms", Value: 100})
+	db.Create(&models.SenderNumber{Number: "10001", IsDefault: true})
+
+	call := func(handler func(echo.Context, *gorm.DB) error, actor models.Account, body string, id uint) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("account", actor)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+	reload := func() models.Account {
+		id := account.ID
+		account = models.Account{}
+		db.First(&account, id)
+		return account
+	}
+	send := func() int {
+		body := `{"senderNumbers": "10001", "phone_number": "09376304339", "message": "hello"}`
+		return call(handlers.SendSingleSMSHandler, reload(), body, 0).Code
+	}
+
+	t.Run("PrepaidStopsAtZero", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send())
+		assert.Equal(t, http.StatusForbidden, send())
+		assert.Equal(t, int64(0), reload().Budget)
+	})
+
+	t.Run("SetCreditLimit", func(t *testing.T) {
+		rec := call(handlers.SetCreditLimitHandler, admin, `{"creditLimit": -1}`, account.ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = call(handlers.SetCreditLimitHandler, admin, `{"creditLimit": 200}`, account.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, int64(200), reload().CreditLimit)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionCreditLimit).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("PostpaidSpendsCreditLimit", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send())
+		assert.Equal(t, http.StatusOK, send())
+		assert.Equal(t, http.StatusForbidden, send())
+		assert.Equal(t, int64(-200), reload().Budget)
+	})
+
+	// the spending is moved to the last month to be billed
+	lastMonth := utils.MonthStart(time.Now()).AddDate(0, -1, 0)
+	db.Model(&models.LedgerEntry{}).Where("account_id = ?", account.ID).Update("created_at", lastMonth.Add(time.Hour))
+
+	var bill models.Bill
+	t.Run("MonthlyBill", func(t *testing.T) {
+		tasks.PostpaidBillingTask(db)()
+		tasks.PostpaidBillingTask(db)()
+
+		var bills []models.Bill
+		db.Where("account_id = ?", account.ID).Find(&bills)
+		if assert.Len(t, bills, 1) {
+			bill = bills[0]
+			assert.True(t, lastMonth.Equal(bill.PeriodStart))
+			assert.Equal(t, int64(300), bill.Usage)
+			assert.Equal(t, int64(200), bill.Amount)
+			assert.Equal(t, models.BillStatusUnpaid, bill.Status)
+			assert.WithinDuration(t, time.Now().AddDate(0, 0, utils.DefaultBillDueDays), bill.DueAt, time.Minute)
+		}
+		assert.True(t, reload().IsActive)
+	})
+
+	t.Run("OverdueSuspension", func(t *testing.T) {
+		db.Model(&bill).Update("due_at", time.Now().Add(-time.Hour))
+		tasks.PostpaidBillingTask(db)()
+
+		reload()
+		assert.False(t, account.IsActive)
+		assert.NotNil(t, account.SuspendedAt)
+
+		// the owner can still log in to pay the bill
+		_, loggedIn, err := utils.Login("enterprise", "test123", false, db)
+		assert.NoError(t, err)
+		assert.Equal(t, account.ID, loggedIn.ID)
+	})
+
+	t.Run("PayBill", func(t *testing.T) {
+		gatewayServer := newFakeZarinpal()
+		defer gatewayServer.Close()
+		defer utils.SetPaymentGateway(utils.GetPaymentGateway())
+		utils.SetPaymentGateway(utils.NewZarinpalGateway(utils.PaymentGatewayOptions{
+			MerchantID:  "merchant",
+			CallbackURL: "http://localhost/accounts/payment/verify",
+			APIURL:      gatewayServer.URL,
+			GateURL:     "https://gateway.test/pay/",
+		}))
+
+		rec := call(handlers.PayBillHandler, reload(), "", bill.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "https://gateway.test/pay/")
+
+		var transaction models.Transaction
+		db.Where("account_id = ?", account.ID).Order("id desc").First(&transaction)
+		assert.Equal(t, int64(200), transaction.Amount)
+
+		rec = call(handlers.PayBillHandler, reload(), "", bill.ID+100)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("PaymentSettlesBillAndReactivates", func(t *testing.T) {
+		assert.NoError(t, utils.CreditBudget(db, account.ID, admin.ID, 200, "Bank transfer", nil))
+
+		db.First(&bill, bill.ID)
+		assert.Equal(t, models.BillStatusPaid, bill.Status)
+		assert.NotNil(t, bill.PaidAt)
+
+		reload()
+		assert.True(t, account.IsActive)
+		assert.Nil(t, account.SuspendedAt)
+		assert.Equal(t, int64(0), account.Budget)
+
+		rec := call(handlers.PayBillHandler, account, "", bill.ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+}
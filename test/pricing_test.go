@@ -0,0 +1,197 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestPricingEngine(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	db.Create(&models.Configuration{Name: "single sms", Value: 100})
+	db.Create(&models.Configuration{Name: "group sms", Value: 50})
+	db.Create(&models.SenderNumber{Number: "3000", IsDefault: true})
+	db.Create(&models.SenderNumber{Number: "2000", IsExclusive: true})
+
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+	account := models.Account{Username: "user", IsActive: true}
+	db.Create(&account)
+
+	price := func(sender, recipient string, group bool) int64 {
+		db.First(&account, account.ID)
+		price, err := utils.MessagePrice(db, account, sender, recipient, group)
+		assert.NoError(t, err)
+		return price
+	}
+
+	call := func(handler func(echo.Context, *gorm.DB) error, body string, params ...string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id", "ruleID")
+		c.SetParamValues(append(params, "", "")[:2]...)
+		c.Set("account", admin)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+
+	t.Run("ConfigurationFallback", func(t *testing.T) {
+		assert.Equal(t, int64(100), price("3000", "09121234567", false))
+		assert.Equal(t, int64(50), price("3000", "09121234567", true))
+	})
+
+	plan := models.PricingPlan{Name: "enterprise", RequestsPerSecond: 10, MessagesPerMinute: 600, SinglePrice: 120}
+	db.Create(&plan)
+	db.Model(&account).Update("pricing_plan_id", plan.ID)
+	planID := fmt.Sprint(plan.ID)
+
+	t.Run("PlanPrices", func(t *testing.T) {
+		assert.Equal(t, int64(120), price("3000", "09121234567", false))
+		// the plan doesn't have a group price
+		assert.Equal(t, int64(50), price("3000", "09121234567", true))
+	})
+
+	t.Run("RateValidation", func(t *testing.T) {
+		rec := call(handlers.SetPriceRateHandler, `{"prefix": "abc", "price": 10}`, planID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.SetPriceRateHandler, `{"prefix": "98", "price": -1}`, planID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.SetPriceRateHandler, `{"prefix": "98", "price": 10}`, "999")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = call(handlers.SetPriceSurchargeHandler, `{"senderType": "premium", "amount": 10}`, planID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.SetPriceTierHandler, `{"minMessages": 10, "discountPercent": 101}`, planID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("DestinationRates", func(t *testing.T) {
+		rec := call(handlers.SetPriceRateHandler, `{"prefix": "+98", "name": "Iran", "price": 130}`, planID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.SetPriceRateHandler, `{"prefix": "98912", "name": "MCI", "price": 140}`, planID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.SetPriceRateHandler, `{"prefix": "98912", "name": "MCI", "price": 150}`, planID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var count int64
+		db.Model(&models.PriceRate{}).Where("pricing_plan_id = ?", plan.ID).Count(&count)
+		assert.Equal(t, int64(2), count)
+
+		assert.Equal(t, int64(150), price("3000", "+989121234567", false))
+		assert.Equal(t, int64(150), price("3000", "00989121234567", false))
+		assert.Equal(t, int64(130), price("3000", "+989351234567", false))
+		assert.Equal(t, int64(120), price("3000", "+14155550123", false))
+	})
+
+	t.Run("SenderSurcharge", func(t *testing.T) {
+		rec := call(handlers.SetPriceSurchargeHandler, `{"senderType": "exclusive", "amount": 20}`, planID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		assert.Equal(t, int64(170), price("2000", "+989121234567", false))
+		assert.Equal(t, int64(150), price("3000", "+989121234567", false))
+	})
+
+	t.Run("VolumeTiers", func(t *testing.T) {
+		rec := call(handlers.SetPriceTierHandler, `{"minMessages": 2, "discountPercent": 10}`, planID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.SetPriceTierHandler, `{"minMessages": 3, "discountPercent": 20}`, planID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		assert.Equal(t, int64(150), price("3000", "+989121234567", false))
+
+		for i := 0; i < 2; i++ {
+			db.Create(&models.SMSMessage{AccountID: account.ID, Sender: "3000", Recipient: "09121234567", CreatedAt: time.Now()})
+		}
+		assert.Equal(t, int64(135), price("3000", "+989121234567", false))
+		assert.Equal(t, int64(155), price("2000", "+989121234567", false))
+
+		db.Create(&models.SMSMessage{AccountID: account.ID, Sender: "3000", Recipient: "09121234567", CreatedAt: time.Now()})
+		assert.Equal(t, int64(120), price("3000", "+989121234567", false))
+	})
+
+	t.Run("ListAndDelete", func(t *testing.T) {
+		rec := call(handlers.PricesHandler, "", planID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var prices handlers.PricesResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &prices))
+		assert.Len(t, prices.Tiers, 2)
+		assert.Len(t, prices.Rates, 2)
+		assert.Len(t, prices.Surcharges, 1)
+
+		rec = call(handlers.DeletePriceSurchargeHandler, "", planID, fmt.Sprint(prices.Surcharges[0].ID))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.DeletePriceSurchargeHandler, "", planID, fmt.Sprint(prices.Surcharges[0].ID))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionPriceRuleSet).Count(&count)
+		assert.Equal(t, int64(6), count)
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionPriceRuleDelete).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
+
+func TestSingleSMSUsesPricingEngine(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+	utils.MessageLimiter = utils.NewRateLimiter()
+
+	plan := models.PricingPlan{Name: "operators", RequestsPerSecond: 10, MessagesPerMinute: 600, SinglePrice: 100}
+	db.Create(&plan)
+	db.Create(&models.PriceRate{PricingPlanID: plan.ID, Prefix: "98912", Name: "MCI", Price: 70})
+	user := models.User{FirstName: "john", LastName: "doe", Phone: "09376304339", Email: "test@gmail.com", NationalID: "123456789"}
+	db.Create(&user)
+	account := models.Account{UserID: user.ID, Username: "testuser", Budget: 1000, IsActive: true, PricingPlanID: &plan.ID}
+	db.Create(&account)
+	phoneBook := models.PhoneBook{AccountID: account.ID, Name: "Test"}
+	db.Create(&phoneBook)
+	db.Create(&models.PhoneBookNumber{PhoneBookID: phoneBook.ID, Username: "mci", Name: "mci", Phone: "+989121234567"})
+	db.Create(&models.PhoneBookNumber{PhoneBookID: phoneBook.ID, Username: "other", Name: "other", Phone: "+989376304339"})
+	db.Create(&models.SenderNumber{Number: "10001", IsDefault: true})
+
+	send := func(phone string) {
+		e := echo.New()
+		body := `{"senderNumbers": "10001", "phone_number": "` + phone + `", "message": "hello"}`
+		req := httptest.NewRequest(http.MethodPost, "/sms/single", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		db.First(&account, account.ID)
+		c.Set("account", account)
+
+		assert.NoError(t, handlers.SendSingleSMSHandler(c, db))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	send("09121234567")
+	db.First(&account, account.ID)
+	assert.Equal(t, int64(930), account.Budget)
+
+	send("09376304339")
+	db.First(&account, account.ID)
+	assert.Equal(t, int64(830), account.Budget)
+
+	var spent int64
+	db.Model(&models.LedgerEntry{}).Where("account_id = ? AND kind = ?", account.ID, models.LedgerSpend).
+		Select("COALESCE(SUM(amount), 0)").Scan(&spent)
+	assert.Equal(t, int64(-170), spent)
+}
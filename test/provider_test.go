@@ -0,0 +1,269 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// fakeSender is a provider which counts its messages, and fails or blocks when it's told to
+type fakeSender struct {
+	mu    sync.Mutex
+	calls int
+	fail  bool
+	block bool
+}
+
+func (s *fakeSender) Send(ctx context.Context, message utils.ProviderMessage) (string, error) {
+	s.mu.Lock()
+	s.calls++
+	fail, block := s.fail, s.block
+	s.mu.Unlock()
+
+	if block {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	if fail {
+		return "", errors.New("provider is down")
+	}
+	return "Message sent successfully", nil
+}
+
+func (s *fakeSender) Set(fail, block bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail, s.block = fail, block
+}
+
+func (s *fakeSender) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestProviderFailover(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	magfa, kavenegar := &fakeSender{}, &fakeSender{}
+	utils.SetSMSSender("magfa", magfa)
+	utils.SetSMSSender("kavenegar", kavenegar)
+	defer utils.SetSMSSender("magfa", nil)
+	defer utils.SetSMSSender("kavenegar", nil)
+
+	mci := models.Operator{Name: "MCI", Provider: utils.DefaultProvider, Prefixes: []models.OperatorPrefix{{Prefix: "98912"}}}
+	db.Create(&mci)
+	magfaProvider := models.SMSProvider{Name: "magfa", Price: 100, Enabled: true}
+	kavenegarProvider := models.SMSProvider{Name: "kavenegar", Price: 80, Enabled: true}
+	db.Create(&magfaProvider)
+	db.Create(&kavenegarProvider)
+	db.Create(&models.ProviderRoute{OperatorID: &mci.ID, ProviderID: magfaProvider.ID, Position: 0})
+	db.Create(&models.ProviderRoute{OperatorID: &mci.ID, ProviderID: kavenegarProvider.ID, Position: 1})
+	db.Create(&models.Configuration{Name: utils.SettingProviderFailureThreshold, Value: 2})
+
+	message := utils.ProviderMessage{Text: "hello", Source: "3000", Destination: "+989121234567"}
+
+	t.Run("FirstProviderOfRoute", func(t *testing.T) {
+		deliveryReport, provider, err := utils.RouteMessage(db, "", message)
+		assert.NoError(t, err)
+		assert.Equal(t, "Message sent successfully", deliveryReport)
+		assert.Equal(t, "magfa", provider)
+		assert.Equal(t, 0, kavenegar.Calls())
+	})
+
+	t.Run("DefaultProviderWithoutRoute", func(t *testing.T) {
+		_, provider, err := utils.RouteMessage(db, "", utils.ProviderMessage{Text: "hello", Destination: "+989351234567"})
+		assert.NoError(t, err)
+		assert.Equal(t, utils.DefaultProvider, provider)
+	})
+
+	t.Run("Failover", func(t *testing.T) {
+		magfa.Set(true, false)
+		_, provider, err := utils.RouteMessage(db, "", message)
+		assert.NoError(t, err)
+		assert.Equal(t, "kavenegar", provider)
+		assert.Equal(t, utils.CircuitClosed, utils.ProviderBreakers.Get("magfa").Health().State)
+	})
+
+	t.Run("CircuitOpens", func(t *testing.T) {
+		_, provider, err := utils.RouteMessage(db, "", message)
+		assert.NoError(t, err)
+		assert.Equal(t, "kavenegar", provider)
+
+		health := utils.ProviderBreakers.Get("magfa").Health()
+		assert.Equal(t, utils.CircuitOpen, health.State)
+		assert.Equal(t, 2, health.ConsecutiveFailures)
+		assert.Equal(t, "provider is down", health.LastError)
+
+		// magfa is skipped while its circuit is open
+		calls := magfa.Calls()
+		_, provider, err = utils.RouteMessage(db, "", message)
+		assert.NoError(t, err)
+		assert.Equal(t, "kavenegar", provider)
+		assert.Equal(t, calls, magfa.Calls())
+	})
+
+	t.Run("AllProvidersFail", func(t *testing.T) {
+		kavenegar.Set(true, false)
+		deliveryReport, _, err := utils.RouteMessage(db, "", message)
+		assert.Error(t, err)
+		assert.Equal(t, "message not sent", deliveryReport)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		utils.ProviderBreakers.Clear()
+		magfa.Set(false, true)
+		kavenegar.Set(false, false)
+		db.Create(&models.Configuration{Name: utils.SettingProviderTimeoutMS, Value: 50})
+		utils.Settings.Invalidate()
+
+		_, provider, err := utils.RouteMessage(db, "", message)
+		assert.NoError(t, err)
+		assert.Equal(t, "kavenegar", provider)
+		assert.Equal(t, utils.ErrProviderTimeout.Error(), utils.ProviderBreakers.Get("magfa").Health().LastError)
+		magfa.Set(false, false)
+	})
+
+	t.Run("LeastCost", func(t *testing.T) {
+		utils.ProviderBreakers.Clear()
+		db.Create(&models.Configuration{Name: utils.SettingLeastCostRouting, Value: 1})
+		utils.Settings.Invalidate()
+
+		message := &handlers.Message{Text: "hello", Source: "3000", Destination: "+989121234567"}
+		_, err := handlers.SendMessage(message, db)
+		assert.NoError(t, err)
+		assert.Equal(t, "kavenegar", message.Provider)
+	})
+
+	t.Run("DisabledProvider", func(t *testing.T) {
+		db.Model(&kavenegarProvider).Update("enabled", false)
+		utils.Providers.Invalidate()
+
+		_, provider, err := utils.RouteMessage(db, "", message)
+		assert.NoError(t, err)
+		assert.Equal(t, "magfa", provider)
+	})
+}
+
+func TestProviderAdmin(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+	mci := models.Operator{Name: "MCI", Provider: utils.DefaultProvider, Prefixes: []models.OperatorPrefix{{Prefix: "98912"}}}
+	db.Create(&mci)
+
+	call := func(handler func(echo.Context, *gorm.DB) error, body string, id uint) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("account", admin)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+
+	var magfa handlers.ProviderResponse
+	t.Run("Create", func(t *testing.T) {
+		rec := call(handlers.CreateProviderHandler, `{"name": "magfa", "price": 90}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &magfa))
+		assert.True(t, magfa.Enabled)
+		assert.Equal(t, utils.CircuitClosed, magfa.Health.State)
+
+		rec = call(handlers.CreateProviderHandler, `{"name": "kavenegar", "price": 80, "enabled": false}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = call(handlers.CreateProviderHandler, `{"name": "magfa"}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.CreateProviderHandler, `{"name": "asanak", "price": -1}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("SetRoute", func(t *testing.T) {
+		rec := call(handlers.SetRouteHandler, fmt.Sprintf(`{"operatorID": %d, "providers": ["magfa", "kavenegar"]}`, mci.ID), 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.SetRouteHandler, `{"providers": ["kavenegar"]}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = call(handlers.SetRouteHandler, `{"providers": ["asanak"]}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.SetRouteHandler, `{"providers": ["magfa", "magfa"]}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.SetRouteHandler, `{"operatorID": 100, "providers": ["magfa"]}`, 0)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		var routes []handlers.RouteResponse
+		rec = call(handlers.ListRoutesHandler, "", 0)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &routes))
+		assert.Len(t, routes, 2)
+		for _, route := range routes {
+			if route.OperatorID == nil {
+				assert.Equal(t, []string{"kavenegar"}, route.Providers)
+			} else {
+				assert.Equal(t, "MCI", route.Operator)
+				assert.Equal(t, []string{"magfa", "kavenegar"}, route.Providers)
+			}
+		}
+
+		// kavenegar is disabled, so it isn't in the routes which messages are sent through
+		route, err := utils.Providers.Route(db, "09121234567")
+		assert.NoError(t, err)
+		assert.Len(t, route, 1)
+		assert.Equal(t, "magfa", route[0].Name)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionRouteSet).Count(&count)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("Health", func(t *testing.T) {
+		utils.ProviderBreakers.Get("magfa").Failure(errors.New("provider is down"), 1)
+
+		var providers []handlers.ProviderResponse
+		rec := call(handlers.ListProvidersHandler, "", 0)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &providers))
+		assert.Len(t, providers, 2)
+		assert.Equal(t, "magfa", providers[1].Name)
+		assert.Equal(t, utils.CircuitOpen, providers[1].Health.State)
+		assert.Equal(t, int64(1), providers[1].Health.Failed)
+
+		rec = call(handlers.ResetProviderHandler, "", magfa.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, utils.CircuitClosed, utils.ProviderBreakers.Get("magfa").Health().State)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		rec := call(handlers.DeleteProviderHandler, "", magfa.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var count int64
+		db.Model(&models.ProviderRoute{}).Where("provider_id = ?", magfa.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+
+		rec = call(handlers.DeleteProviderHandler, "", magfa.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -0,0 +1,287 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/middlewares"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := utils.NewRateLimiter()
+	limit := utils.RateLimit{Key: "test", Rate: 1, Burst: 2}
+	other := utils.RateLimit{Key: "other", Rate: 1, Burst: 5}
+
+	assert.NoError(t, limiter.Allow(1, limit, other))
+	assert.NoError(t, limiter.Allow(1, limit, other))
+
+	err := limiter.Allow(1, limit, other)
+	rateLimitErr, ok := err.(utils.RateLimitError)
+	if assert.True(t, ok, "Expected a rate limit error") {
+		assert.InDelta(t, time.Second.Seconds(), rateLimitErr.RetryAfter.Seconds(), 0.1)
+		assert.Equal(t, 1, rateLimitErr.RetryAfterSeconds())
+	}
+
+	// tokens aren't taken from the other limit when one limit is exceeded
+	assert.NoError(t, limiter.Check(3, other))
+	assert.Error(t, limiter.Check(4, other))
+}
+
+func TestAccountPricingPlan(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	account := models.Account{Username: "user", IsActive: true}
+	db.Create(&account)
+
+	plan := utils.AccountPricingPlan(db, account)
+	assert.Equal(t, utils.DefaultMessagesPerMinute, plan.MessagesPerMinute)
+
+	defaultPlan := models.PricingPlan{Name: "default", IsDefault: true, RequestsPerSecond: 5, MessagesPerMinute: 100}
+	db.Create(&defaultPlan)
+	plan = utils.AccountPricingPlan(db, account)
+	assert.Equal(t, defaultPlan.ID, plan.ID)
+
+	business := models.PricingPlan{Name: "business", RequestsPerSecond: 50, MessagesPerMinute: 5000}
+	db.Create(&business)
+	account.PricingPlanID = &business.ID
+	plan = utils.AccountPricingPlan(db, account)
+	assert.Equal(t, business.ID, plan.ID)
+}
+
+func TestMessageRateLimit(t *testing.T) {
+	utils.MessageLimiter = utils.NewRateLimiter()
+	defer func() { utils.MessageLimiter = utils.NewRateLimiter() }()
+
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	plan := models.PricingPlan{Name: "tiny", RequestsPerSecond: 1, MessagesPerMinute: 1}
+	db.Create(&plan)
+	user := models.User{FirstName: "john", LastName: "doe", Phone: "09376304339", Email: "test@gmail.com", NationalID: "123456789"}
+	db.Create(&user)
+	account := models.Account{UserID: user.ID, Username: "testuser", Budget: 1000, IsActive: true, PricingPlanID: &plan.ID}
+	db.Create(&account)
+	phoneBook := models.PhoneBook{AccountID: account.ID, Name: "Test"}
+	db.Create(&phoneBook)
+	db.Create(&models.PhoneBookNumber{PhoneBookID: phoneBook.ID, Username: "test", Name: "test", Phone: "+989376304339"})
+	db.Create(&models.Configuration{Name: "single sms", Value: 100})
+	db.Create(&models.SenderNumber{Number: "10001", IsDefault: true})
+
+	send := func() *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/sms/single", strings.NewReader(`{"senderNumbers": "10001", "phone_number": "09376304339", "message": "hello"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("account", account)
+
+		err := handlers.SendSingleSMSHandler(c, db)
+		assert.NoError(t, err)
+		return rec
+	}
+
+	rec := send()
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = send()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	// the rate limited message isn't charged
+	db.First(&account, account.ID)
+	assert.Equal(t, int64(900), account.Budget)
+}
+
+func TestPricingPlanHandlers(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+	account := models.Account{Username: "user", IsActive: true}
+	db.Create(&account)
+
+	call := func(handler func(echo.Context, *gorm.DB) error, method, body string, id uint) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("account", admin)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+
+	var basic, business models.PricingPlan
+
+	t.Run("Create", func(t *testing.T) {
+		rec := call(handlers.CreatePricingPlanHandler, http.MethodPost, `{"name": "basic", "isDefault": true, "requestsPerSecond": 5, "messagesPerMinute": 100}`, 0)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &basic))
+
+		rec = call(handlers.CreatePricingPlanHandler, http.MethodPost, `{"name": "business", "isDefault": true, "requestsPerSecond": 50, "messagesPerMinute": 5000}`, 0)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &business))
+
+		// there is only one default plan
+		db.First(&basic, basic.ID)
+		assert.False(t, basic.IsDefault)
+
+		rec = call(handlers.CreatePricingPlanHandler, http.MethodPost, `{"name": "broken", "requestsPerSecond": 0, "messagesPerMinute": 10}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		rec := call(handlers.UpdatePricingPlanHandler, http.MethodPatch, `{"messagesPerMinute": 200}`, basic.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		db.First(&basic, basic.ID)
+		assert.Equal(t, 200, basic.MessagesPerMinute)
+		assert.Equal(t, float64(5), basic.RequestsPerSecond)
+	})
+
+	t.Run("AssignAndDelete", func(t *testing.T) {
+		rec := call(handlers.SetAccountPricingPlanHandler, http.MethodPatch, fmt.Sprintf(`{"pricingPlanID": %d}`, basic.ID), account.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		db.First(&account, account.ID)
+		assert.Equal(t, basic.ID, *account.PricingPlanID)
+
+		// a plan which is used can't be deleted
+		rec = call(handlers.DeletePricingPlanHandler, http.MethodDelete, "", basic.ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = call(handlers.SetAccountPricingPlanHandler, http.MethodPatch, `{"pricingPlanID": null}`, account.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.DeletePricingPlanHandler, http.MethodDelete, "", basic.ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("target = ?", fmt.Sprintf("pricing_plan:%d", basic.ID)).Count(&count)
+		assert.Equal(t, int64(3), count)
+	})
+}
+
+func TestAPIKeyHandlers(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	account := models.Account{Username: "user", IsActive: true}
+	db.Create(&account)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/accounts/api-keys", strings.NewReader(`{"name": "backend"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("account", account)
+	assert.NoError(t, handlers.CreateAPIKeyHandler(c, db))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var created handlers.CreateAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+
+	// only the hash of the key is stored
+	var apiKey models.APIKey
+	db.First(&apiKey, created.ID)
+	assert.Equal(t, utils.HashCode(created.Key), apiKey.KeyHash)
+
+	req = httptest.NewRequest(http.MethodDelete, "/", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(created.ID))
+	c.Set("account", account)
+	assert.NoError(t, handlers.RevokeAPIKeyHandler(c, db))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	db.First(&apiKey, created.ID)
+	assert.NotNil(t, apiKey.RevokedAt)
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+	t.Setenv("SECRET", "secret")
+
+	suspendedAt := time.Now()
+	owner := models.Account{Username: "owner", SuspendedAt: &suspendedAt, Token: "token"}
+	db.Create(&owner)
+	db.Model(&owner).Update("is_active", false)
+	memberAccount := models.Account{Username: "member", IsActive: true, Token: "token"}
+	db.Create(&memberAccount)
+	member := models.AccountMember{AccountID: owner.ID, MemberID: memberAccount.ID, Role: models.MemberRoleSender}
+	db.Create(&member)
+	db.Create(&models.APIKey{AccountID: owner.ID, Name: "owner", Prefix: "owner", KeyHash: utils.HashCode("owner-key")})
+	db.Create(&models.APIKey{AccountID: memberAccount.ID, Name: "member", Prefix: "member", KeyHash: utils.HashCode("member-key")})
+	token, err := utils.GenerateToken(owner.ID, false)
+	assert.NoError(t, err)
+
+	e := echo.New()
+	authenticate := func(path string, header string, value string) (echo.Context, error) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(header, value)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetPath(path)
+		err := middlewares.IsLoggedInWithDB(db)(func(c echo.Context) error {
+			return nil
+		})(c)
+		return c, err
+	}
+	status := func(err error) int {
+		if httpErr, ok := err.(*echo.HTTPError); ok {
+			return httpErr.Code
+		}
+		return http.StatusOK
+	}
+
+	t.Run("SuspendedAccount", func(t *testing.T) {
+		// tokens and API keys of a suspended account get the same response
+		_, err := authenticate("/accounts/sms", "Authorization", token)
+		assert.Equal(t, http.StatusPaymentRequired, status(err))
+		_, err = authenticate("/accounts/sms", "X-API-Key", "owner-key")
+		assert.Equal(t, http.StatusPaymentRequired, status(err))
+
+		c, err := authenticate("/accounts/bills", "X-API-Key", "owner-key")
+		assert.NoError(t, err)
+		assert.Equal(t, owner.ID, c.Get("account").(models.Account).ID)
+	})
+
+	t.Run("MemberAPIKey", func(t *testing.T) {
+		c, err := authenticate("/accounts/bills", "X-API-Key", "member-key")
+		assert.NoError(t, err)
+		assert.Equal(t, owner.ID, c.Get("account").(models.Account).ID)
+		assert.Equal(t, member.ID, c.Get("member").(models.AccountMember).ID)
+
+		_, err = authenticate("/accounts/sms", "X-API-Key", "member-key")
+		assert.Equal(t, http.StatusPaymentRequired, status(err))
+	})
+
+	t.Run("DeactivatedAccount", func(t *testing.T) {
+		db.Model(&models.Account{}).Where("id = ?", owner.ID).Updates(map[string]interface{}{"suspended_at": nil})
+		_, err := authenticate("/accounts/bills", "X-API-Key", "owner-key")
+		assert.Equal(t, http.StatusUnauthorized, status(err))
+		_, err = authenticate("/accounts/bills", "X-API-Key", "member-key")
+		assert.Equal(t, http.StatusUnauthorized, status(err))
+	})
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"SMS-panel/models"
+	"SMS-panel/tasks"
+	"SMS-panel/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcilePaymentsTask(t *testing.T) {
+	defer utils.SetPaymentGateway(utils.GetPaymentGateway())
+
+	server := newFakeZarinpal()
+	defer server.Close()
+	utils.SetPaymentGateway(utils.NewZarinpalGateway(utils.PaymentGatewayOptions{MerchantID: "merchant", APIURL: server.URL}))
+
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	user := models.User{FirstName: "john", LastName: "doe", Phone: "09376304339", Email: "test@gmail.com", NationalID: "123456789"}
+	db.Create(&user)
+	account := models.Account{UserID: user.ID, Username: "testuser", IsActive: true}
+	db.Create(&account)
+
+	createTransaction := func(age time.Duration) models.Transaction {
+		transaction := models.Transaction{
+			AccountID: account.ID,
+			Amount:    10000,
+			Status:    models.TransactionStatusWait,
+			Authority: server.create(10000),
+			CreatedAt: time.Now().Add(-age),
+		}
+		db.Create(&transaction)
+		return transaction
+	}
+
+	paid := createTransaction(30 * time.Minute)
+	server.paid[paid.Authority] = true
+	failed := createTransaction(30 * time.Minute)
+	server.failed[failed.Authority] = true
+	abandoned := createTransaction(25 * time.Hour)
+	pending := createTransaction(30 * time.Minute)
+	recent := createTransaction(time.Minute)
+	server.paid[recent.Authority] = true
+
+	tasks.ReconcilePaymentsTask(db, 15*time.Minute, 24*time.Hour)()
+
+	status := func(transaction models.Transaction) string {
+		db.First(&transaction, transaction.ID)
+		return transaction.Status
+	}
+	assert.Equal(t, models.TransactionStatusOkay, status(paid))
+	assert.Equal(t, models.TransactionStatusFailed, status(failed))
+	assert.Equal(t, models.TransactionStatusExpired, status(abandoned))
+	assert.Equal(t, models.TransactionStatusWait, status(pending))
+	assert.Equal(t, models.TransactionStatusWait, status(recent))
+
+	db.First(&account, account.ID)
+	assert.Equal(t, int64(10000), account.Budget)
+
+	// running it again doesn't credit twice
+	tasks.ReconcilePaymentsTask(db, 15*time.Minute, 24*time.Hour)()
+	db.First(&account, account.ID)
+	assert.Equal(t, int64(10000), account.Budget)
+}
@@ -0,0 +1,224 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestSenderNumberPool(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+	john := models.Account{UserID: 1, Username: "john", IsActive: true, Budget: 1000}
+	db.Create(&john)
+	jane := models.Account{UserID: 2, Username: "jane", IsActive: true, Budget: 1000}
+	db.Create(&jane)
+	db.Create(&models.SubscriptionNumberPackage{Title: "2 Month", Price: 30, Duration: 2})
+	db.Create(&models.SubscriptionNumberPackage{Title: "Buy", Price: 300, Type: models.PackageTypeBuy})
+	db.Create(&models.SMSProvider{Name: "magfa", Enabled: true})
+
+	call := func(handler func(echo.Context, *gorm.DB) error, account models.Account, target, body string, id uint) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("account", account)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+
+	numbers := make(map[string]handlers.SenderNumberResponse)
+	t.Run("Create", func(t *testing.T) {
+		for _, body := range []string{
+			`{"number": "3000", "type": "default"}`,
+			`{"number": "3001", "type": "shared", "rentPrice": 10}`,
+			`{"number": "3002", "rentPrice": 40, "buyPrice": 400, "provider": "magfa"}`,
+			`{"number": "3003", "type": "vanity", "buyPrice": 900}`,
+		} {
+			rec := call(handlers.CreateSenderNumberHandler, admin, "/", body, 0)
+			assert.Equal(t, http.StatusOK, rec.Code, body)
+			var number handlers.SenderNumberResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &number))
+			numbers[number.Number] = number
+		}
+		assert.Equal(t, models.SenderTypeExclusive, numbers["3002"].Type)
+		assert.Equal(t, "magfa", numbers["3002"].Provider)
+
+		var defaultNumber models.SenderNumber
+		db.First(&defaultNumber, numbers["3000"].ID)
+		assert.True(t, defaultNumber.IsDefault)
+
+		for _, body := range []string{
+			`{"number": "3000"}`,
+			`{"number": "30a0"}`,
+			`{"number": "3004", "type": "premium"}`,
+			`{"number": "3004", "rentPrice": -1}`,
+			`{"number": "3004", "provider": "kavenegar"}`,
+			`{"type": "shared"}`,
+		} {
+			rec := call(handlers.CreateSenderNumberHandler, admin, "/", body, 0)
+			assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, body)
+		}
+	})
+
+	t.Run("RentWithNumberPrice", func(t *testing.T) {
+		rec := call(handlers.RentNumberHandler, john, "/", `{"senderNumber": "3002", "subscriptionNumberPackage": "2 Month"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		db.First(&john, john.ID)
+		assert.Equal(t, int64(1000-2*40), john.Budget)
+
+		// an exclusive number has a single holder
+		rec = call(handlers.RentNumberHandler, jane, "/", `{"senderNumber": "3002", "subscriptionNumberPackage": "2 Month"}`, 0)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("RentSharedNumber", func(t *testing.T) {
+		for _, account := range []models.Account{john, jane} {
+			rec := call(handlers.RentNumberHandler, account, "/", `{"senderNumber": "3001", "subscriptionNumberPackage": "2 Month"}`, 0)
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+		rec := call(handlers.RentNumberHandler, jane, "/", `{"senderNumber": "3001", "subscriptionNumberPackage": "2 Month"}`, 0)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		rec = call(handlers.BuyNumberHandler, jane, "/", `{"senderNumber": "3001"}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		var shared models.SenderNumber
+		db.First(&shared, numbers["3001"].ID)
+		assert.False(t, shared.IsExclusive)
+	})
+
+	t.Run("BuyWithNumberPrice", func(t *testing.T) {
+		db.Model(&jane).Update("budget", 500)
+		db.First(&jane, jane.ID)
+		rec := call(handlers.BuyNumberHandler, jane, "/", `{"senderNumber": "3003"}`, 0)
+		assert.Equal(t, http.StatusNotFound, rec.Code) // the price of the number is more than the budget
+
+		db.Model(&jane).Update("budget", 2000)
+		db.First(&jane, jane.ID)
+		rec = call(handlers.BuyNumberHandler, jane, "/", `{"senderNumber": "3003"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		db.First(&jane, jane.ID)
+		assert.Equal(t, int64(2000-900), jane.Budget)
+		assert.Equal(t, models.SenderTypeVanity, utils.SenderNumberType(db, "3003"))
+	})
+
+	t.Run("Holders", func(t *testing.T) {
+		rec := call(handlers.GetSenderNumberHandler, admin, "/", "", numbers["3001"].ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var shared handlers.SenderNumberResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &shared))
+		assert.Len(t, shared.Holders, 2)
+		assert.Equal(t, "john", shared.Holders[0].Username)
+		assert.Equal(t, "2 Month", shared.Holders[0].Package)
+		assert.NotNil(t, shared.Holders[0].EndDate)
+
+		rec = call(handlers.GetSenderNumberHandler, admin, "/", "", numbers["3003"].ID)
+		var vanity handlers.SenderNumberResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &vanity))
+		assert.Len(t, vanity.Holders, 1)
+		assert.True(t, vanity.Holders[0].Bought)
+		assert.Nil(t, vanity.Holders[0].EndDate)
+
+		var held []handlers.SenderNumberResponse
+		rec = call(handlers.ListSenderNumbersHandler, admin, "/?held=false", "", 0)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &held))
+		assert.Len(t, held, 1)
+		assert.Equal(t, "3000", held[0].Number)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		rec := call(handlers.UpdateSenderNumberHandler, admin, "/", `{"type": "vanity"}`, numbers["3002"].ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.UpdateSenderNumberHandler, admin, "/", `{"number": "3009"}`, numbers["3002"].ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = call(handlers.UpdateSenderNumberHandler, admin, "/", `{"rentPrice": 50, "provider": ""}`, numbers["3002"].ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var number handlers.SenderNumberResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &number))
+		assert.Equal(t, int64(50), number.RentPrice)
+		assert.Empty(t, number.Provider)
+		assert.Len(t, number.Holders, 1)
+	})
+
+	t.Run("ProviderBinding", func(t *testing.T) {
+		rec := call(handlers.UpdateSenderNumberHandler, admin, "/", `{"provider": "magfa"}`, numbers["3001"].ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "magfa", utils.SenderProvider(db, "3001"))
+		assert.Equal(t, "", utils.SenderProvider(db, "3000"))
+
+		message := &handlers.Message{Text: "hello", Source: "3001", Destination: "+989121234567"}
+		_, err := handlers.SendMessage(message, db)
+		assert.NoError(t, err)
+		assert.Equal(t, "magfa", message.Provider)
+
+		// the handlers send from the sender number, so its provider sends the messages
+		magfa := &fakeSender{}
+		utils.SetSMSSender("magfa", magfa)
+		defer utils.SetSMSSender("magfa", nil)
+		phoneBook := models.PhoneBook{AccountID: john.ID, Name: "Friends"}
+		db.Create(&phoneBook)
+		db.Create(&models.PhoneBookNumber{PhoneBookID: phoneBook.ID, Username: "jane", Phone: "+989121234567"})
+
+		db.First(&john, john.ID)
+		rec = call(handlers.SendSingleSMSHandler, john, "/", `{"senderNumbers": "3001", "username": "jane", "message": "hello"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 1, magfa.Calls())
+
+		db.First(&john, john.ID)
+		sendToPhoneBooks := func(c echo.Context, db *gorm.DB) error {
+			return handlers.NewSmsPhoneBookHandler(db).SendMessageToPhoneBooksHandler(c)
+		}
+		rec = call(sendToPhoneBooks, john, "/", `{"senderNumbers": "3001", "phoneBooks": ["Friends"], "message": "hello"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 2, magfa.Calls())
+	})
+
+	t.Run("Retire", func(t *testing.T) {
+		rec := call(handlers.UpdateSenderNumberHandler, admin, "/", `{"retired": true}`, numbers["3000"].ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.False(t, utils.IsSenderNumberExist(context.Background(), db, "3000", john.UserID))
+		// john keeps the numbers he rented
+		assert.True(t, utils.IsSenderNumberExist(context.Background(), db, "3001", john.UserID))
+
+		rec = call(handlers.UpdateSenderNumberHandler, admin, "/", `{"retired": true}`, numbers["3001"].ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.GetAllSenderNumbersForSaleHandler, john, "/", "", 0)
+		assert.NotContains(t, rec.Body.String(), "3001")
+		rec = call(handlers.RentNumberHandler, john, "/", `{"senderNumber": "3001", "subscriptionNumberPackage": "2 Month"}`, 0)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		rec := call(handlers.DeleteSenderNumberHandler, admin, "/", "", numbers["3002"].ID)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		rec = call(handlers.DeleteSenderNumberHandler, admin, "/", "", numbers["3000"].ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.GetSenderNumberHandler, admin, "/", "", numbers["3000"].ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("target LIKE ?", "sender_number:%").Count(&count)
+		assert.Equal(t, int64(13), count)
+	})
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestSettings(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+
+	call := func(handler func(echo.Context, *gorm.DB) error, key, body string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("key")
+		c.SetParamValues(key)
+		c.Set("account", admin)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+
+	list := func() map[string]handlers.SettingResponse {
+		rec := call(handlers.ListSettingsHandler, "", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var settings []handlers.SettingResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &settings))
+		byKey := make(map[string]handlers.SettingResponse)
+		for _, setting := range settings {
+			byKey[setting.Key] = setting
+		}
+		return byKey
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		settings := list()
+		dueDays := settings[utils.SettingBillDueDays]
+		assert.Equal(t, "int", dueDays.Type)
+		assert.Equal(t, float64(utils.DefaultBillDueDays), dueDays.Value)
+		assert.False(t, dueDays.IsSet)
+		assert.True(t, dueDays.Declared)
+		assert.NotEmpty(t, dueDays.Description)
+
+		assert.Equal(t, utils.DefaultBillDueDays, utils.BillDueDays(db))
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		rec := call(handlers.UpdateSettingHandler, utils.SettingBillDueDays, `{"value": "20"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.UpdateSettingHandler, utils.SettingBillDueDays, `{"value": 2.5}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.UpdateSettingHandler, utils.SettingVATPercent, `{"value": 120}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.UpdateSettingHandler, "unknown", `{"value": 1}`)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		rec = call(handlers.AddConfigHandler, "", `{"name": "single sms", "value": -5}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		var count int64
+		db.Model(&models.Configuration{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("UpdateAndCache", func(t *testing.T) {
+		rec := call(handlers.UpdateSettingHandler, utils.SettingBillDueDays, `{"value": 20}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 20, utils.BillDueDays(db))
+
+		// the value is read from the cache until the settings change
+		db.Model(&models.Configuration{}).Where("name = ?", utils.SettingBillDueDays).Update("value", 30)
+		assert.Equal(t, 20, utils.BillDueDays(db))
+
+		rec = call(handlers.UpdateSettingHandler, utils.SettingBillDueDays, `{"value": 25}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 25, utils.BillDueDays(db))
+		assert.True(t, list()[utils.SettingBillDueDays].IsSet)
+
+		var count int64
+		db.Model(&models.Configuration{}).Where("name = ?", utils.SettingBillDueDays).Count(&count)
+		assert.Equal(t, int64(1), count)
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionConfigUpdate).Count(&count)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("UndeclaredConfiguration", func(t *testing.T) {
+		rec := call(handlers.AddConfigHandler, "", `{"name": "custom", "value": 1.5}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		custom := list()["custom"]
+		assert.False(t, custom.Declared)
+		assert.Equal(t, "float", custom.Type)
+		assert.Equal(t, 1.5, custom.Value)
+
+		rec = call(handlers.UpdateSettingHandler, "custom", `{"value": 2.5}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 2.5, list()["custom"].Value)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		rec := call(handlers.DeleteSettingHandler, utils.SettingBillDueDays, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, utils.DefaultBillDueDays, utils.BillDueDays(db))
+		assert.False(t, list()[utils.SettingBillDueDays].IsSet)
+
+		rec = call(handlers.DeleteSettingHandler, utils.SettingBillDueDays, "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionConfigDelete).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
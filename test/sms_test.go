@@ -51,7 +51,7 @@ func TestSendSingleSMSHandler(t *testing.T) {
 		PhoneBookID: phoneBook.ID,
 		Username:    "test",
 		Name:        "test",
-		Phone:       "09376304339",
+		Phone:       "+989376304339",
 	}
 	err = db.Create(&phonebooknumber).Error
 	assert.NoError(t, err)
@@ -227,6 +227,30 @@ func TestSendSingleSMSHandler(t *testing.T) {
 
 		assert.Equal(t, "SMS sent successfully", response.Message)
 	})
+
+	t.Run("StaleBudget", func(t *testing.T) {
+		// the account in the context still has the budget it had before the sends
+		send := func() *httptest.ResponseRecorder {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/sms/single", strings.NewReader(`{ "senderNumbers": "123456789", "message":"hello","username":"test" }`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("account", account)
+			assert.NoError(t, handlers.SendSingleSMSHandler(c, db))
+			return rec
+		}
+		assert.Equal(t, http.StatusOK, send().Code)
+		assert.Equal(t, http.StatusForbidden, send().Code)
+
+		var current models.Account
+		db.First(&current, account.ID)
+		assert.Equal(t, int64(0), current.Budget)
+		var spent int64
+		db.Model(&models.LedgerEntry{}).Where("account_id = ? AND kind = ?", account.ID, models.LedgerSpend).
+			Select("COALESCE(SUM(amount), 0)").Scan(&spent)
+		assert.Equal(t, int64(200), -spent)
+	})
 }
 
 func TestPeriodicSendSMSHandler(t *testing.T) {
@@ -260,7 +284,7 @@ func TestPeriodicSendSMSHandler(t *testing.T) {
 	assert.NoError(t, err)
 
 	phoneBookNumber1 := models.PhoneBookNumber{
-		Phone:       "09376304339",
+		Phone:       "+989376304339",
 		PhoneBookID: phoneBook.ID,
 		PhoneBook:   phoneBook,
 		Username:    "test",
@@ -471,5 +495,13 @@ func TestPeriodicSendSMSHandler(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
 		assert.Equal(t, "SMS scheduled successfully", rec.Body.String())
+
+		// the messages are charged when they are sent, not when they are scheduled
+		var current models.Account
+		db.First(&current, account.ID)
+		assert.Equal(t, int64(1000), current.Budget)
+		var count int64
+		db.Model(&models.LedgerEntry{}).Where("account_id = ? AND kind = ?", account.ID, models.LedgerSpend).Count(&count)
+		assert.Equal(t, int64(0), count)
 	})
 }
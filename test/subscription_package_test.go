@@ -0,0 +1,153 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestSubscriptionPackages(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	admin := models.Account{Username: "admin", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+	john := models.Account{UserID: 1, Username: "john", IsActive: true, Budget: 1000}
+	db.Create(&john)
+	db.Create(&models.SenderNumber{Number: "3001", Type: models.SenderTypeShared})
+	db.Create(&models.SenderNumber{Number: "3002"})
+
+	call := func(handler func(echo.Context, *gorm.DB) error, account models.Account, body string, id uint) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("account", account)
+
+		assert.NoError(t, handler(c, db))
+		return rec
+	}
+
+	packages := make(map[string]handlers.SubscriptionPackageResponse)
+	t.Run("Create", func(t *testing.T) {
+		for _, body := range []string{
+			`{"title": "10 Day", "price": 10, "duration": 10, "durationUnit": "day"}`,
+			`{"title": "3 Month", "price": 40, "duration": 3}`,
+			`{"title": "Buy", "price": 300, "type": "buy"}`,
+		} {
+			rec := call(handlers.CreateSubscriptionPackageHandler, admin, body, 0)
+			assert.Equal(t, http.StatusOK, rec.Code, body)
+			var subPackage handlers.SubscriptionPackageResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &subPackage))
+			packages[subPackage.Title] = subPackage
+		}
+		assert.Equal(t, models.DurationUnitMonth, packages["3 Month"].DurationUnit)
+		assert.True(t, packages["Buy"].IsActive)
+
+		for _, body := range []string{
+			`{"title": "Buy", "type": "buy"}`,
+			`{"title": "1 Week", "duration": 7, "durationUnit": "week"}`,
+			`{"title": "Lease", "type": "lease", "duration": 1}`,
+			`{"title": "Forever"}`,
+			`{"title": "Buy 2", "type": "buy", "duration": 1}`,
+			`{"title": "Free", "price": -1, "duration": 1}`,
+			`{"price": 10, "duration": 1}`,
+		} {
+			rec := call(handlers.CreateSubscriptionPackageHandler, admin, body, 0)
+			assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, body)
+		}
+	})
+
+	t.Run("RentForDays", func(t *testing.T) {
+		rec := call(handlers.RentNumberHandler, john, `{"senderNumber": "3001", "subscriptionNumberPackage": "10 Day"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var userNumber models.UserNumbers
+		db.Last(&userNumber)
+		assert.Equal(t, models.PackageTypeRent, userNumber.Type)
+		assert.WithinDuration(t, userNumber.StartDate.AddDate(0, 0, 10), userNumber.EndDate, time.Second)
+		db.First(&john, john.ID)
+		assert.Equal(t, int64(1000-10), john.Budget)
+
+		// a buy package can't be rented with
+		rec = call(handlers.RentNumberHandler, john, `{"senderNumber": "3002", "subscriptionNumberPackage": "Buy"}`, 0)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Buy", func(t *testing.T) {
+		rec := call(handlers.BuyNumberHandler, john, `{"senderNumber": "3002", "subscriptionNumberPackage": "3 Month"}`, 0)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		rec = call(handlers.BuyNumberHandler, john, `{"senderNumber": "3002"}`, 0)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var userNumber models.UserNumbers
+		db.Last(&userNumber)
+		assert.Equal(t, models.PackageTypeBuy, userNumber.Type)
+		assert.Equal(t, packages["Buy"].ID, userNumber.SubscriptionPackageID)
+		db.First(&john, john.ID)
+		assert.Equal(t, int64(1000-10-300), john.Budget)
+	})
+
+	t.Run("NoDuration", func(t *testing.T) {
+		// packages which were migrated without their duration
+		noDuration := models.SubscriptionNumberPackage{Title: "Special", Price: 5, Type: models.PackageTypeRent, IsActive: true}
+		db.Create(&noDuration)
+		defer db.Delete(&noDuration)
+
+		rec := call(handlers.RentNumberHandler, john, `{"senderNumber": "3001", "subscriptionNumberPackage": "Special"}`, 0)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		var userNumber models.UserNumbers
+		db.Where("type = ?", models.PackageTypeRent).First(&userNumber)
+		rec = call(handlers.RenewNumberHandler, john, `{"subscriptionNumberPackage": "Special"}`, userNumber.ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		db.First(&john, john.ID)
+		assert.Equal(t, int64(1000-10-300), john.Budget)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		rec := call(handlers.UpdateSubscriptionPackageHandler, admin, `{"type": "buy"}`, packages["3 Month"].ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = call(handlers.UpdateSubscriptionPackageHandler, admin, `{"duration": 0}`, packages["3 Month"].ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = call(handlers.UpdateSubscriptionPackageHandler, admin, `{"isActive": false}`, packages["10 Day"].ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.RentNumberHandler, john, `{"senderNumber": "3001", "subscriptionNumberPackage": "10 Day"}`, 0)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		var active []handlers.SubscriptionPackageResponse
+		rec = call(handlers.GetSubscriptionPackagesHandler, john, "", 0)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &active))
+		assert.Len(t, active, 2)
+		assert.Equal(t, "3 Month", active[0].Title)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		rec := call(handlers.DeleteSubscriptionPackageHandler, admin, "", packages["10 Day"].ID)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		rec = call(handlers.DeleteSubscriptionPackageHandler, admin, "", packages["3 Month"].ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = call(handlers.UpdateSubscriptionPackageHandler, admin, `{"price": 50}`, packages["3 Month"].ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("target LIKE ?", "subscription_package:%").Count(&count)
+		assert.Equal(t, int64(5), count)
+	})
+}
@@ -0,0 +1,170 @@
+package test
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 test vector, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	code, err := utils.TOTPCode(secret, time.Unix(59, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	assert.True(t, utils.ValidateTOTP(secret, "287082", time.Unix(59, 0)))
+	assert.True(t, utils.ValidateTOTP(secret, "287082", time.Unix(89, 0)), "Expected one period of drift to be accepted")
+	assert.False(t, utils.ValidateTOTP(secret, "287082", time.Unix(150, 0)))
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	user := models.User{FirstName: "testuser", LastName: "testuser", Phone: "09376304339", Email: "amir@gmail.com", NationalID: "0265670578"}
+	db.Create(&user)
+	hash, err := bcrypt.GenerateFromPassword([]byte("test123"), bcrypt.DefaultCost)
+	assert.NoError(t, err)
+	account := models.Account{UserID: user.ID, Username: "testuser", Password: string(hash), Token: "testtoken", IsActive: true}
+	db.Create(&account)
+
+	var recoveryCodes []string
+
+	t.Run("EnableTOTP", func(t *testing.T) {
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/accounts/2fa/totp/setup", nil), rec)
+		c.Set("account", account)
+
+		err := handlers.SetupTOTPHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var setup handlers.TOTPSetupResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &setup))
+		assert.True(t, strings.HasPrefix(setup.URL, "otpauth://totp/"))
+
+		code, err := utils.TOTPCode(setup.Secret, time.Now())
+		assert.NoError(t, err)
+
+		db.First(&account, account.ID)
+		req := httptest.NewRequest(http.MethodPost, "/accounts/2fa/totp/enable", strings.NewReader(`{"code":"`+code+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec = httptest.NewRecorder()
+		c = e.NewContext(req, rec)
+		c.Set("account", account)
+
+		err = handlers.EnableTOTPHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var res handlers.RecoveryCodesResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Len(t, res.RecoveryCodes, 10)
+		recoveryCodes = res.RecoveryCodes
+
+		var auditLogs []models.AuditLog
+		db.Where("target = ?", fmt.Sprintf("account:%d", account.ID)).Order("id").Find(&auditLogs)
+		if assert.Len(t, auditLogs, 2) {
+			assert.Equal(t, models.AuditActionTwoFactorSetup, auditLogs[0].Action)
+			assert.Equal(t, models.AuditActionTwoFactorEnable, auditLogs[1].Action)
+			for _, auditLog := range auditLogs {
+				assert.NotContains(t, auditLog.Before+auditLog.After, setup.Secret)
+				assert.NotContains(t, auditLog.Before+auditLog.After, recoveryCodes[0])
+			}
+		}
+	})
+
+	login := func(t *testing.T) handlers.TwoFactorChallengeResponse {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/accounts/login", strings.NewReader(`{"username": "testuser", "password": "test123"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+
+		err := handlers.LoginHandler(e.NewContext(req, rec), db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+
+		var res handlers.TwoFactorChallengeResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, models.TwoFactorTOTP, res.Method)
+		return res
+	}
+
+	verify := func(challenge, code string) *httptest.ResponseRecorder {
+		e := echo.New()
+		body := fmt.Sprintf(`{"challenge": "%s", "code": "%s"}`, challenge, code)
+		req := httptest.NewRequest(http.MethodPost, "/accounts/login/verify", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+
+		err := handlers.VerifyTwoFactorHandler(e.NewContext(req, rec), db)
+		assert.NoError(t, err)
+		return rec
+	}
+
+	t.Run("LoginWithTOTP", func(t *testing.T) {
+		challenge := login(t)
+
+		db.First(&account, account.ID)
+		code, err := utils.TOTPCode(account.TOTPSecret, time.Now())
+		assert.NoError(t, err)
+
+		rec := verify(challenge.Challenge, code)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		// challenge can't be used twice
+		rec = verify(challenge.Challenge, code)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("LoginWithRecoveryCode", func(t *testing.T) {
+		challenge := login(t)
+		rec := verify(challenge.Challenge, recoveryCodes[0])
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		// recovery codes are single use
+		challenge = login(t)
+		rec = verify(challenge.Challenge, recoveryCodes[0])
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("TooManyAttempts", func(t *testing.T) {
+		challenge := login(t)
+		for i := 0; i < 5; i++ {
+			rec := verify(challenge.Challenge, "000000x")
+			assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		}
+		rec := verify(challenge.Challenge, "000000x")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	})
+
+	t.Run("DisableWithWrongPassword", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/accounts/2fa/disable", strings.NewReader(`{"password":"wrong"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("account", account)
+
+		err := handlers.DisableTwoFactorHandler(c, db)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+}
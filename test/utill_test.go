@@ -50,6 +50,44 @@ func TestValidatePhone(t *testing.T) {
 	})
 }
 
+func TestNormalizePhone(t *testing.T) {
+	t.Run("IranianFormats", func(t *testing.T) {
+		for _, phone := range []string{"09121234567", "9121234567", "+989121234567", "00989121234567", "989121234567", "0912 123-4567", "+98 (912) 123.4567"} {
+			normalized, err := utils.NormalizePhone(phone, utils.IranCallingCode)
+			assert.NoError(t, err, phone)
+			assert.Equal(t, "+989121234567", normalized, phone)
+		}
+	})
+
+	t.Run("DefaultCountry", func(t *testing.T) {
+		normalized, err := utils.NormalizePhone("07911123456", "+44")
+		assert.NoError(t, err)
+		assert.Equal(t, "+447911123456", normalized)
+
+		normalized, err = utils.NormalizePhone("+989121234567", "44")
+		assert.NoError(t, err)
+		assert.Equal(t, "+989121234567", normalized)
+	})
+
+	t.Run("UnsupportedCountry", func(t *testing.T) {
+		_, err := utils.NormalizePhone("+2348031234567", utils.IranCallingCode)
+		assert.ErrorIs(t, err, utils.ErrUnsupportedCountry)
+	})
+
+	t.Run("InvalidPhone", func(t *testing.T) {
+		for _, phone := range []string{"0812123456", "091212345678", "+98912abc4567", "+4412345", ""} {
+			_, err := utils.NormalizePhone(phone, utils.IranCallingCode)
+			assert.ErrorIs(t, err, utils.ErrInvalidPhone, phone)
+		}
+	})
+
+	t.Run("CallingCode", func(t *testing.T) {
+		assert.Equal(t, "+98", utils.PhoneCallingCode("+989121234567"))
+		assert.Equal(t, "+44", utils.PhoneCallingCode("+447911123456"))
+		assert.Equal(t, "", utils.PhoneCallingCode("+2348031234567"))
+	})
+}
+
 func TestParseInt(t *testing.T) {
 	t.Run("ValidInput", func(t *testing.T) {
 		validInput := "123"
@@ -134,7 +172,7 @@ func TestValidateUser(t *testing.T) {
 		assert.Equal(t, "John", user.FirstName)
 		assert.Equal(t, "Doe", user.LastName)
 		assert.Equal(t, "johndoe@example.com", user.Email)
-		assert.Equal(t, "09376304339", user.Phone)
+		assert.Equal(t, "+989376304339", user.Phone)
 		assert.Equal(t, "0817762590", user.NationalID)
 	})
 
@@ -382,14 +420,16 @@ func TestLogin(t *testing.T) {
 		msg, _, err := utils.Login("invaliduser", "test123", false, db)
 
 		assert.Error(t, err, "Expected error in Login")
-		assert.Equal(t, "Invalid Username", msg, "Expected message to be 'Invalid Username'")
+		assert.ErrorIs(t, err, utils.ErrInvalidCredentials)
+		assert.Equal(t, utils.InvalidCredentialsMessage, msg, "Expected the same message as a wrong password")
 	})
 
 	t.Run("InvalidPassword", func(t *testing.T) {
 		msg, _, err := utils.Login("testuser", "wrongpassword", false, db)
 
 		assert.Error(t, err, "Expected error in Login")
-		assert.Equal(t, "Wrong Password", msg, "Expected message to be 'Wrong Password'")
+		assert.ErrorIs(t, err, utils.ErrInvalidCredentials)
+		assert.Equal(t, utils.InvalidCredentialsMessage, msg, "Expected the same message as an invalid username")
 	})
 
 	t.Run("InactiveAccount", func(t *testing.T) {
@@ -409,10 +449,9 @@ func TestLogin(t *testing.T) {
 
 		msg, resultAccount, err := utils.Login("testuser", "test123", true, db)
 
-		assert.NoError(t, err, "Expected no error in Login")
-		assert.Equal(t, "OK", msg, "Expected message to be 'OK'")
+		assert.ErrorIs(t, err, utils.ErrTwoFactorRequired, "Expected admins to need two factor authentication")
+		assert.Equal(t, "Two Factor Authentication Required", msg)
 		assert.Equal(t, account.ID, resultAccount.ID, "Expected account ID to match")
-		assert.NotEmpty(t, resultAccount.Token, "Expected account token to be generated")
 		assert.True(t, resultAccount.IsAdmin, "Expected account to be admin")
 	})
 }
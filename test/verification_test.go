@@ -0,0 +1,172 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"SMS-panel/handlers"
+	"SMS-panel/models"
+	"SMS-panel/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestVerificationAndPasswordReset(t *testing.T) {
+	db, err := utils.CreateTestDatabase()
+	assert.NoError(t, err)
+	defer utils.CloseTestDatabase(db)
+
+	smtpServer, err := utils.StartTestSMTPServer()
+	assert.NoError(t, err)
+	defer smtpServer.Close()
+	utils.SetMailer(utils.NewSMTPMailer(smtpServer.Host(), smtpServer.Port(), "", "", "no-reply@sms-panel.local"))
+	defer utils.SetMailer(utils.LogMailer{})
+
+	assert.NoError(t, db.Create(&models.SenderNumber{Number: "10001", IsDefault: true}).Error)
+
+	post := func(handler func(echo.Context, *gorm.DB) error, body interface{}) *httptest.ResponseRecorder {
+		jsonData, err := json.Marshal(body)
+		assert.NoError(t, err)
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(jsonData))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec), db))
+		return rec
+	}
+
+	lastSMS := func() string {
+		var sms models.SMSMessage
+		db.Where("recipient = ?", "+989376304339").Order("id desc").First(&sms)
+		return sms.Message
+	}
+
+	lastMail := func() string {
+		mails := smtpServer.Mails()
+		if !assert.NotEmpty(t, mails) {
+			return ""
+		}
+		assert.Equal(t, []string{"johndoe@example.com"}, mails[len(mails)-1].To)
+		return mails[len(mails)-1].Data
+	}
+
+	rec := post(handlers.RegisterHandler, map[string]interface{}{
+		"firstname":  "John",
+		"lastname":   "Doe",
+		"email":      "johndoe@example.com",
+		"phone":      "09376304339",
+		"nationalid": "0817762590",
+		"username":   "johndoe",
+		"password":   "password",
+	})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	t.Run("UnverifiedAccountCantLogin", func(t *testing.T) {
+		var account models.Account
+		db.Where("username = ?", "johndoe").First(&account)
+		assert.True(t, account.PendingVerification)
+		assert.Empty(t, account.Token)
+
+		msg, _, err := utils.Login("johndoe", "password", false, db)
+		assert.Error(t, err)
+		assert.Equal(t, "Please Verify Your Phone Number Or Email", msg)
+	})
+
+	t.Run("VerifyPhone", func(t *testing.T) {
+		code := strings.TrimPrefix(lastSMS(), "Your verification code: ")
+
+		rec := post(handlers.VerifyPhoneHandler, handlers.VerifyPhoneRequest{Username: "johndoe", Code: "wrong"})
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = post(handlers.VerifyPhoneHandler, handlers.VerifyPhoneRequest{Username: "johndoe", Code: code})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		// code can be used once
+		rec = post(handlers.VerifyPhoneHandler, handlers.VerifyPhoneRequest{Username: "johndoe", Code: code})
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		_, account, err := utils.Login("johndoe", "password", false, db)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, account.Token)
+	})
+
+	t.Run("VerifyEmail", func(t *testing.T) {
+		token := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(lastMail())
+		if !assert.Len(t, token, 2) {
+			return
+		}
+
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/accounts/verify/email?token="+token[1], nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handlers.VerifyEmailHandler(e.NewContext(req, rec), db))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var user models.User
+		db.Where("email = ?", "johndoe@example.com").First(&user)
+		assert.NotNil(t, user.EmailVerifiedAt)
+		assert.NotNil(t, user.PhoneVerifiedAt)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionAccountVerify).Count(&count)
+		assert.NotZero(t, count)
+	})
+
+	t.Run("ResetPasswordByEmail", func(t *testing.T) {
+		rec := post(handlers.ForgotPasswordHandler, handlers.ForgotPasswordRequest{Username: "johndoe", Channel: "email"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		token := regexp.MustCompile(`reset token: ([0-9a-f]+)`).FindStringSubmatch(lastMail())
+		if !assert.Len(t, token, 2) {
+			return
+		}
+
+		rec = post(handlers.ResetPasswordHandler, handlers.ResetPasswordRequest{Token: token[1], Password: "newpassword"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		_, _, err := utils.Login("johndoe", "newpassword", false, db)
+		assert.NoError(t, err)
+
+		// token can be used once
+		rec = post(handlers.ResetPasswordHandler, handlers.ResetPasswordRequest{Token: token[1], Password: "other"})
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		var auditLogs []models.AuditLog
+		db.Where("action IN ?", []string{models.AuditActionPasswordForgot, models.AuditActionPasswordReset}).Order("id").Find(&auditLogs)
+		if assert.Len(t, auditLogs, 2) {
+			assert.Equal(t, models.AuditActionPasswordReset, auditLogs[1].Action)
+			assert.NotZero(t, auditLogs[1].ActorID)
+			assert.NotContains(t, auditLogs[0].After, token[1])
+		}
+	})
+
+	t.Run("ResetPasswordBySMS", func(t *testing.T) {
+		rec := post(handlers.ForgotPasswordHandler, handlers.ForgotPasswordRequest{Username: "johndoe", Channel: "sms"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		token := strings.TrimPrefix(lastSMS(), "Your password reset token: ")
+
+		// a new request expires the previous token
+		rec = post(handlers.ForgotPasswordHandler, handlers.ForgotPasswordRequest{Username: "johndoe", Channel: "sms"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = post(handlers.ResetPasswordHandler, handlers.ResetPasswordRequest{Token: token, Password: "other"})
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		token = strings.TrimPrefix(lastSMS(), "Your password reset token: ")
+		rec = post(handlers.ResetPasswordHandler, handlers.ResetPasswordRequest{Token: token, Password: "other"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("UnknownUsernameLooksTheSame", func(t *testing.T) {
+		known := post(handlers.ForgotPasswordHandler, handlers.ForgotPasswordRequest{Username: "johndoe", Channel: "email"})
+		unknown := post(handlers.ForgotPasswordHandler, handlers.ForgotPasswordRequest{Username: "nobody", Channel: "email"})
+		assert.Equal(t, known.Code, unknown.Code)
+		assert.Equal(t, known.Body.String(), unknown.Body.String())
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"SMS-panel/models"
@@ -13,6 +14,20 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	ErrTwoFactorRequired  = errors.New("two factor authentication required")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrLoginLocked        = errors.New("login is locked")
+)
+
+// Same message for unknown usernames and wrong passwords, so usernames can't be discovered
+const InvalidCredentialsMessage = "Invalid Username Or Password"
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
 // this function used to check user properties validation
 func ValidateUser(jsonBody map[string]interface{}) (string, models.User, error) {
 	msg := "OK"
@@ -37,10 +52,12 @@ func ValidateUser(jsonBody map[string]interface{}) (string, models.User, error)
 	}
 
 	// Check Phone Number Validation
-	if !ValidatePhone(user.Phone) {
+	phone, err := NormalizePhone(user.Phone, IranCallingCode)
+	if err != nil {
 		msg = "Invalid Phone Number"
 		return msg, models.User{}, errors.New("")
 	}
+	user.Phone = phone
 
 	// Check Email Validation
 	if !ValidateEmail(user.Email) {
@@ -117,21 +134,7 @@ func CreateAccount(user_id int, username string, is_admin bool, password string,
 	}
 
 	// generate token
-	var token *jwt.Token
-	if is_admin {
-		token = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id":    account.ID,
-			"exp":   time.Now().Add(time.Hour).Unix(),
-			"admin": true,
-		})
-	} else {
-		token = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id":    account.ID,
-			"exp":   time.Now().Add(time.Hour).Unix(),
-			"admin": false,
-		})
-	}
-	tokenString, err := token.SignedString([]byte(os.Getenv("SECRET")))
+	tokenString, err := GenerateToken(account.ID, is_admin)
 	if err != nil {
 		msg = "Failed To Create Token"
 		return msg, models.Account{}, errors.New("")
@@ -151,47 +154,44 @@ func Login(username, password string, is_admin bool, db *gorm.DB) (string, model
 
 	db.Where("username = ?", username).First(&account)
 
-	// Account Not Found
+	// Account Not Found, compare with a dummy hash so it takes as long as a wrong password
 	if account.ID == 0 {
-		msg = "Invalid Username"
-		return msg, models.Account{}, errors.New("")
+		dummyPasswordHashOnce.Do(func() {
+			dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return InvalidCredentialsMessage, models.Account{}, ErrInvalidCredentials
 	}
 
 	// Incorrect Password
 	err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password))
 	if err != nil {
-		msg = "Wrong Password"
-		return msg, models.Account{}, errors.New("")
+		return InvalidCredentialsMessage, models.Account{}, ErrInvalidCredentials
 	}
 
-	if is_admin {
-		if !account.IsAdmin {
-			msg = "You are not admin!"
-			return msg, models.Account{}, errors.New("")
-		}
+	// Not Admin Accounts Can't Log In As Admin
+	if is_admin && !account.IsAdmin {
+		return InvalidCredentialsMessage, models.Account{}, ErrInvalidCredentials
 	}
-	// Account isn't active
-	if !account.IsActive {
+	// Account isn't active, accounts which are suspended for an overdue bill can log in to pay it
+	if !account.IsActive && account.SuspendedAt == nil {
 		msg = "Your Account Isn't Active"
 		return msg, models.Account{}, errors.New("")
 	}
 
-	var token *jwt.Token
-	if is_admin {
-		token = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id":    account.ID,
-			"exp":   time.Now().Add(time.Hour).Unix(),
-			"admin": true,
-		})
-	} else {
-		token = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id":    account.ID,
-			"exp":   time.Now().Add(time.Hour).Unix(),
-			"admin": false,
-		})
+	// Registered Account Hasn't Verified Its Phone Number Or Email Yet
+	if account.PendingVerification {
+		msg = "Please Verify Your Phone Number Or Email"
+		return msg, models.Account{}, errors.New("")
 	}
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("SECRET")))
+	// Two factor authentication is mandatory for admins and optional for others
+	if account.IsAdmin || account.TwoFactorMethod != "" {
+		msg = "Two Factor Authentication Required"
+		return msg, account, ErrTwoFactorRequired
+	}
+
+	tokenString, err := GenerateToken(account.ID, is_admin)
 	if err != nil {
 		msg = "Failed To Create Token"
 		return msg, models.Account{}, errors.New("")
@@ -202,3 +202,13 @@ func Login(username, password string, is_admin bool, db *gorm.DB) (string, model
 	db.Save(&account)
 	return msg, account, nil
 }
+
+// this function generates a signed token for the account
+func GenerateToken(account_id uint, is_admin bool) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":    account_id,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"admin": is_admin,
+	})
+	return token.SignedString([]byte(os.Getenv("SECRET")))
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Days which a postpaid account has to pay its bill, unless the "bill due days"
+// configuration sets it.
+const DefaultBillDueDays = 15
+
+var ErrBillExists = errors.New("Bill Of The Period Is Already Issued")
+
+// This Function Returns The Budget Which The Account Can Spend, Postpaid Accounts
+// Can Spend Their Credit Limit Under Zero.
+func AvailableBudget(account models.Account) int64 {
+	return account.Budget + account.CreditLimit
+}
+
+// This Function Returns The Days Which Postpaid Accounts Have To Pay Their Bills.
+func BillDueDays(db *gorm.DB) int {
+	return int(SettingInt(db, SettingBillDueDays))
+}
+
+// This Function Returns The First Moment Of The Month Of t.
+func MonthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// This Function Returns The Spending Of The Account In The Period.
+func spendingBetween(db *gorm.DB, accountID uint, from, to time.Time) (int64, error) {
+	var spent int64
+	err := db.Model(&models.LedgerEntry{}).
+		Where("account_id = ? AND kind = ? AND created_at >= ? AND created_at < ?", accountID, models.LedgerSpend, from, to).
+		Select("COALESCE(SUM(amount), 0)").Scan(&spent).Error
+	return -spent, err
+}
+
+// This Function Issues The Bill Of The Account For The Month Which Starts At periodStart.
+// The Bill's Amount Is The Usage Of The Month Which The Budget Didn't Cover, A Bill
+// Without Amount Is Issued As Paid.
+func IssueBill(db *gorm.DB, accountID uint, periodStart time.Time) (models.Bill, error) {
+	var count int64
+	if err := db.Model(&models.Bill{}).Where("account_id = ? AND period_start = ?", accountID, periodStart).Count(&count).Error; err != nil {
+		return models.Bill{}, err
+	}
+	if count > 0 {
+		return models.Bill{}, ErrBillExists
+	}
+
+	var account models.Account
+	if err := db.First(&account, accountID).Error; err != nil {
+		return models.Bill{}, err
+	}
+
+	periodEnd := periodStart.AddDate(0, 1, 0)
+	usage, err := spendingBetween(db, accountID, periodStart, periodEnd)
+	if err != nil {
+		return models.Bill{}, err
+	}
+
+	// usage after the period isn't billed yet
+	later, err := spendingBetween(db, accountID, periodEnd, time.Now().Add(time.Second))
+	if err != nil {
+		return models.Bill{}, err
+	}
+	// and the debt of the earlier bills is already billed
+	var unpaid int64
+	err = db.Model(&models.Bill{}).Where("account_id = ? AND status = ?", accountID, models.BillStatusUnpaid).
+		Select("COALESCE(SUM(amount), 0)").Scan(&unpaid).Error
+	if err != nil {
+		return models.Bill{}, err
+	}
+	amount := -(account.Budget + later + unpaid)
+	if amount > usage {
+		amount = usage
+	}
+	if amount < 0 {
+		amount = 0
+	}
+
+	now := time.Now()
+	bill := models.Bill{
+		AccountID:   accountID,
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+		Usage:       usage,
+		Amount:      amount,
+		Status:      models.BillStatusUnpaid,
+		DueAt:       now.AddDate(0, 0, BillDueDays(db)),
+		CreatedAt:   now,
+	}
+	if amount == 0 {
+		bill.Status = models.BillStatusPaid
+		bill.PaidAt = &now
+	}
+	return bill, db.Create(&bill).Error
+}
+
+// This Function Marks The Bills Which The Budget Of The Account Covers As Paid,
+// Oldest First, And Reactivates The Account When It Doesn't Have Overdue Bills Anymore.
+func SettleBills(db *gorm.DB, accountID uint) error {
+	var account models.Account
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, accountID).Error; err != nil {
+		return err
+	}
+
+	var bills []models.Bill
+	err := db.Where("account_id = ? AND status = ?", accountID, models.BillStatusUnpaid).
+		Order("period_start").Find(&bills).Error
+	if err != nil {
+		return err
+	}
+
+	// the debt which isn't covered is of the latest bills and of the usage which isn't billed yet
+	var unbilled int64
+	if len(bills) > 0 {
+		unbilled, err = spendingBetween(db, accountID, bills[len(bills)-1].PeriodEnd, time.Now().Add(time.Second))
+		if err != nil {
+			return err
+		}
+	}
+	var remaining int64
+	for _, bill := range bills {
+		remaining += bill.Amount
+	}
+
+	debt := -account.Budget
+	now := time.Now()
+	for _, bill := range bills {
+		if debt > remaining-bill.Amount+unbilled {
+			break
+		}
+		remaining -= bill.Amount
+		err := db.Model(&bill).Updates(map[string]interface{}{"status": models.BillStatusPaid, "paid_at": &now}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if account.SuspendedAt == nil {
+		return nil
+	}
+	var overdue int64
+	err = db.Model(&models.Bill{}).
+		Where("account_id = ? AND status = ? AND due_at < ?", accountID, models.BillStatusUnpaid, now).
+		Count(&overdue).Error
+	if err != nil || overdue > 0 {
+		return err
+	}
+	return db.Model(&account).Updates(map[string]interface{}{"is_active": true, "suspended_at": nil}).Error
+}
+
+// This Function Deactivates The Active Accounts Which Have Overdue Bills, And Returns Their IDs.
+func SuspendOverdueAccounts(db *gorm.DB) ([]uint, error) {
+	var accountIDs []uint
+	err := db.Model(&models.Bill{}).
+		Joins("JOIN accounts ON accounts.id = bills.account_id").
+		Where("bills.status = ? AND bills.due_at < ? AND accounts.is_active = ?", models.BillStatusUnpaid, time.Now(), true).
+		Distinct().Pluck("bills.account_id", &accountIDs).Error
+	if err != nil || len(accountIDs) == 0 {
+		return nil, err
+	}
+
+	err = db.Model(&models.Account{}).Where("id IN ?", accountIDs).
+		Updates(map[string]interface{}{"is_active": false, "suspended_at": time.Now()}).Error
+	return accountIDs, err
+}
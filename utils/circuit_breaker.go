@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// States of the circuit of a provider. Messages aren't sent through a provider whose
+// circuit is open, after a while a single message is sent through it in the half-open
+// state, and its circuit closes again when that message is sent.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// ProviderHealth is the status of the circuit of a provider since the server started.
+type ProviderHealth struct {
+	State string `json:"state" example:"closed"`
+	// ConsecutiveFailures are the failures since the last sent message
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Sent                int64      `json:"sent"`
+	Failed              int64      `json:"failed"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastFailureAt       *time.Time `json:"lastFailureAt,omitempty"`
+	// OpenedAt is when the circuit opened, it is empty when the circuit is closed
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+}
+
+// CircuitBreaker stops sending messages through a provider after it fails a number
+// of times in a row.
+type CircuitBreaker struct {
+	mu      sync.Mutex
+	health  ProviderHealth
+	probing bool
+}
+
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{health: ProviderHealth{State: CircuitClosed}}
+}
+
+// Allow reports whether a message can be sent through the provider. An open circuit
+// becomes half-open after openFor, and lets a single message through.
+func (b *CircuitBreaker) Allow(openFor time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.health.State {
+	case CircuitOpen:
+		if time.Since(*b.health.OpenedAt) < openFor {
+			return false
+		}
+		b.health.State = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success closes the circuit after a message is sent through the provider.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.health.Sent++
+	b.health.ConsecutiveFailures = 0
+	b.health.State = CircuitClosed
+	b.health.OpenedAt = nil
+	b.probing = false
+}
+
+// Failure counts a failed message, the circuit opens after threshold failures in a
+// row, or right away when it is half-open.
+func (b *CircuitBreaker) Failure(err error, threshold int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.health.Failed++
+	b.health.ConsecutiveFailures++
+	b.health.LastError = err.Error()
+	b.health.LastFailureAt = &now
+	if b.health.State == CircuitHalfOpen || b.health.ConsecutiveFailures >= threshold {
+		b.health.State = CircuitOpen
+		b.health.OpenedAt = &now
+	}
+	b.probing = false
+}
+
+// Reset closes the circuit, e.g. after an admin sees the provider is up again.
+func (b *CircuitBreaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.health.State = CircuitClosed
+	b.health.ConsecutiveFailures = 0
+	b.health.OpenedAt = nil
+	b.probing = false
+}
+
+// Health returns the status of the circuit.
+func (b *CircuitBreaker) Health() ProviderHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.health
+}
+
+// CircuitBreakers keeps a circuit breaker for each provider.
+type CircuitBreakers struct {
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+func NewCircuitBreakers() *CircuitBreakers {
+	return &CircuitBreakers{breakers: make(map[string]*CircuitBreaker)}
+}
+
+// ProviderBreakers are the circuit breakers of the providers which messages are sent through.
+var ProviderBreakers = NewCircuitBreakers()
+
+// Get returns the circuit breaker of the provider.
+func (c *CircuitBreakers) Get(provider string) *CircuitBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	breaker, ok := c.breakers[provider]
+	if !ok {
+		breaker = NewCircuitBreaker()
+		c.breakers[provider] = breaker
+	}
+	return breaker
+}
+
+// Clear removes the circuit breakers of all providers.
+func (c *CircuitBreakers) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.breakers = make(map[string]*CircuitBreaker)
+}
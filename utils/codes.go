@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"os"
+)
+
+// This Function Generates A Random Numeric Code With Input Length.
+func GenerateNumericCode(length int) (string, error) {
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}
+
+// This Function Generates A Random Hex Token With Input Number Of Bytes.
+func GenerateRandomToken(size int) (string, error) {
+	token := make([]byte, size)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// This Function Hashes Codes And Tokens Before Storing Them In Database.
+func HashCode(code string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET")))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// This Function Compares Input Code With A Hash Made By HashCode.
+func CheckCodeHash(code, hash string) bool {
+	return hmac.Equal([]byte(HashCode(code)), []byte(hash))
+}
@@ -1,3 +0,0 @@
-package utils
-
-const SUBSCRIOPTION_PACKAGE_BUY_ID uint = 666
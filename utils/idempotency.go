@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyTTL is how long the response to an idempotent request is replayed.
+const IdempotencyTTL = 24 * time.Hour
+
+var (
+	ErrIdempotencyConflict   = errors.New("Idempotency Key Is Used For Another Request")
+	ErrIdempotencyInProgress = errors.New("Request With This Idempotency Key Is In Progress")
+)
+
+// This Function Hashes The Parts Of A Request Which Must Be Same When It Is Retried.
+func IdempotencyRequestHash(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// This Function Reserves The Idempotency Key Of An Account For A Request.
+// It Returns The Stored Key With Completed True If The Request Is Already Done,
+// ErrIdempotencyConflict If The Key Is Used For Another Request And
+// ErrIdempotencyInProgress If The First Request Isn't Done Yet.
+func BeginIdempotentRequest(db *gorm.DB, accountID uint, key, requestHash string) (models.IdempotencyKey, bool, error) {
+	now := time.Now()
+
+	// expired keys can be used again
+	err := db.Where("account_id = ? AND key = ? AND expires_at < ?", accountID, key, now).
+		Delete(&models.IdempotencyKey{}).Error
+	if err != nil {
+		return models.IdempotencyKey{}, false, err
+	}
+
+	record := models.IdempotencyKey{
+		AccountID:   accountID,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(IdempotencyTTL),
+		CreatedAt:   now,
+	}
+	if err := db.Create(&record).Error; err == nil {
+		return record, false, nil
+	}
+
+	// the key is reserved by another request
+	var existing models.IdempotencyKey
+	if err := db.Where("account_id = ? AND key = ?", accountID, key).First(&existing).Error; err != nil {
+		return models.IdempotencyKey{}, false, err
+	}
+	if existing.RequestHash != requestHash {
+		return existing, false, ErrIdempotencyConflict
+	}
+	if existing.CompletedAt == nil {
+		return existing, false, ErrIdempotencyInProgress
+	}
+	return existing, true, nil
+}
+
+// This Function Stores The Response Of An Idempotent Request To Be Replayed.
+func CompleteIdempotentRequest(db *gorm.DB, id uint, statusCode int, contentType string, body []byte) error {
+	now := time.Now()
+	return db.Model(&models.IdempotencyKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status_code":   statusCode,
+		"content_type":  contentType,
+		"response_body": body,
+		"completed_at":  &now,
+	}).Error
+}
+
+// This Function Releases An Idempotency Key So The Request Can Be Retried.
+func ReleaseIdempotencyKey(db *gorm.DB, id uint) error {
+	return db.Delete(&models.IdempotencyKey{}, id).Error
+}
+
+// This Function Deletes Expired Idempotency Keys.
+func PurgeIdempotencyKeys(db *gorm.DB) (int64, error) {
+	result := db.Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
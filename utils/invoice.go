@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sync"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultVATPercent is used when the "vat percent" configuration isn't set.
+const DefaultVATPercent = 10
+
+// InvoiceSeller is the company which issues the invoices.
+type InvoiceSeller struct {
+	Name         string
+	EconomicCode string
+	NationalID   string
+	Address      string
+	PostalCode   string
+	Phone        string
+}
+
+var (
+	invoiceSeller   = InvoiceSeller{Name: "SMS Panel"}
+	invoiceSellerMu sync.RWMutex
+)
+
+// SetInvoiceSeller replaces the company which is printed on invoices.
+func SetInvoiceSeller(seller InvoiceSeller) {
+	invoiceSellerMu.Lock()
+	defer invoiceSellerMu.Unlock()
+	invoiceSeller = seller
+}
+
+// GetInvoiceSeller returns the company which is printed on invoices.
+func GetInvoiceSeller() InvoiceSeller {
+	invoiceSellerMu.RLock()
+	defer invoiceSellerMu.RUnlock()
+	return invoiceSeller
+}
+
+// This Function Returns The VAT Percent Which Is Set In Configuration.
+func InvoiceVATPercent(db *gorm.DB) int {
+	return int(SettingInt(db, SettingVATPercent))
+}
+
+// This Function Issues The Invoice Of A Successful Transaction. The Amount Of The
+// Transaction Includes VAT.
+func IssueInvoice(db *gorm.DB, transaction models.Transaction) (models.Invoice, error) {
+	var account models.Account
+	if err := db.First(&account, transaction.AccountID).Error; err != nil {
+		return models.Invoice{}, err
+	}
+	var user models.User
+	if err := db.First(&user, account.UserID).Error; err != nil {
+		return models.Invoice{}, err
+	}
+
+	vatPercent := InvoiceVATPercent(db)
+	vat := transaction.Amount * int64(vatPercent) / int64(100+vatPercent)
+
+	issuedAt := time.Now()
+	if transaction.VerifiedAt != nil {
+		issuedAt = *transaction.VerifiedAt
+	}
+
+	invoice := models.Invoice{
+		Number:            fmt.Sprintf("TMP-%d", transaction.ID),
+		AccountID:         account.ID,
+		TransactionID:     transaction.ID,
+		Subtotal:          transaction.Amount - vat,
+		VATPercent:        vatPercent,
+		VAT:               vat,
+		Total:             transaction.Amount,
+		BuyerName:         user.FirstName + " " + user.LastName,
+		BuyerCompany:      user.CompanyName,
+		BuyerNationalID:   user.NationalID,
+		BuyerEconomicCode: user.EconomicCode,
+		BuyerAddress:      user.Address,
+		BuyerPostalCode:   user.PostalCode,
+		BuyerPhone:        user.Phone,
+		BuyerEmail:        user.Email,
+		IssuedAt:          issuedAt,
+		CreatedAt:         time.Now(),
+	}
+	if err := db.Create(&invoice).Error; err != nil {
+		return models.Invoice{}, err
+	}
+
+	// invoices are numbered in the order they are issued
+	invoice.Number = fmt.Sprintf("INV-%06d", invoice.ID)
+	if err := db.Model(&invoice).Update("number", invoice.Number).Error; err != nil {
+		return models.Invoice{}, err
+	}
+	return invoice, nil
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Invoice.Number}}</title>
+<style>
+body { font-family: sans-serif; margin: 40px; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border: 1px solid #999; padding: 6px; text-align: left; }
+.amount { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Invoice.Number}}</h1>
+<p>Date: {{.Invoice.IssuedAt.Format "2006-01-02"}}</p>
+<h2>Seller</h2>
+<p>
+{{.Seller.Name}}<br>
+{{if .Seller.EconomicCode}}Economic Code: {{.Seller.EconomicCode}}<br>{{end}}
+{{if .Seller.NationalID}}National ID: {{.Seller.NationalID}}<br>{{end}}
+{{if .Seller.Address}}Address: {{.Seller.Address}} {{.Seller.PostalCode}}<br>{{end}}
+{{if .Seller.Phone}}Phone: {{.Seller.Phone}}{{end}}
+</p>
+<h2>Buyer</h2>
+<p>
+{{if .Invoice.BuyerCompany}}{{.Invoice.BuyerCompany}}<br>{{end}}
+{{.Invoice.BuyerName}}<br>
+National ID: {{.Invoice.BuyerNationalID}}<br>
+{{if .Invoice.BuyerEconomicCode}}Economic Code: {{.Invoice.BuyerEconomicCode}}<br>{{end}}
+{{if .Invoice.BuyerAddress}}Address: {{.Invoice.BuyerAddress}} {{.Invoice.BuyerPostalCode}}<br>{{end}}
+Phone: {{.Invoice.BuyerPhone}}<br>
+Email: {{.Invoice.BuyerEmail}}
+</p>
+<table>
+<tr><th>Description</th><th class="amount">Amount (Rials)</th></tr>
+<tr><td>Account budget top-up (transaction {{.Invoice.TransactionID}})</td><td class="amount">{{.Invoice.Subtotal}}</td></tr>
+<tr><td>VAT ({{.Invoice.VATPercent}}%)</td><td class="amount">{{.Invoice.VAT}}</td></tr>
+<tr><th>Total</th><th class="amount">{{.Invoice.Total}}</th></tr>
+</table>
+</body>
+</html>
+`))
+
+// This Function Renders An Invoice As An HTML Page.
+func RenderInvoiceHTML(invoice models.Invoice) ([]byte, error) {
+	var page bytes.Buffer
+	err := invoiceTemplate.Execute(&page, struct {
+		Invoice models.Invoice
+		Seller  InvoiceSeller
+	}{invoice, GetInvoiceSeller()})
+	return page.Bytes(), err
+}
+
+// This Function Renders An Invoice As A PDF Document.
+func RenderInvoicePDF(invoice models.Invoice) []byte {
+	seller := GetInvoiceSeller()
+	lines := []string{
+		"Invoice " + invoice.Number,
+		"Date: " + invoice.IssuedAt.Format("2006-01-02"),
+		"",
+		"Seller: " + seller.Name,
+	}
+	if seller.EconomicCode != "" {
+		lines = append(lines, "Economic Code: "+seller.EconomicCode)
+	}
+	if seller.NationalID != "" {
+		lines = append(lines, "National ID: "+seller.NationalID)
+	}
+	if seller.Address != "" {
+		lines = append(lines, "Address: "+seller.Address+" "+seller.PostalCode)
+	}
+	if seller.Phone != "" {
+		lines = append(lines, "Phone: "+seller.Phone)
+	}
+
+	lines = append(lines, "", "Buyer: "+invoice.BuyerName)
+	if invoice.BuyerCompany != "" {
+		lines = append(lines, "Company: "+invoice.BuyerCompany)
+	}
+	lines = append(lines, "National ID: "+invoice.BuyerNationalID)
+	if invoice.BuyerEconomicCode != "" {
+		lines = append(lines, "Economic Code: "+invoice.BuyerEconomicCode)
+	}
+	if invoice.BuyerAddress != "" {
+		lines = append(lines, "Address: "+invoice.BuyerAddress+" "+invoice.BuyerPostalCode)
+	}
+	lines = append(lines,
+		"Phone: "+invoice.BuyerPhone,
+		"Email: "+invoice.BuyerEmail,
+		"",
+		fmt.Sprintf("Account budget top-up (transaction %d): %d Rials", invoice.TransactionID, invoice.Subtotal),
+		fmt.Sprintf("VAT (%d%%): %d Rials", invoice.VATPercent, invoice.VAT),
+		fmt.Sprintf("Total: %d Rials", invoice.Total),
+	)
+	return RenderTextPDF(lines)
+}
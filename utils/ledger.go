@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInsufficientBudget = errors.New("Insufficient Budget")
+
+// Record a change of the account's budget in the ledger.
+func AddLedgerEntry(db *gorm.DB, entry models.LedgerEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	return db.Create(&entry).Error
+}
+
+// Record the cost which is spent from the account's budget. The budget itself is
+// decreased by the caller, the promotional credits which will expire first are
+// consumed before the paid budget.
+func RecordSpending(db *gorm.DB, accountID uint, cost int64, reason string) error {
+	var promoCredits []models.PromoCredit
+	err := db.Where("account_id = ? AND remaining > 0 AND expires_at > ?", accountID, time.Now()).
+		Order("expires_at, id").Find(&promoCredits).Error
+	if err != nil {
+		return err
+	}
+
+	remaining := cost
+	for _, promoCredit := range promoCredits {
+		if remaining <= 0 {
+			break
+		}
+		consumed := promoCredit.Remaining
+		if consumed > remaining {
+			consumed = remaining
+		}
+		err := db.Model(&models.PromoCredit{}).Where("id = ?", promoCredit.ID).
+			Update("remaining", gorm.Expr("remaining - ?", consumed)).Error
+		if err != nil {
+			return err
+		}
+		remaining -= consumed
+	}
+
+	return AddLedgerEntry(db, models.LedgerEntry{
+		AccountID: accountID,
+		Kind:      models.LedgerSpend,
+		Amount:    -cost,
+		Reason:    reason,
+	})
+}
+
+// Add budget to the account. When expiresAt is set the budget is a promotional
+// credit, and the part of it which isn't spent is removed when it expires.
+func CreditBudget(db *gorm.DB, accountID, actorID uint, amount int64, reason string, expiresAt *time.Time) error {
+	entry := models.LedgerEntry{
+		AccountID: accountID,
+		Kind:      models.LedgerAdminCredit,
+		Amount:    amount,
+		Reason:    reason,
+		ActorID:   actorID,
+	}
+
+	if expiresAt != nil {
+		promoCredit := models.PromoCredit{
+			AccountID: accountID,
+			Amount:    amount,
+			Remaining: amount,
+			Reason:    reason,
+			ActorID:   actorID,
+			ExpiresAt: *expiresAt,
+			CreatedAt: time.Now(),
+		}
+		if err := db.Create(&promoCredit).Error; err != nil {
+			return err
+		}
+		entry.Kind = models.LedgerPromoCredit
+		entry.PromoCreditID = &promoCredit.ID
+	}
+
+	err := db.Model(&models.Account{}).Where("id = ?", accountID).
+		Update("budget", gorm.Expr("budget + ?", amount)).Error
+	if err != nil {
+		return err
+	}
+	if err := AddLedgerEntry(db, entry); err != nil {
+		return err
+	}
+	return SettleBills(db, accountID)
+}
+
+// Take the cost from the account's budget and record it as spent. The budget is
+// checked by the update itself, so parallel charges can't spend the same budget;
+// ErrInsufficientBudget is returned when the account can't afford the cost.
+func ChargeBudget(db *gorm.DB, accountID uint, cost int64, reason string) error {
+	result := db.Model(&models.Account{}).
+		Where("id = ? AND budget + credit_limit >= ?", accountID, cost).
+		Update("budget", gorm.Expr("budget - ?", cost))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientBudget
+	}
+	return RecordSpending(db, accountID, cost, reason)
+}
+
+// Give back the cost which was spent from the account's budget for something which
+// didn't happen, e.g. a message which couldn't be sent.
+func RefundSpending(db *gorm.DB, accountID uint, amount int64, reason string) error {
+	err := db.Model(&models.Account{}).Where("id = ?", accountID).
+		Update("budget", gorm.Expr("budget + ?", amount)).Error
+	if err != nil {
+		return err
+	}
+	return AddLedgerEntry(db, models.LedgerEntry{
+		AccountID: accountID,
+		Kind:      models.LedgerRefund,
+		Amount:    amount,
+		Reason:    reason,
+	})
+}
+
+// Remove budget from the account. The paid budget is removed first, promotional
+// credits are only reduced when the budget becomes less than them.
+func DebitBudget(db *gorm.DB, accountID, actorID uint, amount int64, reason string) error {
+	var account models.Account
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, accountID).Error; err != nil {
+		return err
+	}
+	if account.Budget < amount {
+		return ErrInsufficientBudget
+	}
+
+	budget := account.Budget - amount
+	if err := db.Model(&account).Update("budget", budget).Error; err != nil {
+		return err
+	}
+	if err := trimPromoCredits(db, accountID, budget); err != nil {
+		return err
+	}
+
+	return AddLedgerEntry(db, models.LedgerEntry{
+		AccountID: accountID,
+		Kind:      models.LedgerAdminDebit,
+		Amount:    -amount,
+		Reason:    reason,
+		ActorID:   actorID,
+	})
+}
+
+// Reduce the remaining promotional credits, latest expiring first, so they
+// aren't more than the budget.
+func trimPromoCredits(db *gorm.DB, accountID uint, budget int64) error {
+	var promoCredits []models.PromoCredit
+	err := db.Where("account_id = ? AND remaining > 0", accountID).
+		Order("expires_at desc, id desc").Find(&promoCredits).Error
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, promoCredit := range promoCredits {
+		total += promoCredit.Remaining
+	}
+
+	for _, promoCredit := range promoCredits {
+		if total <= budget {
+			break
+		}
+		reduced := total - budget
+		if reduced > promoCredit.Remaining {
+			reduced = promoCredit.Remaining
+		}
+		err := db.Model(&models.PromoCredit{}).Where("id = ?", promoCredit.ID).
+			Update("remaining", promoCredit.Remaining-reduced).Error
+		if err != nil {
+			return err
+		}
+		total -= reduced
+	}
+	return nil
+}
+
+// Remove the unspent part of an expired promotional credit from the account's budget.
+func ExpirePromoCredit(db *gorm.DB, promoCreditID uint) error {
+	tx := db.Begin()
+
+	var promoCredit models.PromoCredit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&promoCredit, promoCreditID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if promoCredit.Remaining <= 0 || promoCredit.ExpiresAt.After(time.Now()) {
+		tx.Rollback()
+		return nil
+	}
+
+	var account models.Account
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, promoCredit.AccountID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	expired := promoCredit.Remaining
+	if expired > account.Budget {
+		expired = account.Budget
+	}
+	// the budget of a postpaid account may be under zero
+	if expired < 0 {
+		expired = 0
+	}
+
+	if err := tx.Model(&account).Update("budget", account.Budget-expired).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Model(&promoCredit).Update("remaining", 0).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	err := AddLedgerEntry(tx, models.LedgerEntry{
+		AccountID:     promoCredit.AccountID,
+		Kind:          models.LedgerPromoExpire,
+		Amount:        -expired,
+		Reason:        "Promotional credit expired",
+		PromoCreditID: &promoCredit.ID,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
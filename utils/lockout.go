@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// Failed logins older than the window are forgotten.
+const (
+	loginFailureWindow = 15 * time.Minute
+	maxLoginDelay      = time.Minute
+)
+
+// lockoutPolicy delays logins progressively after some failures and locks them after more.
+type lockoutPolicy struct {
+	delayAfter   int
+	lockAfter    int
+	lockDuration time.Duration
+}
+
+var loginLockoutPolicies = map[string]lockoutPolicy{
+	models.LoginAttemptUsername: {delayAfter: 3, lockAfter: 10, lockDuration: 15 * time.Minute},
+	// an IP address may be shared by many users
+	models.LoginAttemptIP: {delayAfter: 10, lockAfter: 30, lockDuration: 15 * time.Minute},
+}
+
+// lockFor returns how long logins are refused after the number of failures
+func (p lockoutPolicy) lockFor(failures int) time.Duration {
+	switch {
+	case failures >= p.lockAfter:
+		return p.lockDuration
+	case failures >= p.delayAfter:
+		delay := time.Second << uint(failures-p.delayAfter)
+		if delay > maxLoginDelay {
+			delay = maxLoginDelay
+		}
+		return delay
+	}
+	return 0
+}
+
+// This Function Returns How Long Logins Of The Username Or From The IP Are Locked.
+func LoginLockedFor(db *gorm.DB, username, ip string) time.Duration {
+	var attempts []models.LoginAttempt
+	db.Where("(kind = ? AND value = ?) OR (kind = ? AND value = ?)",
+		models.LoginAttemptUsername, username, models.LoginAttemptIP, ip).
+		Find(&attempts)
+
+	var lockedFor time.Duration
+	for _, attempt := range attempts {
+		if attempt.LockedUntil == nil {
+			continue
+		}
+		if d := time.Until(*attempt.LockedUntil); d > lockedFor {
+			lockedFor = d
+		}
+	}
+	return lockedFor
+}
+
+// This Function Records A Failed Login Of The Username From The IP.
+func RecordLoginFailure(db *gorm.DB, username, ip string) error {
+	if err := recordLoginFailure(db, models.LoginAttemptUsername, username); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return recordLoginFailure(db, models.LoginAttemptIP, ip)
+}
+
+func recordLoginFailure(db *gorm.DB, kind, value string) error {
+	now := time.Now()
+
+	// failures are counted in the database so concurrent logins aren't lost
+	result := db.Model(&models.LoginAttempt{}).
+		Where("kind = ? AND value = ?", kind, value).
+		Updates(map[string]interface{}{
+			"failures":        gorm.Expr("CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END", now.Add(-loginFailureWindow)),
+			"last_failure_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		attempt := models.LoginAttempt{Kind: kind, Value: value, Failures: 1, LastFailureAt: now}
+		if err := db.Create(&attempt).Error; err != nil {
+			return err
+		}
+	}
+
+	var attempt models.LoginAttempt
+	if err := db.Where("kind = ? AND value = ?", kind, value).First(&attempt).Error; err != nil {
+		return err
+	}
+	if lockFor := loginLockoutPolicies[kind].lockFor(attempt.Failures); lockFor > 0 {
+		lockedUntil := now.Add(lockFor)
+		return db.Model(&attempt).Update("locked_until", &lockedUntil).Error
+	}
+	return nil
+}
+
+// This Function Forgets The Failed Logins Of The Username After A Successful Login.
+func ClearLoginFailures(db *gorm.DB, username string) error {
+	return db.Where("kind = ? AND value = ?", models.LoginAttemptUsername, username).
+		Delete(&models.LoginAttempt{}).Error
+}
@@ -16,10 +16,21 @@ func CreateTestDatabase() (*gorm.DB, error) {
 	err = db.AutoMigrate(&models.User{}, &models.Account{}, &models.Bad_Word{},
 		&models.Configuration{}, &models.PhoneBook{}, &models.PhoneBookNumber{},
 		&models.Transaction{}, &models.SMSMessage{},
-		&models.SenderNumber{}, &models.UserNumbers{})
+		&models.SenderNumber{}, &models.UserNumbers{}, &models.AccountMember{}, &models.AuditLog{},
+		&models.RecoveryCode{}, &models.LoginChallenge{}, &models.OTPCode{}, &models.VerificationToken{}, &models.LoginAttempt{},
+		&models.PricingPlan{}, &models.APIKey{}, &models.IdempotencyKey{},
+		&models.Invoice{}, &models.LedgerEntry{}, &models.PromoCredit{}, &models.LowBalanceAlert{}, &models.Bill{},
+		&models.PriceTier{}, &models.PriceRate{}, &models.PriceSurcharge{},
+		&models.Operator{}, &models.OperatorPrefix{}, &models.SMSProvider{}, &models.ProviderRoute{},
+		&models.NumberReservation{}, &models.NumberWaitlist{}, &models.NumberTransfer{})
 	if err != nil {
 		return nil, err
 	}
+	// settings, operators and providers of the previous test database aren't in this one
+	Settings.Invalidate()
+	Operators.Invalidate()
+	Providers.Invalidate()
+	ProviderBreakers.Clear()
 
 	return db, nil
 }
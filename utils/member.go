@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"errors"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+)
+
+var ErrSpendingLimitExceeded = errors.New("Spending Limit Exceeded")
+
+// Check if member can spend the cost without passing its spending limit.
+// A zero spending limit means the member is not limited.
+func CanMemberSpend(member models.AccountMember, cost int64) bool {
+	if member.SpendingLimit == 0 {
+		return true
+	}
+	return member.Spent+cost <= member.SpendingLimit
+}
+
+// Add cost to the amount the member has spent from the organization budget.
+// The spending limit is checked by the update itself, so parallel sends of the
+// member can't pass it together; ErrSpendingLimitExceeded is returned then.
+// A negative cost gives back spending and is never limited.
+func AddMemberSpending(db *gorm.DB, memberID uint, cost int64) error {
+	query := db.Model(&models.AccountMember{}).Where("id = ?", memberID)
+	if cost > 0 {
+		query = query.Where("spending_limit = 0 OR spent + ? <= spending_limit", cost)
+	}
+	result := query.Update("spent", gorm.Expr("spent + ?", cost))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSpendingLimitExceeded
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// A reservation holds a number for an account this long, while it rents or buys it.
+const NumberReservationTTL = 10 * time.Minute
+
+var (
+	ErrNumberReserved       = errors.New("Number Is Reserved By Another Account")
+	ErrInvalidNumberPattern = errors.New("Pattern Must Only Have Digits, * And ?")
+)
+
+// This Function Reserves The Number For The Account, A Reservation Of The Account
+// Itself Is Extended. It Returns ErrNumberReserved When Another Account Has Reserved It.
+func ReserveNumber(db *gorm.DB, numberID, accountID uint) (models.NumberReservation, error) {
+	now := time.Now()
+	var reservation models.NumberReservation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("number_id = ? AND (expires_at <= ? OR account_id = ?)", numberID, now, accountID).
+			Delete(&models.NumberReservation{}).Error
+		if err != nil {
+			return err
+		}
+		reservation = models.NumberReservation{
+			NumberID:  numberID,
+			AccountID: accountID,
+			ExpiresAt: now.Add(NumberReservationTTL),
+			CreatedAt: now,
+		}
+		// the unique number_id doesn't let two accounts reserve the number at once
+		if err := tx.Create(&reservation).Error; err != nil {
+			if isDuplicatedKey(tx, err) {
+				return ErrNumberReserved
+			}
+			return err
+		}
+		return nil
+	})
+	return reservation, err
+}
+
+// This Function Reports Whether The Error Is A Unique Constraint Violation Of The Database.
+func isDuplicatedKey(db *gorm.DB, err error) bool {
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		err = translator.Translate(err)
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+// This Function Deletes The Expired Reservations And Returns How Many Were Deleted.
+func PurgeNumberReservations(db *gorm.DB) (int64, error) {
+	result := db.Where("expires_at <= ?", time.Now()).Delete(&models.NumberReservation{})
+	return result.RowsAffected, result.Error
+}
+
+// This Function Converts A Pattern Of Numbers To A LIKE Pattern, * Matches Any Digits
+// And ? Matches One Digit. For Example *1000 Matches The Numbers Ending In 1000.
+func NumberPatternToLike(pattern string) (string, error) {
+	var like strings.Builder
+	for _, r := range pattern {
+		switch {
+		case r >= '0' && r <= '9':
+			like.WriteRune(r)
+		case r == '*':
+			like.WriteRune('%')
+		case r == '?':
+			like.WriteRune('_')
+		default:
+			return "", ErrInvalidNumberPattern
+		}
+	}
+	return like.String(), nil
+}
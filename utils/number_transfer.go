@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A transfer of a number can be accepted by its recipient for this long.
+const NumberTransferTTL = 72 * time.Hour
+
+var (
+	ErrNumberNotHeld         = errors.New("Number Is No Longer Held By The Sender")
+	ErrNumberAlreadyHeld     = errors.New("Recipient Already Holds The Number")
+	ErrNumberTransferExpired = errors.New("Number Transfer Is Expired")
+	ErrNumberTransferClosed  = errors.New("Number Transfer Isn't Pending Anymore")
+)
+
+// This Function Returns The Refund Of Releasing The Rented Number Now, Which Is The
+// Share Of The Whole Days Left Of The Current Period In The Price Paid For It, Times
+// The Refund Percent. Bought Numbers And Rents In Their Grace Period Aren't Refunded.
+func NumberRefund(db *gorm.DB, userNumber models.UserNumbers, now time.Time) int64 {
+	if userNumber.Type != models.PackageTypeRent || !userNumber.IsAvailable || !userNumber.EndDate.After(now) {
+		return 0
+	}
+	periodDays := int64(userNumber.EndDate.Sub(userNumber.PeriodStart).Hours() / 24)
+	leftDays := int64(userNumber.EndDate.Sub(now).Hours() / 24)
+	if periodDays <= 0 || leftDays <= 0 {
+		return 0
+	}
+	if leftDays > periodDays {
+		leftDays = periodDays
+	}
+
+	return userNumber.PaidPrice * leftDays * SettingInt(db, SettingNumberRefundPercent) / (periodDays * 100)
+}
+
+// This Function Releases The Number Which The Account Holds Before Its Rent Ends, So
+// Other Accounts Can Rent Or Buy It, And Refunds The Unused Days Of A Rent To The
+// Budget. It Returns The Refund. The Number Of userNumber Must Be Loaded, And The
+// Rent Is Locked, So db Must Be A Transaction.
+func ReleaseNumber(db *gorm.DB, accountID uint, userNumber models.UserNumbers) (int64, error) {
+	// the number may have been renewed or transferred since it was read
+	var current models.UserNumbers
+	err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ?", userNumber.ID, userNumber.UserID).First(&current).Error
+	if err != nil {
+		return 0, err
+	}
+	refund := NumberRefund(db, current, time.Now())
+
+	result := db.Where("id = ? AND user_id = ?", userNumber.ID, userNumber.UserID).Delete(&models.UserNumbers{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	if userNumber.Number.Type != models.SenderTypeShared {
+		err := db.Model(&models.SenderNumber{}).Where("id = ?", userNumber.NumberID).Update("is_exclusive", false).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := CancelNumberTransfers(db, []uint{userNumber.ID}); err != nil {
+		return 0, err
+	}
+	if refund == 0 {
+		return 0, nil
+	}
+
+	err = db.Model(&models.Account{}).Where("id = ?", accountID).
+		Update("budget", gorm.Expr("budget + ?", refund)).Error
+	if err != nil {
+		return 0, err
+	}
+	err = AddLedgerEntry(db, models.LedgerEntry{
+		AccountID: accountID,
+		Kind:      models.LedgerRefund,
+		Amount:    refund,
+		Reason:    "release of sender number " + userNumber.Number.Number,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return refund, SettleBills(db, accountID)
+}
+
+// This Function Cancels The Pending Transfers Of The Held Numbers, They Can't Be
+// Accepted After The Numbers Are Released.
+func CancelNumberTransfers(db *gorm.DB, userNumberIDs []uint) error {
+	return db.Model(&models.NumberTransfer{}).
+		Where("user_number_id IN ? AND status = ?", userNumberIDs, models.NumberTransferPending).
+		Updates(map[string]interface{}{"status": models.NumberTransferCancelled, "responded_at": time.Now()}).Error
+}
+
+// This Function Moves The Number Of The Pending Transfer To Its Recipient. The Number
+// Keeps Its Rent And Package, But Auto-Renew Is Turned Off Until The Recipient Turns
+// It On. It Returns ErrNumberTransferClosed When The Transfer Was Accepted, Declined
+// Or Cancelled Meanwhile, ErrNumberNotHeld When The Sender Doesn't Hold The Usable
+// Number Anymore, And ErrNumberAlreadyHeld When The Recipient Already Rents The Shared
+// Number. db Must Be A Transaction, It Is Rolled Back On Errors.
+func TransferNumber(db *gorm.DB, transfer *models.NumberTransfer) error {
+	now := time.Now()
+	if !transfer.ExpiresAt.After(now) {
+		return ErrNumberTransferExpired
+	}
+
+	// the transfer is claimed first, so an accept which races a decline, a cancel or a release doesn't move the number
+	result := db.Model(&models.NumberTransfer{}).
+		Where("id = ? AND status = ?", transfer.ID, models.NumberTransferPending).
+		Updates(map[string]interface{}{"status": models.NumberTransferAccepted, "responded_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNumberTransferClosed
+	}
+
+	var sender, recipient models.Account
+	if err := db.First(&sender, transfer.FromAccountID).Error; err != nil {
+		return err
+	}
+	if err := db.First(&recipient, transfer.ToAccountID).Error; err != nil {
+		return err
+	}
+	var number models.SenderNumber
+	if err := db.First(&number, transfer.NumberID).Error; err != nil {
+		return err
+	}
+
+	var held int64
+	db.Model(&models.UserNumbers{}).Where("number_id = ? AND user_id = ?", number.ID, recipient.UserID).Count(&held)
+	if held > 0 {
+		return ErrNumberAlreadyHeld
+	}
+
+	// the sender may have released the number or it may have ended since the transfer was offered
+	result = db.Model(&models.UserNumbers{}).
+		Where("id = ? AND user_id = ? AND is_available = ?", transfer.UserNumberID, sender.UserID, true).
+		Updates(map[string]interface{}{
+			"user_id":           recipient.UserID,
+			"auto_renew":        false,
+			"reminded_at":       nil,
+			"renewal_failed_at": nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNumberNotHeld
+	}
+	err := db.Model(&models.SenderNumber{}).Where("id = ?", number.ID).
+		Update("is_exclusive", number.Type != models.SenderTypeShared).Error
+	if err != nil {
+		return err
+	}
+	err = db.Where("number_id = ? AND account_id = ?", number.ID, recipient.ID).Delete(&models.NumberWaitlist{}).Error
+	if err != nil {
+		return err
+	}
+
+	transfer.Status = models.NumberTransferAccepted
+	transfer.RespondedAt = &now
+	return nil
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultProvider sends the messages to the recipients whose operator isn't detected.
+const DefaultProvider = "default"
+
+// Operators are reloaded from the database after this long, so the changes of other
+// instances are seen.
+const OperatorsCacheTTL = time.Minute
+
+// A range of prefixes, e.g. 98910-98919, can't have more prefixes than this.
+const maxPrefixRange = 100
+
+var ErrInvalidPrefix = errors.New("Prefix Must Be Digits Or A Range Of Digits Like 98910-98919")
+
+// This Function Returns The Digits Of A Number In The International Format Without
+// + Or 00, e.g. 09121234567 Is 989121234567. Invalid Numbers Are Only Stripped.
+func InternationalNumber(number string) string {
+	if phone, err := NormalizePhone(number, IranCallingCode); err == nil {
+		return phone[1:]
+	}
+	return PriceNumber(number)
+}
+
+// This Function Returns The International Digits Of A Prefix, Prefixes Of National Numbers Are Iranian, e.g. 0912 Is 98912.
+func InternationalPrefix(prefix string) string {
+	prefix = PriceNumber(prefix)
+	if strings.HasPrefix(prefix, "0") {
+		return "98" + prefix[1:]
+	}
+	return prefix
+}
+
+// This Function Expands A Prefix Or A Range Of Prefixes Of The Same Length, e.g. 98910-98919.
+func ExpandPrefixRange(prefix string) ([]string, error) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(prefix), "-")
+	from, to = InternationalPrefix(from), InternationalPrefix(to)
+	if !isRange {
+		if !IsNumeric(from) || len(from) > 20 {
+			return nil, ErrInvalidPrefix
+		}
+		return []string{from}, nil
+	}
+
+	if !IsNumeric(from) || !IsNumeric(to) || len(from) != len(to) || len(from) > 18 {
+		return nil, ErrInvalidPrefix
+	}
+	start, _ := strconv.ParseInt(from, 10, 64)
+	end, _ := strconv.ParseInt(to, 10, 64)
+	if start > end || end-start >= maxPrefixRange {
+		return nil, ErrInvalidPrefix
+	}
+
+	var prefixes []string
+	for n := start; n <= end; n++ {
+		prefixes = append(prefixes, fmt.Sprintf("%0*d", len(from), n))
+	}
+	return prefixes, nil
+}
+
+type operatorPrefix struct {
+	prefix   string
+	operator models.Operator
+}
+
+// OperatorCache keeps the prefixes of the operators in memory, so detecting the
+// operator of a recipient doesn't query the database.
+type OperatorCache struct {
+	mu       sync.RWMutex
+	ttl      time.Duration
+	prefixes []operatorPrefix
+	loadedAt time.Time
+}
+
+func NewOperatorCache(ttl time.Duration) *OperatorCache {
+	return &OperatorCache{ttl: ttl}
+}
+
+// Operators is the cache which the operators of recipients are detected by.
+var Operators = NewOperatorCache(OperatorsCacheTTL)
+
+// Invalidate makes the next detection load the operators from the database again.
+func (o *OperatorCache) Invalidate() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.prefixes = nil
+}
+
+func (o *OperatorCache) load(db *gorm.DB) ([]operatorPrefix, error) {
+	o.mu.RLock()
+	prefixes, loadedAt := o.prefixes, o.loadedAt
+	o.mu.RUnlock()
+	if prefixes != nil && time.Since(loadedAt) < o.ttl {
+		return prefixes, nil
+	}
+
+	var operators []models.Operator
+	if err := db.Preload("Prefixes").Find(&operators).Error; err != nil {
+		return nil, err
+	}
+	prefixes = []operatorPrefix{}
+	for _, operator := range operators {
+		for _, prefix := range operator.Prefixes {
+			prefixes = append(prefixes, operatorPrefix{prefix: prefix.Prefix, operator: models.Operator{
+				ID:       operator.ID,
+				Name:     operator.Name,
+				Provider: operator.Provider,
+			}})
+		}
+	}
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return len(prefixes[i].prefix) > len(prefixes[j].prefix)
+	})
+
+	o.mu.Lock()
+	o.prefixes, o.loadedAt = prefixes, time.Now()
+	o.mu.Unlock()
+	return prefixes, nil
+}
+
+// Detect returns the operator of the number by its longest matching prefix.
+func (o *OperatorCache) Detect(db *gorm.DB, number string) (models.Operator, bool) {
+	prefixes, err := o.load(db)
+	if err != nil {
+		log.Printf("Failed to load operators: %v", err)
+		return models.Operator{}, false
+	}
+	number = InternationalNumber(number)
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(number, prefix.prefix) {
+			return prefix.operator, true
+		}
+	}
+	return models.Operator{}, false
+}
+
+// This Function Returns The ID Of The Operator Of The Number, Or nil When It Isn't Detected.
+func DetectOperatorID(db *gorm.DB, number string) *uint {
+	operator, ok := Operators.Detect(db, number)
+	if !ok {
+		return nil
+	}
+	return &operator.ID
+}
+
+// This Function Returns The Provider Which Messages To The Number Are Sent Through.
+func MessageProvider(db *gorm.DB, number string) string {
+	operator, ok := Operators.Detect(db, number)
+	if !ok || operator.Provider == "" {
+		return DefaultProvider
+	}
+	return operator.Provider
+}
+
+// This Function Detects The Operators Of The Phone Book Numbers Again, After The
+// Operators Or Their Prefixes Are Changed.
+func RedetectOperators(db *gorm.DB) error {
+	Operators.Invalidate()
+
+	var numbers []models.PhoneBookNumber
+	return db.Select("id", "phone", "operator_id").FindInBatches(&numbers, 500, func(tx *gorm.DB, batch int) error {
+		for _, number := range numbers {
+			operatorID := DetectOperatorID(db, number.Phone)
+			if operatorID == nil && number.OperatorID == nil ||
+				operatorID != nil && number.OperatorID != nil && *operatorID == *number.OperatorID {
+				continue
+			}
+			err := db.Model(&models.PhoneBookNumber{}).Where("id = ?", number.ID).Update("operator_id", operatorID).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPaymentGateway        = errors.New("Failed To Create Payment In Gateway")
+	ErrTransactionVerified   = errors.New("Transaction Is Already Verified")
+	ErrTransactionClosed     = errors.New("Transaction Is Not Waiting For Payment")
+	ErrPaymentAmountMismatch = errors.New("Amount Of Payment Doesn't Match Transaction")
+)
+
+// This Function Creates A Transaction Which Waits For Payment And Its Payment In The Gateway.
+// It Returns ErrPaymentGateway When The Gateway Doesn't Create The Payment.
+func CreatePaymentTransaction(db *gorm.DB, accountID uint, user models.User, amount int64, description string) (models.Transaction, PaymentSession, error) {
+	transaction := models.Transaction{
+		AccountID: accountID,
+		Amount:    amount,
+		Status:    models.TransactionStatusWait,
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&transaction).Error; err != nil {
+		return models.Transaction{}, PaymentSession{}, err
+	}
+
+	session, err := GetPaymentGateway().CreatePayment(PaymentRequest{
+		OrderID:     fmt.Sprint(transaction.ID),
+		Amount:      transaction.Amount,
+		Description: description,
+		Mobile:      user.Phone,
+		Email:       user.Email,
+	})
+	if err != nil {
+		log.Printf("Failed to create payment of transaction %d: %v", transaction.ID, err)
+		db.Model(&transaction).Update("status", models.TransactionStatusFailed)
+		return transaction, PaymentSession{}, ErrPaymentGateway
+	}
+
+	transaction.Authority = session.Authority
+	if err := db.Model(&transaction).Update("authority", session.Authority).Error; err != nil {
+		return transaction, PaymentSession{}, err
+	}
+	return transaction, session, nil
+}
+
+// This Function Changes The Status Of A Transaction Which Is Waiting For Payment.
+func CloseTransaction(db *gorm.DB, transactionID uint, status string) error {
+	return db.Model(&models.Transaction{}).
+		Where("id = ? AND status = ?", transactionID, models.TransactionStatusWait).
+		Update("status", status).Error
+}
+
+// This Function Adds The Amount Of A Verified Payment To The Budget Of Its Account.
+// The Transaction Is Locked So A Payment Which Is Verified Concurrently Is Credited Once.
+func CreditTransaction(db *gorm.DB, transactionID uint, verification PaymentVerification) error {
+	tx := db.Begin()
+
+	var transaction models.Transaction
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&transaction, transactionID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	switch transaction.Status {
+	case models.TransactionStatusOkay:
+		tx.Rollback()
+		return ErrTransactionVerified
+	case models.TransactionStatusWait:
+	default:
+		tx.Rollback()
+		return ErrTransactionClosed
+	}
+
+	if verification.Amount != transaction.Amount {
+		log.Printf("Amount of payment %d is %d, expected %d", transaction.ID, verification.Amount, transaction.Amount)
+		if err := tx.Model(&transaction).Update("status", models.TransactionStatusFailed).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		tx.Commit()
+		return ErrPaymentAmountMismatch
+	}
+
+	var account models.Account
+	if err := tx.First(&account, transaction.AccountID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// only the hash of the card number is kept
+	cardHash := verification.CardHash
+	if cardHash == "" && verification.CardPan != "" {
+		cardHash = HashCode(verification.CardPan)
+	}
+
+	now := time.Now()
+	err := tx.Model(&transaction).Updates(map[string]interface{}{
+		"status":      models.TransactionStatusOkay,
+		"ref_id":      verification.RefID,
+		"card_hash":   cardHash,
+		"verified_at": &now,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Model(&models.Account{}).Where("id = ?", account.ID).
+		Update("budget", gorm.Expr("budget + ?", transaction.Amount)).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = AddLedgerEntry(tx, models.LedgerEntry{
+		AccountID:     account.ID,
+		Kind:          models.LedgerTopUp,
+		Amount:        transaction.Amount,
+		Reason:        "Payment " + verification.RefID,
+		TransactionID: &transaction.ID,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := SettleBills(tx, account.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	transaction.VerifiedAt = &now
+	if _, err := IssueInvoice(tx, transaction); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
@@ -0,0 +1,597 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Names of the payment gateways which can be configured with PAYMENT_GATEWAY.
+const (
+	PaymentGatewayZarinpal = "zarinpal"
+	PaymentGatewayIDPay    = "idpay"
+	PaymentGatewayNextPay  = "nextpay"
+)
+
+var ErrRefundNotSupported = errors.New("Refund Is Not Supported By Payment Gateway")
+
+// PaymentGateway creates, verifies and refunds the payments which add budget to accounts.
+type PaymentGateway interface {
+	Name() string
+	// CreatePayment registers a payment and returns the URL the user pays in.
+	CreatePayment(payment PaymentRequest) (PaymentSession, error)
+	// ParseCallback reads the parameters which the gateway redirects the user back with.
+	ParseCallback(values url.Values) PaymentCallback
+	// Verify confirms a paid payment, a payment must be verified before the budget is added.
+	Verify(payment PaymentVerifyRequest) (PaymentVerification, error)
+	// Inquire returns the status of a payment without changing it.
+	Inquire(payment PaymentVerifyRequest) (string, error)
+	Refund(payment PaymentVerifyRequest) error
+}
+
+// Statuses of a payment which are returned by PaymentGateway.Inquire
+const (
+	PaymentStatusPending  = "pending"
+	PaymentStatusPaid     = "paid"
+	PaymentStatusVerified = "verified"
+	PaymentStatusFailed   = "failed"
+)
+
+// PaymentGatewayOptions configures a payment gateway, empty URLs are replaced by
+// the gateway's own URLs.
+type PaymentGatewayOptions struct {
+	MerchantID  string
+	CallbackURL string
+	APIURL      string
+	GateURL     string
+	Sandbox     bool
+}
+
+type PaymentRequest struct {
+	OrderID     string
+	Amount      int64
+	Description string
+	Mobile      string
+	Email       string
+}
+
+type PaymentSession struct {
+	Authority  string
+	PaymentURL string
+}
+
+type PaymentCallback struct {
+	Authority string
+	OK        bool
+}
+
+type PaymentVerifyRequest struct {
+	OrderID   string
+	Authority string
+	Amount    int64
+}
+
+type PaymentVerification struct {
+	Verified        bool
+	AlreadyVerified bool
+	Amount          int64
+	RefID           string
+	CardPan         string
+	CardHash        string
+	Message         string
+}
+
+// This Function Creates The Payment Gateway With Input Name.
+func NewPaymentGateway(name string, options PaymentGatewayOptions) (PaymentGateway, error) {
+	switch name {
+	case PaymentGatewayZarinpal, "":
+		return NewZarinpalGateway(options), nil
+	case PaymentGatewayIDPay:
+		return NewIDPayGateway(options), nil
+	case PaymentGatewayNextPay:
+		return NewNextPayGateway(options), nil
+	}
+	return nil, fmt.Errorf("unknown payment gateway %q", name)
+}
+
+var (
+	paymentGateway   PaymentGateway = NewZarinpalGateway(PaymentGatewayOptions{Sandbox: true})
+	paymentGatewayMu sync.RWMutex
+)
+
+// SetPaymentGateway replaces the gateway which payments are made with.
+func SetPaymentGateway(g PaymentGateway) {
+	paymentGatewayMu.Lock()
+	defer paymentGatewayMu.Unlock()
+	paymentGateway = g
+}
+
+// GetPaymentGateway returns the gateway which payments are made with.
+func GetPaymentGateway() PaymentGateway {
+	paymentGatewayMu.RLock()
+	defer paymentGatewayMu.RUnlock()
+	return paymentGateway
+}
+
+var paymentHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// This Function Posts Input Data As JSON To A Payment Gateway And Decodes Its Response.
+func postPaymentJSON(endpoint string, headers map[string]string, data interface{}, result interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := paymentHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("invalid response from payment gateway (status %d): %w", resp.StatusCode, err)
+	}
+	return nil
+}
+
+// Zarinpal
+
+const (
+	zarinpalAPIURL         = "https://api.zarinpal.com"
+	zarinpalGateURL        = "https://www.zarinpal.com/pg/StartPay/"
+	zarinpalSandboxAPIURL  = "https://sandbox.banktest.ir/zarinpal/api.zarinpal.com"
+	zarinpalSandboxGateURL = "https://sandbox.banktest.ir/zarinpal/www.zarinpal.com/pg/StartPay/"
+	zarinpalSandboxMerchID = "860C78FA-D6A9-48AE-805D-2B33B52309D2"
+	defaultCallbackURL     = "http://localhost:8080/accounts/payment/verify"
+)
+
+// ZarinpalGateway makes payments with Zarinpal's v4 API.
+type ZarinpalGateway struct {
+	options PaymentGatewayOptions
+}
+
+func NewZarinpalGateway(options PaymentGatewayOptions) *ZarinpalGateway {
+	if options.APIURL == "" {
+		options.APIURL = zarinpalAPIURL
+		if options.Sandbox {
+			options.APIURL = zarinpalSandboxAPIURL
+		}
+	}
+	if options.GateURL == "" {
+		options.GateURL = zarinpalGateURL
+		if options.Sandbox {
+			options.GateURL = zarinpalSandboxGateURL
+		}
+	}
+	if options.MerchantID == "" && options.Sandbox {
+		options.MerchantID = zarinpalSandboxMerchID
+	}
+	if options.CallbackURL == "" {
+		options.CallbackURL = defaultCallbackURL
+	}
+	return &ZarinpalGateway{options: options}
+}
+
+type zarinpalData struct {
+	Code      int         `json:"code"`
+	Message   string      `json:"message"`
+	Status    string      `json:"status"`
+	Authority string      `json:"authority"`
+	CardHash  string      `json:"card_hash"`
+	CardPan   string      `json:"card_pan"`
+	RefID     json.Number `json:"ref_id"`
+}
+
+type zarinpalErrors struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// zarinpal returns data as an empty array when there is an error, and errors when there isn't
+func (d *zarinpalData) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return nil
+	}
+	type plain zarinpalData
+	return json.Unmarshal(data, (*plain)(d))
+}
+
+func (e *zarinpalErrors) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return nil
+	}
+	type plain zarinpalErrors
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+type zarinpalResponse struct {
+	Data   zarinpalData   `json:"data"`
+	Errors zarinpalErrors `json:"errors"`
+}
+
+func (g *ZarinpalGateway) Name() string {
+	return PaymentGatewayZarinpal
+}
+
+func (g *ZarinpalGateway) CreatePayment(payment PaymentRequest) (PaymentSession, error) {
+	data := map[string]interface{}{
+		"merchant_id":  g.options.MerchantID,
+		"amount":       payment.Amount,
+		"callback_url": g.options.CallbackURL,
+		"description":  payment.Description,
+		"metadata": map[string]string{
+			"mobile":   payment.Mobile,
+			"email":    payment.Email,
+			"order_id": payment.OrderID,
+		},
+	}
+
+	var result zarinpalResponse
+	if err := postPaymentJSON(g.options.APIURL+"/pg/v4/payment/request.json", nil, data, &result); err != nil {
+		return PaymentSession{}, err
+	}
+	if result.Data.Code != 100 || result.Data.Authority == "" {
+		return PaymentSession{}, fmt.Errorf("zarinpal: %s (%d)", result.Errors.Message, result.Errors.Code)
+	}
+
+	return PaymentSession{
+		Authority:  result.Data.Authority,
+		PaymentURL: g.options.GateURL + result.Data.Authority,
+	}, nil
+}
+
+func (g *ZarinpalGateway) ParseCallback(values url.Values) PaymentCallback {
+	return PaymentCallback{Authority: values.Get("Authority"), OK: values.Get("Status") == "OK"}
+}
+
+func (g *ZarinpalGateway) Verify(payment PaymentVerifyRequest) (PaymentVerification, error) {
+	data := map[string]interface{}{
+		"merchant_id": g.options.MerchantID,
+		"amount":      payment.Amount,
+		"authority":   payment.Authority,
+	}
+
+	var result zarinpalResponse
+	if err := postPaymentJSON(g.options.APIURL+"/pg/v4/payment/verify.json", nil, data, &result); err != nil {
+		return PaymentVerification{}, err
+	}
+
+	// the response of Zarinpal doesn't have the amount, it verifies the amount itself and
+	// fails with code -50 when the paid amount isn't the amount which is verified
+	verification := PaymentVerification{
+		Verified:        result.Data.Code == 100 || result.Data.Code == 101,
+		AlreadyVerified: result.Data.Code == 101,
+		Amount:          payment.Amount,
+		RefID:           result.Data.RefID.String(),
+		CardPan:         result.Data.CardPan,
+		CardHash:        result.Data.CardHash,
+		Message:         result.Data.Message,
+	}
+	if !verification.Verified {
+		verification.Message = result.Errors.Message
+	}
+	return verification, nil
+}
+
+func (g *ZarinpalGateway) Inquire(payment PaymentVerifyRequest) (string, error) {
+	data := map[string]interface{}{
+		"merchant_id": g.options.MerchantID,
+		"authority":   payment.Authority,
+	}
+
+	var result zarinpalResponse
+	if err := postPaymentJSON(g.options.APIURL+"/pg/v4/payment/inquiry.json", nil, data, &result); err != nil {
+		return "", err
+	}
+	if result.Data.Code != 100 {
+		return "", fmt.Errorf("zarinpal: %s (%d)", result.Errors.Message, result.Errors.Code)
+	}
+
+	switch result.Data.Status {
+	case "IN_BANK":
+		return PaymentStatusPending, nil
+	case "PAID":
+		return PaymentStatusPaid, nil
+	case "VERIFIED":
+		return PaymentStatusVerified, nil
+	}
+	return PaymentStatusFailed, nil
+}
+
+// Refund reverses a verified payment, Zarinpal only reverses payments of the last 30 minutes.
+func (g *ZarinpalGateway) Refund(payment PaymentVerifyRequest) error {
+	data := map[string]interface{}{
+		"merchant_id": g.options.MerchantID,
+		"authority":   payment.Authority,
+	}
+
+	var result zarinpalResponse
+	if err := postPaymentJSON(g.options.APIURL+"/pg/v4/payment/reverse.json", nil, data, &result); err != nil {
+		return err
+	}
+	if result.Data.Code != 100 {
+		return fmt.Errorf("zarinpal: %s (%d)", result.Errors.Message, result.Errors.Code)
+	}
+	return nil
+}
+
+// IDPay
+
+const (
+	idpayAPIURL = "https://api.idpay.ir/v1.1"
+)
+
+// IDPayGateway makes payments with IDPay's v1.1 API, MerchantID is the API key.
+type IDPayGateway struct {
+	options PaymentGatewayOptions
+}
+
+func NewIDPayGateway(options PaymentGatewayOptions) *IDPayGateway {
+	if options.APIURL == "" {
+		options.APIURL = idpayAPIURL
+	}
+	if options.CallbackURL == "" {
+		options.CallbackURL = defaultCallbackURL
+	}
+	return &IDPayGateway{options: options}
+}
+
+type idpayResponse struct {
+	ID           string      `json:"id"`
+	Link         string      `json:"link"`
+	Status       json.Number `json:"status"`
+	TrackID      json.Number `json:"track_id"`
+	Amount       json.Number `json:"amount"`
+	ErrorCode    int         `json:"error_code"`
+	ErrorMessage string      `json:"error_message"`
+	Payment      struct {
+		TrackID      json.Number `json:"track_id"`
+		CardNo       string      `json:"card_no"`
+		HashedCardNo string      `json:"hashed_card_no"`
+	} `json:"payment"`
+}
+
+func (g *IDPayGateway) headers() map[string]string {
+	headers := map[string]string{"X-API-KEY": g.options.MerchantID}
+	if g.options.Sandbox {
+		headers["X-SANDBOX"] = "1"
+	}
+	return headers
+}
+
+func (g *IDPayGateway) Name() string {
+	return PaymentGatewayIDPay
+}
+
+func (g *IDPayGateway) CreatePayment(payment PaymentRequest) (PaymentSession, error) {
+	data := map[string]interface{}{
+		"order_id": payment.OrderID,
+		"amount":   payment.Amount,
+		"phone":    payment.Mobile,
+		"mail":     payment.Email,
+		"desc":     payment.Description,
+		"callback": g.options.CallbackURL,
+	}
+
+	var result idpayResponse
+	if err := postPaymentJSON(g.options.APIURL+"/payment", g.headers(), data, &result); err != nil {
+		return PaymentSession{}, err
+	}
+	if result.ID == "" || result.Link == "" {
+		return PaymentSession{}, fmt.Errorf("idpay: %s (%d)", result.ErrorMessage, result.ErrorCode)
+	}
+
+	paymentURL := result.Link
+	if g.options.GateURL != "" {
+		paymentURL = g.options.GateURL + result.ID
+	}
+	return PaymentSession{Authority: result.ID, PaymentURL: paymentURL}, nil
+}
+
+// idpay redirects back with status 10 when the payment is waiting to be verified
+func (g *IDPayGateway) ParseCallback(values url.Values) PaymentCallback {
+	return PaymentCallback{Authority: values.Get("id"), OK: values.Get("status") == "10"}
+}
+
+func (g *IDPayGateway) Verify(payment PaymentVerifyRequest) (PaymentVerification, error) {
+	data := map[string]interface{}{
+		"id":       payment.Authority,
+		"order_id": payment.OrderID,
+	}
+
+	var result idpayResponse
+	if err := postPaymentJSON(g.options.APIURL+"/payment/verify", g.headers(), data, &result); err != nil {
+		return PaymentVerification{}, err
+	}
+
+	amount, _ := result.Amount.Int64()
+	status := result.Status.String()
+	verification := PaymentVerification{
+		Verified:        status == "100" || status == "101",
+		AlreadyVerified: status == "101",
+		Amount:          amount,
+		RefID:           result.Payment.TrackID.String(),
+		CardPan:         result.Payment.CardNo,
+		CardHash:        result.Payment.HashedCardNo,
+		Message:         result.ErrorMessage,
+	}
+	return verification, nil
+}
+
+func (g *IDPayGateway) Inquire(payment PaymentVerifyRequest) (string, error) {
+	data := map[string]interface{}{
+		"id":       payment.Authority,
+		"order_id": payment.OrderID,
+	}
+
+	var result idpayResponse
+	if err := postPaymentJSON(g.options.APIURL+"/payment/inquiry", g.headers(), data, &result); err != nil {
+		return "", err
+	}
+	if result.Status == "" {
+		return "", fmt.Errorf("idpay: %s (%d)", result.ErrorMessage, result.ErrorCode)
+	}
+
+	switch result.Status.String() {
+	case "1", "8":
+		return PaymentStatusPending, nil
+	case "10":
+		return PaymentStatusPaid, nil
+	case "100", "101", "200":
+		return PaymentStatusVerified, nil
+	}
+	return PaymentStatusFailed, nil
+}
+
+func (g *IDPayGateway) Refund(payment PaymentVerifyRequest) error {
+	return ErrRefundNotSupported
+}
+
+// NextPay
+
+const (
+	nextpayAPIURL  = "https://nextpay.org/nx/gateway"
+	nextpayGateURL = "https://nextpay.org/nx/gateway/payment/"
+)
+
+// NextPayGateway makes payments with NextPay's gateway API, MerchantID is the API key.
+type NextPayGateway struct {
+	options PaymentGatewayOptions
+}
+
+func NewNextPayGateway(options PaymentGatewayOptions) *NextPayGateway {
+	if options.APIURL == "" {
+		options.APIURL = nextpayAPIURL
+	}
+	if options.GateURL == "" {
+		options.GateURL = nextpayGateURL
+	}
+	if options.CallbackURL == "" {
+		options.CallbackURL = defaultCallbackURL
+	}
+	return &NextPayGateway{options: options}
+}
+
+type nextpayResponse struct {
+	Code          int         `json:"code"`
+	TransID       string      `json:"trans_id"`
+	Amount        json.Number `json:"amount"`
+	CardHolder    string      `json:"card_holder"`
+	ShaparakRefID string      `json:"Shaparak_Ref_Id"`
+}
+
+func (g *NextPayGateway) Name() string {
+	return PaymentGatewayNextPay
+}
+
+func (g *NextPayGateway) CreatePayment(payment PaymentRequest) (PaymentSession, error) {
+	data := map[string]interface{}{
+		"api_key":        g.options.MerchantID,
+		"order_id":       payment.OrderID,
+		"amount":         payment.Amount,
+		"currency":       "IRR",
+		"callback_uri":   g.options.CallbackURL,
+		"customer_phone": payment.Mobile,
+	}
+
+	var result nextpayResponse
+	if err := postPaymentJSON(g.options.APIURL+"/token", nil, data, &result); err != nil {
+		return PaymentSession{}, err
+	}
+	if result.Code != -1 || result.TransID == "" {
+		return PaymentSession{}, fmt.Errorf("nextpay: error code %d", result.Code)
+	}
+
+	return PaymentSession{Authority: result.TransID, PaymentURL: g.options.GateURL + result.TransID}, nil
+}
+
+// nextpay doesn't send the status of the payment back, it is known by verifying it
+func (g *NextPayGateway) ParseCallback(values url.Values) PaymentCallback {
+	return PaymentCallback{Authority: values.Get("trans_id"), OK: values.Get("trans_id") != ""}
+}
+
+func (g *NextPayGateway) Verify(payment PaymentVerifyRequest) (PaymentVerification, error) {
+	data := map[string]interface{}{
+		"api_key":  g.options.MerchantID,
+		"trans_id": payment.Authority,
+		"amount":   payment.Amount,
+		"currency": "IRR",
+	}
+
+	var result nextpayResponse
+	if err := postPaymentJSON(g.options.APIURL+"/verify", nil, data, &result); err != nil {
+		return PaymentVerification{}, err
+	}
+
+	amount, _ := result.Amount.Int64()
+	return PaymentVerification{
+		Verified: result.Code == 0,
+		Amount:   amount,
+		RefID:    result.ShaparakRefID,
+		CardPan:  result.CardHolder,
+		Message:  fmt.Sprintf("code %d", result.Code),
+	}, nil
+}
+
+// Inquire uses NextPay's verify endpoint, which is the only way to know the status of a payment.
+func (g *NextPayGateway) Inquire(payment PaymentVerifyRequest) (string, error) {
+	data := map[string]interface{}{
+		"api_key":  g.options.MerchantID,
+		"trans_id": payment.Authority,
+		"amount":   payment.Amount,
+		"currency": "IRR",
+	}
+
+	var result nextpayResponse
+	if err := postPaymentJSON(g.options.APIURL+"/verify", nil, data, &result); err != nil {
+		return "", err
+	}
+
+	switch result.Code {
+	case 0:
+		return PaymentStatusVerified, nil
+	case -1, -2, -3, -4:
+		return PaymentStatusPending, nil
+	}
+	return PaymentStatusFailed, nil
+}
+
+// Refund gives the money of a verified payment back, it is done with NextPay's verify endpoint.
+func (g *NextPayGateway) Refund(payment PaymentVerifyRequest) error {
+	data := map[string]interface{}{
+		"api_key":        g.options.MerchantID,
+		"trans_id":       payment.Authority,
+		"amount":         payment.Amount,
+		"currency":       "IRR",
+		"refund_request": "yes_money_back",
+	}
+
+	var result nextpayResponse
+	if err := postPaymentJSON(g.options.APIURL+"/verify", nil, data, &result); err != nil {
+		return err
+	}
+	if result.Code != -90 {
+		return fmt.Errorf("nextpay: error code %d", result.Code)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// IranCallingCode is the country of the numbers which don't have a country code.
+const IranCallingCode = "98"
+
+var (
+	ErrInvalidPhone       = errors.New("Invalid Phone Number")
+	ErrUnsupportedCountry = errors.New("Country Of The Phone Number Is Not Supported")
+)
+
+// Country is a country which messages can be sent to. Its mobile numbers have
+// MinLength to MaxLength digits after the calling code, and start with one of the
+// MobilePrefixes when there are any.
+type Country struct {
+	ISO            string
+	CallingCode    string
+	MinLength      int
+	MaxLength      int
+	MobilePrefixes []string
+}
+
+var countries = []Country{
+	{ISO: "IR", CallingCode: "98", MinLength: 10, MaxLength: 10, MobilePrefixes: []string{"9"}},
+	{ISO: "US", CallingCode: "1", MinLength: 10, MaxLength: 10},
+	{ISO: "RU", CallingCode: "7", MinLength: 10, MaxLength: 10, MobilePrefixes: []string{"7", "9"}},
+	{ISO: "NL", CallingCode: "31", MinLength: 9, MaxLength: 9, MobilePrefixes: []string{"6"}},
+	{ISO: "FR", CallingCode: "33", MinLength: 9, MaxLength: 9, MobilePrefixes: []string{"6", "7"}},
+	{ISO: "ES", CallingCode: "34", MinLength: 9, MaxLength: 9, MobilePrefixes: []string{"6", "7"}},
+	{ISO: "IT", CallingCode: "39", MinLength: 9, MaxLength: 10, MobilePrefixes: []string{"3"}},
+	{ISO: "GB", CallingCode: "44", MinLength: 10, MaxLength: 10, MobilePrefixes: []string{"7"}},
+	{ISO: "DE", CallingCode: "49", MinLength: 10, MaxLength: 11, MobilePrefixes: []string{"15", "16", "17"}},
+	{ISO: "AU", CallingCode: "61", MinLength: 9, MaxLength: 9, MobilePrefixes: []string{"4"}},
+	{ISO: "CN", CallingCode: "86", MinLength: 11, MaxLength: 11, MobilePrefixes: []string{"1"}},
+	{ISO: "TR", CallingCode: "90", MinLength: 10, MaxLength: 10, MobilePrefixes: []string{"5"}},
+	{ISO: "IN", CallingCode: "91", MinLength: 10, MaxLength: 10, MobilePrefixes: []string{"6", "7", "8", "9"}},
+	{ISO: "PK", CallingCode: "92", MinLength: 10, MaxLength: 10, MobilePrefixes: []string{"3"}},
+	{ISO: "AF", CallingCode: "93", MinLength: 9, MaxLength: 9, MobilePrefixes: []string{"7"}},
+	{ISO: "AM", CallingCode: "374", MinLength: 8, MaxLength: 8},
+	{ISO: "IQ", CallingCode: "964", MinLength: 10, MaxLength: 10, MobilePrefixes: []string{"7"}},
+	{ISO: "KW", CallingCode: "965", MinLength: 8, MaxLength: 8, MobilePrefixes: []string{"5", "6", "9"}},
+	{ISO: "SA", CallingCode: "966", MinLength: 9, MaxLength: 9, MobilePrefixes: []string{"5"}},
+	{ISO: "OM", CallingCode: "968", MinLength: 8, MaxLength: 8, MobilePrefixes: []string{"7", "9"}},
+	{ISO: "AE", CallingCode: "971", MinLength: 9, MaxLength: 9, MobilePrefixes: []string{"5"}},
+	{ISO: "BH", CallingCode: "973", MinLength: 8, MaxLength: 8, MobilePrefixes: []string{"3", "6"}},
+	{ISO: "QA", CallingCode: "974", MinLength: 8, MaxLength: 8, MobilePrefixes: []string{"3", "5", "6", "7"}},
+	{ISO: "AZ", CallingCode: "994", MinLength: 9, MaxLength: 9},
+}
+
+// isMobile checks the digits of a number after the calling code of the country
+func (c Country) isMobile(national string) bool {
+	if len(national) < c.MinLength || len(national) > c.MaxLength {
+		return false
+	}
+	if len(c.MobilePrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.MobilePrefixes {
+		if strings.HasPrefix(national, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// This Function Returns The Country Of The International Digits Of A Number.
+func PhoneCountry(digits string) (Country, bool) {
+	digits = strings.TrimPrefix(digits, "+")
+	// calling codes are prefix free, so only one of them matches
+	for _, country := range countries {
+		if strings.HasPrefix(digits, country.CallingCode) {
+			return country, true
+		}
+	}
+	return Country{}, false
+}
+
+// This Function Returns The E.164 Form Of A Mobile Number, e.g. +989121234567. It
+// Accepts Numbers With + Or 00 And The Calling Code, And National Numbers With Or
+// Without The Leading 0, Which Are Of The Country Of defaultCallingCode.
+func NormalizePhone(number string, defaultCallingCode string) (string, error) {
+	number = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" -().", r) {
+			return -1
+		}
+		return r
+	}, number)
+	defaultCallingCode = strings.TrimPrefix(strings.TrimSpace(defaultCallingCode), "+")
+	defaultCountry, ok := PhoneCountry(defaultCallingCode)
+	if !ok || defaultCountry.CallingCode != defaultCallingCode {
+		defaultCountry, _ = PhoneCountry(IranCallingCode)
+	}
+
+	var digits string
+	switch {
+	case strings.HasPrefix(number, "+"):
+		digits = number[1:]
+	case strings.HasPrefix(number, "00"):
+		digits = number[2:]
+	case strings.HasPrefix(number, "0"):
+		digits = defaultCountry.CallingCode + number[1:]
+	case strings.HasPrefix(number, defaultCountry.CallingCode) &&
+		defaultCountry.isMobile(number[len(defaultCountry.CallingCode):]):
+		digits = number
+	default:
+		digits = defaultCountry.CallingCode + number
+	}
+	if !IsNumeric(digits) || len(digits) > 15 {
+		return "", ErrInvalidPhone
+	}
+
+	country, ok := PhoneCountry(digits)
+	if !ok {
+		return "", ErrUnsupportedCountry
+	}
+	if !country.isMobile(digits[len(country.CallingCode):]) {
+		return "", ErrInvalidPhone
+	}
+	return "+" + digits, nil
+}
+
+// This Function Returns The Calling Code Of An E.164 Number With +, e.g. +98.
+func PhoneCallingCode(phone string) string {
+	country, ok := PhoneCountry(phone)
+	if !ok {
+		return ""
+	}
+	return "+" + country.CallingCode
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// PriceList is the prices of the messages which an account sends from a sender
+// number, it is loaded once for all the recipients of a send.
+type PriceList struct {
+	Base            int64
+	DiscountPercent int
+	Surcharge       int64
+	// Rates are sorted by the length of their prefix, the longest first
+	Rates []models.PriceRate
+}
+
+// This Function Returns The Price Of A Message To The Recipient.
+func (p PriceList) Price(recipient string) int64 {
+	price := p.Base
+	number := InternationalNumber(recipient)
+	for _, rate := range p.Rates {
+		if strings.HasPrefix(number, rate.Prefix) {
+			price = rate.Price
+			break
+		}
+	}
+	price = price * int64(100-p.DiscountPercent) / 100
+	return price + p.Surcharge
+}
+
+// This Function Returns The Total Price Of Messages To The Recipients.
+func (p PriceList) Total(recipients []string) int64 {
+	var total int64
+	for _, recipient := range recipients {
+		total += p.Price(recipient)
+	}
+	return total
+}
+
+// This Function Returns The Digits Of The Number Which Rate Prefixes Are Matched With.
+func PriceNumber(number string) string {
+	number = strings.TrimPrefix(strings.TrimSpace(number), "+")
+	return strings.TrimPrefix(number, "00")
+}
+
+// This Function Returns The Type Of The Sender Number Which Surcharges Are Matched
+// With, Numbers Which Aren't Vanity Or Held Exclusively Are Shared.
+func SenderNumberType(db *gorm.DB, number string) string {
+	var senderNumber models.SenderNumber
+	if err := db.Where("number = ?", number).First(&senderNumber).Error; err != nil {
+		return models.SenderTypeShared
+	}
+	switch {
+	case senderNumber.Type == models.SenderTypeVanity:
+		return models.SenderTypeVanity
+	case senderNumber.IsExclusive:
+		return models.SenderTypeExclusive
+	}
+	return models.SenderTypeShared
+}
+
+// This Function Returns The Price Of A Message From The "single sms" Or "group sms"
+// Configuration, Which Plans Without A Price Use. Messages Are Free Without It.
+func ConfiguredMessagePrice(db *gorm.DB, group bool) (int64, error) {
+	key := SettingSingleSMSPrice
+	if group {
+		key = SettingGroupSMSPrice
+	}
+	value, err := Settings.Value(db, key)
+	return int64(value), err
+}
+
+// This Function Returns The Number Of Messages Which The Account Has Sent In The Current Month.
+func MonthlyMessageCount(db *gorm.DB, accountID uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.SMSMessage{}).
+		Where("account_id = ? AND created_at >= ?", accountID, MonthStart(time.Now())).
+		Count(&count).Error
+	return count, err
+}
+
+// This Function Loads The Prices Of The Account's Pricing Plan For Messages From
+// The Sender Number. Every Send Path Prices Its Messages With It.
+func LoadPriceList(db *gorm.DB, account models.Account, sender string, group bool) (PriceList, error) {
+	plan := AccountPricingPlan(db, account)
+	list := PriceList{Base: plan.SinglePrice}
+	if group {
+		list.Base = plan.GroupPrice
+	}
+	if list.Base == 0 {
+		base, err := ConfiguredMessagePrice(db, group)
+		if err != nil {
+			return PriceList{}, err
+		}
+		list.Base = base
+	}
+
+	// the built-in default plan doesn't have prices
+	if plan.ID == 0 {
+		return list, nil
+	}
+
+	if err := db.Where("pricing_plan_id = ?", plan.ID).Find(&list.Rates).Error; err != nil {
+		return PriceList{}, err
+	}
+	sort.SliceStable(list.Rates, func(i, j int) bool {
+		return len(list.Rates[i].Prefix) > len(list.Rates[j].Prefix)
+	})
+
+	var tiers []models.PriceTier
+	if err := db.Where("pricing_plan_id = ?", plan.ID).Order("min_messages desc").Find(&tiers).Error; err != nil {
+		return PriceList{}, err
+	}
+	if len(tiers) > 0 {
+		sent, err := MonthlyMessageCount(db, account.ID)
+		if err != nil {
+			return PriceList{}, err
+		}
+		for _, tier := range tiers {
+			if sent >= int64(tier.MinMessages) {
+				list.DiscountPercent = tier.DiscountPercent
+				break
+			}
+		}
+	}
+
+	var surcharge models.PriceSurcharge
+	err := db.Where("pricing_plan_id = ? AND sender_type = ?", plan.ID, SenderNumberType(db, sender)).
+		Limit(1).Find(&surcharge).Error
+	if err != nil {
+		return PriceList{}, err
+	}
+	list.Surcharge = surcharge.Amount
+
+	return list, nil
+}
+
+// This Function Returns The Price Of A Message From The Sender Number To The Recipient.
+func MessagePrice(db *gorm.DB, account models.Account, sender, recipient string, group bool) (int64, error) {
+	list, err := LoadPriceList(db, account, sender, group)
+	if err != nil {
+		return 0, err
+	}
+	return list.Price(recipient), nil
+}
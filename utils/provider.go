@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// Defaults of the provider settings.
+const (
+	DefaultProviderTimeoutMS        = 10000
+	DefaultProviderFailureThreshold = 5
+	DefaultProviderOpenSeconds      = 30
+)
+
+// Providers and routes are reloaded from the database after this long, so the changes
+// of other instances are seen.
+const ProvidersCacheTTL = time.Minute
+
+var (
+	ErrNoProvider      = errors.New("No Provider Is Available")
+	ErrProviderTimeout = errors.New("Provider Timed Out")
+)
+
+// ProviderMessage is a message which is sent through a provider.
+type ProviderMessage struct {
+	Text        string
+	Source      string
+	Destination string
+}
+
+// SMSSender sends messages through the API of a provider, it returns the delivery
+// report of a sent message. Send must give up when ctx is done.
+type SMSSender interface {
+	Send(ctx context.Context, message ProviderMessage) (string, error)
+}
+
+// LogSMSSender only logs the messages, it is used by the providers which don't have a sender.
+type LogSMSSender struct {
+	Provider string
+}
+
+func (s LogSMSSender) Send(ctx context.Context, message ProviderMessage) (string, error) {
+	log.Printf("Message sent - Text: %s, Source: %s, Destination: %s, Provider: %s", message.Text, message.Source, message.Destination, s.Provider)
+	return "Message sent successfully", nil
+}
+
+var (
+	smsSenders   = make(map[string]SMSSender)
+	smsSendersMu sync.RWMutex
+)
+
+// SetSMSSender replaces the sender of the provider, nil makes it only log the messages.
+func SetSMSSender(provider string, sender SMSSender) {
+	smsSendersMu.Lock()
+	defer smsSendersMu.Unlock()
+	if sender == nil {
+		delete(smsSenders, provider)
+		return
+	}
+	smsSenders[provider] = sender
+}
+
+// GetSMSSender returns the sender which messages are sent through the provider with.
+func GetSMSSender(provider string) SMSSender {
+	smsSendersMu.RLock()
+	defer smsSendersMu.RUnlock()
+	if sender, ok := smsSenders[provider]; ok {
+		return sender
+	}
+	return LogSMSSender{Provider: provider}
+}
+
+// ProviderCache keeps the providers and the routes in memory, so sending a message
+// doesn't query them.
+type ProviderCache struct {
+	mu        sync.RWMutex
+	ttl       time.Duration
+	providers map[string]models.SMSProvider
+	// routes are the names of the providers of the operators by position, 0 is the default route
+	routes   map[uint][]string
+	loadedAt time.Time
+}
+
+func NewProviderCache(ttl time.Duration) *ProviderCache {
+	return &ProviderCache{ttl: ttl}
+}
+
+// Providers is the cache which the routes of messages are read from.
+var Providers = NewProviderCache(ProvidersCacheTTL)
+
+// Invalidate makes the next route load the providers from the database again.
+func (p *ProviderCache) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.providers = nil
+}
+
+func (p *ProviderCache) load(db *gorm.DB) (map[string]models.SMSProvider, map[uint][]string, error) {
+	p.mu.RLock()
+	providers, routes, loadedAt := p.providers, p.routes, p.loadedAt
+	p.mu.RUnlock()
+	if providers != nil && time.Since(loadedAt) < p.ttl {
+		return providers, routes, nil
+	}
+
+	var rows []models.SMSProvider
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	var routeRows []models.ProviderRoute
+	if err := db.Order("position").Find(&routeRows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	providers = make(map[string]models.SMSProvider, len(rows))
+	names := make(map[uint]string, len(rows))
+	for _, provider := range rows {
+		providers[provider.Name] = provider
+		names[provider.ID] = provider.Name
+	}
+	routes = make(map[uint][]string)
+	for _, route := range routeRows {
+		var operatorID uint
+		if route.OperatorID != nil {
+			operatorID = *route.OperatorID
+		}
+		routes[operatorID] = append(routes[operatorID], names[route.ProviderID])
+	}
+
+	p.mu.Lock()
+	p.providers, p.routes, p.loadedAt = providers, routes, time.Now()
+	p.mu.Unlock()
+	return providers, routes, nil
+}
+
+// Route returns the enabled providers which messages to the number are tried through
+// in order. It is the route of the operator of the number, or the default route, or
+// the provider of the operator when there isn't any route.
+func (p *ProviderCache) Route(db *gorm.DB, number string) ([]models.SMSProvider, error) {
+	providers, routes, err := p.load(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if operator, ok := Operators.Detect(db, number); ok {
+		names = routes[operator.ID]
+	}
+	if len(names) == 0 {
+		names = routes[0]
+	}
+	if len(names) == 0 {
+		names = []string{MessageProvider(db, number)}
+	}
+
+	var route []models.SMSProvider
+	for _, name := range names {
+		provider, ok := providers[name]
+		if !ok {
+			// providers which aren't registered only have the default sender
+			provider = models.SMSProvider{Name: name, Enabled: true}
+		}
+		if provider.Enabled {
+			route = append(route, provider)
+		}
+	}
+	if SettingBool(db, SettingLeastCostRouting) {
+		sort.SliceStable(route, func(i, j int) bool {
+			return route[i].Price < route[j].Price
+		})
+	}
+	return route, nil
+}
+
+// This Function Sends The Message Through The Provider, Or Through The Providers Of
+// The Route Of Its Destination When provider Is Empty. The Next Provider Is Tried When
+// A Provider Fails Or Times Out, And Providers Whose Circuit Is Open Are Skipped. It
+// Returns The Delivery Report And The Provider Which Sent The Message.
+func RouteMessage(db *gorm.DB, provider string, message ProviderMessage) (string, string, error) {
+	var route []models.SMSProvider
+	if provider != "" {
+		route = []models.SMSProvider{{Name: provider, Enabled: true}}
+	} else {
+		var err error
+		route, err = Providers.Route(db, message.Destination)
+		if err != nil {
+			log.Printf("Failed to load providers: %v", err)
+			route = []models.SMSProvider{{Name: MessageProvider(db, message.Destination), Enabled: true}}
+		}
+	}
+
+	timeout := time.Duration(SettingInt(db, SettingProviderTimeoutMS)) * time.Millisecond
+	threshold := int(SettingInt(db, SettingProviderFailureThreshold))
+	openFor := time.Duration(SettingInt(db, SettingProviderOpenSeconds)) * time.Second
+
+	lastErr := ErrNoProvider
+	for _, provider := range route {
+		breaker := ProviderBreakers.Get(provider.Name)
+		if !breaker.Allow(openFor) {
+			continue
+		}
+		deliveryReport, err := sendWithTimeout(GetSMSSender(provider.Name), message, timeout)
+		if err == nil {
+			breaker.Success()
+			return deliveryReport, provider.Name, nil
+		}
+		log.Printf("Failed to send message through provider %s: %v", provider.Name, err)
+		breaker.Failure(err, threshold)
+		lastErr = err
+	}
+	return "message not sent", "", lastErr
+}
+
+func sendWithTimeout(sender SMSSender, message ProviderMessage, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type result struct {
+		deliveryReport string
+		err            error
+	}
+	done := make(chan result, 1)
+	go func() {
+		deliveryReport, err := sender.Send(ctx, message)
+		done <- result{deliveryReport, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.deliveryReport, r.err
+	case <-ctx.Done():
+		return "", ErrProviderTimeout
+	}
+}
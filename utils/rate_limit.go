@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// Limits of accounts which have no pricing plan and there is no default plan.
+const (
+	DefaultRequestsPerSecond float64 = 10
+	DefaultMessagesPerMinute int     = 600
+)
+
+// Idle buckets are full, so they can be forgotten.
+const rateLimitBucketIdle = 10 * time.Minute
+
+// RateLimit is a token bucket which is refilled with Rate tokens per second up to Burst tokens.
+type RateLimit struct {
+	Key   string
+	Rate  float64
+	Burst float64
+}
+
+// RateLimitError is returned when a rate limit is exceeded.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+// RetryAfterSeconds is the value of the Retry-After header.
+func (e RateLimitError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps the token buckets of rate limits in memory.
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// Rate limiters of HTTP requests and of sent messages.
+var (
+	RequestLimiter = NewRateLimiter()
+	MessageLimiter = NewRateLimiter()
+)
+
+// refill returns the bucket of the limit with the tokens it has now
+func (l *RateLimiter) refill(limit RateLimit, now time.Time) *tokenBucket {
+	bucket, ok := l.buckets[limit.Key]
+	if !ok {
+		bucket = &tokenBucket{tokens: limit.Burst, last: now}
+		l.buckets[limit.Key] = bucket
+	}
+	bucket.tokens = math.Min(limit.Burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate)
+	bucket.last = now
+	return bucket
+}
+
+// wait returns how long it takes until all limits have n tokens
+func (l *RateLimiter) wait(n float64, now time.Time, limits []RateLimit) time.Duration {
+	var wait time.Duration
+	for _, limit := range limits {
+		bucket := l.refill(limit, now)
+		if bucket.tokens >= n {
+			continue
+		}
+		// the limit can't be passed, try again later
+		if limit.Rate <= 0 || n > limit.Burst {
+			return time.Hour
+		}
+		if d := time.Duration((n - bucket.tokens) / limit.Rate * float64(time.Second)); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// Allow takes n tokens from all the limits, or none of them if one of them doesn't have enough.
+func (l *RateLimiter) Allow(n float64, limits ...RateLimit) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	if wait := l.wait(n, now, limits); wait > 0 {
+		return RateLimitError{RetryAfter: wait}
+	}
+	for _, limit := range limits {
+		l.buckets[limit.Key].tokens -= n
+	}
+	return nil
+}
+
+// Check returns an error if the limits don't have n tokens, without taking them.
+func (l *RateLimiter) Check(n float64, limits ...RateLimit) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if wait := l.wait(n, time.Now(), limits); wait > 0 {
+		return RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > rateLimitBucketIdle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// This Function Returns The Pricing Plan Of The Account, The Default Plan If It Has No Plan.
+func AccountPricingPlan(db *gorm.DB, account models.Account) models.PricingPlan {
+	var plan models.PricingPlan
+	if account.PricingPlanID != nil && db.First(&plan, *account.PricingPlanID).Error == nil {
+		return plan
+	}
+	if db.Where("is_default = ?", true).First(&plan).Error == nil {
+		return plan
+	}
+	return models.PricingPlan{
+		Name:              "default",
+		RequestsPerSecond: DefaultRequestsPerSecond,
+		MessagesPerMinute: DefaultMessagesPerMinute,
+	}
+}
+
+// rateLimitKeys returns the keys which requests of the account and the API key are limited by
+func rateLimitKeys(kind string, accountID uint, apiKeyID uint) []string {
+	keys := []string{fmt.Sprintf("%s:account:%d", kind, accountID)}
+	if apiKeyID != 0 {
+		keys = append(keys, fmt.Sprintf("%s:api_key:%d", kind, apiKeyID))
+	}
+	return keys
+}
+
+// This Function Returns The Requests Per Second Limits Of The Account And Its API Key.
+func RequestRateLimits(plan models.PricingPlan, accountID uint, apiKeyID uint) []RateLimit {
+	var limits []RateLimit
+	for _, key := range rateLimitKeys("requests", accountID, apiKeyID) {
+		limits = append(limits, RateLimit{Key: key, Rate: plan.RequestsPerSecond, Burst: math.Max(1, plan.RequestsPerSecond)})
+	}
+	return limits
+}
+
+// This Function Returns The Messages Per Minute Limits Of The Account And Its API Key.
+func MessageRateLimits(plan models.PricingPlan, accountID uint, apiKeyID uint) []RateLimit {
+	var limits []RateLimit
+	for _, key := range rateLimitKeys("messages", accountID, apiKeyID) {
+		limits = append(limits, RateLimit{
+			Key:   key,
+			Rate:  float64(plan.MessagesPerMinute) / 60,
+			Burst: math.Max(1, float64(plan.MessagesPerMinute)),
+		})
+	}
+	return limits
+}
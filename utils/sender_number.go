@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Defaults of the days which accounts are reminded before their rent ends, and which
+// the number is reserved for them after it ends.
+const (
+	DefaultNumberReminderDays = 3
+	DefaultNumberGraceDays    = 7
+)
+
+// By default the whole price of the unused days of a rent is refunded when it is released.
+const DefaultNumberRefundPercent = 100
+
+// Auto-renew charges the account this long before its rent ends.
+const NumberAutoRenewBefore = 24 * time.Hour
+
+var (
+	ErrNumberRetired   = errors.New("Number Is Retired")
+	ErrNumberNotRented = errors.New("Number Is Not Rented")
+)
+
+// This Function Returns The Price Of Renting The Number With The Package, Which Is The
+// Rent Price Of The Number For Each Month Of The Package, Or The Price Of The Package
+// When The Number Doesn't Have A Rent Price. Days Are Charged As Thirtieths Of A Month.
+func NumberRentPrice(number models.SenderNumber, subPackage models.SubscriptionNumberPackage) int64 {
+	if number.RentPrice == 0 {
+		return subPackage.Price
+	}
+	if subPackage.DurationUnit == models.DurationUnitDay {
+		return (number.RentPrice*int64(subPackage.Duration) + 29) / 30
+	}
+	return number.RentPrice * int64(subPackage.Duration)
+}
+
+// This Function Returns The Provider Which The Messages From The Sender Number Are
+// Sent Through, Or An Empty String When The Number Isn't Bound To An Enabled Provider.
+func SenderProvider(db *gorm.DB, number string) string {
+	var provider models.SMSProvider
+	err := db.Model(&models.SMSProvider{}).
+		Joins("JOIN sender_numbers ON sender_numbers.provider_id = sms_providers.id").
+		Where("sender_numbers.number = ? AND sms_providers.enabled = ?", number, true).
+		First(&provider).Error
+	if err != nil {
+		return ""
+	}
+	return provider.Name
+}
+
+// This Function Returns The End Of The Grace Period Of A Rent Which Ends At endDate,
+// The Number Is Reserved For Its Renter Until Then.
+func NumberGraceEnd(db *gorm.DB, endDate time.Time) time.Time {
+	return endDate.AddDate(0, 0, int(SettingInt(db, SettingNumberGraceDays)))
+}
+
+// This Function Returns The Account Which Holds The Numbers Of The User, Members Have
+// The User Of Their Organization And The Organization's Account Holds The Numbers.
+func NumberHolderAccount(db *gorm.DB, userID uint) (models.Account, error) {
+	var account models.Account
+	err := db.Where("user_id = ? AND id NOT IN (SELECT member_id FROM account_members)", userID).
+		Order("id").First(&account).Error
+	return account, err
+}
+
+// This Function Charges The Account For Another Period Of The Rented Number With The
+// Package. The Period Starts At The End Of The Rent, Or Now When The Rent Has Ended,
+// And Renewing In The Grace Period Makes The Number Usable Again. It Returns The Price.
+// The Rent Is Locked, So db Must Be A Transaction.
+func RenewNumber(db *gorm.DB, accountID uint, userNumber *models.UserNumbers, subPackage models.SubscriptionNumberPackage) (int64, error) {
+	// the rent is read again under its lock, so concurrent renewals add their periods one after another
+	var current models.UserNumbers
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, userNumber.ID).Error; err != nil {
+		return 0, err
+	}
+	if current.Type != models.PackageTypeRent {
+		return 0, ErrNumberNotRented
+	}
+	var number models.SenderNumber
+	if err := db.First(&number, userNumber.NumberID).Error; err != nil {
+		return 0, err
+	}
+	if number.RetiredAt != nil {
+		return 0, ErrNumberRetired
+	}
+
+	var account models.Account
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, accountID).Error; err != nil {
+		return 0, err
+	}
+	price := NumberRentPrice(number, subPackage)
+	if !DoesAcountHaveBudget(AvailableBudget(account), price) {
+		return 0, ErrInsufficientBudget
+	}
+
+	if err := db.Model(&account).Update("budget", gorm.Expr("budget - ?", price)).Error; err != nil {
+		return 0, err
+	}
+	if err := RecordSpending(db, account.ID, price, "renewal of sender number "+number.Number); err != nil {
+		return 0, err
+	}
+
+	start := current.EndDate
+	if now := time.Now(); start.Before(now) {
+		start = now
+	}
+	userNumber.PeriodStart = start
+	userNumber.PaidPrice = price
+	userNumber.EndDate = subPackage.EndDate(start)
+	userNumber.IsAvailable = true
+	userNumber.SubscriptionPackageID = subPackage.ID
+	userNumber.RemindedAt = nil
+	userNumber.RenewalFailedAt = nil
+	err := db.Model(&models.UserNumbers{}).Where("id = ?", userNumber.ID).Updates(map[string]interface{}{
+		"period_start":            start,
+		"paid_price":              price,
+		"end_date":                userNumber.EndDate,
+		"is_available":            true,
+		"subscription_package_id": subPackage.ID,
+		"reminded_at":             nil,
+		"renewal_failed_at":       nil,
+	}).Error
+	return price, err
+}
@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"SMS-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// Keys of the declared settings, they are the names of the configuration rows.
+const (
+	SettingSingleSMSPrice = "single sms"
+	SettingGroupSMSPrice  = "group sms"
+	SettingVATPercent     = "vat percent"
+	SettingBillDueDays    = "bill due days"
+
+	SettingLeastCostRouting         = "least cost routing"
+	SettingProviderTimeoutMS        = "provider timeout ms"
+	SettingProviderFailureThreshold = "provider failure threshold"
+	SettingProviderOpenSeconds      = "provider open seconds"
+
+	SettingNumberReminderDays  = "number reminder days"
+	SettingNumberGraceDays     = "number grace days"
+	SettingNumberRefundPercent = "number refund percent"
+)
+
+// SettingType is the type of the value of a setting, all of them are stored as numbers.
+type SettingType string
+
+const (
+	SettingTypeInt   SettingType = "int"
+	SettingTypeFloat SettingType = "float"
+	SettingTypeBool  SettingType = "bool"
+)
+
+// Settings are reloaded from the database after this long, so the changes of other
+// instances are seen.
+const SettingsCacheTTL = time.Minute
+
+var (
+	ErrUnknownSetting = errors.New("Unknown Setting")
+	ErrSettingType    = errors.New("Value Has Wrong Type")
+)
+
+// SettingDefinition declares a setting, its value is Default when it isn't set.
+type SettingDefinition struct {
+	Key         string
+	Type        SettingType
+	Default     float64
+	Description string
+	// Validate checks the value, which already has the type of the setting
+	Validate func(value float64) error
+}
+
+func settingBetween(min, max float64) func(float64) error {
+	return func(value float64) error {
+		if value < min || value > max {
+			return fmt.Errorf("Value Must Be Between %v And %v", min, max)
+		}
+		return nil
+	}
+}
+
+func settingAtLeast(min float64) func(float64) error {
+	return func(value float64) error {
+		if value < min {
+			return fmt.Errorf("Value Must Not Be Less Than %v", min)
+		}
+		return nil
+	}
+}
+
+var settingDefinitions = []SettingDefinition{
+	{
+		Key:         SettingSingleSMSPrice,
+		Type:        SettingTypeInt,
+		Description: "Price of a single message for pricing plans without a single price",
+		Validate:    settingAtLeast(0),
+	},
+	{
+		Key:         SettingGroupSMSPrice,
+		Type:        SettingTypeInt,
+		Description: "Price of a message sent to a group for pricing plans without a group price",
+		Validate:    settingAtLeast(0),
+	},
+	{
+		Key:         SettingVATPercent,
+		Type:        SettingTypeInt,
+		Default:     DefaultVATPercent,
+		Description: "VAT percent which is included in the amount of top-ups",
+		Validate:    settingBetween(0, 100),
+	},
+	{
+		Key:         SettingBillDueDays,
+		Type:        SettingTypeInt,
+		Default:     DefaultBillDueDays,
+		Description: "Days which postpaid accounts have to pay their bills",
+		Validate:    settingBetween(1, 365),
+	},
+	{
+		Key:         SettingLeastCostRouting,
+		Type:        SettingTypeBool,
+		Description: "Try the providers of a route from the cheapest one instead of by their position",
+	},
+	{
+		Key:         SettingProviderTimeoutMS,
+		Type:        SettingTypeInt,
+		Default:     DefaultProviderTimeoutMS,
+		Description: "Milliseconds which a provider has to send a message before the next provider is tried",
+		Validate:    settingBetween(10, 120000),
+	},
+	{
+		Key:         SettingProviderFailureThreshold,
+		Type:        SettingTypeInt,
+		Default:     DefaultProviderFailureThreshold,
+		Description: "Failures in a row which open the circuit of a provider",
+		Validate:    settingBetween(1, 1000),
+	},
+	{
+		Key:         SettingProviderOpenSeconds,
+		Type:        SettingTypeInt,
+		Default:     DefaultProviderOpenSeconds,
+		Description: "Seconds which a provider is skipped for after its circuit opens, then a single message tries it again",
+		Validate:    settingBetween(1, 86400),
+	},
+	{
+		Key:         SettingNumberReminderDays,
+		Type:        SettingTypeInt,
+		Default:     DefaultNumberReminderDays,
+		Description: "Days before the end of the rent of a sender number which the account is reminded, 0 disables reminders",
+		Validate:    settingBetween(0, 60),
+	},
+	{
+		Key:         SettingNumberGraceDays,
+		Type:        SettingTypeInt,
+		Default:     DefaultNumberGraceDays,
+		Description: "Days after the end of the rent of a sender number which it is reserved for the account to renew it",
+		Validate:    settingBetween(0, 90),
+	},
+	{
+		Key:         SettingNumberRefundPercent,
+		Type:        SettingTypeInt,
+		Default:     DefaultNumberRefundPercent,
+		Description: "Percent of the price of the unused days which is refunded when a rented sender number is released early, 0 disables refunds",
+		Validate:    settingBetween(0, 100),
+	},
+}
+
+// This Function Returns The Declared Settings.
+func SettingDefinitions() []SettingDefinition {
+	return settingDefinitions
+}
+
+// This Function Returns The Declaration Of The Setting.
+func LookupSetting(key string) (SettingDefinition, bool) {
+	for _, definition := range settingDefinitions {
+		if definition.Key == key {
+			return definition, true
+		}
+	}
+	return SettingDefinition{}, false
+}
+
+// This Function Converts A Value Of A JSON Body To The Stored Value Of The Setting, And Validates It.
+func (d SettingDefinition) Parse(value interface{}) (float64, error) {
+	var number float64
+	switch d.Type {
+	case SettingTypeBool:
+		b, ok := value.(bool)
+		if !ok {
+			return 0, ErrSettingType
+		}
+		if b {
+			number = 1
+		}
+	case SettingTypeInt:
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) {
+			return 0, ErrSettingType
+		}
+		number = f
+	default:
+		f, ok := value.(float64)
+		if !ok {
+			return 0, ErrSettingType
+		}
+		number = f
+	}
+
+	if d.Validate != nil {
+		if err := d.Validate(number); err != nil {
+			return 0, err
+		}
+	}
+	return number, nil
+}
+
+// This Function Converts A Stored Value Of The Setting To Its Type.
+func (d SettingDefinition) Format(value float64) interface{} {
+	switch d.Type {
+	case SettingTypeBool:
+		return value != 0
+	case SettingTypeInt:
+		return int64(value)
+	default:
+		return value
+	}
+}
+
+// SettingsCache keeps the configuration rows in memory, so sending a message
+// doesn't query the configuration table.
+type SettingsCache struct {
+	mu       sync.RWMutex
+	ttl      time.Duration
+	values   map[string]float64
+	loadedAt time.Time
+}
+
+func NewSettingsCache(ttl time.Duration) *SettingsCache {
+	return &SettingsCache{ttl: ttl}
+}
+
+// Settings is the cache which the settings are read from.
+var Settings = NewSettingsCache(SettingsCacheTTL)
+
+// Invalidate makes the next read load the settings from the database again.
+func (s *SettingsCache) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = nil
+}
+
+func (s *SettingsCache) load(db *gorm.DB) (map[string]float64, error) {
+	s.mu.RLock()
+	values, loadedAt := s.values, s.loadedAt
+	s.mu.RUnlock()
+	if values != nil && time.Since(loadedAt) < s.ttl {
+		return values, nil
+	}
+
+	var configurations []models.Configuration
+	if err := db.Find(&configurations).Error; err != nil {
+		return nil, err
+	}
+	values = make(map[string]float64, len(configurations))
+	for _, configuration := range configurations {
+		values[configuration.Name] = configuration.Value
+	}
+
+	s.mu.Lock()
+	s.values, s.loadedAt = values, time.Now()
+	s.mu.Unlock()
+	return values, nil
+}
+
+// Value returns the stored value of the setting, or its default when it isn't set.
+// Settings which aren't declared are 0 when they aren't set.
+func (s *SettingsCache) Value(db *gorm.DB, key string) (float64, error) {
+	values, err := s.load(db)
+	if err != nil {
+		definition, _ := LookupSetting(key)
+		return definition.Default, err
+	}
+	if value, ok := values[key]; ok {
+		return value, nil
+	}
+	definition, _ := LookupSetting(key)
+	return definition.Default, nil
+}
+
+// This Function Returns The Value Of An int Setting, Or Its Default When The Settings Can't Be Loaded.
+func SettingInt(db *gorm.DB, key string) int64 {
+	value, err := Settings.Value(db, key)
+	if err != nil {
+		log.Printf("Failed to load setting %q: %v", key, err)
+	}
+	return int64(value)
+}
+
+// This Function Returns The Value Of A bool Setting, Or Its Default When The Settings Can't Be Loaded.
+func SettingBool(db *gorm.DB, key string) bool {
+	value, err := Settings.Value(db, key)
+	if err != nil {
+		log.Printf("Failed to load setting %q: %v", key, err)
+	}
+	return value != 0
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// TestMail is a mail received by TestSMTPServer.
+type TestMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// TestSMTPServer is a local SMTP server which keeps the mails it receives,
+// it is used in tests instead of a real mail server.
+type TestSMTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	mails    []TestMail
+}
+
+func StartTestSMTPServer() (*TestSMTPServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	server := &TestSMTPServer{listener: listener}
+	go server.serve()
+	return server, nil
+}
+
+func (s *TestSMTPServer) Host() string {
+	host, _, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host
+}
+
+func (s *TestSMTPServer) Port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+// Mails returns the mails received so far.
+func (s *TestSMTPServer) Mails() []TestMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]TestMail(nil), s.mails...)
+}
+
+func (s *TestSMTPServer) Close() error {
+	return s.listener.Close()
+}
+
+func (s *TestSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *TestSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	writer := textproto.NewWriter(bufio.NewWriter(conn))
+	writer.PrintfLine("220 localhost ESMTP")
+
+	var mail TestMail
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			writer.PrintfLine("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			mail = TestMail{From: strings.Trim(line[len("MAIL FROM:"):], " <>")}
+			writer.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			mail.To = append(mail.To, strings.Trim(line[len("RCPT TO:"):], " <>"))
+			writer.PrintfLine("250 OK")
+		case command == "DATA":
+			writer.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := reader.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.Data = string(data)
+			s.mu.Lock()
+			s.mails = append(s.mails, mail)
+			s.mu.Unlock()
+			writer.PrintfLine("250 OK")
+		case command == "RSET", command == "NOOP":
+			writer.PrintfLine("250 OK")
+		case command == "QUIT":
+			writer.PrintfLine("221 Bye")
+			return
+		default:
+			writer.PrintfLine("502 Command not implemented")
+		}
+	}
+}
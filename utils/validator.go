@@ -5,7 +5,6 @@ import (
 	"errors"
 	"net/mail"
 	"strconv"
-	"strings"
 	"time"
 
 	"SMS-panel/models"
@@ -19,19 +18,20 @@ func ValidateEmail(email string) bool {
 	return err == nil
 }
 
-// This Function Validates Input Phone Number.
+// This Function Validates Input Phone Number, Numbers Without A Country Code Are Iranian.
 func ValidatePhone(phone string) bool {
-	hasCharacter := false
-	for _, digit := range phone {
-		if digit < 48 || digit > 57 {
-			hasCharacter = true
-			break
+	_, err := NormalizePhone(phone, IranCallingCode)
+	return err == nil
+}
+
+// This Function Checks That Input Only Has Digits.
+func IsNumeric(s string) bool {
+	for _, digit := range s {
+		if digit < '0' || digit > '9' {
+			return false
 		}
 	}
-	if hasCharacter {
-		return false
-	}
-	return strings.HasPrefix(phone, "09") && len(phone) == 11
+	return s != ""
 }
 
 // This Function Parse Input String to Integer on Input Base.
@@ -98,7 +98,7 @@ func IsSenderNumberExist(
 		Select("sender_numbers.number").
 		Joins("LEFT JOIN user_numbers ON sender_numbers.id = user_numbers.number_id").
 		Where(
-			"(sender_numbers.is_default=true or (user_numbers.user_id = ? and user_numbers.is_available=true)) and sender_numbers.number = ?",
+			"((sender_numbers.is_default=true and sender_numbers.retired_at is null) or (user_numbers.user_id = ? and user_numbers.is_available=true)) and sender_numbers.number = ?",
 			userId, senderNumber).
 		First(&senderNumbersObjects).Error
 
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var ErrWebhookAddress = errors.New("Webhook Address Isn't Public")
+
+var (
+	webhookIPAllowed   = IsPublicIP
+	webhookIPAllowedMu sync.RWMutex
+)
+
+// SetWebhookIPFilter replaces the check of the addresses which webhooks may be posted to.
+func SetWebhookIPFilter(allowed func(ip net.IP) bool) {
+	webhookIPAllowedMu.Lock()
+	defer webhookIPAllowedMu.Unlock()
+	webhookIPAllowed = allowed
+}
+
+func isWebhookIPAllowed(ip net.IP) bool {
+	webhookIPAllowedMu.RLock()
+	defer webhookIPAllowedMu.RUnlock()
+	return webhookIPAllowed(ip)
+}
+
+// The address is checked again when it's dialed, the host may resolve to another
+// address than the one which was checked when the webhook was set.
+var webhookHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, c syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || !isWebhookIPAllowed(ip) {
+					return ErrWebhookAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// This Function Checks That The IP Is Reachable On The Internet, So It Isn't A
+// Loopback, Private, Link-Local, Multicast Or Unspecified Address.
+func IsPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// This Function Checks That The URL Is An Absolute HTTP Or HTTPS URL, And That All
+// The Addresses Its Host Resolves To Are Public.
+func IsWebhookURL(webhookURL string) bool {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return false
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return false
+	}
+
+	ips, err := net.LookupIP(parsed.Hostname())
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !isWebhookIPAllowed(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// This Function Posts The Payload As JSON To The Webhook, A Response Which Isn't 2xx Is An Error.
+// Webhooks Which Aren't Public Addresses Are Refused With ErrWebhookAddress.
+func PostWebhook(webhookURL string, payload interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookHTTPClient.Post(webhookURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}